@@ -0,0 +1,139 @@
+// Command admin runs maintenance tasks against the trellis database.
+//
+// Usage:
+//
+//	admin purge-trash [-older-than duration]
+//	admin fts-rebuild
+//	admin fts-check
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/rpggio/trellis/internal/config"
+	"github.com/rpggio/trellis/internal/sqlite"
+)
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+		os.Exit(1)
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "purge-trash":
+		err = purgeTrash(cfg, logger, os.Args[2:])
+	case "fts-rebuild":
+		err = rebuildFTS(cfg, logger)
+	case "fts-check":
+		err = checkFTS(cfg, logger)
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		logger.Error(os.Args[1]+" failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: admin <command> [flags]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "commands:")
+	fmt.Fprintln(os.Stderr, "  purge-trash   permanently remove records trashed longer than the retention window")
+	fmt.Fprintln(os.Stderr, "  fts-rebuild   rebuild the search indexes from the records table, then check them")
+	fmt.Fprintln(os.Stderr, "  fts-check     check that the search indexes are intact and match the records table")
+}
+
+// purgeTrash permanently removes records that have been in the trash longer
+// than the retention window (trash.retention unless -older-than is given).
+func purgeTrash(cfg config.Config, logger *slog.Logger, args []string) error {
+	flags := flag.NewFlagSet("purge-trash", flag.ExitOnError)
+	olderThan := flags.Duration("older-than", cfg.Trash.Retention, "purge records trashed longer ago than this")
+	flags.Parse(args)
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	cutoff := time.Now().Add(-*olderThan)
+	purged, err := sqlite.NewRecordRepository(db).PurgeTrash(context.Background(), cutoff)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("purged trash", "records", purged, "before", cutoff.Format(time.RFC3339))
+	return nil
+}
+
+// rebuildFTS rebuilds the full-text indexes, which drift from the records
+// table when rows are edited outside the app, and checks the result.
+func rebuildFTS(cfg config.Config, logger *slog.Logger) error {
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if err := db.RebuildFTS(ctx); err != nil {
+		return err
+	}
+	if err := db.CheckFTS(ctx); err != nil {
+		return err
+	}
+
+	logger.Info("rebuilt search indexes", "tokenizer", cfg.Search.Tokenizer, "trigram", cfg.Search.Trigram)
+	return nil
+}
+
+// checkFTS runs the FTS5 integrity check on the full-text indexes.
+func checkFTS(cfg config.Config, logger *slog.Logger) error {
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.CheckFTS(context.Background()); err != nil {
+		return err
+	}
+
+	logger.Info("search indexes ok")
+	return nil
+}
+
+func openDB(cfg config.Config) (*sqlite.DB, error) {
+	db, err := sqlite.New(cfg.DB.Path)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	if err := db.RunMigrations(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("run migrations: %w", err)
+	}
+	if _, err := db.ConfigureFTS(context.Background(), sqlite.FTSConfig{
+		Tokenizer: cfg.Search.Tokenizer,
+		Trigram:   cfg.Search.Trigram,
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("configure search index: %w", err)
+	}
+	return db, nil
+}
@@ -20,9 +20,9 @@ import (
 	"github.com/rpggio/trellis/internal/domain/project"
 	"github.com/rpggio/trellis/internal/domain/record"
 	"github.com/rpggio/trellis/internal/domain/session"
+	"github.com/rpggio/trellis/internal/embedding"
 	"github.com/rpggio/trellis/internal/mcp"
 	"github.com/rpggio/trellis/internal/sqlite"
-	"github.com/rpggio/trellis/migrations"
 	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
@@ -63,21 +63,47 @@ func main() {
 	}
 	defer db.Close()
 
-	if err := runEmbeddedMigrations(db); err != nil {
+	if err := db.RunMigrations(); err != nil {
 		logger.Error("failed to run migrations", "error", err)
 		os.Exit(1)
 	}
 
+	rebuilt, err := db.ConfigureFTS(context.Background(), sqlite.FTSConfig{
+		Tokenizer: cfg.Search.Tokenizer,
+		Trigram:   cfg.Search.Trigram,
+	})
+	if err != nil {
+		logger.Error("failed to configure search index", "error", err)
+		os.Exit(1)
+	}
+	if rebuilt {
+		logger.Info("rebuilt search index", "tokenizer", cfg.Search.Tokenizer, "trigram", cfg.Search.Trigram)
+	}
+
 	projectRepo := sqlite.NewProjectRepository(db)
 	recordRepo := sqlite.NewRecordRepository(db)
 	sessionRepo := sqlite.NewSessionRepository(db)
 	activityRepo := sqlite.NewActivityRepository(db)
-	searchRepo := sqlite.NewSearchRepository(db)
+	searchRepo := sqlite.NewSearchRepository(db, sqlite.SearchWeights{
+		Title:   cfg.Search.Weights.Title,
+		Summary: cfg.Search.Weights.Summary,
+		Body:    cfg.Search.Weights.Body,
+	})
+
+	embedder, err := newEmbedder(cfg.Embedding)
+	if err != nil {
+		logger.Error("failed to configure embeddings", "error", err)
+		os.Exit(1)
+	}
 
 	projectSvc := project.NewService(projectRepo, logger)
 	activitySvc := activity.NewService(activityRepo, logger)
-	recordSvc := record.NewService(recordRepo, sessionRepo, projectRepo, activityRepo, searchRepo, logger)
-	sessionSvc := session.NewService(recordRepo, sessionRepo, projectRepo, logger)
+	recordSvc := record.NewService(recordRepo, sessionRepo, projectRepo, activityRepo, searchRepo, embedder, db, logger)
+	sessionSvc := session.NewService(recordRepo, sessionRepo, projectRepo, activityRepo, logger)
+
+	sweepCtx, stopSweeper := context.WithCancel(context.Background())
+	defer stopSweeper()
+	go runSessionSweeper(sweepCtx, logger, sessionSvc, cfg.Sessions)
 
 	// Create MCP server with SDK
 	resolver := &apiKeyResolver{db: db}
@@ -102,6 +128,51 @@ func main() {
 	}
 }
 
+// newEmbedder creates the embedding provider used for semantic search.
+func newEmbedder(cfg config.EmbeddingConfig) (record.Embedder, error) {
+	switch cfg.Provider {
+	case "", "local":
+		return embedding.NewHashEmbedder(cfg.Dimensions), nil
+	case "openai":
+		if cfg.URL == "" || cfg.Model == "" {
+			return nil, fmt.Errorf("openai embedding provider needs a url and model")
+		}
+		return embedding.NewOpenAIEmbedder(cfg.URL, cfg.Model, cfg.APIKey, cfg.Timeout), nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider %q (use local or openai)", cfg.Provider)
+	}
+}
+
+// runSessionSweeper marks abandoned sessions stale, and closes them, once
+// per sweep interval until ctx is canceled.
+func runSessionSweeper(ctx context.Context, logger *slog.Logger, svc *session.Service, cfg config.SessionsConfig) {
+	if cfg.SweepInterval <= 0 {
+		return
+	}
+	policy := session.SweepPolicy{
+		StaleAfter:   cfg.StaleAfter,
+		StaleTickGap: cfg.StaleTickGap,
+		CloseAfter:   cfg.CloseAfter,
+	}
+
+	ticker := time.NewTicker(cfg.SweepInterval)
+	defer ticker.Stop()
+	for {
+		result, err := svc.Sweep(ctx, policy)
+		if err != nil {
+			logger.Error("session sweep failed", "error", err)
+		} else if len(result.Staled)+len(result.Closed) > 0 {
+			logger.Info("swept sessions", "stale", len(result.Staled), "closed", len(result.Closed))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 func runStdioMode(logger *slog.Logger, mcpServer *sdkmcp.Server) {
 	logger.Info("starting stdio transport", "auth", "disabled")
 
@@ -163,17 +234,6 @@ func runHTTPMode(logger *slog.Logger, mcpServer *sdkmcp.Server, host string, por
 	waitForShutdown(logger, httpServer)
 }
 
-func runEmbeddedMigrations(db *sqlite.DB) error {
-	data, err := migrations.FS.ReadFile("001_initial_schema.up.sql")
-	if err != nil {
-		return fmt.Errorf("read migrations: %w", err)
-	}
-	if _, err := db.Exec(string(data)); err != nil {
-		return fmt.Errorf("apply migrations: %w", err)
-	}
-	return nil
-}
-
 func ensureDBDir(path string) error {
 	if path == ":memory:" || path == "" {
 		return nil
@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -16,6 +18,10 @@ type Config struct {
 	DB        DBConfig        `yaml:"db"`
 	Log       LogConfig       `yaml:"log"`
 	Auth      AuthConfig      `yaml:"auth"`
+	Trash     TrashConfig     `yaml:"trash"`
+	Sessions  SessionsConfig  `yaml:"sessions"`
+	Search    SearchConfig    `yaml:"search"`
+	Embedding EmbeddingConfig `yaml:"embedding"`
 }
 
 type TransportConfig struct {
@@ -39,6 +45,46 @@ type AuthConfig struct {
 	Enabled bool `yaml:"enabled"`
 }
 
+type TrashConfig struct {
+	Retention time.Duration `yaml:"retention"` // trashed records older than this are purged
+}
+
+// SessionsConfig sets when the server's sweeper gives up on abandoned
+// sessions. Active sessions idle for StaleAfter, or StaleTickGap ticks
+// behind their project, are marked stale; sessions left stale for
+// CloseAfter are closed. A zero value disables that step.
+type SessionsConfig struct {
+	SweepInterval time.Duration `yaml:"sweep_interval"` // how often the sweeper runs
+	StaleAfter    time.Duration `yaml:"stale_after"`
+	StaleTickGap  int64         `yaml:"stale_tick_gap"`
+	CloseAfter    time.Duration `yaml:"close_after"`
+}
+
+type SearchConfig struct {
+	Weights   SearchWeights `yaml:"weights"`
+	Tokenizer string        `yaml:"tokenizer"` // "unicode61" or "porter" (stemming)
+	Trigram   bool          `yaml:"trigram"`   // also index substrings of words
+}
+
+// SearchWeights are the BM25 column weights used to rank search results.
+type SearchWeights struct {
+	Title   float64 `yaml:"title"`
+	Summary float64 `yaml:"summary"`
+	Body    float64 `yaml:"body"`
+}
+
+// EmbeddingConfig selects the embedding provider used for semantic search.
+// The "local" provider hashes text features and needs no network; "openai"
+// calls an OpenAI-compatible /embeddings endpoint at URL.
+type EmbeddingConfig struct {
+	Provider   string        `yaml:"provider"`   // "local" or "openai"
+	Dimensions int           `yaml:"dimensions"` // local provider vector size
+	URL        string        `yaml:"url"`        // base URL, e.g. https://api.openai.com/v1
+	Model      string        `yaml:"model"`
+	APIKey     string        `yaml:"api_key"`
+	Timeout    time.Duration `yaml:"timeout"`
+}
+
 // Load reads configuration from an optional YAML file and environment variables.
 func Load() (Config, error) {
 	// Determine default DB path: same directory as binary
@@ -65,6 +111,26 @@ func Load() (Config, error) {
 		Auth: AuthConfig{
 			Enabled: true,
 		},
+		Trash: TrashConfig{
+			Retention: 30 * 24 * time.Hour,
+		},
+		Sessions: SessionsConfig{
+			SweepInterval: 5 * time.Minute,
+			StaleAfter:    2 * time.Hour,
+			StaleTickGap:  200,
+			CloseAfter:    7 * 24 * time.Hour,
+		},
+		Search: SearchConfig{
+			Weights:   SearchWeights{Title: 10, Summary: 4, Body: 1},
+			Tokenizer: "unicode61",
+		},
+		Embedding: EmbeddingConfig{
+			Provider:   "local",
+			Dimensions: 256,
+			URL:        "https://api.openai.com/v1",
+			Model:      "text-embedding-3-small",
+			Timeout:    30 * time.Second,
+		},
 	}
 
 	if path := os.Getenv("TRELLIS_CONFIG_PATH"); path != "" {
@@ -99,10 +165,91 @@ func Load() (Config, error) {
 		}
 		cfg.Auth.Enabled = value
 	}
+	if retention := os.Getenv("TRELLIS_TRASH_RETENTION"); retention != "" {
+		value, err := time.ParseDuration(retention)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid TRELLIS_TRASH_RETENTION: %w", err)
+		}
+		cfg.Trash.Retention = value
+	}
+	if interval := os.Getenv("TRELLIS_SESSION_SWEEP_INTERVAL"); interval != "" {
+		value, err := time.ParseDuration(interval)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid TRELLIS_SESSION_SWEEP_INTERVAL: %w", err)
+		}
+		cfg.Sessions.SweepInterval = value
+	}
+	if staleAfter := os.Getenv("TRELLIS_SESSION_STALE_AFTER"); staleAfter != "" {
+		value, err := time.ParseDuration(staleAfter)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid TRELLIS_SESSION_STALE_AFTER: %w", err)
+		}
+		cfg.Sessions.StaleAfter = value
+	}
+	if closeAfter := os.Getenv("TRELLIS_SESSION_CLOSE_AFTER"); closeAfter != "" {
+		value, err := time.ParseDuration(closeAfter)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid TRELLIS_SESSION_CLOSE_AFTER: %w", err)
+		}
+		cfg.Sessions.CloseAfter = value
+	}
+	if gap := os.Getenv("TRELLIS_SESSION_STALE_TICK_GAP"); gap != "" {
+		value, err := strconv.ParseInt(gap, 10, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid TRELLIS_SESSION_STALE_TICK_GAP: %w", err)
+		}
+		cfg.Sessions.StaleTickGap = value
+	}
+	if weights := os.Getenv("TRELLIS_SEARCH_WEIGHTS"); weights != "" {
+		value, err := parseSearchWeights(weights)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid TRELLIS_SEARCH_WEIGHTS: %w", err)
+		}
+		cfg.Search.Weights = value
+	}
+	if tokenizer := os.Getenv("TRELLIS_SEARCH_TOKENIZER"); tokenizer != "" {
+		cfg.Search.Tokenizer = tokenizer
+	}
+	if trigram := os.Getenv("TRELLIS_SEARCH_TRIGRAM"); trigram != "" {
+		value, err := strconv.ParseBool(trigram)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid TRELLIS_SEARCH_TRIGRAM: %w", err)
+		}
+		cfg.Search.Trigram = value
+	}
+	if provider := os.Getenv("TRELLIS_EMBEDDING_PROVIDER"); provider != "" {
+		cfg.Embedding.Provider = provider
+	}
+	if url := os.Getenv("TRELLIS_EMBEDDING_URL"); url != "" {
+		cfg.Embedding.URL = url
+	}
+	if model := os.Getenv("TRELLIS_EMBEDDING_MODEL"); model != "" {
+		cfg.Embedding.Model = model
+	}
+	if apiKey := os.Getenv("TRELLIS_EMBEDDING_API_KEY"); apiKey != "" {
+		cfg.Embedding.APIKey = apiKey
+	}
 
 	return cfg, nil
 }
 
+// parseSearchWeights parses "title,summary,body" weights such as "10,4,1".
+func parseSearchWeights(value string) (SearchWeights, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 3 {
+		return SearchWeights{}, fmt.Errorf("want title,summary,body weights, got %q", value)
+	}
+	weights := make([]float64, len(parts))
+	for i, part := range parts {
+		weight, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return SearchWeights{}, err
+		}
+		weights[i] = weight
+	}
+	return SearchWeights{Title: weights[0], Summary: weights[1], Body: weights[2]}, nil
+}
+
 func loadFromFile(path string, cfg *Config) error {
 	data, err := os.ReadFile(path)
 	if err != nil {
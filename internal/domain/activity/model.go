@@ -8,12 +8,20 @@ type ActivityType string
 const (
 	TypeRecordCreated    ActivityType = "record_created"
 	TypeRecordUpdated    ActivityType = "record_updated"
+	TypeRecordReverted   ActivityType = "record_reverted"
 	TypeStateTransition  ActivityType = "state_transition"
+	TypeRecordMoved      ActivityType = "record_moved"
+	TypeRecordLinked     ActivityType = "record_linked"
+	TypeRecordUnlinked   ActivityType = "record_unlinked"
+	TypeRecordDeleted    ActivityType = "record_deleted"
+	TypeRecordRestored   ActivityType = "record_restored"
 	TypeSessionStarted   ActivityType = "session_started"
 	TypeSessionSaved     ActivityType = "session_saved"
 	TypeSessionClosed    ActivityType = "session_closed"
+	TypeSessionStale     ActivityType = "session_stale"
 	TypeSessionBranched  ActivityType = "session_branched"
 	TypeActivation       ActivityType = "activation"
+	TypeDeactivation     ActivityType = "deactivation"
 	TypeConflictDetected ActivityType = "conflict_detected"
 	TypeConflictResolved ActivityType = "conflict_resolved"
 )
@@ -6,6 +6,7 @@ type ListActivityOptions struct {
 	RecordID     *string
 	SessionID    *string
 	ActivityType *ActivityType
+	SinceTick    int64 // only entries with a tick greater than this
 	Limit        int
 	Offset       int
 }
@@ -7,4 +7,7 @@ var (
 	ErrProjectNotFound = errors.New("project not found")
 	// ErrInvalidInput indicates invalid project input.
 	ErrInvalidInput = errors.New("invalid project input")
+	// ErrInvalidPolicy indicates an activation policy with an out-of-range
+	// depth or an unknown state.
+	ErrInvalidPolicy = errors.New("invalid activation policy")
 )
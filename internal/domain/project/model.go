@@ -2,14 +2,16 @@ package project
 
 import "time"
 
-// Project represents a container for records with a monotonic tick counter
+// Project represents a container for records with a monotonic tick counter.
+// ActivationPolicy holds the project's defaults for activation bundles.
 type Project struct {
-	ID          string    `json:"id"`
-	TenantID    string    `json:"tenant_id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description,omitempty"`
-	Tick        int64     `json:"tick"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID               string           `json:"id"`
+	TenantID         string           `json:"tenant_id"`
+	Name             string           `json:"name"`
+	Description      string           `json:"description,omitempty"`
+	Tick             int64            `json:"tick"`
+	ActivationPolicy ActivationPolicy `json:"activation_policy"`
+	CreatedAt        time.Time        `json:"created_at"`
 }
 
 // ProjectSummary is a lightweight representation for listing
@@ -0,0 +1,95 @@
+package project
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/rpggio/trellis/internal/domain/record"
+)
+
+// MaxActivationDepth caps the ancestor and descendant levels of a bundle.
+const MaxActivationDepth = 10
+
+// ActivationPolicy shapes the context bundle that activation returns. Nil
+// fields and an empty FullStates are unset: a request's policy falls back to
+// its project's, and the project's to DefaultActivationPolicy.
+//
+// AncestorDepth is the number of levels above the target in the bundle: the
+// parent is loaded in full and every level in the ancestor path. 0 leaves
+// out both. DescendantDepth is the number of levels below: 1 loads
+// children, 2 grandchildren, and deeper levels load as descendants.
+// Children in FullStates are loaded in full, the rest as references.
+// IncludeLinks adds linked records and IncludeSiblings the target's
+// siblings, both as references.
+type ActivationPolicy struct {
+	AncestorDepth   *int                 `json:"ancestor_depth,omitempty"`
+	DescendantDepth *int                 `json:"descendant_depth,omitempty"`
+	FullStates      []record.RecordState `json:"full_states,omitempty"`
+	IncludeLinks    *bool                `json:"include_links,omitempty"`
+	IncludeSiblings *bool                `json:"include_siblings,omitempty"`
+}
+
+// DefaultActivationPolicy returns the built-in bundle shape: the parent and
+// full ancestor path, OPEN children in full, other children and
+// grandchildren as references, and links but no siblings.
+func DefaultActivationPolicy() ActivationPolicy {
+	ancestorDepth, descendantDepth := MaxActivationDepth, 2
+	includeLinks, includeSiblings := true, false
+	return ActivationPolicy{
+		AncestorDepth:   &ancestorDepth,
+		DescendantDepth: &descendantDepth,
+		FullStates:      []record.RecordState{record.StateOpen},
+		IncludeLinks:    &includeLinks,
+		IncludeSiblings: &includeSiblings,
+	}
+}
+
+// IsZero reports whether no field of p is set.
+func (p ActivationPolicy) IsZero() bool {
+	return p.AncestorDepth == nil && p.DescendantDepth == nil && len(p.FullStates) == 0 &&
+		p.IncludeLinks == nil && p.IncludeSiblings == nil
+}
+
+// Or returns p with its unset fields taken from fallback.
+func (p ActivationPolicy) Or(fallback ActivationPolicy) ActivationPolicy {
+	if p.AncestorDepth == nil {
+		p.AncestorDepth = fallback.AncestorDepth
+	}
+	if p.DescendantDepth == nil {
+		p.DescendantDepth = fallback.DescendantDepth
+	}
+	if len(p.FullStates) == 0 {
+		p.FullStates = fallback.FullStates
+	}
+	if p.IncludeLinks == nil {
+		p.IncludeLinks = fallback.IncludeLinks
+	}
+	if p.IncludeSiblings == nil {
+		p.IncludeSiblings = fallback.IncludeSiblings
+	}
+	return p
+}
+
+// Validate checks depths and states, returning an error wrapping
+// ErrInvalidPolicy.
+func (p ActivationPolicy) Validate() error {
+	if err := validateDepth("ancestor_depth", p.AncestorDepth); err != nil {
+		return err
+	}
+	if err := validateDepth("descendant_depth", p.DescendantDepth); err != nil {
+		return err
+	}
+	for _, state := range p.FullStates {
+		if !slices.Contains(record.RecordStates, state) {
+			return fmt.Errorf("%w: unknown state %q in full_states", ErrInvalidPolicy, state)
+		}
+	}
+	return nil
+}
+
+func validateDepth(name string, depth *int) error {
+	if depth != nil && (*depth < 0 || *depth > MaxActivationDepth) {
+		return fmt.Errorf("%w: %s must be between 0 and %d", ErrInvalidPolicy, name, MaxActivationDepth)
+	}
+	return nil
+}
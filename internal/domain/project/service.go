@@ -25,9 +25,19 @@ func NewService(repo Repository, logger *slog.Logger) *Service {
 
 // CreateRequest defines project creation inputs.
 type CreateRequest struct {
-	ID          string
-	Name        string
-	Description string
+	ID               string
+	Name             string
+	Description      string
+	ActivationPolicy ActivationPolicy
+}
+
+// UpdateRequest defines project update inputs. Nil fields are left as they
+// are; a non-nil ActivationPolicy replaces the project's policy.
+type UpdateRequest struct {
+	ID               string
+	Name             *string
+	Description      *string
+	ActivationPolicy *ActivationPolicy
 }
 
 // Create creates a new project.
@@ -35,6 +45,9 @@ func (s *Service) Create(ctx context.Context, tenantID string, req CreateRequest
 	if strings.TrimSpace(req.Name) == "" {
 		return nil, ErrInvalidInput
 	}
+	if err := req.ActivationPolicy.Validate(); err != nil {
+		return nil, err
+	}
 
 	id := req.ID
 	if strings.TrimSpace(id) == "" {
@@ -42,12 +55,13 @@ func (s *Service) Create(ctx context.Context, tenantID string, req CreateRequest
 	}
 
 	proj := &Project{
-		ID:          id,
-		TenantID:    tenantID,
-		Name:        req.Name,
-		Description: req.Description,
-		Tick:        0,
-		CreatedAt:   time.Now(),
+		ID:               id,
+		TenantID:         tenantID,
+		Name:             req.Name,
+		Description:      req.Description,
+		Tick:             0,
+		ActivationPolicy: req.ActivationPolicy,
+		CreatedAt:        time.Now(),
 	}
 
 	if err := s.repo.Create(ctx, tenantID, proj); err != nil {
@@ -69,6 +83,40 @@ func (s *Service) Get(ctx context.Context, tenantID, id string) (*Project, error
 	return proj, nil
 }
 
+// Update changes a project's name, description or activation policy.
+func (s *Service) Update(ctx context.Context, tenantID string, req UpdateRequest) (*Project, error) {
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		return nil, ErrInvalidInput
+	}
+	if req.ActivationPolicy != nil {
+		if err := req.ActivationPolicy.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	proj, err := s.Get(ctx, tenantID, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name != nil {
+		proj.Name = *req.Name
+	}
+	if req.Description != nil {
+		proj.Description = *req.Description
+	}
+	if req.ActivationPolicy != nil {
+		proj.ActivationPolicy = *req.ActivationPolicy
+	}
+
+	if err := s.repo.Update(ctx, tenantID, proj); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrProjectNotFound
+		}
+		return nil, fmt.Errorf("updating project: %w", err)
+	}
+	return proj, nil
+}
+
 // GetDefault returns the default project, creating one if missing.
 func (s *Service) GetDefault(ctx context.Context, tenantID string) (*Project, error) {
 	proj, err := s.repo.GetDefault(ctx, tenantID)
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/rpggio/trellis/internal/domain/project"
+	"github.com/rpggio/trellis/internal/domain/record"
 	"github.com/rpggio/trellis/internal/repository"
 	"github.com/rpggio/trellis/internal/repository/mocks"
 	"github.com/stretchr/testify/mock"
@@ -35,3 +36,47 @@ func TestProjectService_CreateValidation(t *testing.T) {
 	_, err := svc.Create(ctx, tenantID, project.CreateRequest{Name: ""})
 	require.ErrorIs(t, err, project.ErrInvalidInput)
 }
+
+func TestProjectService_Update(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+
+	repo := &mocks.ProjectRepository{}
+	repo.On("Get", ctx, tenantID, "p1").Return(&project.Project{ID: "p1", Name: "Old"}, nil)
+	repo.On("Update", ctx, tenantID, mock.Anything).Return(nil)
+
+	svc := project.NewService(repo, nil)
+	depth := 1
+	name := "New"
+	proj, err := svc.Update(ctx, tenantID, project.UpdateRequest{
+		ID:               "p1",
+		Name:             &name,
+		ActivationPolicy: &project.ActivationPolicy{DescendantDepth: &depth},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "New", proj.Name)
+	require.Equal(t, 1, *proj.ActivationPolicy.DescendantDepth)
+
+	tooDeep := project.MaxActivationDepth + 1
+	_, err = svc.Update(ctx, tenantID, project.UpdateRequest{
+		ID:               "p1",
+		ActivationPolicy: &project.ActivationPolicy{AncestorDepth: &tooDeep},
+	})
+	require.ErrorIs(t, err, project.ErrInvalidPolicy)
+
+	_, err = svc.Update(ctx, tenantID, project.UpdateRequest{
+		ID:               "p1",
+		ActivationPolicy: &project.ActivationPolicy{FullStates: []record.RecordState{"DONE"}},
+	})
+	require.ErrorIs(t, err, project.ErrInvalidPolicy)
+}
+
+func TestActivationPolicy_Or(t *testing.T) {
+	depth := 0
+	policy := project.ActivationPolicy{AncestorDepth: &depth}.Or(project.DefaultActivationPolicy())
+	require.Equal(t, 0, *policy.AncestorDepth)
+	require.Equal(t, 2, *policy.DescendantDepth)
+	require.Equal(t, []record.RecordState{record.StateOpen}, policy.FullStates)
+	require.True(t, *policy.IncludeLinks)
+	require.False(t, *policy.IncludeSiblings)
+}
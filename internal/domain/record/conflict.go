@@ -1,9 +1,22 @@
 package record
 
-// ConflictInfo describes a conflict detected during an update.
+const (
+	// ConflictUpdate means the record was modified after the session activated it.
+	ConflictUpdate = "update"
+	// ConflictConcurrentSession means the record is active in other sessions.
+	ConflictConcurrentSession = "concurrent_session"
+)
+
+// ConflictInfo describes a conflict detected during an update. For update
+// conflicts BaseVersion is the version the session activated, when it is
+// still in the version history, and Merge combines the proposed update with
+// the remote version against it.
 type ConflictInfo struct {
-	ConflictType  string  `json:"conflict_type"`
-	LocalVersion  *Record `json:"local_version,omitempty"`
-	RemoteVersion *Record `json:"remote_version,omitempty"`
-	Message       string  `json:"message"`
+	ConflictType  string        `json:"conflict_type"`
+	LocalVersion  *Record       `json:"local_version,omitempty"`
+	RemoteVersion *Record       `json:"remote_version,omitempty"`
+	BaseVersion   *Record       `json:"base_version,omitempty"`
+	Merge         *MergeResult  `json:"merge,omitempty"`
+	Sessions      []SessionInfo `json:"sessions,omitempty"`
+	Message       string        `json:"message"`
 }
@@ -0,0 +1,69 @@
+package record
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// ListSort orders listed records. Each order breaks ties by record ID, so
+// a cursor always points at one place in the listing.
+type ListSort string
+
+const (
+	// SortCreated lists the newest records first. It is the default.
+	SortCreated ListSort = "created"
+	// SortModified lists the most recently modified records first.
+	SortModified ListSort = "modified"
+	// SortTick lists records by their last write tick, highest first.
+	SortTick ListSort = "tick"
+	// SortTitle lists records by title, A to Z, ignoring case.
+	SortTitle ListSort = "title"
+	// SortState lists OPEN records, then LATER, RESOLVED and DISCARDED.
+	SortState ListSort = "state"
+	// SortChildrenOpen lists records with the most open children first.
+	SortChildrenOpen ListSort = "children_open"
+)
+
+// Cursor is the decoded form of a page token. For listings it holds the
+// sort key and ID of the last record returned, for search the offset of
+// the next page. Ticks are the project ticks when the first page was read.
+type Cursor struct {
+	Sort   ListSort         `json:"s,omitempty"`
+	Key    string           `json:"k,omitempty"`
+	ID     string           `json:"i,omitempty"`
+	Offset int              `json:"o,omitempty"`
+	Ticks  map[string]int64 `json:"t,omitempty"`
+}
+
+// Encode returns the cursor as an opaque token.
+func (c Cursor) Encode() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		// A Cursor only holds strings and numbers.
+		panic(fmt.Sprintf("encoding cursor: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a token made by Cursor.Encode.
+func DecodeCursor(token string) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// validSort reports whether sort is a known order; empty means SortCreated.
+func validSort(sort ListSort) bool {
+	switch sort {
+	case "", SortCreated, SortModified, SortTick, SortTitle, SortState, SortChildrenOpen:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package record
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContextLines is the number of unchanged lines shown around each hunk.
+const diffContextLines = 3
+
+// diffMaxEdits bounds the edit distance diffLines searches for. Texts
+// further apart than this diff as a replacement of the changed region.
+const diffMaxEdits = 1000
+
+type lineOp int
+
+const (
+	opEqual lineOp = iota
+	opDelete
+	opInsert
+)
+
+// lineEdit is one step of an edit script turning one line slice into another.
+// OldIndex and NewIndex are positions in the old and new slices; the index
+// for the side the line does not appear on is -1.
+type lineEdit struct {
+	Op       lineOp
+	Text     string
+	OldIndex int
+	NewIndex int
+}
+
+// UnifiedDiff returns a unified line diff from one text to another, or an
+// empty string if the texts are identical.
+func UnifiedDiff(fromLabel, toLabel, from, to string) string {
+	if from == to {
+		return ""
+	}
+
+	oldLines := splitLines(from)
+	newLines := splitLines(to)
+	edits := diffLines(oldLines, newLines)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", fromLabel, toLabel)
+	for _, hunk := range groupHunks(edits) {
+		writeHunk(&b, edits[hunk[0]:hunk[1]])
+	}
+	return b.String()
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines computes a minimal edit script using Myers' algorithm, up to
+// diffMaxEdits edits.
+func diffLines(a, b []string) []lineEdit {
+	// Trim the common prefix and suffix so the search only covers the changed region.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := make([]lineEdit, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		edits = append(edits, lineEdit{Op: opEqual, Text: a[i], OldIndex: i, NewIndex: i})
+	}
+	for _, e := range myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		if e.OldIndex >= 0 {
+			e.OldIndex += prefix
+		}
+		if e.NewIndex >= 0 {
+			e.NewIndex += prefix
+		}
+		edits = append(edits, e)
+	}
+	for i := 0; i < suffix; i++ {
+		oldIndex := len(a) - suffix + i
+		newIndex := len(b) - suffix + i
+		edits = append(edits, lineEdit{Op: opEqual, Text: a[oldIndex], OldIndex: oldIndex, NewIndex: newIndex})
+	}
+	return edits
+}
+
+// myers returns the shortest edit script from a to b, or a script deleting
+// all of a and inserting all of b when that takes more than diffMaxEdits
+// edits. The trace keeps only the diagonals reachable at each step, so it
+// grows with the square of the edit count rather than with the text size.
+func myers(a, b []string) []lineEdit {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d] holds v[offset-d-1 : offset+d+2] as it stood before step d,
+	// the diagonals step d reads.
+	trace := make([][]int, 0)
+
+search:
+	for d := 0; d <= max; d++ {
+		if d > diffMaxEdits {
+			return replaceLines(a, b)
+		}
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk the trace backwards to recover the path.
+	edits := make([]lineEdit, 0, n+m)
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		base := d + 1 // index of diagonal 0 in v
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[base+k-1] < v[base+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[base+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			edits = append(edits, lineEdit{Op: opEqual, Text: a[x-1], OldIndex: x - 1, NewIndex: y - 1})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				edits = append(edits, lineEdit{Op: opInsert, Text: b[y-1], OldIndex: -1, NewIndex: y - 1})
+				y--
+			} else {
+				edits = append(edits, lineEdit{Op: opDelete, Text: a[x-1], OldIndex: x - 1, NewIndex: -1})
+				x--
+			}
+		}
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// replaceLines returns the edit script deleting every line of a and then
+// inserting every line of b.
+func replaceLines(a, b []string) []lineEdit {
+	edits := make([]lineEdit, 0, len(a)+len(b))
+	for i, line := range a {
+		edits = append(edits, lineEdit{Op: opDelete, Text: line, OldIndex: i, NewIndex: -1})
+	}
+	for i, line := range b {
+		edits = append(edits, lineEdit{Op: opInsert, Text: line, OldIndex: -1, NewIndex: i})
+	}
+	return edits
+}
+
+// groupHunks returns [start, end) ranges into edits covering each change plus context.
+func groupHunks(edits []lineEdit) [][2]int {
+	var hunks [][2]int
+	for i := 0; i < len(edits); i++ {
+		if edits[i].Op == opEqual {
+			continue
+		}
+
+		start := i - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+		if len(hunks) > 0 && start <= hunks[len(hunks)-1][1] {
+			start = hunks[len(hunks)-1][0]
+			hunks = hunks[:len(hunks)-1]
+		}
+
+		// Extend over further changes that fall inside the trailing context.
+		end := i
+		for end < len(edits) {
+			if edits[end].Op != opEqual {
+				end++
+				continue
+			}
+			next := end
+			for next < len(edits) && next < end+diffContextLines && edits[next].Op == opEqual {
+				next++
+			}
+			if next < len(edits) && next < end+diffContextLines {
+				end = next
+				continue
+			}
+			break
+		}
+		end += diffContextLines
+		if end > len(edits) {
+			end = len(edits)
+		}
+
+		hunks = append(hunks, [2]int{start, end})
+		i = end - 1
+	}
+	return hunks
+}
+
+func writeHunk(b *strings.Builder, edits []lineEdit) {
+	// With context lines included, a side only has no lines when that whole
+	// text is empty; the unified format reports it as "0,0".
+	oldStart, newStart := -1, -1
+	oldCount, newCount := 0, 0
+	for _, e := range edits {
+		if e.OldIndex >= 0 {
+			if oldStart < 0 {
+				oldStart = e.OldIndex
+			}
+			oldCount++
+		}
+		if e.NewIndex >= 0 {
+			if newStart < 0 {
+				newStart = e.NewIndex
+			}
+			newCount++
+		}
+	}
+
+	fmt.Fprintf(b, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+	for _, e := range edits {
+		switch e.Op {
+		case opEqual:
+			b.WriteString(" ")
+		case opDelete:
+			b.WriteString("-")
+		case opInsert:
+			b.WriteString("+")
+		}
+		b.WriteString(e.Text)
+		b.WriteString("\n")
+	}
+}
+
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
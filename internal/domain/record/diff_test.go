@@ -0,0 +1,53 @@
+package record_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/rpggio/trellis/internal/domain/record"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnifiedDiff_Identical(t *testing.T) {
+	require.Empty(t, record.UnifiedDiff("a", "b", "same\ntext", "same\ntext"))
+}
+
+func TestUnifiedDiff_ChangedLine(t *testing.T) {
+	from := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight"
+	to := "one\ntwo\nthree\nfour\nFIVE\nsix\nseven\neight"
+
+	diff := record.UnifiedDiff("old", "new", from, to)
+	require.Equal(t, "--- old\n+++ new\n"+
+		"@@ -2,7 +2,7 @@\n"+
+		" two\n three\n four\n-five\n+FIVE\n six\n seven\n eight\n", diff)
+}
+
+func TestUnifiedDiff_SeparateHunks(t *testing.T) {
+	from := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl"
+	to := "A\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nL"
+
+	diff := record.UnifiedDiff("old", "new", from, to)
+	require.Equal(t, "--- old\n+++ new\n"+
+		"@@ -1,4 +1,4 @@\n-a\n+A\n b\n c\n d\n"+
+		"@@ -9,4 +9,4 @@\n i\n j\n k\n-l\n+L\n", diff)
+}
+
+func TestUnifiedDiff_FromEmpty(t *testing.T) {
+	diff := record.UnifiedDiff("old", "new", "", "added\nlines")
+	require.Equal(t, "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+added\n+lines\n", diff)
+}
+
+func TestUnifiedDiff_UnrelatedBodies(t *testing.T) {
+	var from, to strings.Builder
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&from, "old line %d\n", i)
+		fmt.Fprintf(&to, "new line %d\n", i)
+	}
+
+	// Too far apart to search; the diff replaces the whole body.
+	diff := record.UnifiedDiff("old", "new", "keep\n"+from.String(), "keep\n"+to.String())
+	require.True(t, strings.HasPrefix(diff, "--- old\n+++ new\n@@ -1,5001 +1,5001 @@\n keep\n-old line 0\n-old line 1\n"), diff[:80])
+	require.Equal(t, 5000, strings.Count(diff, "\n-old line "))
+	require.Equal(t, 5000, strings.Count(diff, "\n+new line "))
+}
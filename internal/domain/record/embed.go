@@ -0,0 +1,144 @@
+package record
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Embedder turns text into vectors for semantic search.
+type Embedder interface {
+	// Model identifies the vector space. Vectors of different models are
+	// stored side by side and never compared.
+	Model() string
+	// Embed returns one vector per text, in order.
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// SearchMode selects how search matches a query's text.
+type SearchMode string
+
+const (
+	// SearchModeKeyword ranks full-text matches with BM25.
+	SearchModeKeyword SearchMode = "keyword"
+	// SearchModeSemantic ranks records by embedding similarity to the query.
+	SearchModeSemantic SearchMode = "semantic"
+	// SearchModeHybrid fuses keyword and semantic rankings.
+	SearchModeHybrid SearchMode = "hybrid"
+)
+
+// EmbeddedRef is a record reference with its stored embedding vector.
+type EmbeddedRef struct {
+	Ref    RecordRef
+	Vector []float32
+}
+
+// rrfK dampens the weight of top ranks in reciprocal-rank fusion; 60 is the
+// value from the original RRF paper.
+const rrfK = 60
+
+// hybridCandidates caps how many results of each ranking are fused.
+const hybridCandidates = 100
+
+// embeddingBatchSize caps the texts sent to the embedder at once.
+const embeddingBatchSize = 64
+
+// embeddingText is the text of rec that is embedded.
+func embeddingText(rec *Record) string {
+	return rec.Title + "\n" + rec.Summary + "\n" + rec.Body
+}
+
+// contentHash identifies embedded text, so unchanged records aren't
+// embedded again.
+func contentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// cosine returns the cosine similarity of a and b, or 0 when their lengths
+// differ or either is zero.
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// rankBySimilarity orders candidates by cosine similarity to vector, most
+// similar first, with Rank set to the similarity.
+func rankBySimilarity(vector []float32, candidates []EmbeddedRef) []SearchResult {
+	results := make([]SearchResult, 0, len(candidates))
+	for _, candidate := range candidates {
+		results = append(results, SearchResult{
+			Record:    candidate.Ref,
+			Rank:      cosine(vector, candidate.Vector),
+			Highlight: candidate.Ref.Title,
+		})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Rank > results[j].Rank
+	})
+	return results
+}
+
+// fuseRankings merges rankings with reciprocal-rank fusion: a record scores
+// 1/(k+rank) in each ranking it appears in. Rank is set to the fused score.
+// The first ranking that has a record supplies its highlight and snippet.
+func fuseRankings(rankings ...[]SearchResult) []SearchResult {
+	byID := map[string]*SearchResult{}
+	var order []string
+	for _, ranking := range rankings {
+		for i, result := range ranking {
+			score := 1.0 / float64(rrfK+i+1)
+			if fused, ok := byID[result.Record.ID]; ok {
+				fused.Rank += score
+				continue
+			}
+			result.Rank = score
+			byID[result.Record.ID] = &result
+			order = append(order, result.Record.ID)
+		}
+	}
+
+	fused := make([]SearchResult, len(order))
+	for i, id := range order {
+		fused[i] = *byID[id]
+	}
+	sort.SliceStable(fused, func(i, j int) bool {
+		return fused[i].Rank > fused[j].Rank
+	})
+	return fused
+}
+
+// page applies offset and limit to results ranked in memory.
+func page(results []SearchResult, offset, limit int) []SearchResult {
+	if offset >= len(results) {
+		return []SearchResult{}
+	}
+	results = results[offset:]
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	return results
+}
+
+// queryText is the text of the query's terms, which semantic search embeds.
+func queryText(query Query) string {
+	texts := make([]string, len(query.Terms))
+	for i, term := range query.Terms {
+		texts[i] = term.Text
+	}
+	return strings.Join(texts, " ")
+}
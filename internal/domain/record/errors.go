@@ -19,4 +19,32 @@ var (
 	ErrConflict = errors.New("record modified since activation")
 	// ErrInvalidInput indicates invalid input for record operations.
 	ErrInvalidInput = errors.New("invalid record input")
+	// ErrVersionNotFound indicates no version of the record exists at the requested tick.
+	ErrVersionNotFound = errors.New("record version not found")
+	// ErrInvalidVersionRef indicates a version reference could not be resolved to a tick.
+	ErrInvalidVersionRef = errors.New("invalid version reference")
+	// ErrUnresolvedConflict indicates submitted merge text still contains conflict markers.
+	ErrUnresolvedConflict = errors.New("merge still contains conflict markers")
+	// ErrMoveCycle indicates a move would place a record under itself or a descendant.
+	ErrMoveCycle = errors.New("record cannot be moved under itself or a descendant")
+	// ErrInvalidRelationKind indicates a link kind that is not supported.
+	ErrInvalidRelationKind = errors.New("invalid relation kind")
+	// ErrRelationNotFound indicates the link to remove doesn't exist.
+	ErrRelationNotFound = errors.New("relation not found")
+	// ErrNotInTrash indicates the record to restore was not deleted directly.
+	ErrNotInTrash = errors.New("record not in trash")
+	// ErrParentInTrash indicates a record can't be restored while its parent is deleted.
+	ErrParentInTrash = errors.New("parent record is in trash")
+	// ErrInvalidQuery indicates a search query could not be parsed.
+	ErrInvalidQuery = errors.New("invalid search query")
+	// ErrInvalidCursor indicates a page token that is malformed or from a different listing.
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrInvalidSort indicates an unknown sort order.
+	ErrInvalidSort = errors.New("invalid sort order")
+	// ErrInvalidSearchMode indicates a search mode other than keyword, semantic or hybrid.
+	ErrInvalidSearchMode = errors.New("invalid search mode")
+	// ErrSemanticSearchDisabled indicates semantic search without an embedder configured.
+	ErrSemanticSearchDisabled = errors.New("semantic search not configured")
+	// ErrAmbiguousID indicates a short record ID that matches more than one record.
+	ErrAmbiguousID = errors.New("ambiguous record id")
 )
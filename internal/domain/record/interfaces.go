@@ -2,6 +2,7 @@ package record
 
 import (
 	"context"
+	"time"
 
 	"github.com/rpggio/trellis/internal/domain/activity"
 )
@@ -12,11 +13,24 @@ type RecordRepository interface {
 	Get(ctx context.Context, tenantID, id string) (*Record, error)
 	Update(ctx context.Context, tenantID string, rec *Record, expectedTick int64) error
 	Delete(ctx context.Context, tenantID, id string) error
+	SoftDelete(ctx context.Context, tenantID, id string, deletedAt time.Time) (int, error)
+	GetTrashed(ctx context.Context, tenantID, id string) (*Record, error)
+	Restore(ctx context.Context, tenantID, id string) (int, error)
+	ListTrash(ctx context.Context, tenantID string, opts ListTrashOptions) ([]TrashEntry, error)
 	List(ctx context.Context, tenantID string, opts ListRecordsOptions) ([]RecordRef, error)
+	Count(ctx context.Context, tenantID string, opts ListRecordsOptions) (int, error)
+	Tree(ctx context.Context, tenantID string, opts TreeOptions) ([]TreeNode, error)
+	Ancestors(ctx context.Context, tenantID string, ids []string) (map[string][]Ancestor, error)
+	MatchIDPrefix(ctx context.Context, tenantID, prefix string, limit int) ([]string, error)
 	GetChildren(ctx context.Context, tenantID, parentID string) ([]Record, error)
 	GetChildrenRefs(ctx context.Context, tenantID, parentID string) ([]RecordRef, error)
 	GetRelated(ctx context.Context, tenantID, recordID string) ([]string, error)
-	AddRelation(ctx context.Context, fromRecordID, toRecordID string) error
+	GetLinks(ctx context.Context, tenantID, recordID string) ([]Link, error)
+	GetBacklinks(ctx context.Context, tenantID, recordID string) ([]Link, error)
+	AddRelation(ctx context.Context, fromRecordID, toRecordID string, kind RelationKind) error
+	RemoveRelation(ctx context.Context, fromRecordID, toRecordID string, kind RelationKind) error
+	SaveVersion(ctx context.Context, tenantID string, rec *Record) error
+	GetVersionAt(ctx context.Context, tenantID, id string, tick int64) (*Record, error)
 }
 
 // SessionRepository provides session activation data for records.
@@ -24,11 +38,14 @@ type SessionRepository interface {
 	AddActivation(ctx context.Context, sessionID, recordID string, tick int64) error
 	GetActivations(ctx context.Context, sessionID string) ([]string, error)
 	GetActivationTick(ctx context.Context, sessionID, recordID string) (int64, error)
+	GetByRecordID(ctx context.Context, tenantID, recordID string) ([]SessionInfo, error)
+	Touch(ctx context.Context, tenantID, id string, tick int64, at time.Time) error
 }
 
 // ProjectRepository provides project tick operations.
 type ProjectRepository interface {
 	IncrementTick(ctx context.Context, tenantID, projectID string) (int64, error)
+	Ticks(ctx context.Context, tenantID string, projectIDs []string) (map[string]int64, error)
 }
 
 // ActivityRepository logs record activities.
@@ -36,7 +53,13 @@ type ActivityRepository interface {
 	Log(ctx context.Context, tenantID string, entry *activity.ActivityEntry) error
 }
 
-// SearchRepository performs full-text search.
+// SearchRepository performs full-text search and stores the embeddings
+// used by semantic search.
 type SearchRepository interface {
-	Search(ctx context.Context, tenantID, projectID, query string, opts SearchOptions) ([]SearchResult, error)
+	Search(ctx context.Context, tenantID string, query Query, opts SearchOptions) ([]SearchResult, error)
+	Count(ctx context.Context, tenantID string, query Query, opts SearchOptions) (int, error)
+	EmbeddingHash(ctx context.Context, recordID, model string) (string, error)
+	SaveEmbedding(ctx context.Context, recordID, model, contentHash string, vector []float32) error
+	MissingEmbeddings(ctx context.Context, tenantID, model string, limit int) ([]Record, error)
+	SearchEmbeddings(ctx context.Context, tenantID, model string, query Query, opts SearchOptions) ([]EmbeddedRef, error)
 }
@@ -0,0 +1,195 @@
+package record
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Conflict markers written into merged text where both sides changed the
+// same lines. Only the opening and closing markers are checked when a
+// resolution is submitted, since a bare "=======" line is valid Markdown.
+const (
+	conflictMarkerLocal  = "<<<<<<< "
+	conflictMarkerSplit  = "======="
+	conflictMarkerRemote = ">>>>>>> "
+)
+
+// MergeResult is a three-way merge of a proposed update and the remote
+// version against the version the session activated. Fields named in
+// Conflicts contain conflict markers that must be edited out before the
+// result is submitted with resolve_conflict.
+type MergeResult struct {
+	BaseTick   int64    `json:"base_tick"`
+	RemoteTick int64    `json:"remote_tick"`
+	Title      string   `json:"title"`
+	Summary    string   `json:"summary"`
+	Body       string   `json:"body"`
+	Conflicts  []string `json:"conflicts,omitempty"`
+}
+
+// mergeVersions merges the content fields of local and remote against base.
+func mergeVersions(base, local, remote *Record) *MergeResult {
+	remoteLabel := fmt.Sprintf("tick:%d", remote.Tick)
+	result := &MergeResult{BaseTick: base.Tick, RemoteTick: remote.Tick}
+
+	fields := []struct {
+		name                string
+		base, local, remote string
+		out                 *string
+	}{
+		{"title", base.Title, local.Title, remote.Title, &result.Title},
+		{"summary", base.Summary, local.Summary, remote.Summary, &result.Summary},
+		{"body", base.Body, local.Body, remote.Body, &result.Body},
+	}
+	for _, field := range fields {
+		merged, conflicted := MergeText(field.base, field.local, field.remote, "proposed", remoteLabel)
+		*field.out = merged
+		if conflicted {
+			result.Conflicts = append(result.Conflicts, field.name)
+		}
+	}
+	return result
+}
+
+// hasConflictMarkers reports whether text still contains merge markers.
+func hasConflictMarkers(text string) bool {
+	for _, line := range splitLines(text) {
+		if strings.HasPrefix(line, conflictMarkerLocal) || strings.HasPrefix(line, conflictMarkerRemote) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeChunk replaces base lines [Start, End) with Lines. Pure insertions
+// have Start == End.
+type mergeChunk struct {
+	Start int
+	End   int
+	Lines []string
+}
+
+// MergeText performs a line-based three-way merge. Regions changed on only
+// one side take that side; regions changed differently on both sides are
+// wrapped in conflict markers.
+func MergeText(base, local, remote, localLabel, remoteLabel string) (string, bool) {
+	switch {
+	case local == remote, remote == base:
+		return local, false
+	case local == base:
+		return remote, false
+	}
+
+	baseLines := splitLines(base)
+	localChunks := changeChunks(diffLines(baseLines, splitLines(local)))
+	remoteChunks := changeChunks(diffLines(baseLines, splitLines(remote)))
+
+	var out []string
+	conflicted := false
+	pos, i, j := 0, 0, 0
+	for i < len(localChunks) || j < len(remoteChunks) {
+		// Start a region at the earliest pending chunk and grow it while
+		// chunks from either side touch it.
+		start := nextChunkStart(localChunks, i, remoteChunks, j)
+		end := start
+		li, rj := i, j
+		for {
+			grew := false
+			if li < len(localChunks) && localChunks[li].Start <= end {
+				end = max(end, localChunks[li].End)
+				li++
+				grew = true
+			}
+			if rj < len(remoteChunks) && remoteChunks[rj].Start <= end {
+				end = max(end, remoteChunks[rj].End)
+				rj++
+				grew = true
+			}
+			if !grew {
+				break
+			}
+		}
+
+		out = append(out, baseLines[pos:start]...)
+		localText := applyChunks(baseLines, localChunks[i:li], start, end)
+		remoteText := applyChunks(baseLines, remoteChunks[j:rj], start, end)
+		switch {
+		case li == i:
+			out = append(out, remoteText...)
+		case rj == j, slices.Equal(localText, remoteText):
+			out = append(out, localText...)
+		default:
+			conflicted = true
+			out = append(out, conflictMarkerLocal+localLabel)
+			out = append(out, localText...)
+			out = append(out, conflictMarkerSplit)
+			out = append(out, remoteText...)
+			out = append(out, conflictMarkerRemote+remoteLabel)
+		}
+
+		pos, i, j = end, li, rj
+	}
+	out = append(out, baseLines[pos:]...)
+
+	merged := strings.Join(out, "\n")
+	if len(out) > 0 && strings.HasSuffix(local, "\n") {
+		merged += "\n"
+	}
+	return merged, conflicted
+}
+
+// changeChunks collapses an edit script into runs of changed base lines.
+func changeChunks(edits []lineEdit) []mergeChunk {
+	var chunks []mergeChunk
+	var pending *mergeChunk
+	pos := 0
+	for _, e := range edits {
+		switch e.Op {
+		case opEqual:
+			if pending != nil {
+				chunks = append(chunks, *pending)
+				pending = nil
+			}
+			pos++
+		case opDelete:
+			if pending == nil {
+				pending = &mergeChunk{Start: pos, End: pos}
+			}
+			pos++
+			pending.End = pos
+		case opInsert:
+			if pending == nil {
+				pending = &mergeChunk{Start: pos, End: pos}
+			}
+			pending.Lines = append(pending.Lines, e.Text)
+		}
+	}
+	if pending != nil {
+		chunks = append(chunks, *pending)
+	}
+	return chunks
+}
+
+func nextChunkStart(local []mergeChunk, i int, remote []mergeChunk, j int) int {
+	switch {
+	case i >= len(local):
+		return remote[j].Start
+	case j >= len(remote):
+		return local[i].Start
+	default:
+		return min(local[i].Start, remote[j].Start)
+	}
+}
+
+// applyChunks returns one side's lines for base region [start, end).
+func applyChunks(base []string, chunks []mergeChunk, start, end int) []string {
+	var out []string
+	pos := start
+	for _, c := range chunks {
+		out = append(out, base[pos:c.Start]...)
+		out = append(out, c.Lines...)
+		pos = c.End
+	}
+	return append(out, base[pos:end]...)
+}
@@ -0,0 +1,46 @@
+package record_test
+
+import (
+	"testing"
+
+	"github.com/rpggio/trellis/internal/domain/record"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeText_OneSideChanged(t *testing.T) {
+	merged, conflicted := record.MergeText("a\nb\nc", "a\nB\nc", "a\nb\nc", "local", "remote")
+	require.False(t, conflicted)
+	require.Equal(t, "a\nB\nc", merged)
+
+	merged, conflicted = record.MergeText("a\nb\nc", "a\nb\nc", "a\nb\nC", "local", "remote")
+	require.False(t, conflicted)
+	require.Equal(t, "a\nb\nC", merged)
+}
+
+func TestMergeText_DisjointChanges(t *testing.T) {
+	base := "one\ntwo\nthree\nfour\nfive\nsix"
+	local := "ONE\ntwo\nthree\nfour\nfive\nsix\nseven"
+	remote := "one\ntwo\nthree\nFOUR\nfive\nsix"
+
+	merged, conflicted := record.MergeText(base, local, remote, "local", "remote")
+	require.False(t, conflicted)
+	require.Equal(t, "ONE\ntwo\nthree\nFOUR\nfive\nsix\nseven", merged)
+}
+
+func TestMergeText_SameChangeOnBothSides(t *testing.T) {
+	merged, conflicted := record.MergeText("a\nb\nc\nd", "a\nX\nc\nD", "a\nX\nc\nd", "local", "remote")
+	require.False(t, conflicted)
+	require.Equal(t, "a\nX\nc\nD", merged)
+}
+
+func TestMergeText_Conflict(t *testing.T) {
+	base := "intro\nplan: A\noutro\n"
+	local := "intro\nplan: B\noutro\n"
+	remote := "intro\nplan: C\noutro\n"
+
+	merged, conflicted := record.MergeText(base, local, remote, "proposed", "tick:7")
+	require.True(t, conflicted)
+	require.Equal(t, "intro\n"+
+		"<<<<<<< proposed\nplan: B\n=======\nplan: C\n>>>>>>> tick:7\n"+
+		"outro\n", merged)
+}
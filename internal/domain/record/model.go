@@ -12,6 +12,14 @@ const (
 	StateDiscarded RecordState = "DISCARDED"
 )
 
+// RecordStates lists the workflow states.
+var RecordStates = []RecordState{
+	StateOpen,
+	StateLater,
+	StateResolved,
+	StateDiscarded,
+}
+
 // Record represents a unit of design reasoning
 type Record struct {
 	ID         string      `json:"id"`
@@ -27,7 +35,53 @@ type Record struct {
 	CreatedAt  time.Time   `json:"created_at"`
 	ModifiedAt time.Time   `json:"modified_at"`
 	Tick       int64       `json:"tick"`
-	Related    []string    `json:"related,omitempty"`
+	Related    []string    `json:"related,omitempty"`   // targets of outgoing "relates" links
+	Links      []Link      `json:"links,omitempty"`     // outgoing links of every kind
+	Backlinks  []Link      `json:"backlinks,omitempty"` // links from other records to this one
+	DeletedAt  *time.Time  `json:"deleted_at,omitempty"`
+}
+
+// TrashEntry is a deleted record together with the count of descendants
+// that were trashed along with it and are restored with it.
+type TrashEntry struct {
+	Record      RecordRef `json:"record"`
+	DeletedAt   time.Time `json:"deleted_at"`
+	Descendants int       `json:"descendants"`
+}
+
+// PossibleDuplicate is an OPEN record whose title and summary closely match
+// those of a newly created record. Similarity is the share of words they
+// have in common, from 0 to 1.
+type PossibleDuplicate struct {
+	Record     RecordRef `json:"record"`
+	Similarity float64   `json:"similarity"`
+}
+
+// RelationKind names how a record relates to the record it links to.
+type RelationKind string
+
+const (
+	RelationRelates     RelationKind = "relates"
+	RelationBlocks      RelationKind = "blocks"
+	RelationSupersedes  RelationKind = "supersedes"
+	RelationDependsOn   RelationKind = "depends_on"
+	RelationDerivedFrom RelationKind = "derived_from"
+)
+
+// RelationKinds lists the supported relation kinds.
+var RelationKinds = []RelationKind{
+	RelationRelates,
+	RelationBlocks,
+	RelationSupersedes,
+	RelationDependsOn,
+	RelationDerivedFrom,
+}
+
+// Link is one end of a typed relation. On Record.Links RecordID is the
+// target; on Record.Backlinks it is the record the link comes from.
+type Link struct {
+	Kind     RelationKind `json:"kind"`
+	RecordID string       `json:"record_id"`
 }
 
 // RecordRef is a lightweight reference to a record
@@ -38,13 +92,71 @@ type RecordRef struct {
 	Summary           string      `json:"summary"`
 	State             RecordState `json:"state"`
 	ParentID          *string     `json:"parent_id,omitempty"`
+	ProjectID         string      `json:"project_id,omitempty"`   // set by List and Search
+	ProjectName       string      `json:"project_name,omitempty"` // set by List and Search
 	ChildrenCount     int         `json:"children_count"`
 	OpenChildrenCount int         `json:"open_children_count"`
+	SortKey           string      `json:"-"`                   // position in a List's sort order
+	Unchanged         bool        `json:"unchanged,omitempty"` // already sent to the session
+	Links             []Link      `json:"links,omitempty"`     // set by GetRef only
+	Backlinks         []Link      `json:"backlinks,omitempty"` // set by GetRef only
+	Ancestors         []Ancestor  `json:"ancestors,omitempty"` // set with IncludePath
+}
+
+// Ancestor is a record on the path from a root record down to another
+// record, as a breadcrumb.
+type Ancestor struct {
+	ID    string      `json:"id"`
+	Title string      `json:"title"`
+	Type  string      `json:"type"`
+	State RecordState `json:"state"`
 }
 
-// SearchResult represents a search hit with relevance
+// SearchResult represents a search hit with relevance. Rank is higher for
+// better matches. Highlight is the title and Snippet an excerpt of the body
+// around the matches, with matched terms marked **like this**.
 type SearchResult struct {
-	Record  RecordRef `json:"record"`
-	Rank    float64   `json:"rank"`
-	Snippet string    `json:"snippet,omitempty"`
+	Record    RecordRef `json:"record"`
+	Rank      float64   `json:"rank"`
+	Highlight string    `json:"highlight,omitempty"`
+	Snippet   string    `json:"snippet,omitempty"`
+}
+
+// TreeNode is a record in a tree of RecordRefs. Children holds the child
+// nodes down to the requested depth. Nodes at the depth limit are
+// collapsed: Descendants counts the records below them instead.
+type TreeNode struct {
+	Record      RecordRef   `json:"record"`
+	Children    []*TreeNode `json:"children,omitempty"`
+	Descendants int         `json:"descendant_count,omitempty"`
+}
+
+// ListResult is a page of listed records. NextCursor continues the listing
+// and is empty on the last page. Total counts every record matching the
+// listing. Changed counts the matching records written since the first
+// page was read; their positions may have moved.
+type ListResult struct {
+	Records    []RecordRef
+	NextCursor string
+	Total      int
+	Changed    int
+}
+
+// SearchPage is a page of search results. NextCursor continues the search
+// and is empty on the last page. Total counts every match.
+type SearchPage struct {
+	Results    []SearchResult
+	NextCursor string
+	Total      int
+}
+
+// SessionInfo provides information about an active session. Stale is set
+// when the sweeper found the session idle.
+type SessionInfo struct {
+	SessionID     string    `json:"session_id"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastActivity  time.Time `json:"last_activity"`
+	LastSyncTick  int64     `json:"last_sync_tick"`
+	Stale         bool      `json:"stale,omitempty"`
+	ActiveRecords []string  `json:"active_records,omitempty"`
 }
@@ -1,19 +1,59 @@
 package record
 
 // ListRecordsOptions provides filtering options for listing records.
+// ProjectID and ProjectIDs restrict the projects listed; with neither set
+// records of every project are listed. Cursor is a page token from a
+// previous ListResult; the service decodes it into After, which lists the
+// records following that position in Sort order. IncludePath sets each
+// ref's Ancestors.
 type ListRecordsOptions struct {
+	ProjectID    string
+	ProjectIDs   []string
+	IDs          []string
+	ParentID     *string
+	States       []RecordState
+	Types        []string
+	Sort         ListSort
+	Cursor       string
+	After        *Cursor
+	ChangedSince map[string]int64 // only records written after these project ticks
+	IncludePath  bool
+	Limit        int
+	Offset       int
+}
+
+// TreeOptions selects a tree of records: the subtree under RootID, or
+// every tree of ProjectID when RootID is empty. Depth counts levels below
+// RootID, or from the project's root records. States limits the tree to
+// records in those states; a record in another state is left out with its
+// subtree. RootID itself is always included.
+type TreeOptions struct {
 	ProjectID string
-	ParentID  *string
+	RootID    string
+	Depth     int
 	States    []RecordState
-	Types     []string
+}
+
+// ListTrashOptions provides filtering options for listing the trash.
+type ListTrashOptions struct {
+	ProjectID string
 	Limit     int
 	Offset    int
 }
 
-// SearchOptions provides filtering options for search.
+// SearchOptions provides filtering options for search. Results come from
+// the projects in ProjectIDs, or from every project when it is empty. Mode
+// defaults to SearchModeKeyword. Cursor is a page token from a previous
+// SearchPage and takes the place of Offset and ExistedAt. IncludePath sets
+// the Ancestors of each hit.
 type SearchOptions struct {
-	States []RecordState
-	Types  []string
-	Limit  int
-	Offset int
+	Mode        SearchMode
+	ProjectIDs  []string
+	States      []RecordState
+	Types       []string
+	Cursor      string
+	ExistedAt   map[string]int64 // only records that existed at these project ticks
+	IncludePath bool
+	Limit       int
+	Offset      int
 }
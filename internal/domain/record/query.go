@@ -0,0 +1,290 @@
+package record
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// QueryError describes where and why a search query failed to parse.
+// Offset is the byte offset of the offending input. It wraps
+// ErrInvalidQuery.
+type QueryError struct {
+	Offset  int
+	Message string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Message, e.Offset+1)
+}
+
+func (e *QueryError) Unwrap() error {
+	return ErrInvalidQuery
+}
+
+// QueryTerm is a word or quoted phrase of a search query. A Prefix term
+// matches any word starting with Text.
+type QueryTerm struct {
+	Text   string
+	Phrase bool
+	Prefix bool
+}
+
+// Query is a parsed search query. Every term must match, or any term when
+// MatchAny is set, and no excluded term may match; the field filters narrow
+// the results further.
+//
+// The syntax is whitespace separated words and "quoted phrases". A leading
+// - excludes a term and a trailing * matches a prefix. Field filters are
+// type:<type>, state:<state>, parent:<id> (parent:root for top-level
+// records) and modified>tick:<n> with >, >=, < or <=. Repeated type: and
+// state: filters match any of their values. Words that look like fields but
+// aren't one of these are searched as text.
+type Query struct {
+	Terms          []QueryTerm
+	Excluded       []QueryTerm
+	Types          []string
+	States         []RecordState
+	ParentID       *string // empty for top-level records
+	ModifiedAfter  *int64  // only records with a tick above this
+	ModifiedBefore *int64  // only records with a tick below this
+	MatchAny       bool    // match records containing any term, not all
+}
+
+// ParseQuery parses a search query. It returns a *QueryError describing the
+// first problem found.
+func ParseQuery(input string) (Query, error) {
+	p := queryParser{input: input}
+	if err := p.parse(); err != nil {
+		return Query{}, err
+	}
+	if p.query.empty() {
+		return Query{}, &QueryError{Offset: 0, Message: "query is empty"}
+	}
+	return p.query, nil
+}
+
+// HasText reports whether the query has terms to match against record text.
+func (q Query) HasText() bool {
+	return len(q.Terms) > 0
+}
+
+// FTSExpression returns the query terms as an FTS5 expression that matches
+// records containing all of them, or any of them with MatchAny. Every term
+// is quoted, so punctuation in the input can't change the expression's
+// meaning.
+func (q Query) FTSExpression() string {
+	if q.MatchAny {
+		return ftsJoin(q.Terms, " OR ")
+	}
+	return ftsJoin(q.Terms, " ")
+}
+
+// SubstringFTSExpression is FTSExpression for a trigram index, where every
+// term already matches anywhere inside a word, so prefixes need no marker.
+func (q Query) SubstringFTSExpression() string {
+	terms := make([]QueryTerm, len(q.Terms))
+	for i, term := range q.Terms {
+		terms[i] = QueryTerm{Text: term.Text, Phrase: term.Phrase}
+	}
+	sep := " "
+	if q.MatchAny {
+		sep = " OR "
+	}
+	return ftsJoin(terms, sep)
+}
+
+// ExcludedFTSExpression returns an FTS5 expression matching records that
+// contain any excluded term.
+func (q Query) ExcludedFTSExpression() string {
+	return ftsJoin(q.Excluded, " OR ")
+}
+
+func (q Query) empty() bool {
+	return len(q.Terms) == 0 && len(q.Excluded) == 0 && len(q.Types) == 0 &&
+		len(q.States) == 0 && q.ParentID == nil &&
+		q.ModifiedAfter == nil && q.ModifiedBefore == nil
+}
+
+func ftsJoin(terms []QueryTerm, sep string) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		parts[i] = `"` + strings.ReplaceAll(term.Text, `"`, `""`) + `"`
+		if term.Prefix {
+			parts[i] += "*"
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+// queryOperators are the field operators, longest first for matching.
+var queryOperators = []string{">=", "<=", ":", ">", "<"}
+
+type queryParser struct {
+	input string
+	pos   int
+	query Query
+}
+
+func (p *queryParser) parse() error {
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.input) {
+			return nil
+		}
+
+		start := p.pos
+		negated := false
+		if p.input[p.pos] == '-' {
+			p.pos++
+			if p.pos >= len(p.input) || isSpace(p.input[p.pos]) {
+				// A dash on its own is punctuation, not an exclusion.
+				continue
+			}
+			negated = true
+		}
+
+		if p.input[p.pos] == '"' {
+			text, err := p.quoted()
+			if err != nil {
+				return err
+			}
+			p.addTerm(QueryTerm{Text: text, Phrase: true}, negated)
+			continue
+		}
+
+		word := p.word()
+		if field, op, value, ok := splitField(word); ok {
+			valueStart := p.pos - len(value)
+			if value == "" && p.pos < len(p.input) && p.input[p.pos] == '"' {
+				valueStart = p.pos
+				quoted, err := p.quoted()
+				if err != nil {
+					return err
+				}
+				value = quoted
+			}
+			if negated {
+				return &QueryError{Offset: start, Message: fmt.Sprintf("%s filters can't be negated", field)}
+			}
+			if err := p.addFilter(field, op, value, start, valueStart); err != nil {
+				return err
+			}
+			continue
+		}
+
+		term := QueryTerm{Text: word}
+		if trimmed := strings.TrimRight(word, "*"); trimmed != word && trimmed != "" {
+			term = QueryTerm{Text: trimmed, Prefix: true}
+		}
+		p.addTerm(term, negated)
+	}
+}
+
+func (p *queryParser) addTerm(term QueryTerm, negated bool) {
+	if negated {
+		p.query.Excluded = append(p.query.Excluded, term)
+		return
+	}
+	p.query.Terms = append(p.query.Terms, term)
+}
+
+func (p *queryParser) addFilter(field, op, value string, start, valueStart int) error {
+	if value == "" {
+		return &QueryError{Offset: valueStart, Message: fmt.Sprintf("%s%s needs a value", field, op)}
+	}
+	if field != "modified" && op != ":" {
+		return &QueryError{Offset: start, Message: fmt.Sprintf("%s only supports %s:<value>", field, field)}
+	}
+
+	switch field {
+	case "type":
+		p.query.Types = append(p.query.Types, value)
+	case "state":
+		state := RecordState(strings.ToUpper(value))
+		switch state {
+		case StateOpen, StateLater, StateResolved, StateDiscarded:
+		default:
+			return &QueryError{Offset: valueStart, Message: fmt.Sprintf("unknown state %q (use open, later, resolved or discarded)", value)}
+		}
+		p.query.States = append(p.query.States, state)
+	case "parent":
+		parentID := value
+		if strings.EqualFold(value, "root") {
+			parentID = ""
+		}
+		p.query.ParentID = &parentID
+	case "modified":
+		if op == ":" {
+			return &QueryError{Offset: start, Message: "modified needs a comparison such as modified>tick:120"}
+		}
+		tick, err := strconv.ParseInt(strings.TrimPrefix(strings.ToLower(value), "tick:"), 10, 64)
+		if err != nil || tick < 0 {
+			return &QueryError{Offset: valueStart, Message: fmt.Sprintf("invalid tick %q (use modified%stick:<number>)", value, op)}
+		}
+		switch op {
+		case ">":
+			p.query.ModifiedAfter = &tick
+		case ">=":
+			tick--
+			p.query.ModifiedAfter = &tick
+		case "<":
+			p.query.ModifiedBefore = &tick
+		case "<=":
+			tick++
+			p.query.ModifiedBefore = &tick
+		}
+	}
+	return nil
+}
+
+// quoted reads a quoted phrase starting at the opening quote.
+func (p *queryParser) quoted() (string, error) {
+	start := p.pos
+	end := strings.IndexByte(p.input[start+1:], '"')
+	if end < 0 {
+		return "", &QueryError{Offset: start, Message: "unterminated quote"}
+	}
+	text := p.input[start+1 : start+1+end]
+	p.pos = start + end + 2
+	if strings.TrimSpace(text) == "" {
+		return "", &QueryError{Offset: start, Message: "empty phrase"}
+	}
+	return text, nil
+}
+
+// word reads up to the next space or quote.
+func (p *queryParser) word() string {
+	start := p.pos
+	for p.pos < len(p.input) && !isSpace(p.input[p.pos]) && p.input[p.pos] != '"' {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.input) && isSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+// splitField splits a word such as "state:open" or "modified>tick:3" into
+// a known field, its operator and the value.
+func splitField(word string) (field, op, value string, ok bool) {
+	for _, name := range []string{"type", "state", "parent", "modified"} {
+		if len(word) <= len(name) || !strings.EqualFold(word[:len(name)], name) {
+			continue
+		}
+		rest := word[len(name):]
+		for _, candidate := range queryOperators {
+			if strings.HasPrefix(rest, candidate) {
+				return name, candidate, rest[len(candidate):], true
+			}
+		}
+	}
+	return "", "", "", false
+}
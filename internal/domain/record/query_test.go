@@ -0,0 +1,76 @@
+package record_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rpggio/trellis/internal/domain/record"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQuery_FieldsAndTerms(t *testing.T) {
+	q, err := record.ParseQuery(`type:question state:open parent:abc modified>tick:120 "cache invalidation" -redis stale*`)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"question"}, q.Types)
+	require.Equal(t, []record.RecordState{record.StateOpen}, q.States)
+	require.Equal(t, "abc", *q.ParentID)
+	require.Equal(t, int64(120), *q.ModifiedAfter)
+	require.Nil(t, q.ModifiedBefore)
+	require.Equal(t, []record.QueryTerm{
+		{Text: "cache invalidation", Phrase: true},
+		{Text: "stale", Prefix: true},
+	}, q.Terms)
+	require.Equal(t, []record.QueryTerm{{Text: "redis"}}, q.Excluded)
+	require.Equal(t, `"cache invalidation" "stale"*`, q.FTSExpression())
+	require.Equal(t, `"redis"`, q.ExcludedFTSExpression())
+}
+
+func TestParseQuery_EscapesText(t *testing.T) {
+	q, err := record.ParseQuery(`write-through (cache) AND say:"hi" - note: NEAR(a b)`)
+	require.NoError(t, err)
+	require.Empty(t, q.Excluded)
+	require.Equal(t, `"write-through" "(cache)" "AND" "say:" "hi" "note:" "NEAR(a" "b)"`, q.FTSExpression())
+}
+
+func TestParseQuery_TickComparisons(t *testing.T) {
+	q, err := record.ParseQuery("modified>=tick:10 modified<=20")
+	require.NoError(t, err)
+	require.Equal(t, int64(9), *q.ModifiedAfter)
+	require.Equal(t, int64(21), *q.ModifiedBefore)
+	require.False(t, q.HasText())
+
+	q, err = record.ParseQuery("parent:ROOT State:Later")
+	require.NoError(t, err)
+	require.Equal(t, "", *q.ParentID)
+	require.Equal(t, []record.RecordState{record.StateLater}, q.States)
+}
+
+func TestParseQuery_Errors(t *testing.T) {
+	tests := []struct {
+		query   string
+		message string
+		offset  int
+	}{
+		{query: "", message: "query is empty"},
+		{query: `cache "invalidation`, message: "unterminated quote", offset: 6},
+		{query: "state:pending", message: `unknown state "pending"`, offset: 6},
+		{query: "modified>tick:soon", message: `invalid tick "tick:soon"`, offset: 9},
+		{query: "modified:tick:3", message: "modified needs a comparison"},
+		{query: "cache type:", message: "type: needs a value", offset: 11},
+		{query: "-type:note", message: "type filters can't be negated"},
+		{query: "state>open", message: "state only supports state:<value>"},
+		{query: `x ""`, message: "empty phrase", offset: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := record.ParseQuery(tt.query)
+			require.ErrorIs(t, err, record.ErrInvalidQuery)
+
+			var queryErr *record.QueryError
+			require.True(t, errors.As(err, &queryErr))
+			require.Contains(t, queryErr.Message, tt.message)
+			require.Equal(t, tt.offset, queryErr.Offset)
+		})
+	}
+}
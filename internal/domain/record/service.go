@@ -2,9 +2,13 @@ package record
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rpggio/trellis/internal/domain/activity"
@@ -19,16 +23,21 @@ type Service struct {
 	projects   ProjectRepository
 	activities ActivityRepository
 	search     SearchRepository
+	embedder   Embedder
+	tx         repository.Transactor
 	logger     *slog.Logger
 }
 
-// NewService creates a new record service.
+// NewService creates a new record service. Semantic search is disabled
+// when embedder is nil.
 func NewService(
 	records RecordRepository,
 	sessions SessionRepository,
 	projects ProjectRepository,
 	activities ActivityRepository,
 	search SearchRepository,
+	embedder Embedder,
+	tx repository.Transactor,
 	logger *slog.Logger,
 ) *Service {
 	return &Service{
@@ -37,6 +46,8 @@ func NewService(
 		projects:   projects,
 		activities: activities,
 		search:     search,
+		embedder:   embedder,
+		tx:         tx,
 		logger:     logger,
 	}
 }
@@ -54,7 +65,9 @@ type CreateRequest struct {
 	Related   []string
 }
 
-// UpdateRequest describes a record update request.
+// UpdateRequest describes a record update request. Force writes over
+// changes made since activation; Override writes even though the record is
+// active in other sessions.
 type UpdateRequest struct {
 	SessionID string
 	ID        string
@@ -63,6 +76,39 @@ type UpdateRequest struct {
 	Body      *string
 	Related   []string
 	Force     bool
+	Override  bool
+}
+
+// DiffRequest describes a comparison between two versions of a record.
+// From and To are version references: a tick number, "current", "previous"
+// (the version before current), or "activation" (the version the session
+// activated). An empty To means "current".
+type DiffRequest struct {
+	SessionID string
+	ID        string
+	From      string
+	To        string
+}
+
+// RevertRequest describes restoring a record to the version it had at Tick.
+type RevertRequest struct {
+	SessionID string
+	ID        string
+	Tick      int64
+	Force     bool
+	Override  bool
+}
+
+// ResolveConflictRequest describes a merged version submitted after an
+// update conflict. Nil fields keep the remote value.
+type ResolveConflictRequest struct {
+	SessionID  string
+	ID         string
+	RemoteTick int64
+	Title      *string
+	Summary    *string
+	Body       *string
+	Override   bool
 }
 
 // TransitionRequest describes a state transition request.
@@ -72,10 +118,68 @@ type TransitionRequest struct {
 	ToState    RecordState
 	Reason     *string
 	ResolvedBy *string
+	Override   bool
+}
+
+// MoveRequest describes moving a record under a new parent. A nil or empty
+// ParentID moves the record to the root of its project.
+type MoveRequest struct {
+	SessionID string
+	ID        string
+	ParentID  *string
+	Force     bool
+	Override  bool
+}
+
+// LinkRequest describes adding or removing a typed link from FromID to
+// ToID. An empty Kind means RelationRelates.
+type LinkRequest struct {
+	SessionID string
+	FromID    string
+	ToID      string
+	Kind      RelationKind
+}
+
+// DeleteRequest describes moving a record and its subtree to the trash.
+type DeleteRequest struct {
+	SessionID string
+	ID        string
+	Force     bool
+	Override  bool
+}
+
+// RestoreRequest describes taking a deleted record out of the trash. When
+// SessionID is set the restored record is activated in that session.
+type RestoreRequest struct {
+	SessionID string
+	ID        string
+}
+
+// FindSimilarRequest names what to find similar records for: an existing
+// record by ID, or draft text.
+type FindSimilarRequest struct {
+	ID   string
+	Text string
+}
+
+// Create creates a new record with validation and tick increment. It also
+// returns OPEN records of the project that look like duplicates of the new
+// one; they are warnings and don't prevent the create.
+func (s *Service) Create(ctx context.Context, tenantID string, req CreateRequest) (*Record, []PossibleDuplicate, error) {
+	var rec *Record
+	err := s.withinTx(ctx, func(ctx context.Context) error {
+		var err error
+		rec, err = s.create(ctx, tenantID, req)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	s.indexEmbedding(ctx, rec)
+	return rec, s.possibleDuplicates(ctx, tenantID, rec), nil
 }
 
-// Create creates a new record with validation and tick increment.
-func (s *Service) Create(ctx context.Context, tenantID string, req CreateRequest) (*Record, error) {
+func (s *Service) create(ctx context.Context, tenantID string, req CreateRequest) (*Record, error) {
 	if err := ValidateCreateInput(req); err != nil {
 		return nil, err
 	}
@@ -124,16 +228,19 @@ func (s *Service) Create(ctx context.Context, tenantID string, req CreateRequest
 		if err := s.sessions.AddActivation(ctx, req.SessionID, rec.ID, rec.Tick); err != nil {
 			return nil, fmt.Errorf("adding activation: %w", err)
 		}
+		if err := s.touchSession(ctx, tenantID, req.SessionID, rec.Tick); err != nil {
+			return nil, err
+		}
 	}
 
-	if s.activities != nil {
-		_ = s.activities.Log(ctx, tenantID, &activity.ActivityEntry{
-			ProjectID:    rec.ProjectID,
-			RecordID:     &rec.ID,
-			ActivityType: activity.TypeRecordCreated,
-			Summary:      fmt.Sprintf("created record %s", rec.ID),
-			Tick:         rec.Tick,
-		})
+	if err := s.logActivity(ctx, tenantID, &activity.ActivityEntry{
+		ProjectID:    rec.ProjectID,
+		RecordID:     &rec.ID,
+		ActivityType: activity.TypeRecordCreated,
+		Summary:      fmt.Sprintf("created record %s", rec.ID),
+		Tick:         rec.Tick,
+	}); err != nil {
+		return nil, err
 	}
 
 	return rec, nil
@@ -141,203 +248,1448 @@ func (s *Service) Create(ctx context.Context, tenantID string, req CreateRequest
 
 // Update modifies an active record and performs conflict detection.
 func (s *Service) Update(ctx context.Context, tenantID string, req UpdateRequest) (*Record, *ConflictInfo, error) {
+	return s.mutate(ctx, func(ctx context.Context) (*Record, *ConflictInfo, error) {
+		return s.update(ctx, tenantID, req)
+	})
+}
+
+func (s *Service) update(ctx context.Context, tenantID string, req UpdateRequest) (*Record, *ConflictInfo, error) {
 	if req.SessionID == "" || req.ID == "" {
 		return nil, nil, ErrInvalidInput
 	}
 
-	if err := s.ensureActivated(ctx, tenantID, req.SessionID, req.ID, ErrNotActivated); err != nil {
+	current, conflict, err := s.loadForWrite(ctx, tenantID, req.SessionID, req.ID, req.Force, req.Override)
+	if err != nil {
 		return nil, nil, err
 	}
-
-	current, err := s.records.Get(ctx, tenantID, req.ID)
-	if err != nil {
-		if errors.Is(err, repository.ErrNotFound) {
-			return nil, nil, ErrRecordNotFound
+	if conflict != nil {
+		if conflict.BaseVersion != nil {
+			local := *conflict.BaseVersion
+			applyUpdate(&local, req)
+			conflict.LocalVersion = &local
+			conflict.Merge = mergeVersions(conflict.BaseVersion, &local, conflict.RemoteVersion)
 		}
-		return nil, nil, fmt.Errorf("loading record: %w", err)
+		return nil, conflict, nil
+	}
+
+	updated := *current
+	applyUpdate(&updated, req)
+
+	if err := s.writeVersion(ctx, tenantID, req.SessionID, current, &updated, "updating record"); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.logActivity(ctx, tenantID, &activity.ActivityEntry{
+		ProjectID:    updated.ProjectID,
+		RecordID:     &updated.ID,
+		ActivityType: activity.TypeRecordUpdated,
+		Summary:      fmt.Sprintf("updated record %s", updated.ID),
+		Tick:         updated.Tick,
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	return &updated, nil, nil
+}
+
+// Revert restores the content and state a record had at an earlier tick.
+// The restored version is written as a new change with its own tick, so the
+// overwritten version stays in history and the revert itself can be undone.
+func (s *Service) Revert(ctx context.Context, tenantID string, req RevertRequest) (*Record, *ConflictInfo, error) {
+	return s.mutate(ctx, func(ctx context.Context) (*Record, *ConflictInfo, error) {
+		return s.revert(ctx, tenantID, req)
+	})
+}
+
+func (s *Service) revert(ctx context.Context, tenantID string, req RevertRequest) (*Record, *ConflictInfo, error) {
+	if req.SessionID == "" || req.ID == "" || req.Tick <= 0 {
+		return nil, nil, ErrInvalidInput
+	}
+
+	current, conflict, err := s.loadForWrite(ctx, tenantID, req.SessionID, req.ID, req.Force, req.Override)
+	if err != nil || conflict != nil {
+		return nil, conflict, err
 	}
 
-	activationTick, err := s.sessions.GetActivationTick(ctx, req.SessionID, req.ID)
+	target, err := s.versionAt(ctx, tenantID, current, req.Tick)
 	if err != nil {
-		if errors.Is(err, repository.ErrNotFound) {
-			return nil, nil, ErrNotActivated
+		return nil, nil, err
+	}
+	if target.Tick == current.Tick {
+		return current, nil, nil
+	}
+
+	updated := *current
+	updated.Title = target.Title
+	updated.Summary = target.Summary
+	updated.Body = target.Body
+	updated.State = target.State
+	updated.ResolvedBy = target.ResolvedBy
+
+	// A state change must be one transition would allow.
+	if updated.State != current.State {
+		reason := fmt.Sprintf("reverted to tick %d", target.Tick)
+		if err := ValidateTransition(current.State, updated.State, &reason, updated.ResolvedBy); err != nil {
+			return nil, nil, err
 		}
-		return nil, nil, fmt.Errorf("loading activation tick: %w", err)
 	}
 
-	if activationTick != current.Tick && !req.Force {
-		return nil, &ConflictInfo{
-			ConflictType:  "update",
-			LocalVersion:  nil,
-			RemoteVersion: current,
-			Message:       "record modified since activation",
-		}, nil
+	if err := s.writeVersion(ctx, tenantID, req.SessionID, current, &updated, "reverting record"); err != nil {
+		return nil, nil, err
 	}
 
-	updated := *current
-	if req.Title != nil {
-		updated.Title = *req.Title
+	details, _ := json.Marshal(map[string]int64{"reverted_to_tick": target.Tick})
+	if err := s.logActivity(ctx, tenantID, &activity.ActivityEntry{
+		ProjectID:    updated.ProjectID,
+		RecordID:     &updated.ID,
+		ActivityType: activity.TypeRecordReverted,
+		Summary:      fmt.Sprintf("reverted record %s to tick %d", updated.ID, target.Tick),
+		Details:      string(details),
+		Tick:         updated.Tick,
+	}); err != nil {
+		return nil, nil, err
 	}
-	if req.Summary != nil {
-		updated.Summary = *req.Summary
+
+	return &updated, nil, nil
+}
+
+// ResolveConflict writes a merged version of a record after an update
+// conflict. RemoteTick is the tick of the remote version the merge was made
+// against; if the record has moved on since, a new conflict is returned.
+func (s *Service) ResolveConflict(ctx context.Context, tenantID string, req ResolveConflictRequest) (*Record, *ConflictInfo, error) {
+	return s.mutate(ctx, func(ctx context.Context) (*Record, *ConflictInfo, error) {
+		return s.resolveConflict(ctx, tenantID, req)
+	})
+}
+
+func (s *Service) resolveConflict(ctx context.Context, tenantID string, req ResolveConflictRequest) (*Record, *ConflictInfo, error) {
+	if req.SessionID == "" || req.ID == "" || req.RemoteTick <= 0 {
+		return nil, nil, ErrInvalidInput
 	}
-	if req.Body != nil {
-		updated.Body = *req.Body
+
+	for _, field := range []*string{req.Title, req.Summary, req.Body} {
+		if field != nil && hasConflictMarkers(*field) {
+			return nil, nil, ErrUnresolvedConflict
+		}
 	}
-	if req.Related != nil {
-		updated.Related = req.Related
+
+	if err := s.ensureActivated(ctx, tenantID, req.SessionID, req.ID, ErrNotActivated); err != nil {
+		return nil, nil, err
 	}
-	updated.ModifiedAt = time.Now()
 
-	newTick, err := s.projects.IncrementTick(ctx, tenantID, current.ProjectID)
+	current, err := s.records.Get(ctx, tenantID, req.ID)
 	if err != nil {
-		return nil, nil, fmt.Errorf("incrementing tick: %w", err)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, ErrRecordNotFound
+		}
+		return nil, nil, fmt.Errorf("loading record: %w", err)
 	}
-	updated.Tick = newTick
 
-	if err := s.records.Update(ctx, tenantID, &updated, current.Tick); err != nil {
-		if errors.Is(err, repository.ErrConflict) {
-			return nil, nil, ErrConflict
+	resolved := UpdateRequest{Title: req.Title, Summary: req.Summary, Body: req.Body}
+	if current.Tick != req.RemoteTick {
+		conflict := &ConflictInfo{
+			ConflictType:  ConflictUpdate,
+			RemoteVersion: current,
+			Message:       "record modified again since the merged version",
 		}
-		return nil, nil, fmt.Errorf("updating record: %w", err)
+		base, err := s.versionAt(ctx, tenantID, current, req.RemoteTick)
+		if err != nil && !errors.Is(err, ErrVersionNotFound) {
+			return nil, nil, err
+		}
+		if base != nil {
+			local := *base
+			applyUpdate(&local, resolved)
+			conflict.BaseVersion = base
+			conflict.LocalVersion = &local
+			conflict.Merge = mergeVersions(base, &local, current)
+		}
+		return nil, conflict, nil
+	}
+
+	conflict, err := s.checkConcurrentSessions(ctx, tenantID, req.SessionID, current, req.Override)
+	if err != nil || conflict != nil {
+		return nil, conflict, err
+	}
+
+	updated := *current
+	applyUpdate(&updated, resolved)
+
+	if err := s.writeVersion(ctx, tenantID, req.SessionID, current, &updated, "resolving conflict"); err != nil {
+		return nil, nil, err
 	}
 
-	if s.activities != nil {
-		_ = s.activities.Log(ctx, tenantID, &activity.ActivityEntry{
-			ProjectID:    updated.ProjectID,
-			RecordID:     &updated.ID,
-			ActivityType: activity.TypeRecordUpdated,
-			Summary:      fmt.Sprintf("updated record %s", updated.ID),
-			Tick:         updated.Tick,
-		})
+	details, _ := json.Marshal(map[string]any{
+		"conflict_type": ConflictUpdate,
+		"remote_tick":   req.RemoteTick,
+	})
+	if err := s.logActivity(ctx, tenantID, &activity.ActivityEntry{
+		ProjectID:    updated.ProjectID,
+		SessionID:    &req.SessionID,
+		RecordID:     &updated.ID,
+		ActivityType: activity.TypeConflictResolved,
+		Summary:      fmt.Sprintf("resolved conflict on record %s", updated.ID),
+		Details:      string(details),
+		Tick:         updated.Tick,
+	}); err != nil {
+		return nil, nil, err
 	}
 
 	return &updated, nil, nil
 }
 
 // Transition updates a record state with validation.
-func (s *Service) Transition(ctx context.Context, tenantID string, req TransitionRequest) (*Record, error) {
+func (s *Service) Transition(ctx context.Context, tenantID string, req TransitionRequest) (*Record, *ConflictInfo, error) {
+	return s.mutate(ctx, func(ctx context.Context) (*Record, *ConflictInfo, error) {
+		return s.transition(ctx, tenantID, req)
+	})
+}
+
+func (s *Service) transition(ctx context.Context, tenantID string, req TransitionRequest) (*Record, *ConflictInfo, error) {
 	if req.SessionID == "" || req.ID == "" {
-		return nil, ErrInvalidInput
+		return nil, nil, ErrInvalidInput
 	}
 
 	if err := s.ensureActivated(ctx, tenantID, req.SessionID, req.ID, ErrNotActivated); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	current, err := s.records.Get(ctx, tenantID, req.ID)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
-			return nil, ErrRecordNotFound
+			return nil, nil, ErrRecordNotFound
 		}
-		return nil, fmt.Errorf("loading record: %w", err)
+		return nil, nil, fmt.Errorf("loading record: %w", err)
 	}
 
 	if err := ValidateTransition(current.State, req.ToState, req.Reason, req.ResolvedBy); err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	conflict, err := s.checkConcurrentSessions(ctx, tenantID, req.SessionID, current, req.Override)
+	if err != nil || conflict != nil {
+		return nil, conflict, err
 	}
 
 	updated := *current
 	updated.State = req.ToState
-	updated.ModifiedAt = time.Now()
 	updated.ResolvedBy = req.ResolvedBy
 
-	newTick, err := s.projects.IncrementTick(ctx, tenantID, current.ProjectID)
-	if err != nil {
-		return nil, fmt.Errorf("incrementing tick: %w", err)
+	if err := s.writeVersion(ctx, tenantID, req.SessionID, current, &updated, "transitioning record"); err != nil {
+		return nil, nil, err
 	}
-	updated.Tick = newTick
 
-	if err := s.records.Update(ctx, tenantID, &updated, current.Tick); err != nil {
-		if errors.Is(err, repository.ErrConflict) {
-			return nil, ErrConflict
-		}
-		return nil, fmt.Errorf("transitioning record: %w", err)
+	if err := s.logActivity(ctx, tenantID, &activity.ActivityEntry{
+		ProjectID:    updated.ProjectID,
+		RecordID:     &updated.ID,
+		ActivityType: activity.TypeStateTransition,
+		Summary:      fmt.Sprintf("transitioned record %s", updated.ID),
+		Tick:         updated.Tick,
+	}); err != nil {
+		return nil, nil, err
 	}
 
-	if s.activities != nil {
-		_ = s.activities.Log(ctx, tenantID, &activity.ActivityEntry{
-			ProjectID:    updated.ProjectID,
-			RecordID:     &updated.ID,
-			ActivityType: activity.TypeStateTransition,
-			Summary:      fmt.Sprintf("transitioned record %s", updated.ID),
-			Tick:         updated.Tick,
-		})
-	}
+	return &updated, nil, nil
+}
 
-	return &updated, nil
+// Move reparents an activated record. The new parent must be activated in
+// the same session, belong to the same project and not be the record itself
+// or one of its descendants. The descendants move with the record, so one
+// active in another session conflicts like the record itself.
+func (s *Service) Move(ctx context.Context, tenantID string, req MoveRequest) (*Record, *ConflictInfo, error) {
+	return s.mutate(ctx, func(ctx context.Context) (*Record, *ConflictInfo, error) {
+		return s.move(ctx, tenantID, req)
+	})
 }
 
-// Get returns a record by ID.
-func (s *Service) Get(ctx context.Context, tenantID, id string) (*Record, error) {
-	rec, err := s.records.Get(ctx, tenantID, id)
-	if err != nil {
-		if errors.Is(err, repository.ErrNotFound) {
-			return nil, ErrRecordNotFound
+func (s *Service) move(ctx context.Context, tenantID string, req MoveRequest) (*Record, *ConflictInfo, error) {
+	if req.SessionID == "" || req.ID == "" {
+		return nil, nil, ErrInvalidInput
+	}
+	newParentID := req.ParentID
+	if newParentID != nil && *newParentID == "" {
+		newParentID = nil
+	}
+
+	current, conflict, err := s.loadForWrite(ctx, tenantID, req.SessionID, req.ID, req.Force, req.Override)
+	if err != nil || conflict != nil {
+		return nil, conflict, err
+	}
+
+	if newParentID != nil {
+		if err := s.ensureActivated(ctx, tenantID, req.SessionID, *newParentID, ErrParentNotActivated); err != nil {
+			return nil, nil, err
+		}
+		if err := s.checkMoveTarget(ctx, tenantID, current, *newParentID); err != nil {
+			return nil, nil, err
 		}
-		return nil, fmt.Errorf("getting record: %w", err)
 	}
-	return rec, nil
-}
 
-// GetRef returns a lightweight record reference with child counts.
-func (s *Service) GetRef(ctx context.Context, tenantID, id string) (RecordRef, error) {
-	rec, err := s.records.Get(ctx, tenantID, id)
+	oldParentID := current.ParentID
+	if stringValue(oldParentID) == stringValue(newParentID) {
+		return current, nil, nil
+	}
+
+	subtree, err := s.liveSubtree(ctx, tenantID, current)
 	if err != nil {
-		if errors.Is(err, repository.ErrNotFound) {
-			return RecordRef{}, ErrRecordNotFound
+		return nil, nil, err
+	}
+	for i := 1; i < len(subtree); i++ {
+		conflict, err := s.checkConcurrentSessions(ctx, tenantID, req.SessionID, &subtree[i], req.Override)
+		if err != nil || conflict != nil {
+			return nil, conflict, err
 		}
-		return RecordRef{}, fmt.Errorf("getting record: %w", err)
 	}
 
-	childRefs, err := s.records.GetChildrenRefs(ctx, tenantID, id)
-	if err != nil {
-		return RecordRef{}, fmt.Errorf("getting children: %w", err)
+	updated := *current
+	updated.ParentID = newParentID
+
+	if err := s.writeVersion(ctx, tenantID, req.SessionID, current, &updated, "moving record"); err != nil {
+		return nil, nil, err
 	}
 
-	openCount := 0
-	for _, ref := range childRefs {
-		if ref.State == StateOpen {
-			openCount++
-		}
+	details, _ := json.Marshal(map[string]*string{
+		"old_parent_id": oldParentID,
+		"new_parent_id": newParentID,
+	})
+	if err := s.logActivity(ctx, tenantID, &activity.ActivityEntry{
+		ProjectID:    updated.ProjectID,
+		SessionID:    &req.SessionID,
+		RecordID:     &updated.ID,
+		ActivityType: activity.TypeRecordMoved,
+		Summary:      fmt.Sprintf("moved record %s", updated.ID),
+		Details:      string(details),
+		Tick:         updated.Tick,
+	}); err != nil {
+		return nil, nil, err
 	}
 
-	return RecordRef{
-		ID:                rec.ID,
-		Type:              rec.Type,
-		Title:             rec.Title,
-		Summary:           rec.Summary,
-		State:             rec.State,
-		ParentID:          rec.ParentID,
-		ChildrenCount:     len(childRefs),
-		OpenChildrenCount: openCount,
-	}, nil
+	return &updated, nil, nil
 }
 
-// List returns record references based on options.
-func (s *Service) List(ctx context.Context, tenantID string, opts ListRecordsOptions) ([]RecordRef, error) {
-	return s.records.List(ctx, tenantID, opts)
+// Link adds a typed link from an activated record to another record and
+// returns the source record with its links. The source record takes a new
+// tick, so sessions holding it see the link as a change.
+func (s *Service) Link(ctx context.Context, tenantID string, req LinkRequest) (*Record, error) {
+	if req.Kind == "" {
+		req.Kind = RelationRelates
+	}
+	if err := ValidateLink(req); err != nil {
+		return nil, err
+	}
+
+	var rec *Record
+	err := s.withinTx(ctx, func(ctx context.Context) error {
+		from, err := s.loadLinkSource(ctx, tenantID, req)
+		if err != nil {
+			return err
+		}
+		if _, err := s.Get(ctx, tenantID, req.ToID); err != nil {
+			return err
+		}
+
+		if err := s.records.AddRelation(ctx, req.FromID, req.ToID, req.Kind); err != nil {
+			return fmt.Errorf("adding relation: %w", err)
+		}
+		if err := s.writeLink(ctx, tenantID, req, from, activity.TypeRecordLinked); err != nil {
+			return err
+		}
+
+		rec, err = s.Get(ctx, tenantID, req.FromID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
 }
 
-// Search runs full-text search.
-func (s *Service) Search(ctx context.Context, tenantID, projectID, query string, opts SearchOptions) ([]SearchResult, error) {
-	if s.search == nil {
-		return nil, fmt.Errorf("search repository not configured")
+// Unlink removes a typed link from an activated record and returns the
+// source record with its remaining links. Like Link, it gives the source
+// record a new tick.
+func (s *Service) Unlink(ctx context.Context, tenantID string, req LinkRequest) (*Record, error) {
+	if req.Kind == "" {
+		req.Kind = RelationRelates
+	}
+	if err := ValidateLink(req); err != nil {
+		return nil, err
+	}
+
+	var rec *Record
+	err := s.withinTx(ctx, func(ctx context.Context) error {
+		from, err := s.loadLinkSource(ctx, tenantID, req)
+		if err != nil {
+			return err
+		}
+
+		if err := s.records.RemoveRelation(ctx, req.FromID, req.ToID, req.Kind); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return ErrRelationNotFound
+			}
+			return fmt.Errorf("removing relation: %w", err)
+		}
+		if err := s.writeLink(ctx, tenantID, req, from, activity.TypeRecordUnlinked); err != nil {
+			return err
+		}
+
+		rec, err = s.Get(ctx, tenantID, req.FromID)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	return s.search.Search(ctx, tenantID, projectID, query, opts)
+	return rec, nil
 }
 
-func (s *Service) ensureActivated(ctx context.Context, tenantID, sessionID, recordID string, errIfMissing error) error {
-	activations, err := s.sessions.GetActivations(ctx, sessionID)
+// Delete moves an activated record and all of its descendants to the trash.
+// Trashed records are hidden from reads until restored or purged. Each
+// trashed record gets a new tick and keeps its last version in history, and
+// a descendant active in another session conflicts like the record itself.
+func (s *Service) Delete(ctx context.Context, tenantID string, req DeleteRequest) (*TrashEntry, *ConflictInfo, error) {
+	if req.SessionID == "" || req.ID == "" {
+		return nil, nil, ErrInvalidInput
+	}
+
+	var entry *TrashEntry
+	var conflict *ConflictInfo
+	err := s.withinTx(ctx, func(ctx context.Context) error {
+		current, c, err := s.loadForWrite(ctx, tenantID, req.SessionID, req.ID, req.Force, req.Override)
+		if err != nil || c != nil {
+			conflict = c
+			return err
+		}
+
+		subtree, err := s.liveSubtree(ctx, tenantID, current)
+		if err != nil {
+			return err
+		}
+		for i := 1; i < len(subtree); i++ {
+			c, err := s.checkConcurrentSessions(ctx, tenantID, req.SessionID, &subtree[i], req.Override)
+			if err != nil || c != nil {
+				conflict = c
+				return err
+			}
+		}
+
+		deleted := make([]Record, len(subtree))
+		for i := range subtree {
+			deleted[i] = subtree[i]
+			if err := s.writeVersion(ctx, tenantID, req.SessionID, &subtree[i], &deleted[i], "deleting record"); err != nil {
+				return err
+			}
+		}
+
+		deletedAt := time.Now()
+		count, err := s.records.SoftDelete(ctx, tenantID, current.ID, deletedAt)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return ErrRecordNotFound
+			}
+			return fmt.Errorf("deleting record: %w", err)
+		}
+
+		for i, rec := range deleted {
+			logEntry := &activity.ActivityEntry{
+				ProjectID:    rec.ProjectID,
+				SessionID:    &req.SessionID,
+				RecordID:     &deleted[i].ID,
+				ActivityType: activity.TypeRecordDeleted,
+				Summary:      fmt.Sprintf("deleted record %s with %s", rec.ID, current.ID),
+				Tick:         rec.Tick,
+			}
+			if i == 0 {
+				details, _ := json.Marshal(map[string]int{"deleted_count": count})
+				logEntry.Summary = fmt.Sprintf("deleted record %s", rec.ID)
+				logEntry.Details = string(details)
+			}
+			if err := s.logActivity(ctx, tenantID, logEntry); err != nil {
+				return err
+			}
+		}
+
+		entry = &TrashEntry{
+			Record: RecordRef{
+				ID:       current.ID,
+				Type:     current.Type,
+				Title:    current.Title,
+				Summary:  current.Summary,
+				State:    current.State,
+				ParentID: current.ParentID,
+			},
+			DeletedAt:   deletedAt,
+			Descendants: count - 1,
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("loading activations: %w", err)
+		return nil, nil, err
 	}
+	return entry, conflict, nil
+}
 
-	for _, active := range activations {
-		if active == recordID {
-			return nil
+// liveSubtree returns root followed by its live descendants, parents before
+// children.
+func (s *Service) liveSubtree(ctx context.Context, tenantID string, root *Record) ([]Record, error) {
+	subtree := []Record{*root}
+	for i := 0; i < len(subtree); i++ {
+		children, err := s.records.GetChildren(ctx, tenantID, subtree[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("loading children: %w", err)
 		}
+		subtree = append(subtree, children...)
 	}
+	return subtree, nil
+}
 
-	return errIfMissing
+// Restore takes a deleted record and the descendants deleted with it out of
+// the trash, writing each at a new tick. A record whose parent is still in
+// the trash can't be restored on its own.
+func (s *Service) Restore(ctx context.Context, tenantID string, req RestoreRequest) (*Record, error) {
+	if req.ID == "" {
+		return nil, ErrInvalidInput
+	}
+
+	var rec *Record
+	err := s.withinTx(ctx, func(ctx context.Context) error {
+		trashed, err := s.records.GetTrashed(ctx, tenantID, req.ID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return ErrNotInTrash
+			}
+			return fmt.Errorf("loading trashed record: %w", err)
+		}
+
+		if trashed.ParentID != nil {
+			if _, err := s.Get(ctx, tenantID, *trashed.ParentID); err != nil {
+				if errors.Is(err, ErrRecordNotFound) {
+					return ErrParentInTrash
+				}
+				return err
+			}
+		}
+
+		newTick, err := s.projects.IncrementTick(ctx, tenantID, trashed.ProjectID)
+		if err != nil {
+			return fmt.Errorf("incrementing tick: %w", err)
+		}
+
+		count, err := s.records.Restore(ctx, tenantID, trashed.ID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return ErrNotInTrash
+			}
+			return fmt.Errorf("restoring record: %w", err)
+		}
+
+		restored, err := s.Get(ctx, tenantID, trashed.ID)
+		if err != nil {
+			return err
+		}
+		subtree, err := s.liveSubtree(ctx, tenantID, restored)
+		if err != nil {
+			return err
+		}
+		for i := range subtree {
+			if err := s.writeRestored(ctx, tenantID, &subtree[i], newTick); err != nil {
+				return err
+			}
+		}
+
+		var sessionID *string
+		if req.SessionID != "" {
+			sessionID = &req.SessionID
+			if err := s.sessions.AddActivation(ctx, req.SessionID, trashed.ID, newTick); err != nil {
+				return fmt.Errorf("activating record: %w", err)
+			}
+			if err := s.touchSession(ctx, tenantID, req.SessionID, newTick); err != nil {
+				return err
+			}
+		}
+
+		for i, rec := range subtree {
+			logEntry := &activity.ActivityEntry{
+				ProjectID:    rec.ProjectID,
+				SessionID:    sessionID,
+				RecordID:     &subtree[i].ID,
+				ActivityType: activity.TypeRecordRestored,
+				Summary:      fmt.Sprintf("restored record %s with %s", rec.ID, trashed.ID),
+				Tick:         newTick,
+			}
+			if i == 0 {
+				details, _ := json.Marshal(map[string]int{"restored_count": count})
+				logEntry.Summary = fmt.Sprintf("restored record %s", rec.ID)
+				logEntry.Details = string(details)
+			}
+			if err := s.logActivity(ctx, tenantID, logEntry); err != nil {
+				return err
+			}
+		}
+
+		rec, err = s.Get(ctx, tenantID, trashed.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// writeRestored stores rec, just taken out of the trash, as a new version
+// at tick so other sessions see it reappear. The version it had in the
+// trash stays in its history.
+func (s *Service) writeRestored(ctx context.Context, tenantID string, rec *Record, tick int64) error {
+	if err := s.records.SaveVersion(ctx, tenantID, rec); err != nil {
+		return fmt.Errorf("saving version: %w", err)
+	}
+
+	updated := *rec
+	updated.ModifiedAt = time.Now()
+	updated.Tick = tick
+	if err := s.records.Update(ctx, tenantID, &updated, rec.Tick); err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			return ErrConflict
+		}
+		return fmt.Errorf("restoring record: %w", err)
+	}
+	return nil
+}
+
+// ListTrash returns deleted records that can be restored, most recently
+// deleted first.
+func (s *Service) ListTrash(ctx context.Context, tenantID string, opts ListTrashOptions) ([]TrashEntry, error) {
+	entries, err := s.records.ListTrash(ctx, tenantID, opts)
+	if err != nil {
+		return nil, fmt.Errorf("listing trash: %w", err)
+	}
+	return entries, nil
+}
+
+// Get returns a record by ID.
+func (s *Service) Get(ctx context.Context, tenantID, id string) (*Record, error) {
+	rec, err := s.records.Get(ctx, tenantID, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, fmt.Errorf("getting record: %w", err)
+	}
+	return rec, nil
+}
+
+// ShortIDLength is the length of the ID prefixes shown in outlines.
+// ResolveID expands a prefix of at least this length to the full ID.
+const ShortIDLength = 8
+
+// ResolveID returns the full ID of the record, live or in the trash, whose
+// ID starts with id. Full IDs, and strings too short to be a short ID, are
+// returned unchanged.
+func (s *Service) ResolveID(ctx context.Context, tenantID, id string) (string, error) {
+	if len(id) < ShortIDLength || len(id) >= len(uuid.Nil.String()) {
+		return id, nil
+	}
+	matches, err := s.records.MatchIDPrefix(ctx, tenantID, id, 5)
+	if err != nil {
+		return "", fmt.Errorf("resolving record id: %w", err)
+	}
+	switch len(matches) {
+	case 0:
+		return "", ErrRecordNotFound
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("%w: %s matches %s", ErrAmbiguousID, id, strings.Join(matches, ", "))
+	}
+}
+
+// Diff resolves two version references and returns the record as of each.
+func (s *Service) Diff(ctx context.Context, tenantID string, req DiffRequest) (*Record, *Record, error) {
+	if req.ID == "" || strings.TrimSpace(req.From) == "" {
+		return nil, nil, ErrInvalidInput
+	}
+
+	current, err := s.Get(ctx, tenantID, req.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	from, err := s.resolveVersion(ctx, tenantID, req.SessionID, current, req.From)
+	if err != nil {
+		return nil, nil, err
+	}
+	to, err := s.resolveVersion(ctx, tenantID, req.SessionID, current, req.To)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return from, to, nil
+}
+
+// VersionAt returns the record as it was at the given tick.
+func (s *Service) VersionAt(ctx context.Context, tenantID, id string, tick int64) (*Record, error) {
+	current, err := s.Get(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.versionAt(ctx, tenantID, current, tick)
+}
+
+// GetRef returns a lightweight record reference with child counts.
+func (s *Service) GetRef(ctx context.Context, tenantID, id string) (RecordRef, error) {
+	rec, err := s.records.Get(ctx, tenantID, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return RecordRef{}, ErrRecordNotFound
+		}
+		return RecordRef{}, fmt.Errorf("getting record: %w", err)
+	}
+
+	childRefs, err := s.records.GetChildrenRefs(ctx, tenantID, id)
+	if err != nil {
+		return RecordRef{}, fmt.Errorf("getting children: %w", err)
+	}
+
+	openCount := 0
+	for _, ref := range childRefs {
+		if ref.State == StateOpen {
+			openCount++
+		}
+	}
+
+	return RecordRef{
+		ID:                rec.ID,
+		Type:              rec.Type,
+		Title:             rec.Title,
+		Summary:           rec.Summary,
+		State:             rec.State,
+		ParentID:          rec.ParentID,
+		ChildrenCount:     len(childRefs),
+		OpenChildrenCount: openCount,
+		Links:             rec.Links,
+		Backlinks:         rec.Backlinks,
+	}, nil
+}
+
+// Tree returns the subtree under opts.RootID, or every tree of
+// opts.ProjectID, as nested record references. Depth defaults to
+// DefaultTreeDepth levels.
+func (s *Service) Tree(ctx context.Context, tenantID string, opts TreeOptions) ([]*TreeNode, error) {
+	if opts.RootID == "" && opts.ProjectID == "" {
+		return nil, ErrInvalidInput
+	}
+	if opts.Depth < 0 || opts.Depth > MaxTreeDepth {
+		return nil, fmt.Errorf("%w: depth must be between 0 (default) and %d", ErrInvalidInput, MaxTreeDepth)
+	}
+	if opts.Depth == 0 {
+		opts.Depth = DefaultTreeDepth
+	}
+
+	nodes, err := s.records.Tree(ctx, tenantID, opts)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, fmt.Errorf("getting tree: %w", err)
+	}
+	return nestTree(nodes), nil
+}
+
+// List returns a page of record references based on options. Without a
+// cursor it starts a listing, noting the project ticks so later pages can
+// report how many records changed in the meantime.
+func (s *Service) List(ctx context.Context, tenantID string, opts ListRecordsOptions) (*ListResult, error) {
+	if !validSort(opts.Sort) {
+		return nil, fmt.Errorf("%w: %q (use created, modified, tick, title, state or children_open)", ErrInvalidSort, opts.Sort)
+	}
+	if opts.Sort == "" {
+		opts.Sort = SortCreated
+	}
+
+	var ticks map[string]int64
+	if opts.Cursor != "" {
+		cursor, err := DecodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Sort != opts.Sort || cursor.ID == "" {
+			return nil, fmt.Errorf("%w: cursor is from a listing sorted by %s", ErrInvalidCursor, cursor.Sort)
+		}
+		opts.After = &cursor
+		opts.Offset = 0
+		ticks = cursor.Ticks
+	} else if s.projects != nil {
+		var err error
+		if ticks, err = s.projects.Ticks(ctx, tenantID, listedProjects(opts)); err != nil {
+			return nil, fmt.Errorf("loading project ticks: %w", err)
+		}
+	}
+
+	counted := opts
+	counted.After = nil
+	total, err := s.records.Count(ctx, tenantID, counted)
+	if err != nil {
+		return nil, err
+	}
+	result := &ListResult{Total: total}
+	if opts.After != nil && len(ticks) > 0 {
+		counted.ChangedSince = ticks
+		if result.Changed, err = s.records.Count(ctx, tenantID, counted); err != nil {
+			return nil, err
+		}
+	}
+
+	limit := opts.Limit
+	if limit > 0 {
+		// One extra record tells whether another page follows.
+		opts.Limit = limit + 1
+	}
+	refs, err := s.records.List(ctx, tenantID, opts)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(refs) > limit {
+		refs = refs[:limit]
+		last := refs[limit-1]
+		result.NextCursor = Cursor{Sort: opts.Sort, Key: last.SortKey, ID: last.ID, Ticks: ticks}.Encode()
+	}
+	if opts.IncludePath {
+		targets := make([]*RecordRef, len(refs))
+		for i := range refs {
+			targets[i] = &refs[i]
+		}
+		if err := s.setAncestors(ctx, tenantID, targets); err != nil {
+			return nil, err
+		}
+	}
+	result.Records = refs
+	return result, nil
+}
+
+// listedProjects returns the projects a listing is restricted to, or nil
+// for every project.
+func listedProjects(opts ListRecordsOptions) []string {
+	if opts.ProjectID != "" {
+		return []string{opts.ProjectID}
+	}
+	return opts.ProjectIDs
+}
+
+// Search parses query (see Query for the syntax) and runs it as a
+// full-text search over the projects in opts.ProjectIDs, or over every
+// project when none are given. A parent filter may name a short ID.
+func (s *Service) Search(ctx context.Context, tenantID, query string, opts SearchOptions) (*SearchPage, error) {
+	if s.search == nil {
+		return nil, fmt.Errorf("search repository not configured")
+	}
+	parsed, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.ParentID != nil && *parsed.ParentID != "" {
+		parentID, err := s.ResolveID(ctx, tenantID, *parsed.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		parsed.ParentID = &parentID
+	}
+	if opts.Cursor != "" {
+		// Relevance is scored afresh for every page, so search cursors
+		// hold a position rather than a sort key. Ranking only the records
+		// that existed when the first page was read keeps records created
+		// since from shifting that position.
+		cursor, err := DecodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		opts.Offset = cursor.Offset
+		opts.ExistedAt = cursor.Ticks
+	} else if s.projects != nil {
+		ticks, err := s.projects.Ticks(ctx, tenantID, opts.ProjectIDs)
+		if err != nil {
+			return nil, fmt.Errorf("loading project ticks: %w", err)
+		}
+		opts.ExistedAt = ticks
+	}
+
+	mode := opts.Mode
+	if mode == "" || !parsed.HasText() {
+		// Without text there is nothing to compare meaning against.
+		mode = SearchModeKeyword
+	}
+
+	limit := opts.Limit
+	if limit > 0 {
+		opts.Limit = limit + 1
+	}
+	results, total, err := s.rank(ctx, tenantID, mode, parsed, queryText(parsed), opts)
+	if err != nil {
+		return nil, err
+	}
+	if mode == SearchModeKeyword {
+		if total, err = s.search.Count(ctx, tenantID, parsed, opts); err != nil {
+			return nil, err
+		}
+	}
+	result := &SearchPage{Total: total}
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+		result.NextCursor = Cursor{Offset: opts.Offset + limit, Ticks: opts.ExistedAt}.Encode()
+	}
+	if opts.IncludePath {
+		targets := make([]*RecordRef, len(results))
+		for i := range results {
+			targets[i] = &results[i].Record
+		}
+		if err := s.setAncestors(ctx, tenantID, targets); err != nil {
+			return nil, err
+		}
+	}
+	result.Results = results
+	return result, nil
+}
+
+// FindSimilar returns the records nearest to an existing record or to draft
+// text, best match first. Mode defaults to hybrid when an embedder is
+// configured and keyword otherwise; the record itself is never returned.
+func (s *Service) FindSimilar(ctx context.Context, tenantID string, req FindSimilarRequest, opts SearchOptions) ([]SearchResult, error) {
+	if s.search == nil {
+		return nil, fmt.Errorf("search repository not configured")
+	}
+	if (req.ID == "") == (strings.TrimSpace(req.Text) == "") {
+		return nil, fmt.Errorf("%w: give either a record id or text", ErrInvalidInput)
+	}
+
+	text := req.Text
+	if req.ID != "" {
+		rec, err := s.Get(ctx, tenantID, req.ID)
+		if err != nil {
+			return nil, err
+		}
+		text = embeddingText(rec)
+	}
+
+	query := similarityQuery(text)
+	if !query.HasText() {
+		return []SearchResult{}, nil
+	}
+
+	mode := opts.Mode
+	if mode == "" {
+		mode = SearchModeKeyword
+		if s.embedder != nil {
+			mode = SearchModeHybrid
+		}
+	}
+	limit := opts.Limit
+	opts.Offset = 0
+	if req.ID != "" && limit > 0 {
+		// Leave room for the record itself, which is dropped below.
+		opts.Limit = limit + 1
+	}
+
+	results, _, err := s.rank(ctx, tenantID, mode, query, text, opts)
+	if err != nil {
+		return nil, err
+	}
+	return withoutRecord(results, req.ID, limit), nil
+}
+
+// possibleDuplicates finds OPEN records of rec's project whose title and
+// summary share most of their words with rec's. The record is already
+// written, so a failed lookup is logged and reported as no duplicates.
+func (s *Service) possibleDuplicates(ctx context.Context, tenantID string, rec *Record) []PossibleDuplicate {
+	if s.search == nil {
+		return nil
+	}
+	text := rec.Title + " " + rec.Summary
+	query := similarityQuery(text)
+	if !query.HasText() {
+		return nil
+	}
+
+	candidates, err := s.search.Search(ctx, tenantID, query, SearchOptions{
+		ProjectIDs: []string{rec.ProjectID},
+		States:     []RecordState{StateOpen},
+		Limit:      duplicateCandidates + 1,
+	})
+	if err != nil {
+		if s.logger != nil {
+			s.logger.WarnContext(ctx, "failed to check for duplicate records", "record_id", rec.ID, "error", err)
+		}
+		return nil
+	}
+
+	var duplicates []PossibleDuplicate
+	for _, candidate := range candidates {
+		if candidate.Record.ID == rec.ID {
+			continue
+		}
+		similarity := wordOverlap(text, candidate.Record.Title+" "+candidate.Record.Summary)
+		if similarity >= duplicateThreshold {
+			duplicates = append(duplicates, PossibleDuplicate{Record: candidate.Record, Similarity: similarity})
+		}
+	}
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		return duplicates[i].Similarity > duplicates[j].Similarity
+	})
+	return duplicates
+}
+
+// rank runs a search in the given mode and returns a page of results and
+// how many records were ranked in all. Keyword ranking matches the query
+// and only counts the page; semantic ranking compares text with the
+// embeddings of the records matching the query's filters.
+func (s *Service) rank(ctx context.Context, tenantID string, mode SearchMode, query Query, text string, opts SearchOptions) ([]SearchResult, int, error) {
+	switch mode {
+	case SearchModeKeyword:
+		results, err := s.search.Search(ctx, tenantID, query, opts)
+		if err != nil {
+			return nil, 0, err
+		}
+		return results, len(results), nil
+	case SearchModeSemantic:
+		results, err := s.semanticSearch(ctx, tenantID, text, query, opts)
+		if err != nil {
+			return nil, 0, err
+		}
+		return page(results, opts.Offset, opts.Limit), len(results), nil
+	case SearchModeHybrid:
+		candidates := opts
+		candidates.Limit = hybridCandidates
+		candidates.Offset = 0
+		keyword, err := s.search.Search(ctx, tenantID, query, candidates)
+		if err != nil {
+			return nil, 0, err
+		}
+		semantic, err := s.semanticSearch(ctx, tenantID, text, query, opts)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(semantic) > hybridCandidates {
+			semantic = semantic[:hybridCandidates]
+		}
+		fused := fuseRankings(keyword, semantic)
+		return page(fused, opts.Offset, opts.Limit), len(fused), nil
+	default:
+		return nil, 0, fmt.Errorf("%w: %q", ErrInvalidSearchMode, mode)
+	}
+}
+
+// semanticSearch ranks every record matching the query's filters by the
+// similarity of its embedding to text. Records without a current embedding
+// are embedded first.
+func (s *Service) semanticSearch(ctx context.Context, tenantID, text string, query Query, opts SearchOptions) ([]SearchResult, error) {
+	if s.embedder == nil {
+		return nil, ErrSemanticSearchDisabled
+	}
+	if err := s.backfillEmbeddings(ctx, tenantID); err != nil {
+		return nil, err
+	}
+
+	vectors, err := s.embedder.Embed(ctx, []string{text})
+	if err != nil {
+		return nil, fmt.Errorf("embedding query: %w", err)
+	}
+	candidates, err := s.search.SearchEmbeddings(ctx, tenantID, s.embedder.Model(), query, opts)
+	if err != nil {
+		return nil, err
+	}
+	return rankBySimilarity(vectors[0], candidates), nil
+}
+
+// backfillEmbeddings embeds records that have no embedding for the current
+// model, such as records written before semantic search was enabled.
+func (s *Service) backfillEmbeddings(ctx context.Context, tenantID string) error {
+	model := s.embedder.Model()
+	for {
+		missing, err := s.search.MissingEmbeddings(ctx, tenantID, model, embeddingBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+
+		texts := make([]string, len(missing))
+		for i := range missing {
+			texts[i] = embeddingText(&missing[i])
+		}
+		vectors, err := s.embedder.Embed(ctx, texts)
+		if err != nil {
+			return fmt.Errorf("embedding records: %w", err)
+		}
+		for i := range missing {
+			if err := s.search.SaveEmbedding(ctx, missing[i].ID, model, contentHash(texts[i]), vectors[i]); err != nil {
+				return err
+			}
+		}
+		if len(missing) < embeddingBatchSize {
+			return nil
+		}
+	}
+}
+
+// indexEmbedding refreshes the embedding of a written record. Embeddings
+// are derived data, so a failure is logged rather than failing the write.
+// A new record is embedded by the next semantic search; an updated one
+// keeps its previous embedding until it's written again.
+func (s *Service) indexEmbedding(ctx context.Context, rec *Record) {
+	if s.embedder == nil || s.search == nil {
+		return
+	}
+	if err := s.saveEmbedding(ctx, rec); err != nil && s.logger != nil {
+		s.logger.WarnContext(ctx, "failed to index record embedding", "record_id", rec.ID, "error", err)
+	}
+}
+
+func (s *Service) saveEmbedding(ctx context.Context, rec *Record) error {
+	model := s.embedder.Model()
+	text := embeddingText(rec)
+	hash := contentHash(text)
+	current, err := s.search.EmbeddingHash(ctx, rec.ID, model)
+	if err != nil {
+		return err
+	}
+	if current == hash {
+		return nil
+	}
+
+	vectors, err := s.embedder.Embed(ctx, []string{text})
+	if err != nil {
+		return fmt.Errorf("embedding record: %w", err)
+	}
+	return s.search.SaveEmbedding(ctx, rec.ID, model, hash, vectors[0])
+}
+
+func (s *Service) ensureActivated(ctx context.Context, tenantID, sessionID, recordID string, errIfMissing error) error {
+	activations, err := s.sessions.GetActivations(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("loading activations: %w", err)
+	}
+
+	for _, active := range activations {
+		if active == recordID {
+			return nil
+		}
+	}
+
+	return errIfMissing
+}
+
+// withinTx runs fn as one unit of work. Without a transactor fn runs
+// directly, which is how the service is unit tested.
+func (s *Service) withinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s.tx == nil {
+		return fn(ctx)
+	}
+	return s.tx.WithinTx(ctx, fn)
+}
+
+// mutate runs a write that may end in a conflict as one unit of work.
+// Activity logged while detecting the conflict is committed with it.
+func (s *Service) mutate(ctx context.Context, fn func(ctx context.Context) (*Record, *ConflictInfo, error)) (*Record, *ConflictInfo, error) {
+	var rec *Record
+	var conflict *ConflictInfo
+	err := s.withinTx(ctx, func(ctx context.Context) error {
+		var err error
+		rec, conflict, err = fn(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if rec != nil && conflict == nil {
+		s.indexEmbedding(ctx, rec)
+	}
+	return rec, conflict, nil
+}
+
+// logActivity appends entry to the activity log. It runs inside the
+// mutation's unit of work, so a failure rolls the mutation back.
+func (s *Service) logActivity(ctx context.Context, tenantID string, entry *activity.ActivityEntry) error {
+	if s.activities == nil {
+		return nil
+	}
+	if err := s.activities.Log(ctx, tenantID, entry); err != nil {
+		return fmt.Errorf("logging activity: %w", err)
+	}
+	return nil
+}
+
+// checkMoveTarget verifies rec may be placed under parentID by walking the
+// new parent's ancestors.
+func (s *Service) checkMoveTarget(ctx context.Context, tenantID string, rec *Record, parentID string) error {
+	parent, err := s.Get(ctx, tenantID, parentID)
+	if err != nil {
+		return err
+	}
+	if parent.ProjectID != rec.ProjectID {
+		return ErrInvalidInput
+	}
+
+	seen := map[string]bool{}
+	for ancestor := parent; ; {
+		if ancestor.ID == rec.ID {
+			return ErrMoveCycle
+		}
+		if ancestor.ParentID == nil || seen[ancestor.ID] {
+			return nil
+		}
+		seen[ancestor.ID] = true
+
+		ancestor, err = s.Get(ctx, tenantID, *ancestor.ParentID)
+		if err != nil {
+			return fmt.Errorf("loading ancestor: %w", err)
+		}
+	}
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// loadLinkSource loads the record a link starts from, which the session
+// must have activated.
+func (s *Service) loadLinkSource(ctx context.Context, tenantID string, req LinkRequest) (*Record, error) {
+	if err := s.ensureActivated(ctx, tenantID, req.SessionID, req.FromID, ErrNotActivated); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, tenantID, req.FromID)
+}
+
+// writeLink gives from, whose links just changed, a new version and tick
+// like any other write, and logs the change at that tick.
+func (s *Service) writeLink(ctx context.Context, tenantID string, req LinkRequest, from *Record, activityType activity.ActivityType) error {
+	updated := *from
+	// A nil Related keeps the links as they now are.
+	updated.Related = nil
+	if err := s.writeVersion(ctx, tenantID, req.SessionID, from, &updated, "updating links"); err != nil {
+		return err
+	}
+
+	verb := "linked"
+	if activityType == activity.TypeRecordUnlinked {
+		verb = "unlinked"
+	}
+	details, _ := json.Marshal(map[string]string{
+		"kind":         string(req.Kind),
+		"to_record_id": req.ToID,
+	})
+	return s.logActivity(ctx, tenantID, &activity.ActivityEntry{
+		ProjectID:    from.ProjectID,
+		SessionID:    &req.SessionID,
+		RecordID:     &from.ID,
+		ActivityType: activityType,
+		Summary:      fmt.Sprintf("%s record %s %s %s", verb, from.ID, req.Kind, req.ToID),
+		Details:      string(details),
+		Tick:         updated.Tick,
+	})
+}
+
+func applyUpdate(rec *Record, req UpdateRequest) {
+	if req.Title != nil {
+		rec.Title = *req.Title
+	}
+	if req.Summary != nil {
+		rec.Summary = *req.Summary
+	}
+	if req.Body != nil {
+		rec.Body = *req.Body
+	}
+	if req.Related != nil {
+		rec.Related = req.Related
+	}
+}
+
+// loadForWrite loads a record the session is about to change. It returns a
+// conflict instead of the record when the record was modified after the
+// session activated it, unless force is set, or when it is active in other
+// sessions, unless override is set.
+func (s *Service) loadForWrite(ctx context.Context, tenantID, sessionID, id string, force, override bool) (*Record, *ConflictInfo, error) {
+	if err := s.ensureActivated(ctx, tenantID, sessionID, id, ErrNotActivated); err != nil {
+		return nil, nil, err
+	}
+
+	current, err := s.records.Get(ctx, tenantID, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, ErrRecordNotFound
+		}
+		return nil, nil, fmt.Errorf("loading record: %w", err)
+	}
+
+	activationTick, err := s.sessions.GetActivationTick(ctx, sessionID, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, ErrNotActivated
+		}
+		return nil, nil, fmt.Errorf("loading activation tick: %w", err)
+	}
+
+	// The activation tick is the project tick when the session last loaded
+	// or wrote the record, so only later writes count as remote changes.
+	if current.Tick > activationTick && !force {
+		base, err := s.versionAt(ctx, tenantID, current, activationTick)
+		if err != nil && !errors.Is(err, ErrVersionNotFound) {
+			return nil, nil, err
+		}
+		return nil, &ConflictInfo{
+			ConflictType:  ConflictUpdate,
+			LocalVersion:  nil,
+			RemoteVersion: current,
+			BaseVersion:   base,
+			Message:       "record modified since activation",
+		}, nil
+	}
+
+	conflict, err := s.checkConcurrentSessions(ctx, tenantID, sessionID, current, override)
+	if err != nil || conflict != nil {
+		return nil, conflict, err
+	}
+
+	return current, nil, nil
+}
+
+// checkConcurrentSessions returns a conflict when the record is active in
+// sessions other than sessionID. Stale sessions don't count: the sweeper
+// found them abandoned. With override set the write may proceed; either
+// outcome is recorded in the activity log.
+func (s *Service) checkConcurrentSessions(ctx context.Context, tenantID, sessionID string, current *Record, override bool) (*ConflictInfo, error) {
+	sessions, err := s.sessions.GetByRecordID(ctx, tenantID, current.ID)
+	if err != nil {
+		return nil, fmt.Errorf("loading active sessions: %w", err)
+	}
+
+	others := make([]SessionInfo, 0, len(sessions))
+	otherIDs := make([]string, 0, len(sessions))
+	for _, info := range sessions {
+		if info.SessionID != sessionID && !info.Stale {
+			others = append(others, info)
+			otherIDs = append(otherIDs, info.SessionID)
+		}
+	}
+	if len(others) == 0 {
+		return nil, nil
+	}
+
+	activityType := activity.TypeConflictDetected
+	summary := fmt.Sprintf("record %s active in other sessions", current.ID)
+	if override {
+		activityType = activity.TypeConflictResolved
+		summary = fmt.Sprintf("overrode other sessions on record %s", current.ID)
+	}
+	details, _ := json.Marshal(map[string]any{
+		"conflict_type":  ConflictConcurrentSession,
+		"other_sessions": otherIDs,
+		"override":       override,
+	})
+	if err := s.logActivity(ctx, tenantID, &activity.ActivityEntry{
+		ProjectID:    current.ProjectID,
+		SessionID:    &sessionID,
+		RecordID:     &current.ID,
+		ActivityType: activityType,
+		Summary:      summary,
+		Details:      string(details),
+		Tick:         current.Tick,
+	}); err != nil {
+		return nil, err
+	}
+	if override {
+		return nil, nil
+	}
+
+	return &ConflictInfo{
+		ConflictType: ConflictConcurrentSession,
+		Sessions:     others,
+		Message:      fmt.Sprintf("record is active in other sessions: %s", strings.Join(otherIDs, ", ")),
+	}, nil
+}
+
+// writeVersion stores updated as the next version of current. It assigns a
+// new project tick, keeps current in the version history and moves the
+// writing session's activation to the new version it now holds, so that
+// version is the base of any later merge. The write counts as activity in
+// the session.
+func (s *Service) writeVersion(ctx context.Context, tenantID, sessionID string, current, updated *Record, action string) error {
+	updated.ModifiedAt = time.Now()
+
+	newTick, err := s.projects.IncrementTick(ctx, tenantID, current.ProjectID)
+	if err != nil {
+		return fmt.Errorf("incrementing tick: %w", err)
+	}
+	updated.Tick = newTick
+
+	if err := s.records.SaveVersion(ctx, tenantID, current); err != nil {
+		return fmt.Errorf("saving version: %w", err)
+	}
+
+	if err := s.records.Update(ctx, tenantID, updated, current.Tick); err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			return ErrConflict
+		}
+		return fmt.Errorf("%s: %w", action, err)
+	}
+
+	if err := s.sessions.AddActivation(ctx, sessionID, updated.ID, updated.Tick); err != nil {
+		return fmt.Errorf("updating activation: %w", err)
+	}
+
+	return s.touchSession(ctx, tenantID, sessionID, updated.Tick)
+}
+
+// touchSession records a write in sessionID's session, which keeps the
+// sweeper off a session that is in use. tick is the project tick the write
+// took. Writes outside a session are not tracked.
+func (s *Service) touchSession(ctx context.Context, tenantID, sessionID string, tick int64) error {
+	if sessionID == "" {
+		return nil
+	}
+	if err := s.sessions.Touch(ctx, tenantID, sessionID, tick, time.Now()); err != nil {
+		return fmt.Errorf("updating session: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) versionAt(ctx context.Context, tenantID string, current *Record, tick int64) (*Record, error) {
+	if tick >= current.Tick {
+		return current, nil
+	}
+
+	version, err := s.records.GetVersionAt(ctx, tenantID, current.ID, tick)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrVersionNotFound
+		}
+		return nil, fmt.Errorf("loading version: %w", err)
+	}
+	return version, nil
+}
+
+func (s *Service) resolveVersion(ctx context.Context, tenantID, sessionID string, current *Record, ref string) (*Record, error) {
+	ref = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(ref)), "tick:")
+	switch ref {
+	case "", "current":
+		return current, nil
+	case "previous":
+		return s.versionAt(ctx, tenantID, current, current.Tick-1)
+	case "activation":
+		if sessionID == "" {
+			return nil, ErrNotActivated
+		}
+		tick, err := s.sessions.GetActivationTick(ctx, sessionID, current.ID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, ErrNotActivated
+			}
+			return nil, fmt.Errorf("loading activation tick: %w", err)
+		}
+		return s.versionAt(ctx, tenantID, current, tick)
+	}
+
+	tick, err := strconv.ParseInt(ref, 10, 64)
+	if err != nil || tick < 0 {
+		return nil, ErrInvalidVersionRef
+	}
+	return s.versionAt(ctx, tenantID, current, tick)
 }
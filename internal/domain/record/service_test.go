@@ -2,9 +2,12 @@ package record_test
 
 import (
 	"context"
+	"strings"
 	"testing"
 
+	"github.com/rpggio/trellis/internal/domain/activity"
 	"github.com/rpggio/trellis/internal/domain/record"
+	"github.com/rpggio/trellis/internal/repository"
 	"github.com/rpggio/trellis/internal/repository/mocks"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -24,10 +27,11 @@ func TestRecordService_Create_WithParentActivation(t *testing.T) {
 	projectsRepo.On("IncrementTick", ctx, tenantID, "proj1").Return(int64(5), nil)
 	recordsRepo.On("Create", ctx, tenantID, mock.Anything).Return(nil)
 	sessionsRepo.On("AddActivation", ctx, "sess1", mock.Anything, int64(5)).Return(nil)
+	sessionsRepo.On("Touch", ctx, tenantID, "sess1", int64(5), mock.Anything).Return(nil)
 	activitiesRepo.On("Log", ctx, tenantID, mock.Anything).Return(nil)
 
-	svc := record.NewService(recordsRepo, sessionsRepo, projectsRepo, activitiesRepo, nil, nil)
-	rec, err := svc.Create(ctx, tenantID, record.CreateRequest{
+	svc := record.NewService(recordsRepo, sessionsRepo, projectsRepo, activitiesRepo, nil, nil, nil, nil)
+	rec, _, err := svc.Create(ctx, tenantID, record.CreateRequest{
 		SessionID: "sess1",
 		ProjectID: "proj1",
 		ParentID:  &parentID,
@@ -52,8 +56,8 @@ func TestRecordService_Create_ParentNotActivated(t *testing.T) {
 
 	sessionsRepo.On("GetActivations", ctx, "sess1").Return([]string{}, nil)
 
-	svc := record.NewService(recordsRepo, sessionsRepo, projectsRepo, nil, nil, nil)
-	_, err := svc.Create(ctx, tenantID, record.CreateRequest{
+	svc := record.NewService(recordsRepo, sessionsRepo, projectsRepo, nil, nil, nil, nil, nil)
+	_, _, err := svc.Create(ctx, tenantID, record.CreateRequest{
 		SessionID: "sess1",
 		ProjectID: "proj1",
 		ParentID:  &parentID,
@@ -79,17 +83,74 @@ func TestRecordService_Update_Conflict(t *testing.T) {
 	recordsRepo.On("Get", ctx, tenantID, recordID).Return(&record.Record{
 		ID:        recordID,
 		ProjectID: "proj1",
+		Title:     "Remote title",
+		Summary:   "Summary",
+		Body:      "intro\nplan: A\noutro",
 		Tick:      2,
 	}, nil)
+	recordsRepo.On("GetVersionAt", ctx, tenantID, recordID, int64(1)).Return(&record.Record{
+		ID:      recordID,
+		Title:   "Title",
+		Summary: "Summary",
+		Body:    "intro\nplan: A\noutro",
+		Tick:    1,
+	}, nil)
 
-	svc := record.NewService(recordsRepo, sessionsRepo, projectsRepo, nil, nil, nil)
+	svc := record.NewService(recordsRepo, sessionsRepo, projectsRepo, nil, nil, nil, nil, nil)
+	summary := "Local summary"
+	body := "intro\nplan: B\noutro"
 	updated, conflict, err := svc.Update(ctx, tenantID, record.UpdateRequest{
 		SessionID: "sess1",
 		ID:        recordID,
+		Summary:   &summary,
+		Body:      &body,
 	})
 	require.NoError(t, err)
 	require.Nil(t, updated)
 	require.NotNil(t, conflict)
+	require.Equal(t, record.ConflictUpdate, conflict.ConflictType)
+	require.NotNil(t, conflict.Merge)
+	require.Equal(t, int64(1), conflict.Merge.BaseTick)
+	require.Equal(t, "Remote title", conflict.Merge.Title)
+	require.Equal(t, "Local summary", conflict.Merge.Summary)
+	require.Equal(t, body, conflict.Merge.Body)
+	require.Empty(t, conflict.Merge.Conflicts)
+}
+
+func TestRecordService_Update_ActivationTick(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+	recordID := "r1"
+
+	recordsRepo := &mocks.RecordRepository{}
+	sessionsRepo := &mocks.SessionRepository{}
+	projectsRepo := &mocks.ProjectRepository{}
+
+	// The session activated at project tick 9; the record last changed at
+	// tick 5, so writes to other records since then don't conflict.
+	current := &record.Record{ID: recordID, ProjectID: "proj1", Title: "Title", Tick: 5}
+	sessionsRepo.On("GetActivations", ctx, "sess1").Return([]string{recordID}, nil)
+	sessionsRepo.On("GetActivationTick", ctx, "sess1", recordID).Return(int64(9), nil)
+	sessionsRepo.On("GetByRecordID", ctx, tenantID, recordID).Return([]record.SessionInfo{{SessionID: "sess1"}}, nil)
+	recordsRepo.On("Get", ctx, tenantID, recordID).Return(current, nil)
+	projectsRepo.On("IncrementTick", ctx, tenantID, "proj1").Return(int64(10), nil)
+	recordsRepo.On("SaveVersion", ctx, tenantID, current).Return(nil)
+	recordsRepo.On("Update", ctx, tenantID, mock.Anything, int64(5)).Return(nil)
+	sessionsRepo.On("AddActivation", ctx, "sess1", recordID, int64(10)).Return(nil).Once()
+	sessionsRepo.On("Touch", ctx, tenantID, "sess1", int64(10), mock.Anything).Return(nil).Once()
+
+	svc := record.NewService(recordsRepo, sessionsRepo, projectsRepo, nil, nil, nil, nil, nil)
+	title := "New title"
+	updated, conflict, err := svc.Update(ctx, tenantID, record.UpdateRequest{
+		SessionID: "sess1",
+		ID:        recordID,
+		Title:     &title,
+	})
+	require.NoError(t, err)
+	require.Nil(t, conflict)
+	require.Equal(t, int64(10), updated.Tick)
+	// The session now holds the version it wrote.
+	sessionsRepo.AssertExpectations(t)
 }
 
 func TestRecordService_Transition_Invalid(t *testing.T) {
@@ -108,11 +169,888 @@ func TestRecordService_Transition_Invalid(t *testing.T) {
 		State:     record.StateResolved,
 	}, nil)
 
-	svc := record.NewService(recordsRepo, sessionsRepo, projectsRepo, nil, nil, nil)
-	_, err := svc.Transition(ctx, tenantID, record.TransitionRequest{
+	svc := record.NewService(recordsRepo, sessionsRepo, projectsRepo, nil, nil, nil, nil, nil)
+	_, _, err := svc.Transition(ctx, tenantID, record.TransitionRequest{
 		SessionID: "sess1",
 		ID:        recordID,
 		ToState:   record.StateLater,
 	})
 	require.ErrorIs(t, err, record.ErrInvalidTransition)
 }
+
+func TestRecordService_Diff_ResolvesVersions(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+	recordID := "r1"
+
+	recordsRepo := &mocks.RecordRepository{}
+	sessionsRepo := &mocks.SessionRepository{}
+
+	recordsRepo.On("Get", ctx, tenantID, recordID).Return(&record.Record{
+		ID:    recordID,
+		Title: "Current",
+		Tick:  9,
+	}, nil)
+	recordsRepo.On("GetVersionAt", ctx, tenantID, recordID, int64(8)).Return(&record.Record{
+		ID:    recordID,
+		Title: "Previous",
+		Tick:  6,
+	}, nil)
+	sessionsRepo.On("GetActivationTick", ctx, "sess1", recordID).Return(int64(9), nil)
+
+	svc := record.NewService(recordsRepo, sessionsRepo, nil, nil, nil, nil, nil, nil)
+	from, to, err := svc.Diff(ctx, tenantID, record.DiffRequest{
+		SessionID: "sess1",
+		ID:        recordID,
+		From:      "previous",
+		To:        "activation",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Previous", from.Title)
+	require.Equal(t, "Current", to.Title)
+
+	_, _, err = svc.Diff(ctx, tenantID, record.DiffRequest{ID: recordID, From: "yesterday"})
+	require.ErrorIs(t, err, record.ErrInvalidVersionRef)
+}
+
+func TestRecordService_Revert_RestoresVersion(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+	recordID := "r1"
+
+	recordsRepo := &mocks.RecordRepository{}
+	sessionsRepo := &mocks.SessionRepository{}
+	projectsRepo := &mocks.ProjectRepository{}
+	activitiesRepo := &mocks.ActivityRepository{}
+
+	current := &record.Record{
+		ID:        recordID,
+		ProjectID: "proj1",
+		Title:     "Sloppy",
+		Body:      "sloppy body",
+		State:     record.StateResolved,
+		Tick:      7,
+	}
+	sessionsRepo.On("GetActivations", ctx, "sess1").Return([]string{recordID}, nil)
+	sessionsRepo.On("GetActivationTick", ctx, "sess1", recordID).Return(int64(7), nil)
+	recordsRepo.On("Get", ctx, tenantID, recordID).Return(current, nil)
+	recordsRepo.On("GetVersionAt", ctx, tenantID, recordID, int64(4)).Return(&record.Record{
+		ID:    recordID,
+		Title: "Careful",
+		Body:  "careful body",
+		State: record.StateOpen,
+		Tick:  3,
+	}, nil)
+	projectsRepo.On("IncrementTick", ctx, tenantID, "proj1").Return(int64(8), nil)
+	recordsRepo.On("SaveVersion", ctx, tenantID, current).Return(nil)
+	recordsRepo.On("Update", ctx, tenantID, mock.Anything, int64(7)).Return(nil)
+	sessionsRepo.On("AddActivation", ctx, "sess1", recordID, int64(8)).Return(nil)
+	sessionsRepo.On("Touch", ctx, tenantID, "sess1", int64(8), mock.Anything).Return(nil)
+	sessionsRepo.On("GetByRecordID", ctx, tenantID, recordID).Return([]record.SessionInfo{{SessionID: "sess1"}}, nil)
+	activitiesRepo.On("Log", ctx, tenantID, mock.MatchedBy(func(entry *activity.ActivityEntry) bool {
+		return entry.ActivityType == activity.TypeRecordReverted && entry.Tick == 8
+	})).Return(nil)
+
+	svc := record.NewService(recordsRepo, sessionsRepo, projectsRepo, activitiesRepo, nil, nil, nil, nil)
+	reverted, conflict, err := svc.Revert(ctx, tenantID, record.RevertRequest{
+		SessionID: "sess1",
+		ID:        recordID,
+		Tick:      4,
+	})
+	require.NoError(t, err)
+	require.Nil(t, conflict)
+	require.Equal(t, "Careful", reverted.Title)
+	require.Equal(t, "careful body", reverted.Body)
+	require.Equal(t, record.StateOpen, reverted.State)
+	require.Equal(t, int64(8), reverted.Tick)
+	activitiesRepo.AssertExpectations(t)
+}
+
+func TestRecordService_Revert_Conflict(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+	recordID := "r1"
+
+	recordsRepo := &mocks.RecordRepository{}
+	sessionsRepo := &mocks.SessionRepository{}
+
+	sessionsRepo.On("GetActivations", ctx, "sess1").Return([]string{recordID}, nil)
+	sessionsRepo.On("GetActivationTick", ctx, "sess1", recordID).Return(int64(5), nil)
+	recordsRepo.On("Get", ctx, tenantID, recordID).Return(&record.Record{
+		ID:        recordID,
+		ProjectID: "proj1",
+		Tick:      7,
+	}, nil)
+	recordsRepo.On("GetVersionAt", ctx, tenantID, recordID, int64(5)).Return(nil, repository.ErrNotFound)
+
+	svc := record.NewService(recordsRepo, sessionsRepo, nil, nil, nil, nil, nil, nil)
+	reverted, conflict, err := svc.Revert(ctx, tenantID, record.RevertRequest{
+		SessionID: "sess1",
+		ID:        recordID,
+		Tick:      4,
+	})
+	require.NoError(t, err)
+	require.Nil(t, reverted)
+	require.NotNil(t, conflict)
+}
+
+func TestRecordService_Revert_ValidatesState(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+	recordID := "r1"
+	resolver := "r2"
+
+	tests := []struct {
+		name    string
+		current record.RecordState
+		target  *record.Record
+		wantErr error
+	}{
+		{
+			name:    "resolved without resolved_by",
+			current: record.StateOpen,
+			target:  &record.Record{ID: recordID, State: record.StateResolved, Tick: 3},
+			wantErr: record.ErrMissingResolvedBy,
+		},
+		{
+			name:    "transition not allowed",
+			current: record.StateLater,
+			target:  &record.Record{ID: recordID, State: record.StateResolved, ResolvedBy: &resolver, Tick: 3},
+			wantErr: record.ErrInvalidTransition,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recordsRepo := &mocks.RecordRepository{}
+			sessionsRepo := &mocks.SessionRepository{}
+
+			sessionsRepo.On("GetActivations", ctx, "sess1").Return([]string{recordID}, nil)
+			sessionsRepo.On("GetActivationTick", ctx, "sess1", recordID).Return(int64(7), nil)
+			sessionsRepo.On("GetByRecordID", ctx, tenantID, recordID).Return([]record.SessionInfo{{SessionID: "sess1"}}, nil)
+			recordsRepo.On("Get", ctx, tenantID, recordID).Return(&record.Record{
+				ID:        recordID,
+				ProjectID: "proj1",
+				State:     tt.current,
+				Tick:      7,
+			}, nil)
+			recordsRepo.On("GetVersionAt", ctx, tenantID, recordID, int64(4)).Return(tt.target, nil)
+
+			svc := record.NewService(recordsRepo, sessionsRepo, nil, nil, nil, nil, nil, nil)
+			_, _, err := svc.Revert(ctx, tenantID, record.RevertRequest{
+				SessionID: "sess1",
+				ID:        recordID,
+				Tick:      4,
+			})
+			require.ErrorIs(t, err, tt.wantErr)
+			recordsRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestRecordService_Update_ConcurrentSession(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+	recordID := "r1"
+
+	recordsRepo := &mocks.RecordRepository{}
+	sessionsRepo := &mocks.SessionRepository{}
+	projectsRepo := &mocks.ProjectRepository{}
+	activitiesRepo := &mocks.ActivityRepository{}
+
+	current := &record.Record{
+		ID:        recordID,
+		ProjectID: "proj1",
+		Tick:      2,
+	}
+	sessionsRepo.On("GetActivations", ctx, "sess1").Return([]string{recordID}, nil)
+	sessionsRepo.On("GetActivationTick", ctx, "sess1", recordID).Return(int64(2), nil)
+	sessionsRepo.On("GetByRecordID", ctx, tenantID, recordID).Return([]record.SessionInfo{
+		{SessionID: "sess1"},
+		{SessionID: "sess2"},
+	}, nil)
+	recordsRepo.On("Get", ctx, tenantID, recordID).Return(current, nil)
+	activitiesRepo.On("Log", ctx, tenantID, mock.MatchedBy(func(entry *activity.ActivityEntry) bool {
+		return entry.ActivityType == activity.TypeConflictDetected && strings.Contains(entry.Details, "sess2")
+	})).Return(nil).Once()
+
+	svc := record.NewService(recordsRepo, sessionsRepo, projectsRepo, activitiesRepo, nil, nil, nil, nil)
+	updated, conflict, err := svc.Update(ctx, tenantID, record.UpdateRequest{
+		SessionID: "sess1",
+		ID:        recordID,
+	})
+	require.NoError(t, err)
+	require.Nil(t, updated)
+	require.NotNil(t, conflict)
+	require.Equal(t, record.ConflictConcurrentSession, conflict.ConflictType)
+	require.Len(t, conflict.Sessions, 1)
+	require.Equal(t, "sess2", conflict.Sessions[0].SessionID)
+
+	projectsRepo.On("IncrementTick", ctx, tenantID, "proj1").Return(int64(3), nil)
+	recordsRepo.On("SaveVersion", ctx, tenantID, current).Return(nil)
+	recordsRepo.On("Update", ctx, tenantID, mock.Anything, int64(2)).Return(nil)
+	sessionsRepo.On("AddActivation", ctx, "sess1", recordID, int64(3)).Return(nil)
+	sessionsRepo.On("Touch", ctx, tenantID, "sess1", int64(3), mock.Anything).Return(nil)
+	activitiesRepo.On("Log", ctx, tenantID, mock.MatchedBy(func(entry *activity.ActivityEntry) bool {
+		return entry.ActivityType == activity.TypeConflictResolved && strings.Contains(entry.Details, "sess2")
+	})).Return(nil).Once()
+	activitiesRepo.On("Log", ctx, tenantID, mock.MatchedBy(func(entry *activity.ActivityEntry) bool {
+		return entry.ActivityType == activity.TypeRecordUpdated
+	})).Return(nil).Once()
+
+	updated, conflict, err = svc.Update(ctx, tenantID, record.UpdateRequest{
+		SessionID: "sess1",
+		ID:        recordID,
+		Override:  true,
+	})
+	require.NoError(t, err)
+	require.Nil(t, conflict)
+	require.Equal(t, int64(3), updated.Tick)
+	activitiesRepo.AssertExpectations(t)
+}
+
+func TestRecordService_Update_StaleSessionDoesNotConflict(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+	recordID := "r1"
+
+	recordsRepo := &mocks.RecordRepository{}
+	sessionsRepo := &mocks.SessionRepository{}
+	projectsRepo := &mocks.ProjectRepository{}
+	activitiesRepo := &mocks.ActivityRepository{}
+
+	current := &record.Record{ID: recordID, ProjectID: "proj1", Tick: 2}
+	sessionsRepo.On("GetActivations", ctx, "sess1").Return([]string{recordID}, nil)
+	sessionsRepo.On("GetActivationTick", ctx, "sess1", recordID).Return(int64(2), nil)
+	sessionsRepo.On("GetByRecordID", ctx, tenantID, recordID).Return([]record.SessionInfo{
+		{SessionID: "sess1"},
+		{SessionID: "sess2", Stale: true},
+	}, nil)
+	recordsRepo.On("Get", ctx, tenantID, recordID).Return(current, nil)
+	projectsRepo.On("IncrementTick", ctx, tenantID, "proj1").Return(int64(3), nil)
+	recordsRepo.On("SaveVersion", ctx, tenantID, current).Return(nil)
+	recordsRepo.On("Update", ctx, tenantID, mock.Anything, int64(2)).Return(nil)
+	sessionsRepo.On("AddActivation", ctx, "sess1", recordID, int64(3)).Return(nil)
+	sessionsRepo.On("Touch", ctx, tenantID, "sess1", int64(3), mock.Anything).Return(nil)
+	// No conflict is logged, only the update.
+	activitiesRepo.On("Log", ctx, tenantID, mock.MatchedBy(func(entry *activity.ActivityEntry) bool {
+		return entry.ActivityType == activity.TypeRecordUpdated
+	})).Return(nil).Once()
+
+	svc := record.NewService(recordsRepo, sessionsRepo, projectsRepo, activitiesRepo, nil, nil, nil, nil)
+	updated, conflict, err := svc.Update(ctx, tenantID, record.UpdateRequest{
+		SessionID: "sess1",
+		ID:        recordID,
+	})
+	require.NoError(t, err)
+	require.Nil(t, conflict)
+	require.Equal(t, int64(3), updated.Tick)
+	activitiesRepo.AssertExpectations(t)
+}
+
+func TestRecordService_ResolveConflict(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+	recordID := "r1"
+
+	recordsRepo := &mocks.RecordRepository{}
+	sessionsRepo := &mocks.SessionRepository{}
+	projectsRepo := &mocks.ProjectRepository{}
+	activitiesRepo := &mocks.ActivityRepository{}
+
+	current := &record.Record{
+		ID:        recordID,
+		ProjectID: "proj1",
+		Title:     "Remote",
+		Body:      "remote body",
+		Tick:      4,
+	}
+	sessionsRepo.On("GetActivations", ctx, "sess1").Return([]string{recordID}, nil)
+	sessionsRepo.On("GetByRecordID", ctx, tenantID, recordID).Return([]record.SessionInfo{{SessionID: "sess1"}}, nil)
+	recordsRepo.On("Get", ctx, tenantID, recordID).Return(current, nil)
+
+	svc := record.NewService(recordsRepo, sessionsRepo, projectsRepo, activitiesRepo, nil, nil, nil, nil)
+
+	unresolved := "<<<<<<< proposed\nmine\n=======\ntheirs\n>>>>>>> tick:4"
+	_, _, err := svc.ResolveConflict(ctx, tenantID, record.ResolveConflictRequest{
+		SessionID:  "sess1",
+		ID:         recordID,
+		RemoteTick: 4,
+		Body:       &unresolved,
+	})
+	require.ErrorIs(t, err, record.ErrUnresolvedConflict)
+
+	recordsRepo.On("GetVersionAt", ctx, tenantID, recordID, int64(3)).Return(&record.Record{
+		ID:    recordID,
+		Title: "Older",
+		Body:  "remote body",
+		Tick:  3,
+	}, nil)
+	merged := "merged body"
+	resolved, conflict, err := svc.ResolveConflict(ctx, tenantID, record.ResolveConflictRequest{
+		SessionID:  "sess1",
+		ID:         recordID,
+		RemoteTick: 3,
+		Body:       &merged,
+	})
+	require.NoError(t, err)
+	require.Nil(t, resolved)
+	require.NotNil(t, conflict)
+	require.Equal(t, "merged body", conflict.Merge.Body)
+	require.Equal(t, "Remote", conflict.Merge.Title)
+
+	projectsRepo.On("IncrementTick", ctx, tenantID, "proj1").Return(int64(5), nil)
+	recordsRepo.On("SaveVersion", ctx, tenantID, current).Return(nil)
+	recordsRepo.On("Update", ctx, tenantID, mock.Anything, int64(4)).Return(nil)
+	sessionsRepo.On("AddActivation", ctx, "sess1", recordID, int64(5)).Return(nil)
+	sessionsRepo.On("Touch", ctx, tenantID, "sess1", int64(5), mock.Anything).Return(nil)
+	activitiesRepo.On("Log", ctx, tenantID, mock.MatchedBy(func(entry *activity.ActivityEntry) bool {
+		return entry.ActivityType == activity.TypeConflictResolved && entry.Tick == 5
+	})).Return(nil).Once()
+
+	resolved, conflict, err = svc.ResolveConflict(ctx, tenantID, record.ResolveConflictRequest{
+		SessionID:  "sess1",
+		ID:         recordID,
+		RemoteTick: 4,
+		Body:       &merged,
+	})
+	require.NoError(t, err)
+	require.Nil(t, conflict)
+	require.Equal(t, "Remote", resolved.Title)
+	require.Equal(t, "merged body", resolved.Body)
+	activitiesRepo.AssertExpectations(t)
+}
+
+func TestRecordService_LinkUnlink(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+
+	recordsRepo := &mocks.RecordRepository{}
+	sessionsRepo := &mocks.SessionRepository{}
+	projectsRepo := &mocks.ProjectRepository{}
+	activitiesRepo := &mocks.ActivityRepository{}
+
+	from := &record.Record{ID: "a", ProjectID: "proj1", Tick: 3, Related: []string{"c"}}
+	sessionsRepo.On("GetActivations", ctx, "sess1").Return([]string{"a"}, nil)
+	recordsRepo.On("Get", ctx, tenantID, "a").Return(from, nil)
+	recordsRepo.On("Get", ctx, tenantID, "b").Return(&record.Record{ID: "b", ProjectID: "proj1"}, nil)
+	recordsRepo.On("Get", ctx, tenantID, "missing").Return(nil, repository.ErrNotFound)
+
+	// Each link change writes the source record at a new tick, leaving its
+	// links to the relation change.
+	expectLinkWrite := func(tick int64) {
+		projectsRepo.On("IncrementTick", ctx, tenantID, "proj1").Return(tick, nil).Once()
+		recordsRepo.On("SaveVersion", ctx, tenantID, from).Return(nil).Once()
+		recordsRepo.On("Update", ctx, tenantID, mock.MatchedBy(func(rec *record.Record) bool {
+			return rec.ID == "a" && rec.Tick == tick && rec.Related == nil
+		}), int64(3)).Return(nil).Once()
+		sessionsRepo.On("AddActivation", ctx, "sess1", "a", tick).Return(nil).Once()
+		sessionsRepo.On("Touch", ctx, tenantID, "sess1", tick, mock.Anything).Return(nil).Once()
+	}
+
+	svc := record.NewService(recordsRepo, sessionsRepo, projectsRepo, activitiesRepo, nil, nil, nil, nil)
+
+	_, err := svc.Link(ctx, tenantID, record.LinkRequest{SessionID: "sess1", FromID: "a", ToID: "b", Kind: "causes"})
+	require.ErrorIs(t, err, record.ErrInvalidRelationKind)
+
+	_, err = svc.Link(ctx, tenantID, record.LinkRequest{SessionID: "sess1", FromID: "a", ToID: "a"})
+	require.ErrorIs(t, err, record.ErrInvalidInput)
+
+	_, err = svc.Link(ctx, tenantID, record.LinkRequest{SessionID: "sess1", FromID: "b", ToID: "a"})
+	require.ErrorIs(t, err, record.ErrNotActivated)
+
+	_, err = svc.Link(ctx, tenantID, record.LinkRequest{SessionID: "sess1", FromID: "a", ToID: "missing"})
+	require.ErrorIs(t, err, record.ErrRecordNotFound)
+
+	recordsRepo.On("AddRelation", ctx, "a", "b", record.RelationRelates).Return(nil).Once()
+	expectLinkWrite(4)
+	activitiesRepo.On("Log", ctx, tenantID, mock.MatchedBy(func(entry *activity.ActivityEntry) bool {
+		return entry.ActivityType == activity.TypeRecordLinked &&
+			entry.Tick == 4 &&
+			strings.Contains(entry.Details, `"kind":"relates"`)
+	})).Return(nil).Once()
+	rec, err := svc.Link(ctx, tenantID, record.LinkRequest{SessionID: "sess1", FromID: "a", ToID: "b"})
+	require.NoError(t, err)
+	require.Equal(t, "a", rec.ID)
+
+	recordsRepo.On("RemoveRelation", ctx, "a", "b", record.RelationBlocks).Return(repository.ErrNotFound).Once()
+	_, err = svc.Unlink(ctx, tenantID, record.LinkRequest{SessionID: "sess1", FromID: "a", ToID: "b", Kind: record.RelationBlocks})
+	require.ErrorIs(t, err, record.ErrRelationNotFound)
+
+	recordsRepo.On("RemoveRelation", ctx, "a", "b", record.RelationRelates).Return(nil).Once()
+	expectLinkWrite(5)
+	activitiesRepo.On("Log", ctx, tenantID, mock.MatchedBy(func(entry *activity.ActivityEntry) bool {
+		return entry.ActivityType == activity.TypeRecordUnlinked && entry.Tick == 5
+	})).Return(nil).Once()
+	_, err = svc.Unlink(ctx, tenantID, record.LinkRequest{SessionID: "sess1", FromID: "a", ToID: "b"})
+	require.NoError(t, err)
+
+	recordsRepo.AssertExpectations(t)
+	sessionsRepo.AssertExpectations(t)
+	activitiesRepo.AssertExpectations(t)
+}
+
+func TestRecordService_Move(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+	root := "root"
+	child := "child"
+
+	recordsRepo := &mocks.RecordRepository{}
+	sessionsRepo := &mocks.SessionRepository{}
+	projectsRepo := &mocks.ProjectRepository{}
+	activitiesRepo := &mocks.ActivityRepository{}
+
+	// root -> child, with "other" at the top level.
+	rootRec := &record.Record{ID: root, ProjectID: "proj1", Tick: 1}
+	childRec := &record.Record{ID: child, ProjectID: "proj1", ParentID: &root, Tick: 2}
+	otherRec := &record.Record{ID: "other", ProjectID: "proj1", Tick: 3}
+	sessionsRepo.On("GetActivations", ctx, "sess1").Return([]string{root, child, "other"}, nil)
+	sessionsRepo.On("GetActivationTick", ctx, "sess1", root).Return(int64(1), nil)
+	sessionsRepo.On("GetActivationTick", ctx, "sess1", child).Return(int64(2), nil)
+	sessionsRepo.On("GetByRecordID", ctx, tenantID, root).Return([]record.SessionInfo{{SessionID: "sess1"}}, nil)
+	sessionsRepo.On("GetByRecordID", ctx, tenantID, child).Return([]record.SessionInfo{{SessionID: "sess1"}}, nil)
+	recordsRepo.On("Get", ctx, tenantID, root).Return(rootRec, nil)
+	recordsRepo.On("Get", ctx, tenantID, child).Return(childRec, nil)
+	recordsRepo.On("Get", ctx, tenantID, "other").Return(otherRec, nil)
+
+	svc := record.NewService(recordsRepo, sessionsRepo, projectsRepo, activitiesRepo, nil, nil, nil, nil)
+
+	_, _, err := svc.Move(ctx, tenantID, record.MoveRequest{SessionID: "sess1", ID: root, ParentID: &child})
+	require.ErrorIs(t, err, record.ErrMoveCycle)
+
+	_, _, err = svc.Move(ctx, tenantID, record.MoveRequest{SessionID: "sess1", ID: root, ParentID: &root})
+	require.ErrorIs(t, err, record.ErrMoveCycle)
+
+	// The grandchild moves with child, and another session holds it.
+	grandchildRec := record.Record{ID: "grandchild", ProjectID: "proj1", ParentID: &child, Tick: 1}
+	recordsRepo.On("GetChildren", ctx, tenantID, child).Return([]record.Record{grandchildRec}, nil)
+	recordsRepo.On("GetChildren", ctx, tenantID, "grandchild").Return([]record.Record{}, nil)
+	sessionsRepo.On("GetByRecordID", ctx, tenantID, "grandchild").Return([]record.SessionInfo{{SessionID: "sess2"}}, nil)
+	activitiesRepo.On("Log", ctx, tenantID, mock.MatchedBy(func(entry *activity.ActivityEntry) bool {
+		return entry.ActivityType == activity.TypeConflictDetected && *entry.RecordID == "grandchild"
+	})).Return(nil).Once()
+
+	other := "other"
+	_, conflict, err := svc.Move(ctx, tenantID, record.MoveRequest{SessionID: "sess1", ID: child, ParentID: &other})
+	require.NoError(t, err)
+	require.NotNil(t, conflict)
+	require.Equal(t, record.ConflictConcurrentSession, conflict.ConflictType)
+	require.Equal(t, "sess2", conflict.Sessions[0].SessionID)
+
+	activitiesRepo.On("Log", ctx, tenantID, mock.MatchedBy(func(entry *activity.ActivityEntry) bool {
+		return entry.ActivityType == activity.TypeConflictResolved && *entry.RecordID == "grandchild"
+	})).Return(nil).Once()
+	projectsRepo.On("IncrementTick", ctx, tenantID, "proj1").Return(int64(4), nil)
+	recordsRepo.On("SaveVersion", ctx, tenantID, childRec).Return(nil)
+	recordsRepo.On("Update", ctx, tenantID, mock.MatchedBy(func(rec *record.Record) bool {
+		return rec.ID == child && rec.ParentID != nil && *rec.ParentID == "other"
+	}), int64(2)).Return(nil)
+	sessionsRepo.On("AddActivation", ctx, "sess1", child, int64(4)).Return(nil)
+	sessionsRepo.On("Touch", ctx, tenantID, "sess1", int64(4), mock.Anything).Return(nil)
+	activitiesRepo.On("Log", ctx, tenantID, mock.MatchedBy(func(entry *activity.ActivityEntry) bool {
+		return entry.ActivityType == activity.TypeRecordMoved &&
+			entry.Details == `{"new_parent_id":"other","old_parent_id":"root"}`
+	})).Return(nil).Once()
+
+	moved, conflict, err := svc.Move(ctx, tenantID, record.MoveRequest{SessionID: "sess1", ID: child, ParentID: &other, Override: true})
+	require.NoError(t, err)
+	require.Nil(t, conflict)
+	require.Equal(t, "other", *moved.ParentID)
+	require.Equal(t, int64(4), moved.Tick)
+	activitiesRepo.AssertExpectations(t)
+}
+
+func TestRecordService_DeleteRestore(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+	parent := "parent"
+	child := "child"
+
+	recordsRepo := &mocks.RecordRepository{}
+	sessionsRepo := &mocks.SessionRepository{}
+	projectsRepo := &mocks.ProjectRepository{}
+	activitiesRepo := &mocks.ActivityRepository{}
+
+	childRec := &record.Record{ID: child, ProjectID: "proj1", ParentID: &parent, Title: "Child", Tick: 2}
+	grandchildRec := record.Record{ID: "grandchild", ProjectID: "proj1", ParentID: &child, Title: "Grandchild", Tick: 1}
+	sessionsRepo.On("GetActivations", ctx, "sess1").Return([]string{child}, nil)
+	sessionsRepo.On("GetActivationTick", ctx, "sess1", child).Return(int64(2), nil)
+	sessionsRepo.On("GetByRecordID", ctx, tenantID, child).Return([]record.SessionInfo{{SessionID: "sess1"}}, nil)
+	sessionsRepo.On("GetByRecordID", ctx, tenantID, "grandchild").Return([]record.SessionInfo{}, nil)
+	recordsRepo.On("Get", ctx, tenantID, child).Return(childRec, nil).Once()
+	recordsRepo.On("GetChildren", ctx, tenantID, child).Return([]record.Record{grandchildRec}, nil).Once()
+	recordsRepo.On("GetChildren", ctx, tenantID, "grandchild").Return([]record.Record{}, nil)
+
+	// Every trashed record is versioned at its own tick.
+	projectsRepo.On("IncrementTick", ctx, tenantID, "proj1").Return(int64(3), nil).Once()
+	projectsRepo.On("IncrementTick", ctx, tenantID, "proj1").Return(int64(4), nil).Once()
+	recordsRepo.On("SaveVersion", ctx, tenantID, childRec).Return(nil)
+	recordsRepo.On("SaveVersion", ctx, tenantID, &grandchildRec).Return(nil)
+	recordsRepo.On("Update", ctx, tenantID, mock.MatchedBy(func(rec *record.Record) bool {
+		return rec.ID == child && rec.Tick == 3
+	}), int64(2)).Return(nil)
+	recordsRepo.On("Update", ctx, tenantID, mock.MatchedBy(func(rec *record.Record) bool {
+		return rec.ID == "grandchild" && rec.Tick == 4
+	}), int64(1)).Return(nil)
+	sessionsRepo.On("AddActivation", ctx, "sess1", child, int64(3)).Return(nil).Once()
+	sessionsRepo.On("Touch", ctx, tenantID, "sess1", int64(3), mock.Anything).Return(nil).Once()
+	sessionsRepo.On("AddActivation", ctx, "sess1", "grandchild", int64(4)).Return(nil).Once()
+	sessionsRepo.On("Touch", ctx, tenantID, "sess1", int64(4), mock.Anything).Return(nil).Once()
+	recordsRepo.On("SoftDelete", ctx, tenantID, child, mock.Anything).Return(2, nil)
+	activitiesRepo.On("Log", ctx, tenantID, mock.MatchedBy(func(entry *activity.ActivityEntry) bool {
+		return entry.ActivityType == activity.TypeRecordDeleted &&
+			*entry.RecordID == child &&
+			entry.Tick == 3 &&
+			entry.Details == `{"deleted_count":2}`
+	})).Return(nil).Once()
+	activitiesRepo.On("Log", ctx, tenantID, mock.MatchedBy(func(entry *activity.ActivityEntry) bool {
+		return entry.ActivityType == activity.TypeRecordDeleted &&
+			*entry.RecordID == "grandchild" &&
+			entry.Tick == 4
+	})).Return(nil).Once()
+
+	svc := record.NewService(recordsRepo, sessionsRepo, projectsRepo, activitiesRepo, nil, nil, nil, nil)
+
+	entry, conflict, err := svc.Delete(ctx, tenantID, record.DeleteRequest{SessionID: "sess1", ID: child})
+	require.NoError(t, err)
+	require.Nil(t, conflict)
+	require.Equal(t, child, entry.Record.ID)
+	require.Equal(t, 1, entry.Descendants)
+
+	// Restoring needs the parent out of the trash.
+	recordsRepo.On("GetTrashed", ctx, tenantID, "missing").Return(nil, repository.ErrNotFound)
+	recordsRepo.On("GetTrashed", ctx, tenantID, child).Return(childRec, nil)
+	recordsRepo.On("Get", ctx, tenantID, parent).Return(nil, repository.ErrNotFound).Once()
+
+	_, err = svc.Restore(ctx, tenantID, record.RestoreRequest{SessionID: "sess1", ID: "missing"})
+	require.ErrorIs(t, err, record.ErrNotInTrash)
+
+	_, err = svc.Restore(ctx, tenantID, record.RestoreRequest{SessionID: "sess1", ID: child})
+	require.ErrorIs(t, err, record.ErrParentInTrash)
+
+	// Every restored record is written at the restore's tick.
+	trashedChild := &record.Record{ID: child, ProjectID: "proj1", ParentID: &parent, Title: "Child", Tick: 3}
+	trashedGrandchild := record.Record{ID: "grandchild", ProjectID: "proj1", ParentID: &child, Title: "Grandchild", Tick: 4}
+	restoredChild := &record.Record{ID: child, ProjectID: "proj1", ParentID: &parent, Title: "Child", Tick: 5}
+	recordsRepo.On("Get", ctx, tenantID, parent).Return(&record.Record{ID: parent, ProjectID: "proj1"}, nil)
+	projectsRepo.On("IncrementTick", ctx, tenantID, "proj1").Return(int64(5), nil).Once()
+	recordsRepo.On("Restore", ctx, tenantID, child).Return(2, nil)
+	recordsRepo.On("Get", ctx, tenantID, child).Return(trashedChild, nil).Once()
+	recordsRepo.On("GetChildren", ctx, tenantID, child).Return([]record.Record{trashedGrandchild}, nil)
+	recordsRepo.On("SaveVersion", ctx, tenantID, trashedChild).Return(nil).Once()
+	recordsRepo.On("SaveVersion", ctx, tenantID, &trashedGrandchild).Return(nil).Once()
+	recordsRepo.On("Update", ctx, tenantID, mock.MatchedBy(func(rec *record.Record) bool {
+		return rec.ID == child && rec.Tick == 5
+	}), int64(3)).Return(nil).Once()
+	recordsRepo.On("Update", ctx, tenantID, mock.MatchedBy(func(rec *record.Record) bool {
+		return rec.ID == "grandchild" && rec.Tick == 5
+	}), int64(4)).Return(nil).Once()
+	sessionsRepo.On("AddActivation", ctx, "sess1", child, int64(5)).Return(nil).Once()
+	sessionsRepo.On("Touch", ctx, tenantID, "sess1", int64(5), mock.Anything).Return(nil)
+	activitiesRepo.On("Log", ctx, tenantID, mock.MatchedBy(func(entry *activity.ActivityEntry) bool {
+		return entry.ActivityType == activity.TypeRecordRestored &&
+			*entry.RecordID == child &&
+			entry.Tick == 5 &&
+			entry.Details == `{"restored_count":2}`
+	})).Return(nil).Once()
+	activitiesRepo.On("Log", ctx, tenantID, mock.MatchedBy(func(entry *activity.ActivityEntry) bool {
+		return entry.ActivityType == activity.TypeRecordRestored &&
+			*entry.RecordID == "grandchild" &&
+			entry.Tick == 5
+	})).Return(nil).Once()
+	recordsRepo.On("Get", ctx, tenantID, child).Return(restoredChild, nil).Once()
+
+	restored, err := svc.Restore(ctx, tenantID, record.RestoreRequest{SessionID: "sess1", ID: child})
+	require.NoError(t, err)
+	require.Equal(t, child, restored.ID)
+	require.Equal(t, int64(5), restored.Tick)
+	recordsRepo.AssertExpectations(t)
+	activitiesRepo.AssertExpectations(t)
+	sessionsRepo.AssertExpectations(t)
+}
+
+// fixedEmbedder embeds every text as the vector registered for it.
+type fixedEmbedder map[string][]float32
+
+func (e fixedEmbedder) Model() string { return "fixed" }
+
+func (e fixedEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = e[text]
+	}
+	return vectors, nil
+}
+
+func TestRecordService_SemanticAndHybridSearch(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+
+	searchRepo := &mocks.SearchRepository{}
+	embedder := fixedEmbedder{
+		"cache":                  {1, 0},
+		"Caching\nSummary\nBody": {0.8, 0.6},
+	}
+	query, err := record.ParseQuery("cache")
+	require.NoError(t, err)
+
+	// The record written before embeddings existed is embedded first.
+	searchRepo.On("MissingEmbeddings", ctx, tenantID, "fixed", 64).Return([]record.Record{
+		{ID: "b", Title: "Caching", Summary: "Summary", Body: "Body"},
+	}, nil).Once()
+	searchRepo.On("SaveEmbedding", ctx, "b", "fixed", mock.Anything, []float32{0.8, 0.6}).Return(nil).Once()
+	searchRepo.On("MissingEmbeddings", ctx, tenantID, "fixed", 64).Return([]record.Record{}, nil)
+	searchRepo.On("SearchEmbeddings", ctx, tenantID, "fixed", query, mock.Anything).Return([]record.EmbeddedRef{
+		{Ref: record.RecordRef{ID: "c", Title: "Eviction"}, Vector: []float32{0.6, 0.8}},
+		{Ref: record.RecordRef{ID: "b", Title: "Caching"}, Vector: []float32{0.8, 0.6}},
+		{Ref: record.RecordRef{ID: "d", Title: "Budget"}, Vector: []float32{0, 1}},
+	}, nil)
+	searchRepo.On("Search", ctx, tenantID, query, record.SearchOptions{Mode: record.SearchModeHybrid, Limit: 100}).Return([]record.SearchResult{
+		{Record: record.RecordRef{ID: "a"}, Rank: 9, Snippet: "**cache** a"},
+		{Record: record.RecordRef{ID: "b"}, Rank: 5, Snippet: "**cache** b"},
+	}, nil)
+
+	svc := record.NewService(nil, nil, nil, nil, searchRepo, embedder, nil, nil)
+
+	page, err := svc.Search(ctx, tenantID, "cache", record.SearchOptions{Mode: record.SearchModeSemantic, Limit: 2})
+	require.NoError(t, err)
+	results := page.Results
+	require.Len(t, results, 2)
+	require.Equal(t, "b", results[0].Record.ID)
+	require.InDelta(t, 0.8, results[0].Rank, 1e-6)
+	require.Equal(t, "c", results[1].Record.ID)
+	require.Equal(t, 3, page.Total)
+	require.NotEmpty(t, page.NextCursor)
+
+	// The cursor continues where the first page stopped.
+	page, err = svc.Search(ctx, tenantID, "cache", record.SearchOptions{Mode: record.SearchModeSemantic, Limit: 2, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, page.Results, 1)
+	require.Equal(t, "d", page.Results[0].Record.ID)
+	require.Empty(t, page.NextCursor)
+
+	// b is in both rankings, so it beats a, the top keyword hit.
+	page, err = svc.Search(ctx, tenantID, "cache", record.SearchOptions{Mode: record.SearchModeHybrid, Limit: 3})
+	require.NoError(t, err)
+	results = page.Results
+	require.Len(t, results, 3)
+	require.Equal(t, []string{"b", "a", "c"}, []string{results[0].Record.ID, results[1].Record.ID, results[2].Record.ID})
+	require.Equal(t, "**cache** b", results[0].Snippet)
+	require.Equal(t, 4, page.Total)
+	searchRepo.AssertExpectations(t)
+
+	_, err = svc.Search(ctx, tenantID, "cache", record.SearchOptions{Mode: "fuzzy"})
+	require.ErrorIs(t, err, record.ErrInvalidSearchMode)
+
+	disabled := record.NewService(nil, nil, nil, nil, searchRepo, nil, nil, nil)
+	_, err = disabled.Search(ctx, tenantID, "cache", record.SearchOptions{Mode: record.SearchModeSemantic})
+	require.ErrorIs(t, err, record.ErrSemanticSearchDisabled)
+}
+
+func TestRecordService_FindSimilarAndDuplicates(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+
+	recordsRepo := &mocks.RecordRepository{}
+	sessionsRepo := &mocks.SessionRepository{}
+	projectsRepo := &mocks.ProjectRepository{}
+	searchRepo := &mocks.SearchRepository{}
+
+	projectsRepo.On("IncrementTick", ctx, tenantID, "proj1").Return(int64(3), nil)
+	recordsRepo.On("Create", ctx, tenantID, mock.Anything).Return(nil)
+	similar := record.Query{MatchAny: true, Terms: []record.QueryTerm{
+		{Text: "should"}, {Text: "we"}, {Text: "cache"}, {Text: "session"}, {Text: "lookups"}, {Text: "caching"},
+	}}
+	searchRepo.On("Search", ctx, tenantID, similar, record.SearchOptions{
+		ProjectIDs: []string{"proj1"},
+		States:     []record.RecordState{record.StateOpen},
+		Limit:      21,
+	}).Return([]record.SearchResult{
+		{Record: record.RecordRef{ID: "near", Title: "Cache session lookups?", Summary: "Should we"}},
+		{Record: record.RecordRef{ID: "far", Title: "Session expiry", Summary: "When do sessions end"}},
+	}, nil)
+
+	svc := record.NewService(recordsRepo, sessionsRepo, projectsRepo, nil, searchRepo, nil, nil, nil)
+	rec, duplicates, err := svc.Create(ctx, tenantID, record.CreateRequest{
+		ProjectID: "proj1",
+		Type:      "question",
+		Title:     "Should we cache session lookups?",
+		Summary:   "Caching",
+		Body:      "Body",
+	})
+	require.NoError(t, err)
+	require.Len(t, duplicates, 1)
+	require.Equal(t, "near", duplicates[0].Record.ID)
+	require.InDelta(t, 10.0/11, duplicates[0].Similarity, 1e-9)
+
+	// Similar to an existing record: the record itself is left out.
+	recordsRepo.On("Get", ctx, tenantID, rec.ID).Return(rec, nil)
+	searchRepo.On("Search", ctx, tenantID, mock.MatchedBy(func(q record.Query) bool {
+		return q.MatchAny && len(q.Terms) == 7
+	}), record.SearchOptions{Limit: 2}).Return([]record.SearchResult{
+		{Record: record.RecordRef{ID: rec.ID}},
+		{Record: record.RecordRef{ID: "near"}},
+	}, nil)
+	results, err := svc.FindSimilar(ctx, tenantID, record.FindSimilarRequest{ID: rec.ID}, record.SearchOptions{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, "near", results[0].Record.ID)
+
+	_, err = svc.FindSimilar(ctx, tenantID, record.FindSimilarRequest{ID: rec.ID, Text: "draft"}, record.SearchOptions{})
+	require.ErrorIs(t, err, record.ErrInvalidInput)
+
+	results, err = svc.FindSimilar(ctx, tenantID, record.FindSimilarRequest{Text: "?!"}, record.SearchOptions{})
+	require.NoError(t, err)
+	require.Empty(t, results)
+}
+
+func TestRecordService_ListPaging(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+
+	recordsRepo := &mocks.RecordRepository{}
+	projectsRepo := &mocks.ProjectRepository{}
+	svc := record.NewService(recordsRepo, nil, projectsRepo, nil, nil, nil, nil, nil)
+
+	ticks := map[string]int64{"proj1": 7}
+	projectsRepo.On("Ticks", ctx, tenantID, []string{"proj1"}).Return(ticks, nil).Once()
+	first := record.ListRecordsOptions{ProjectID: "proj1", Sort: record.SortTitle, Limit: 2}
+	recordsRepo.On("Count", ctx, tenantID, record.ListRecordsOptions{ProjectID: "proj1", Sort: record.SortTitle, Limit: 2}).Return(3, nil)
+	recordsRepo.On("List", ctx, tenantID, record.ListRecordsOptions{ProjectID: "proj1", Sort: record.SortTitle, Limit: 3}).Return([]record.RecordRef{
+		{ID: "a", SortKey: "alpha"},
+		{ID: "b", SortKey: "beta"},
+		{ID: "c", SortKey: "gamma"},
+	}, nil)
+
+	list, err := svc.List(ctx, tenantID, first)
+	require.NoError(t, err)
+	require.Len(t, list.Records, 2)
+	require.Equal(t, 3, list.Total)
+	require.Zero(t, list.Changed)
+	require.NotEmpty(t, list.NextCursor)
+
+	cursor, err := record.DecodeCursor(list.NextCursor)
+	require.NoError(t, err)
+	require.Equal(t, record.Cursor{Sort: record.SortTitle, Key: "beta", ID: "b", Ticks: ticks}, cursor)
+
+	// The next page continues after b and counts records written since
+	// the first page was read.
+	recordsRepo.On("Count", ctx, tenantID, record.ListRecordsOptions{
+		ProjectID: "proj1", Sort: record.SortTitle, Limit: 2, Cursor: list.NextCursor, ChangedSince: ticks,
+	}).Return(1, nil)
+	recordsRepo.On("Count", ctx, tenantID, record.ListRecordsOptions{
+		ProjectID: "proj1", Sort: record.SortTitle, Limit: 2, Cursor: list.NextCursor,
+	}).Return(4, nil)
+	recordsRepo.On("List", ctx, tenantID, record.ListRecordsOptions{
+		ProjectID: "proj1", Sort: record.SortTitle, Limit: 3, Cursor: list.NextCursor, After: &cursor,
+	}).Return([]record.RecordRef{{ID: "c", SortKey: "gamma"}}, nil)
+
+	next := first
+	next.Cursor = list.NextCursor
+	list, err = svc.List(ctx, tenantID, next)
+	require.NoError(t, err)
+	require.Len(t, list.Records, 1)
+	require.Equal(t, 4, list.Total)
+	require.Equal(t, 1, list.Changed)
+	require.Empty(t, list.NextCursor)
+	recordsRepo.AssertExpectations(t)
+	projectsRepo.AssertExpectations(t)
+
+	// A cursor only continues a listing in the same order.
+	_, err = svc.List(ctx, tenantID, record.ListRecordsOptions{Sort: record.SortTick, Cursor: next.Cursor})
+	require.ErrorIs(t, err, record.ErrInvalidCursor)
+	_, err = svc.List(ctx, tenantID, record.ListRecordsOptions{Cursor: "not a cursor"})
+	require.ErrorIs(t, err, record.ErrInvalidCursor)
+	_, err = svc.List(ctx, tenantID, record.ListRecordsOptions{Sort: "size"})
+	require.ErrorIs(t, err, record.ErrInvalidSort)
+}
+
+func TestRecordService_Tree(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+
+	recordsRepo := &mocks.RecordRepository{}
+	svc := record.NewService(recordsRepo, nil, nil, nil, nil, nil, nil, nil)
+
+	a, b := "a", "b"
+	recordsRepo.On("Tree", ctx, tenantID, record.TreeOptions{ProjectID: "proj1", Depth: record.DefaultTreeDepth}).Return([]record.TreeNode{
+		{Record: record.RecordRef{ID: "a"}},
+		{Record: record.RecordRef{ID: "f"}},
+		{Record: record.RecordRef{ID: "b", ParentID: &a}},
+		{Record: record.RecordRef{ID: "c", ParentID: &a}},
+		{Record: record.RecordRef{ID: "d", ParentID: &b}, Descendants: 2},
+	}, nil)
+
+	roots, err := svc.Tree(ctx, tenantID, record.TreeOptions{ProjectID: "proj1"})
+	require.NoError(t, err)
+	require.Len(t, roots, 2)
+	require.Equal(t, "a", roots[0].Record.ID)
+	require.Empty(t, roots[1].Children)
+	require.Len(t, roots[0].Children, 2)
+	require.Equal(t, "b", roots[0].Children[0].Record.ID)
+	require.Equal(t, "d", roots[0].Children[0].Children[0].Record.ID)
+	require.Equal(t, 2, roots[0].Children[0].Children[0].Descendants)
+
+	recordsRepo.On("Tree", ctx, tenantID, record.TreeOptions{RootID: "missing", Depth: 1}).Return(nil, repository.ErrNotFound)
+	_, err = svc.Tree(ctx, tenantID, record.TreeOptions{RootID: "missing", Depth: 1})
+	require.ErrorIs(t, err, record.ErrRecordNotFound)
+
+	_, err = svc.Tree(ctx, tenantID, record.TreeOptions{ProjectID: "proj1", Depth: record.MaxTreeDepth + 1})
+	require.ErrorIs(t, err, record.ErrInvalidInput)
+	require.ErrorContains(t, err, "depth must be between 0 (default) and")
+	_, err = svc.Tree(ctx, tenantID, record.TreeOptions{})
+	require.ErrorIs(t, err, record.ErrInvalidInput)
+}
+
+func TestRecordService_ListIncludePath(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+
+	recordsRepo := &mocks.RecordRepository{}
+	svc := record.NewService(recordsRepo, nil, nil, nil, nil, nil, nil, nil)
+
+	opts := record.ListRecordsOptions{IDs: []string{"a", "c"}, IncludePath: true}
+	recordsRepo.On("Count", ctx, tenantID, record.ListRecordsOptions{IDs: []string{"a", "c"}, Sort: record.SortCreated, IncludePath: true}).Return(2, nil)
+	recordsRepo.On("List", ctx, tenantID, record.ListRecordsOptions{IDs: []string{"a", "c"}, Sort: record.SortCreated, IncludePath: true}).Return([]record.RecordRef{
+		{ID: "a"}, {ID: "c"},
+	}, nil)
+	recordsRepo.On("Ancestors", ctx, tenantID, []string{"a", "c"}).Return(map[string][]record.Ancestor{
+		"c": {{ID: "a"}, {ID: "b"}},
+	}, nil)
+
+	list, err := svc.List(ctx, tenantID, opts)
+	require.NoError(t, err)
+	require.Empty(t, list.Records[0].Ancestors)
+	require.Equal(t, []record.Ancestor{{ID: "a"}, {ID: "b"}}, list.Records[1].Ancestors)
+}
+
+func TestRecordService_ResolveID(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+
+	recordsRepo := &mocks.RecordRepository{}
+	svc := record.NewService(recordsRepo, nil, nil, nil, nil, nil, nil, nil)
+
+	full := "0f8e2c1a-3b4d-4e5f-8a9b-0c1d2e3f4a5b"
+	recordsRepo.On("MatchIDPrefix", ctx, tenantID, "0f8e2c1a", 5).Return([]string{full}, nil)
+	recordsRepo.On("MatchIDPrefix", ctx, tenantID, "0f8e2c1b", 5).Return([]string{}, nil)
+	recordsRepo.On("MatchIDPrefix", ctx, tenantID, "0f8e2c1c", 5).Return([]string{"0f8e2c1c-1", "0f8e2c1c-2"}, nil)
+
+	id, err := svc.ResolveID(ctx, tenantID, "0f8e2c1a")
+	require.NoError(t, err)
+	require.Equal(t, full, id)
+
+	// Full ids and strings shorter than a short id pass through untouched.
+	id, err = svc.ResolveID(ctx, tenantID, full)
+	require.NoError(t, err)
+	require.Equal(t, full, id)
+	id, err = svc.ResolveID(ctx, tenantID, "r1")
+	require.NoError(t, err)
+	require.Equal(t, "r1", id)
+
+	_, err = svc.ResolveID(ctx, tenantID, "0f8e2c1b")
+	require.ErrorIs(t, err, record.ErrRecordNotFound)
+	_, err = svc.ResolveID(ctx, tenantID, "0f8e2c1c")
+	require.ErrorIs(t, err, record.ErrAmbiguousID)
+	require.Contains(t, err.Error(), "0f8e2c1c-2")
+}
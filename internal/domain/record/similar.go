@@ -0,0 +1,80 @@
+package record
+
+import (
+	"strings"
+	"unicode"
+)
+
+// duplicateThreshold is the word overlap of title and summary above which
+// an OPEN record is reported as a possible duplicate of a new one.
+const duplicateThreshold = 0.7
+
+// duplicateCandidates caps the keyword matches checked for duplicates.
+const duplicateCandidates = 20
+
+// maxSimilarTerms caps the words of a text used to find similar records.
+const maxSimilarTerms = 32
+
+// textWords returns the distinct lowercased words of text, in order.
+func textWords(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	seen := make(map[string]bool, len(fields))
+	words := fields[:0]
+	for _, field := range fields {
+		if !seen[field] {
+			seen[field] = true
+			words = append(words, field)
+		}
+	}
+	return words
+}
+
+// similarityQuery returns a query matching records that share any word with
+// text, so BM25 ranks records sharing more and rarer words first.
+func similarityQuery(text string) Query {
+	words := textWords(text)
+	if len(words) > maxSimilarTerms {
+		words = words[:maxSimilarTerms]
+	}
+	query := Query{MatchAny: true}
+	for _, word := range words {
+		query.Terms = append(query.Terms, QueryTerm{Text: word})
+	}
+	return query
+}
+
+// wordOverlap returns the Dice coefficient of the word sets of a and b:
+// 1 when they use the same words, 0 when they share none.
+func wordOverlap(a, b string) float64 {
+	wordsA, wordsB := textWords(a), textWords(b)
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return 0
+	}
+	inA := make(map[string]bool, len(wordsA))
+	for _, word := range wordsA {
+		inA[word] = true
+	}
+	shared := 0
+	for _, word := range wordsB {
+		if inA[word] {
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(wordsA)+len(wordsB))
+}
+
+// withoutRecord drops the result for id, keeping at most limit results.
+func withoutRecord(results []SearchResult, id string, limit int) []SearchResult {
+	kept := make([]SearchResult, 0, len(results))
+	for _, result := range results {
+		if result.Record.ID != id {
+			kept = append(kept, result)
+		}
+	}
+	if limit > 0 && len(kept) > limit {
+		kept = kept[:limit]
+	}
+	return kept
+}
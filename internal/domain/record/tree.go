@@ -0,0 +1,50 @@
+package record
+
+import (
+	"context"
+	"fmt"
+)
+
+// DefaultTreeDepth is how many levels Tree returns when no depth is given.
+const DefaultTreeDepth = 3
+
+// MaxTreeDepth caps the levels Tree returns in one call.
+const MaxTreeDepth = 20
+
+// nestTree links flat nodes, parents listed before their children, into
+// trees and returns the top-level nodes in order.
+func nestTree(nodes []TreeNode) []*TreeNode {
+	byID := make(map[string]*TreeNode, len(nodes))
+	var roots []*TreeNode
+	for i := range nodes {
+		node := &nodes[i]
+		byID[node.Record.ID] = node
+		if node.Record.ParentID != nil {
+			if parent, ok := byID[*node.Record.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+	return roots
+}
+
+// setAncestors fills in the Ancestors of each ref, root first.
+func (s *Service) setAncestors(ctx context.Context, tenantID string, refs []*RecordRef) error {
+	if len(refs) == 0 {
+		return nil
+	}
+	ids := make([]string, len(refs))
+	for i, ref := range refs {
+		ids[i] = ref.ID
+	}
+	paths, err := s.records.Ancestors(ctx, tenantID, ids)
+	if err != nil {
+		return fmt.Errorf("loading ancestors: %w", err)
+	}
+	for _, ref := range refs {
+		ref.Ancestors = paths[ref.ID]
+	}
+	return nil
+}
@@ -1,6 +1,9 @@
 package record
 
-import "strings"
+import (
+	"slices"
+	"strings"
+)
 
 // ValidateCreateInput validates fields required to create a record.
 func ValidateCreateInput(req CreateRequest) error {
@@ -62,3 +65,17 @@ func ValidateTransition(fromState, toState RecordState, reason, resolvedBy *stri
 
 	return nil
 }
+
+// ValidateLink validates a request to add or remove a link.
+func ValidateLink(req LinkRequest) error {
+	if strings.TrimSpace(req.FromID) == "" || strings.TrimSpace(req.ToID) == "" {
+		return ErrInvalidInput
+	}
+	if req.FromID == req.ToID {
+		return ErrInvalidInput
+	}
+	if !slices.Contains(RelationKinds, req.Kind) {
+		return ErrInvalidRelationKind
+	}
+	return nil
+}
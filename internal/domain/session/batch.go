@@ -0,0 +1,156 @@
+package session
+
+import (
+	"fmt"
+
+	"github.com/rpggio/trellis/internal/domain/record"
+)
+
+// MaxBatchActivation caps the records activated in one call.
+const MaxBatchActivation = 20
+
+// activationIDs returns the records a request activates, without repeats.
+func activationIDs(req ActivateRequest) ([]string, error) {
+	if req.RecordID != "" && len(req.RecordIDs) > 0 {
+		return nil, fmt.Errorf("%w: give either one record ID or a list", ErrInvalidInput)
+	}
+	if req.RecordID != "" {
+		return []string{req.RecordID}, nil
+	}
+	if len(req.RecordIDs) > MaxBatchActivation {
+		return nil, fmt.Errorf("%w: at most %d records can be activated at once", ErrInvalidInput, MaxBatchActivation)
+	}
+
+	ids := make([]string, 0, len(req.RecordIDs))
+	seen := make(map[string]bool, len(req.RecordIDs))
+	for _, id := range req.RecordIDs {
+		if id == "" {
+			return nil, ErrInvalidInput
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, ErrInvalidInput
+	}
+	return ids, nil
+}
+
+// bundleMerger collects records for a merged bundle, keeping the first role
+// each record is claimed in.
+type bundleMerger struct {
+	claimed map[string]bool
+}
+
+func (m *bundleMerger) claim(id string) bool {
+	if m.claimed[id] {
+		return false
+	}
+	m.claimed[id] = true
+	return true
+}
+
+func (m *bundleMerger) records(dst []record.Record, recs ...record.Record) []record.Record {
+	for _, rec := range recs {
+		if m.claim(rec.ID) {
+			dst = append(dst, rec)
+		}
+	}
+	return dst
+}
+
+func (m *bundleMerger) refs(dst []record.RecordRef, refs ...record.RecordRef) []record.RecordRef {
+	for _, ref := range refs {
+		if m.claim(ref.ID) {
+			dst = append(dst, ref)
+		}
+	}
+	return dst
+}
+
+// mergeBundles merges the bundles of targets into one in which each record
+// appears once, in its most complete role: target, parent, full child,
+// unchanged reference, then the other references. The targets fill Targets
+// and Parents, and their ancestor paths go to Paths.
+func mergeBundles(targets []*record.Record, bundles []ContextBundle) ContextBundle {
+	m := &bundleMerger{claimed: make(map[string]bool)}
+	merged := ContextBundle{
+		Targets:       make([]record.Record, 0, len(targets)),
+		Parents:       make([]record.Record, 0),
+		Paths:         make(map[string][]record.Ancestor),
+		Ancestors:     make([]record.Ancestor, 0),
+		OpenChildren:  make([]record.Record, 0),
+		OtherChildren: make([]record.RecordRef, 0),
+		Grandchildren: make([]record.RecordRef, 0),
+	}
+
+	isTarget := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		isTarget[target.ID] = true
+	}
+
+	// Targets come first, full when changed and as unchanged references
+	// otherwise, so no other role can claim them.
+	for _, bundle := range bundles {
+		if bundle.Target != nil {
+			merged.Targets = m.records(merged.Targets, *bundle.Target)
+		}
+	}
+	for _, bundle := range bundles {
+		for _, ref := range bundle.Unchanged {
+			if isTarget[ref.ID] {
+				merged.Unchanged = m.refs(merged.Unchanged, ref)
+			}
+		}
+	}
+
+	for i, bundle := range bundles {
+		if len(bundle.Ancestors) > 0 {
+			merged.Paths[targets[i].ID] = bundle.Ancestors
+		}
+		if bundle.Parent != nil {
+			merged.Parents = m.records(merged.Parents, *bundle.Parent)
+		}
+	}
+	for _, bundle := range bundles {
+		merged.OpenChildren = m.records(merged.OpenChildren, bundle.OpenChildren...)
+	}
+	for _, bundle := range bundles {
+		merged.Unchanged = m.refs(merged.Unchanged, bundle.Unchanged...)
+	}
+	for _, bundle := range bundles {
+		merged.OtherChildren = m.refs(merged.OtherChildren, bundle.OtherChildren...)
+	}
+	for _, bundle := range bundles {
+		merged.Grandchildren = m.refs(merged.Grandchildren, bundle.Grandchildren...)
+	}
+	for _, bundle := range bundles {
+		merged.Descendants = m.refs(merged.Descendants, bundle.Descendants...)
+	}
+	for _, bundle := range bundles {
+		merged.Siblings = m.refs(merged.Siblings, bundle.Siblings...)
+	}
+	merged.Links = mergeLinks(m, bundles, func(b ContextBundle) map[record.RelationKind][]record.RecordRef { return b.Links })
+	merged.Backlinks = mergeLinks(m, bundles, func(b ContextBundle) map[record.RelationKind][]record.RecordRef { return b.Backlinks })
+	return merged
+}
+
+// mergeLinks merges the link groups that links picks from each bundle.
+func mergeLinks(m *bundleMerger, bundles []ContextBundle, links func(ContextBundle) map[record.RelationKind][]record.RecordRef) map[record.RelationKind][]record.RecordRef {
+	var merged map[record.RelationKind][]record.RecordRef
+	for _, kind := range record.RelationKinds {
+		for _, bundle := range bundles {
+			refs := m.refs(nil, links(bundle)[kind]...)
+			if len(refs) == 0 {
+				continue
+			}
+			if merged == nil {
+				merged = make(map[record.RelationKind][]record.RecordRef)
+			}
+			merged[kind] = append(merged[kind], refs...)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,190 @@
+package session
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rpggio/trellis/internal/domain/record"
+)
+
+// Token costs are estimated at bytesPerToken bytes of text per token, plus a
+// fixed overhead for the JSON fields around each record or reference.
+const (
+	bytesPerToken  = 4
+	recordOverhead = 40
+	refOverhead    = 20
+)
+
+// truncationMarker ends a body cut short to fit a token budget.
+const truncationMarker = "\n[truncated]"
+
+// BudgetReport describes what was left out of a bundle to fit MaxTokens.
+// Truncated lists records whose body was cut, Demoted the open children sent
+// as references in OtherChildren, and Omitted the references dropped.
+type BudgetReport struct {
+	MaxTokens       int      `json:"max_tokens"`
+	EstimatedTokens int      `json:"estimated_tokens"`
+	Truncated       []string `json:"truncated"`
+	Demoted         []string `json:"demoted"`
+	Omitted         []string `json:"omitted"`
+}
+
+// Cut reports whether anything was left out of the bundle.
+func (r *BudgetReport) Cut() bool {
+	return len(r.Truncated)+len(r.Demoted)+len(r.Omitted) > 0
+}
+
+// EstimateTokens returns the approximate number of tokens in text.
+func EstimateTokens(text string) int {
+	return (len(text) + bytesPerToken - 1) / bytesPerToken
+}
+
+func recordTokens(rec *record.Record) int {
+	return recordOverhead + EstimateTokens(rec.Title) + EstimateTokens(rec.Summary) + EstimateTokens(rec.Body)
+}
+
+func refTokens(ref record.RecordRef) int {
+	return refOverhead + EstimateTokens(ref.Title) + EstimateTokens(ref.Summary)
+}
+
+// budget tracks the tokens spent while a bundle is filled.
+type budget struct {
+	max    int
+	used   int
+	report *BudgetReport
+}
+
+// fits spends cost and reports true if the budget covers it.
+func (b *budget) fits(cost int) bool {
+	if b.used+cost > b.max {
+		return false
+	}
+	b.used += cost
+	return true
+}
+
+// fitRecord keeps rec, cutting its body to the tokens left. The title and
+// summary are always kept, even past the budget.
+func (b *budget) fitRecord(rec *record.Record) {
+	if b.fits(recordTokens(rec)) {
+		return
+	}
+	b.used += recordTokens(&record.Record{Title: rec.Title, Summary: rec.Summary})
+	if rec.Body == "" {
+		return
+	}
+
+	room := (b.max - b.used - EstimateTokens(truncationMarker)) * bytesPerToken
+	rec.Body = truncate(rec.Body, room)
+	b.used += EstimateTokens(rec.Body)
+	b.report.Truncated = append(b.report.Truncated, rec.ID)
+}
+
+// fitRefs keeps the references that fit, in order, and records the rest
+// as omitted.
+func (b *budget) fitRefs(refs []record.RecordRef) []record.RecordRef {
+	kept := refs[:0]
+	for _, ref := range refs {
+		if b.fits(refTokens(ref)) {
+			kept = append(kept, ref)
+			continue
+		}
+		b.report.Omitted = append(b.report.Omitted, ref.ID)
+	}
+	return kept
+}
+
+// truncate cuts text to at most n bytes on a rune boundary and marks the
+// cut. No text is kept when n leaves no room.
+func truncate(text string, n int) string {
+	if n >= len(text) {
+		return text
+	}
+	if n <= 0 {
+		return strings.TrimPrefix(truncationMarker, "\n")
+	}
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return strings.TrimRight(text[:n], " \t\n") + truncationMarker
+}
+
+// applyBudget trims bundle to about maxTokens tokens. It fills by priority:
+// the ancestor paths and unchanged references, which are always kept, then
+// the targets and parents, whose bodies are cut to fit, then open children,
+// which become references when they do not fit, then the other references.
+// childRefs are the target's children, used to demote open children.
+func applyBudget(bundle *ContextBundle, childRefs []record.RecordRef, maxTokens int) {
+	report := &BudgetReport{
+		MaxTokens: maxTokens,
+		Truncated: make([]string, 0),
+		Demoted:   make([]string, 0),
+		Omitted:   make([]string, 0),
+	}
+	b := &budget{max: maxTokens, report: report}
+
+	for _, ancestor := range bundle.Ancestors {
+		b.used += refOverhead + EstimateTokens(ancestor.Title)
+	}
+	for _, path := range bundle.Paths {
+		for _, ancestor := range path {
+			b.used += refOverhead + EstimateTokens(ancestor.Title)
+		}
+	}
+	for _, ref := range bundle.Unchanged {
+		b.used += refTokens(ref)
+	}
+
+	if bundle.Target != nil {
+		b.fitRecord(bundle.Target)
+	}
+	for i := range bundle.Targets {
+		b.fitRecord(&bundle.Targets[i])
+	}
+	if bundle.Parent != nil {
+		b.fitRecord(bundle.Parent)
+	}
+	for i := range bundle.Parents {
+		b.fitRecord(&bundle.Parents[i])
+	}
+
+	refsByID := make(map[string]record.RecordRef, len(childRefs))
+	for _, ref := range childRefs {
+		refsByID[ref.ID] = ref
+	}
+	openChildren := make([]record.Record, 0, len(bundle.OpenChildren))
+	demoted := make([]record.RecordRef, 0)
+	for i := range bundle.OpenChildren {
+		child := bundle.OpenChildren[i]
+		if b.fits(recordTokens(&child)) {
+			openChildren = append(openChildren, child)
+			continue
+		}
+		demoted = append(demoted, refsByID[child.ID])
+	}
+	bundle.OpenChildren = openChildren
+
+	// Demoted children lead the other children so they are the last
+	// references to be dropped.
+	kept := b.fitRefs(demoted)
+	for _, ref := range kept {
+		report.Demoted = append(report.Demoted, ref.ID)
+	}
+	bundle.OtherChildren = append(kept, b.fitRefs(bundle.OtherChildren)...)
+	bundle.Grandchildren = b.fitRefs(bundle.Grandchildren)
+	bundle.Descendants = b.fitRefs(bundle.Descendants)
+	for _, kind := range record.RelationKinds {
+		if refs, ok := bundle.Links[kind]; ok {
+			bundle.Links[kind] = b.fitRefs(refs)
+		}
+	}
+	for _, kind := range record.RelationKinds {
+		if refs, ok := bundle.Backlinks[kind]; ok {
+			bundle.Backlinks[kind] = b.fitRefs(refs)
+		}
+	}
+	bundle.Siblings = b.fitRefs(bundle.Siblings)
+
+	report.EstimatedTokens = b.used
+	bundle.Budget = report
+}
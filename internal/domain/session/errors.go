@@ -9,4 +9,6 @@ var (
 	ErrRecordNotFound = errors.New("record not found")
 	// ErrInvalidInput indicates invalid session input.
 	ErrInvalidInput = errors.New("invalid session input")
+	// ErrRecordNotActive indicates the record is not active in the session.
+	ErrRecordNotActive = errors.New("record not active in session")
 )
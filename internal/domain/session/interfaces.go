@@ -2,7 +2,9 @@ package session
 
 import (
 	"context"
+	"time"
 
+	"github.com/rpggio/trellis/internal/domain/activity"
 	"github.com/rpggio/trellis/internal/domain/project"
 	"github.com/rpggio/trellis/internal/domain/record"
 )
@@ -12,6 +14,8 @@ type RecordRepository interface {
 	Get(ctx context.Context, tenantID, id string) (*record.Record, error)
 	GetChildren(ctx context.Context, tenantID, parentID string) ([]record.Record, error)
 	GetChildrenRefs(ctx context.Context, tenantID, parentID string) ([]record.RecordRef, error)
+	List(ctx context.Context, tenantID string, opts record.ListRecordsOptions) ([]record.RecordRef, error)
+	Ancestors(ctx context.Context, tenantID string, ids []string) (map[string][]record.Ancestor, error)
 }
 
 // SessionRepository provides persistence for sessions.
@@ -20,10 +24,24 @@ type SessionRepository interface {
 	Get(ctx context.Context, tenantID, id string) (*Session, error)
 	Update(ctx context.Context, tenantID string, sess *Session) error
 	Close(ctx context.Context, tenantID, id string) error
+	MarkStale(ctx context.Context, tenantID, id string, lastActivity, staleAt time.Time) error
+	CloseStale(ctx context.Context, tenantID, id string, lastActivity time.Time) error
 	ListActive(ctx context.Context, tenantID, projectID string) ([]SessionInfo, error)
+	List(ctx context.Context, tenantID string, opts ListSessionsOptions) ([]Session, error)
+	ListOpen(ctx context.Context) ([]Session, error)
 	GetByRecordID(ctx context.Context, tenantID, recordID string) ([]SessionInfo, error)
 	AddActivation(ctx context.Context, sessionID, recordID string, tick int64) error
+	RemoveActivation(ctx context.Context, sessionID, recordID string) error
 	GetActivations(ctx context.Context, sessionID string) ([]string, error)
+	SetContextTick(ctx context.Context, sessionID, recordID string, tick int64) error
+	GetContextTick(ctx context.Context, sessionID, recordID string) (int64, error)
+}
+
+// ActivityRepository provides the activity log used to build change feeds
+// and to record activations.
+type ActivityRepository interface {
+	Log(ctx context.Context, tenantID string, entry *activity.ActivityEntry) error
+	List(ctx context.Context, tenantID string, opts activity.ListActivityOptions) ([]activity.ActivityEntry, error)
 }
 
 // ProjectRepository provides project access for tick data.
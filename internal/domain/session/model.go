@@ -15,6 +15,17 @@ const (
 	StatusClosed SessionStatus = "closed"
 )
 
+// Statuses lists every session status.
+var Statuses = []SessionStatus{StatusActive, StatusStale, StatusClosed}
+
+// ListSessionsOptions filters a session listing. An empty ProjectID lists
+// every project and an empty Status every status.
+type ListSessionsOptions struct {
+	ProjectID string
+	Status    SessionStatus
+	Limit     int
+}
+
 // Session represents a chat session tracking activated records
 type Session struct {
 	ID            string        `json:"id"`
@@ -25,18 +36,66 @@ type Session struct {
 	LastSyncTick  int64         `json:"last_sync_tick"`
 	CreatedAt     time.Time     `json:"created_at"`
 	LastActivity  time.Time     `json:"last_activity"`
+	StaleAt       *time.Time    `json:"stale_at,omitempty"`
 	ClosedAt      *time.Time    `json:"closed_at,omitempty"`
 	ActiveRecords []string      `json:"active_records"`
 }
 
-// ContextBundle contains everything needed to reason with a record
+// ContextBundle contains everything needed to reason with a record. Its
+// shape follows the activation policy: OpenChildren holds the children in
+// the policy's full states (OPEN by default), Descendants the levels below
+// Grandchildren, and Siblings the target's siblings when asked for.
+// On re-activation within a session, records the session was already sent
+// (tick not past SinceTick) are moved to Unchanged as references; Target and
+// Parent are then nil when unchanged. Ancestors is the path from the root
+// down to the parent. Links and Backlinks hold references to the records
+// linked from and to the target, grouped by relation kind. Budget is set
+// when the bundle was filled to a token budget.
+//
+// A batch activation merges the bundles of its records: Targets and Parents
+// then replace Target and Parent, Paths holds each target's ancestor path,
+// and every record appears only once.
 type ContextBundle struct {
-	Target        record.Record      `json:"target"`
-	Parent        *record.Record     `json:"parent,omitempty"`
-	OpenChildren  []record.Record    `json:"open_children"`
-	OtherChildren []record.RecordRef `json:"other_children"`
-	Grandchildren []record.RecordRef `json:"grandchildren"`
-	Warnings      []string           `json:"warnings,omitempty"`
+	Target        *record.Record                             `json:"target,omitempty"`
+	Targets       []record.Record                            `json:"targets,omitempty"`
+	Parent        *record.Record                             `json:"parent,omitempty"`
+	Parents       []record.Record                            `json:"parents,omitempty"`
+	Ancestors     []record.Ancestor                          `json:"ancestors"`
+	Paths         map[string][]record.Ancestor               `json:"paths,omitempty"`
+	OpenChildren  []record.Record                            `json:"open_children"`
+	OtherChildren []record.RecordRef                         `json:"other_children"`
+	Grandchildren []record.RecordRef                         `json:"grandchildren"`
+	Descendants   []record.RecordRef                         `json:"descendants,omitempty"`
+	Siblings      []record.RecordRef                         `json:"siblings,omitempty"`
+	Links         map[record.RelationKind][]record.RecordRef `json:"links,omitempty"`
+	Backlinks     map[record.RelationKind][]record.RecordRef `json:"backlinks,omitempty"`
+	Unchanged     []record.RecordRef                         `json:"unchanged,omitempty"`
+	SinceTick     int64                                      `json:"since_tick,omitempty"`
+	Warnings      []string                                   `json:"warnings,omitempty"`
+	Budget        *BudgetReport                              `json:"budget,omitempty"`
+}
+
+// ChangeType classifies a record change reported by sync.
+type ChangeType string
+
+const (
+	ChangeCreated      ChangeType = "created"
+	ChangeUpdated      ChangeType = "updated"
+	ChangeTransitioned ChangeType = "transitioned"
+	ChangeMoved        ChangeType = "moved"
+	ChangeDeleted      ChangeType = "deleted"
+	ChangeRestored     ChangeType = "restored"
+	ChangeLinked       ChangeType = "linked"
+	ChangeUnlinked     ChangeType = "unlinked"
+)
+
+// Change describes a record written since a session last synced. Activated
+// is set when the record is active in the syncing session.
+type Change struct {
+	Type      ChangeType       `json:"type"`
+	Tick      int64            `json:"tick"`
+	Record    record.RecordRef `json:"record"`
+	Activated bool             `json:"activated"`
 }
 
 // ConflictInfo describes a conflict detected during activation or update
@@ -48,11 +107,6 @@ type ConflictInfo struct {
 	Message        string         `json:"message"`
 }
 
-// SessionInfo provides information about an active session
-type SessionInfo struct {
-	SessionID     string    `json:"session_id"`
-	CreatedAt     time.Time `json:"created_at"`
-	LastActivity  time.Time `json:"last_activity"`
-	LastSyncTick  int64     `json:"last_sync_tick"`
-	ActiveRecords []string  `json:"active_records,omitempty"`
-}
+// SessionInfo provides information about an active session. It is declared
+// in the record package so record writes can report concurrent sessions.
+type SessionInfo = record.SessionInfo
@@ -5,19 +5,40 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"sort"
 	"time"
 
+	"github.com/rpggio/trellis/internal/domain/activity"
+	"github.com/rpggio/trellis/internal/domain/project"
 	"github.com/rpggio/trellis/internal/domain/record"
 	"github.com/rpggio/trellis/internal/repository"
 	"github.com/google/uuid"
 )
 
+// maxSyncChanges caps the change feed returned by SyncSession.
+const maxSyncChanges = 200
+
+// changeTypes maps record activity to the change types reported by sync.
+var changeTypes = map[activity.ActivityType]ChangeType{
+	activity.TypeRecordCreated:   ChangeCreated,
+	activity.TypeRecordUpdated:   ChangeUpdated,
+	activity.TypeRecordReverted:  ChangeUpdated,
+	activity.TypeStateTransition: ChangeTransitioned,
+	activity.TypeRecordMoved:     ChangeMoved,
+	activity.TypeRecordDeleted:   ChangeDeleted,
+	activity.TypeRecordRestored:  ChangeRestored,
+	activity.TypeRecordLinked:    ChangeLinked,
+	activity.TypeRecordUnlinked:  ChangeUnlinked,
+}
+
 // Service handles session operations.
 type Service struct {
-	records  RecordRepository
-	sessions SessionRepository
-	projects ProjectRepository
-	logger   *slog.Logger
+	records    RecordRepository
+	sessions   SessionRepository
+	projects   ProjectRepository
+	activities ActivityRepository
+	logger     *slog.Logger
 }
 
 // NewService creates a new session service.
@@ -25,78 +46,241 @@ func NewService(
 	records RecordRepository,
 	sessions SessionRepository,
 	projects ProjectRepository,
+	activities ActivityRepository,
 	logger *slog.Logger,
 ) *Service {
 	return &Service{
-		records:  records,
-		sessions: sessions,
-		projects: projects,
-		logger:   logger,
+		records:    records,
+		sessions:   sessions,
+		projects:   projects,
+		activities: activities,
+		logger:     logger,
 	}
 }
 
-// ActivateRequest describes a session activation request.
+// ActivateRequest describes a session activation request. RecordIDs
+// activates several records at once in place of RecordID.
+// Full forces the whole bundle even if the session already holds parts of it.
+// A positive MaxTokens fills the bundle to about that many tokens. Policy
+// overrides the project's activation policy field by field.
 type ActivateRequest struct {
 	SessionID string
 	RecordID  string
+	RecordIDs []string
+	Full      bool
+	MaxTokens int
+	Policy    project.ActivationPolicy
 }
 
-// ActivateResult holds activation response data.
+// ActivateResult holds activation response data. RecordWarnings holds the
+// warnings of each record of a batch activation, keyed by record ID.
 type ActivateResult struct {
-	SessionID string
-	Context   ContextBundle
-	Warnings  []string
+	SessionID      string
+	Context        ContextBundle
+	Warnings       []string
+	RecordWarnings map[string][]string
 }
 
-// SyncResult describes a sync response.
+// SyncResult describes a sync response. Changes lists records written since
+// the previous sync, most recent first, capped at maxSyncChanges.
 type SyncResult struct {
-	SessionID string
-	TickGap   int64
-	Status    SessionStatus
+	SessionID        string
+	TickGap          int64
+	Status           SessionStatus
+	Changes          []Change
+	ChangesTruncated bool
 }
 
-// Activate activates a record and returns a context bundle.
+// Activate activates one record, or several in a batch, and returns a
+// context bundle. A batch is activated at a single project tick and returns
+// the bundles of its records merged.
 func (s *Service) Activate(ctx context.Context, tenantID string, req ActivateRequest) (*ActivateResult, error) {
-	if req.RecordID == "" {
-		return nil, ErrInvalidInput
+	ids, err := activationIDs(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.MaxTokens < 0 {
+		return nil, fmt.Errorf("%w: max_tokens must not be negative", ErrInvalidInput)
+	}
+	if err := req.Policy.Validate(); err != nil {
+		return nil, err
 	}
 
-	target, err := s.records.Get(ctx, tenantID, req.RecordID)
-	if err != nil {
-		if errors.Is(err, repository.ErrNotFound) {
-			return nil, ErrRecordNotFound
+	targets := make([]*record.Record, len(ids))
+	for i, id := range ids {
+		target, err := s.records.Get(ctx, tenantID, id)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, ErrRecordNotFound
+			}
+			return nil, fmt.Errorf("loading record: %w", err)
+		}
+		if i > 0 && target.ProjectID != targets[0].ProjectID {
+			return nil, fmt.Errorf("%w: records must belong to one project", ErrInvalidInput)
 		}
-		return nil, fmt.Errorf("loading record: %w", err)
+		targets[i] = target
 	}
 
-	proj, err := s.projects.Get(ctx, tenantID, target.ProjectID)
+	proj, err := s.projects.Get(ctx, tenantID, targets[0].ProjectID)
 	if err != nil {
 		return nil, fmt.Errorf("loading project: %w", err)
 	}
 
-	sessionID, err := s.ensureSession(ctx, tenantID, req.SessionID, target, proj.Tick)
+	sinceTicks := make([]int64, len(targets))
+	if req.SessionID != "" && !req.Full {
+		for i, target := range targets {
+			sinceTicks[i], err = s.sessions.GetContextTick(ctx, req.SessionID, target.ID)
+			if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				return nil, fmt.Errorf("loading context tick: %w", err)
+			}
+		}
+	}
+
+	sessionID, err := s.ensureSession(ctx, tenantID, req.SessionID, targets[0], proj.Tick)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := s.sessions.AddActivation(ctx, sessionID, target.ID, proj.Tick); err != nil {
-		return nil, fmt.Errorf("adding activation: %w", err)
+	for _, target := range targets {
+		if err := s.sessions.AddActivation(ctx, sessionID, target.ID, proj.Tick); err != nil {
+			return nil, fmt.Errorf("adding activation: %w", err)
+		}
+		if err := s.logActivity(ctx, tenantID, &activity.ActivityEntry{
+			ProjectID:    proj.ID,
+			SessionID:    &sessionID,
+			RecordID:     &target.ID,
+			ActivityType: activity.TypeActivation,
+			Summary:      fmt.Sprintf("activated record %s", target.ID),
+			Tick:         proj.Tick,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	policy := req.Policy.Or(proj.ActivationPolicy).Or(project.DefaultActivationPolicy())
+	bundles := make([]ContextBundle, len(targets))
+	var childRefs []record.RecordRef
+	for i, target := range targets {
+		bundle, refs, err := s.loadContext(ctx, tenantID, target, policy, sinceTicks[i])
+		if err != nil {
+			return nil, err
+		}
+		bundles[i] = bundle
+		childRefs = append(childRefs, refs...)
 	}
 
-	context, err := s.loadContext(ctx, tenantID, target)
+	context := bundles[0]
+	if len(bundles) > 1 {
+		context = mergeBundles(targets, bundles)
+	}
+	if req.MaxTokens > 0 {
+		applyBudget(&context, childRefs, req.MaxTokens)
+	}
+
+	for _, target := range targets {
+		if err := s.sessions.SetContextTick(ctx, sessionID, target.ID, proj.Tick); err != nil {
+			return nil, fmt.Errorf("recording context tick: %w", err)
+		}
+	}
+
+	result := &ActivateResult{SessionID: sessionID, Context: context}
+	if len(targets) == 1 {
+		result.Warnings, err = s.activationWarnings(ctx, tenantID, sessionID, targets[0].ID)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	result.Warnings = make([]string, 0)
+	result.RecordWarnings = make(map[string][]string)
+	for _, target := range targets {
+		warnings, err := s.activationWarnings(ctx, tenantID, sessionID, target.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(warnings) > 0 {
+			result.RecordWarnings[target.ID] = warnings
+		}
+	}
+	return result, nil
+}
+
+// DeactivateResult describes the records a session released and those it
+// still holds.
+type DeactivateResult struct {
+	SessionID     string
+	Released      []string
+	ActiveRecords []string
+}
+
+// Deactivate releases records from a session, so other sessions no longer
+// see them as busy. Every record must be active in the session; otherwise
+// nothing is released. Activating a released record again sends its full
+// bundle.
+func (s *Service) Deactivate(ctx context.Context, tenantID, sessionID string, recordIDs []string) (*DeactivateResult, error) {
+	if sessionID == "" || len(recordIDs) == 0 {
+		return nil, ErrInvalidInput
+	}
+
+	sess, err := s.sessions.Get(ctx, tenantID, sessionID)
 	if err != nil {
-		return nil, err
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("loading session: %w", err)
 	}
 
-	warnings, err := s.activationWarnings(ctx, tenantID, sessionID, target.ID)
+	active, err := s.sessions.GetActivations(ctx, sessionID)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("loading activations: %w", err)
+	}
+	released := make([]string, 0, len(recordIDs))
+	for _, id := range recordIDs {
+		if !slices.Contains(active, id) {
+			return nil, fmt.Errorf("%w: %s", ErrRecordNotActive, id)
+		}
+		if !slices.Contains(released, id) {
+			released = append(released, id)
+		}
+	}
+
+	proj, err := s.projects.Get(ctx, tenantID, sess.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("loading project: %w", err)
+	}
+
+	for _, id := range released {
+		if err := s.sessions.RemoveActivation(ctx, sessionID, id); err != nil {
+			return nil, fmt.Errorf("removing activation: %w", err)
+		}
+		if err := s.logActivity(ctx, tenantID, &activity.ActivityEntry{
+			ProjectID:    proj.ID,
+			SessionID:    &sessionID,
+			RecordID:     &id,
+			ActivityType: activity.TypeDeactivation,
+			Summary:      fmt.Sprintf("released record %s", id),
+			Tick:         proj.Tick,
+		}); err != nil {
+			return nil, err
+		}
 	}
 
-	return &ActivateResult{
-		SessionID: sessionID,
-		Context:   context,
-		Warnings:  warnings,
+	sess.LastActivity = time.Now()
+	if err := s.sessions.Update(ctx, tenantID, sess); err != nil {
+		return nil, fmt.Errorf("updating session: %w", err)
+	}
+
+	remaining := make([]string, 0, len(active))
+	for _, id := range active {
+		if !slices.Contains(released, id) {
+			remaining = append(remaining, id)
+		}
+	}
+	return &DeactivateResult{
+		SessionID:     sessionID,
+		Released:      released,
+		ActiveRecords: remaining,
 	}, nil
 }
 
@@ -119,19 +303,27 @@ func (s *Service) SyncSession(ctx context.Context, tenantID, sessionID string) (
 		return nil, fmt.Errorf("loading project: %w", err)
 	}
 
+	changes, truncated, err := s.changesSince(ctx, tenantID, sess)
+	if err != nil {
+		return nil, err
+	}
+
 	tickGap := proj.Tick - sess.LastSyncTick
 	sess.LastSyncTick = proj.Tick
 	sess.LastActivity = time.Now()
 	sess.Status = StatusActive
+	sess.StaleAt = nil
 
 	if err := s.sessions.Update(ctx, tenantID, sess); err != nil {
 		return nil, fmt.Errorf("updating session: %w", err)
 	}
 
 	return &SyncResult{
-		SessionID: sessionID,
-		TickGap:   tickGap,
-		Status:    sess.Status,
+		SessionID:        sessionID,
+		TickGap:          tickGap,
+		Status:           sess.Status,
+		Changes:          changes,
+		ChangesTruncated: truncated,
 	}, nil
 }
 
@@ -157,6 +349,7 @@ func (s *Service) SaveSession(ctx context.Context, tenantID, sessionID string) e
 	sess.LastSyncTick = proj.Tick
 	sess.LastActivity = time.Now()
 	sess.Status = StatusActive
+	sess.StaleAt = nil
 
 	if err := s.sessions.Update(ctx, tenantID, sess); err != nil {
 		return fmt.Errorf("updating session: %w", err)
@@ -206,6 +399,126 @@ func (s *Service) ListActiveSessions(ctx context.Context, tenantID, projectID st
 	return sessions, nil
 }
 
+// ListSessions returns sessions matching opts, most recently active first,
+// each with its active records.
+func (s *Service) ListSessions(ctx context.Context, tenantID string, opts ListSessionsOptions) ([]Session, error) {
+	if opts.Status != "" && !slices.Contains(Statuses, opts.Status) {
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidInput, opts.Status)
+	}
+	if opts.Limit < 0 {
+		return nil, fmt.Errorf("%w: limit must not be negative", ErrInvalidInput)
+	}
+
+	sessions, err := s.sessions.List(ctx, tenantID, opts)
+	if err != nil {
+		return nil, fmt.Errorf("listing sessions: %w", err)
+	}
+
+	for i := range sessions {
+		activations, err := s.sessions.GetActivations(ctx, sessions[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("loading activations for session %s: %w", sessions[i].ID, err)
+		}
+		if activations == nil {
+			activations = []string{}
+		}
+		sessions[i].ActiveRecords = activations
+	}
+
+	return sessions, nil
+}
+
+// changesSince collects record changes logged after the session's last sync
+// tick, one entry per record. A record created in the window is reported as
+// created; otherwise its latest change wins.
+func (s *Service) changesSince(ctx context.Context, tenantID string, sess *Session) ([]Change, bool, error) {
+	if s.activities == nil {
+		return nil, false, nil
+	}
+
+	entries, err := s.activities.List(ctx, tenantID, activity.ListActivityOptions{
+		ProjectID: sess.ProjectID,
+		SinceTick: sess.LastSyncTick,
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("loading activity: %w", err)
+	}
+
+	byRecord := make(map[string]*Change)
+	for _, entry := range entries {
+		changeType, ok := changeTypes[entry.ActivityType]
+		if !ok || entry.RecordID == nil {
+			continue
+		}
+
+		change, seen := byRecord[*entry.RecordID]
+		if !seen {
+			byRecord[*entry.RecordID] = &Change{Type: changeType, Tick: entry.Tick}
+			continue
+		}
+		if entry.Tick > change.Tick {
+			change.Tick = entry.Tick
+			if change.Type != ChangeCreated {
+				change.Type = changeType
+			}
+		}
+		if changeType == ChangeCreated {
+			change.Type = ChangeCreated
+		}
+	}
+	if len(byRecord) == 0 {
+		return []Change{}, false, nil
+	}
+
+	ids := make([]string, 0, len(byRecord))
+	for id := range byRecord {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return byRecord[ids[i]].Tick > byRecord[ids[j]].Tick
+	})
+
+	truncated := len(ids) > maxSyncChanges
+	if truncated {
+		ids = ids[:maxSyncChanges]
+	}
+
+	refs, err := s.records.List(ctx, tenantID, record.ListRecordsOptions{
+		ProjectID: sess.ProjectID,
+		IDs:       ids,
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("loading changed records: %w", err)
+	}
+	refsByID := make(map[string]record.RecordRef, len(refs))
+	for _, ref := range refs {
+		refsByID[ref.ID] = ref
+	}
+
+	activated := make(map[string]bool, len(sess.ActiveRecords))
+	for _, id := range sess.ActiveRecords {
+		activated[id] = true
+	}
+
+	changes := make([]Change, 0, len(ids))
+	for _, id := range ids {
+		change := byRecord[id]
+		ref, ok := refsByID[id]
+		if !ok {
+			// Deleted records no longer list; report them by ID only.
+			if change.Type != ChangeDeleted {
+				continue
+			}
+			ref = record.RecordRef{ID: id}
+		}
+		change.Record = ref
+		change.Activated = activated[id]
+		changes = append(changes, *change)
+	}
+
+	return changes, truncated, nil
+}
+
 func (s *Service) ensureSession(ctx context.Context, tenantID, sessionID string, target *record.Record, projectTick int64) (string, error) {
 	now := time.Now()
 	if sessionID == "" {
@@ -248,6 +561,7 @@ func (s *Service) ensureSession(ctx context.Context, tenantID, sessionID string,
 	sess.LastSyncTick = projectTick
 	sess.LastActivity = now
 	sess.Status = StatusActive
+	sess.StaleAt = nil
 	if err := s.sessions.Update(ctx, tenantID, sess); err != nil {
 		return "", fmt.Errorf("updating session: %w", err)
 	}
@@ -255,23 +569,42 @@ func (s *Service) ensureSession(ctx context.Context, tenantID, sessionID string,
 	return sessionID, nil
 }
 
-func (s *Service) loadContext(ctx context.Context, tenantID string, target *record.Record) (ContextBundle, error) {
+// loadContext builds the context bundle for target, shaped by policy, which
+// must have every field set, and returns it with the target's child
+// references. A non-zero sinceTick is the tick at which the session was
+// last sent this bundle; records not modified since then are returned as
+// unchanged references.
+func (s *Service) loadContext(ctx context.Context, tenantID string, target *record.Record, policy project.ActivationPolicy, sinceTick int64) (ContextBundle, []record.RecordRef, error) {
 	var parent *record.Record
-	if target.ParentID != nil {
+	ancestors := make([]record.Ancestor, 0)
+	if target.ParentID != nil && *policy.AncestorDepth > 0 {
 		p, err := s.records.Get(ctx, tenantID, *target.ParentID)
 		if err != nil {
-			return ContextBundle{}, fmt.Errorf("loading parent: %w", err)
+			return ContextBundle{}, nil, fmt.Errorf("loading parent: %w", err)
 		}
 		parent = p
-	}
 
-	children, err := s.records.GetChildren(ctx, tenantID, target.ID)
-	if err != nil {
-		return ContextBundle{}, fmt.Errorf("loading children: %w", err)
+		paths, err := s.records.Ancestors(ctx, tenantID, []string{target.ID})
+		if err != nil {
+			return ContextBundle{}, nil, fmt.Errorf("loading ancestors: %w", err)
+		}
+		if path, ok := paths[target.ID]; ok {
+			ancestors = path[max(len(path)-*policy.AncestorDepth, 0):]
+		}
 	}
-	childRefs, err := s.records.GetChildrenRefs(ctx, tenantID, target.ID)
-	if err != nil {
-		return ContextBundle{}, fmt.Errorf("loading child refs: %w", err)
+
+	var children []record.Record
+	var childRefs []record.RecordRef
+	if *policy.DescendantDepth > 0 {
+		var err error
+		children, err = s.records.GetChildren(ctx, tenantID, target.ID)
+		if err != nil {
+			return ContextBundle{}, nil, fmt.Errorf("loading children: %w", err)
+		}
+		childRefs, err = s.records.GetChildrenRefs(ctx, tenantID, target.ID)
+		if err != nil {
+			return ContextBundle{}, nil, fmt.Errorf("loading child refs: %w", err)
+		}
 	}
 
 	childrenByID := make(map[string]record.Record, len(children))
@@ -282,7 +615,7 @@ func (s *Service) loadContext(ctx context.Context, tenantID string, target *reco
 	openChildren := make([]record.Record, 0)
 	otherChildren := make([]record.RecordRef, 0)
 	for _, ref := range childRefs {
-		if ref.State == record.StateOpen {
+		if slices.Contains(policy.FullStates, ref.State) {
 			if full, ok := childrenByID[ref.ID]; ok {
 				openChildren = append(openChildren, full)
 			}
@@ -291,22 +624,197 @@ func (s *Service) loadContext(ctx context.Context, tenantID string, target *reco
 		}
 	}
 
+	// Each level below the children is loaded from the one above it.
 	grandchildren := make([]record.RecordRef, 0)
-	for _, ref := range childRefs {
-		refs, err := s.records.GetChildrenRefs(ctx, tenantID, ref.ID)
+	var descendants []record.RecordRef
+	level := childRefs
+	for depth := 2; depth <= *policy.DescendantDepth && len(level) > 0; depth++ {
+		var next []record.RecordRef
+		for _, ref := range level {
+			refs, err := s.records.GetChildrenRefs(ctx, tenantID, ref.ID)
+			if err != nil {
+				return ContextBundle{}, nil, fmt.Errorf("loading descendants: %w", err)
+			}
+			next = append(next, refs...)
+		}
+		if depth == 2 {
+			grandchildren = append(grandchildren, next...)
+		} else {
+			descendants = append(descendants, next...)
+		}
+		level = next
+	}
+
+	var links, backlinks map[record.RelationKind][]record.RecordRef
+	if *policy.IncludeLinks {
+		var err error
+		links, err = s.linkedRefs(ctx, tenantID, target.Links)
+		if err != nil {
+			return ContextBundle{}, nil, fmt.Errorf("loading links: %w", err)
+		}
+		backlinks, err = s.linkedRefs(ctx, tenantID, target.Backlinks)
+		if err != nil {
+			return ContextBundle{}, nil, fmt.Errorf("loading backlinks: %w", err)
+		}
+	}
+
+	var siblings []record.RecordRef
+	if *policy.IncludeSiblings {
+		var err error
+		siblings, err = s.siblingRefs(ctx, tenantID, target)
 		if err != nil {
-			return ContextBundle{}, fmt.Errorf("loading grandchildren: %w", err)
+			return ContextBundle{}, nil, fmt.Errorf("loading siblings: %w", err)
 		}
-		grandchildren = append(grandchildren, refs...)
 	}
 
-	return ContextBundle{
-		Target:        *target,
+	bundle := ContextBundle{
+		Target:        target,
 		Parent:        parent,
+		Ancestors:     ancestors,
 		OpenChildren:  openChildren,
 		OtherChildren: otherChildren,
 		Grandchildren: grandchildren,
-	}, nil
+		Descendants:   descendants,
+		Siblings:      siblings,
+		Links:         links,
+		Backlinks:     backlinks,
+	}
+	if sinceTick > 0 {
+		if err := s.omitUnchanged(ctx, tenantID, &bundle, childRefs, sinceTick); err != nil {
+			return ContextBundle{}, nil, err
+		}
+	}
+	return bundle, childRefs, nil
+}
+
+// siblingRefs loads references to the other children of target's parent,
+// or to the other root records of its project.
+func (s *Service) siblingRefs(ctx context.Context, tenantID string, target *record.Record) ([]record.RecordRef, error) {
+	var refs []record.RecordRef
+	var err error
+	if target.ParentID != nil {
+		refs, err = s.records.GetChildrenRefs(ctx, tenantID, *target.ParentID)
+	} else {
+		rootID := ""
+		refs, err = s.records.List(ctx, tenantID, record.ListRecordsOptions{
+			ProjectID: target.ProjectID,
+			ParentID:  &rootID,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	siblings := make([]record.RecordRef, 0, len(refs))
+	for _, ref := range refs {
+		if ref.ID != target.ID {
+			siblings = append(siblings, ref)
+		}
+	}
+	return siblings, nil
+}
+
+// linkedRefs loads references to the records at the far end of links,
+// grouped by relation kind.
+func (s *Service) linkedRefs(ctx context.Context, tenantID string, links []record.Link) (map[record.RelationKind][]record.RecordRef, error) {
+	if len(links) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, 0, len(links))
+	for _, link := range links {
+		ids = append(ids, link.RecordID)
+	}
+	refs, err := s.records.List(ctx, tenantID, record.ListRecordsOptions{IDs: ids})
+	if err != nil {
+		return nil, err
+	}
+	refsByID := make(map[string]record.RecordRef, len(refs))
+	for _, ref := range refs {
+		refsByID[ref.ID] = ref
+	}
+
+	grouped := make(map[record.RelationKind][]record.RecordRef)
+	for _, link := range links {
+		if ref, ok := refsByID[link.RecordID]; ok {
+			grouped[link.Kind] = append(grouped[link.Kind], ref)
+		}
+	}
+	return grouped, nil
+}
+
+// omitUnchanged replaces full records the session already holds with
+// references marked unchanged.
+func (s *Service) omitUnchanged(ctx context.Context, tenantID string, bundle *ContextBundle, childRefs []record.RecordRef, sinceTick int64) error {
+	bundle.SinceTick = sinceTick
+	bundle.Unchanged = make([]record.RecordRef, 0)
+
+	targetUnchanged := bundle.Target.Tick <= sinceTick
+	if targetUnchanged {
+		bundle.Unchanged = append(bundle.Unchanged, unchangedRef(bundle.Target, childRefs))
+		bundle.Target = nil
+	}
+
+	// An unchanged target has not moved, so the session also holds its parent.
+	if bundle.Parent != nil && targetUnchanged && bundle.Parent.Tick <= sinceTick {
+		siblings, err := s.records.GetChildrenRefs(ctx, tenantID, bundle.Parent.ID)
+		if err != nil {
+			return fmt.Errorf("loading parent children: %w", err)
+		}
+		bundle.Unchanged = append(bundle.Unchanged, unchangedRef(bundle.Parent, siblings))
+		bundle.Parent = nil
+	}
+
+	refsByID := make(map[string]record.RecordRef, len(childRefs))
+	for _, ref := range childRefs {
+		refsByID[ref.ID] = ref
+	}
+
+	openChildren := make([]record.Record, 0, len(bundle.OpenChildren))
+	for _, child := range bundle.OpenChildren {
+		if child.Tick > sinceTick {
+			openChildren = append(openChildren, child)
+			continue
+		}
+		ref := refsByID[child.ID]
+		ref.Unchanged = true
+		bundle.Unchanged = append(bundle.Unchanged, ref)
+	}
+	bundle.OpenChildren = openChildren
+
+	return nil
+}
+
+func unchangedRef(rec *record.Record, children []record.RecordRef) record.RecordRef {
+	openCount := 0
+	for _, child := range children {
+		if child.State == record.StateOpen {
+			openCount++
+		}
+	}
+
+	return record.RecordRef{
+		ID:                rec.ID,
+		Type:              rec.Type,
+		Title:             rec.Title,
+		Summary:           rec.Summary,
+		State:             rec.State,
+		ParentID:          rec.ParentID,
+		ChildrenCount:     len(children),
+		OpenChildrenCount: openCount,
+		Unchanged:         true,
+	}
+}
+
+// logActivity appends entry to the activity log, when one is configured.
+func (s *Service) logActivity(ctx context.Context, tenantID string, entry *activity.ActivityEntry) error {
+	if s.activities == nil {
+		return nil
+	}
+	if err := s.activities.Log(ctx, tenantID, entry); err != nil {
+		return fmt.Errorf("logging activity: %w", err)
+	}
+	return nil
 }
 
 func (s *Service) activationWarnings(ctx context.Context, tenantID, sessionID, recordID string) ([]string, error) {
@@ -317,7 +825,11 @@ func (s *Service) activationWarnings(ctx context.Context, tenantID, sessionID, r
 
 	warnings := make([]string, 0)
 	for _, info := range sessions {
-		if info.SessionID != sessionID {
+		switch {
+		case info.SessionID == sessionID:
+		case info.Stale:
+			warnings = append(warnings, fmt.Sprintf("record active in stale session %s", info.SessionID))
+		default:
 			warnings = append(warnings, fmt.Sprintf("record active in session %s", info.SessionID))
 		}
 	}
@@ -2,12 +2,15 @@ package session_test
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/rpggio/trellis/internal/domain/activity"
 	"github.com/rpggio/trellis/internal/domain/project"
 	"github.com/rpggio/trellis/internal/domain/record"
 	"github.com/rpggio/trellis/internal/domain/session"
+	"github.com/rpggio/trellis/internal/repository"
 	"github.com/rpggio/trellis/internal/repository/mocks"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -46,6 +49,9 @@ func TestSessionService_Activate_ContextLoading(t *testing.T) {
 	recordsRepo.On("GetChildrenRefs", ctx, tenantID, recordID).Return(childRefs, nil)
 	recordsRepo.On("GetChildrenRefs", ctx, tenantID, "c1").Return([]record.RecordRef{}, nil)
 	recordsRepo.On("GetChildrenRefs", ctx, tenantID, "c2").Return([]record.RecordRef{}, nil)
+	recordsRepo.On("Ancestors", ctx, tenantID, []string{recordID}).Return(map[string][]record.Ancestor{
+		recordID: {{ID: "root", Title: "Root"}, {ID: parentID, Title: "Parent"}},
+	}, nil)
 
 	projectsRepo.On("Get", ctx, tenantID, "proj1").Return(&project.Project{
 		ID:   "proj1",
@@ -54,15 +60,19 @@ func TestSessionService_Activate_ContextLoading(t *testing.T) {
 
 	sessionsRepo.On("Create", ctx, tenantID, mock.Anything).Return(nil)
 	sessionsRepo.On("AddActivation", ctx, mock.Anything, recordID, int64(7)).Return(nil)
+	sessionsRepo.On("SetContextTick", ctx, mock.Anything, recordID, int64(7)).Return(nil)
 	sessionsRepo.On("GetByRecordID", ctx, tenantID, recordID).Return([]session.SessionInfo{}, nil)
 
-	svc := session.NewService(recordsRepo, sessionsRepo, projectsRepo, nil)
+	svc := session.NewService(recordsRepo, sessionsRepo, projectsRepo, nil, nil)
 	result, err := svc.Activate(ctx, tenantID, session.ActivateRequest{RecordID: recordID})
 	require.NoError(t, err)
 	require.NotEmpty(t, result.SessionID)
 	require.NotNil(t, result.Context.Parent)
 	require.Len(t, result.Context.OpenChildren, 1)
 	require.Len(t, result.Context.OtherChildren, 1)
+	require.Len(t, result.Context.Ancestors, 2)
+	require.Equal(t, "root", result.Context.Ancestors[0].ID)
+	require.Equal(t, parentID, result.Context.Ancestors[1].ID)
 }
 
 func TestSessionService_Activate_Warnings(t *testing.T) {
@@ -88,11 +98,12 @@ func TestSessionService_Activate_Warnings(t *testing.T) {
 
 	sessionsRepo.On("Create", ctx, tenantID, mock.Anything).Return(nil)
 	sessionsRepo.On("AddActivation", ctx, mock.Anything, recordID, int64(2)).Return(nil)
+	sessionsRepo.On("SetContextTick", ctx, mock.Anything, recordID, int64(2)).Return(nil)
 	sessionsRepo.On("GetByRecordID", ctx, tenantID, recordID).Return([]session.SessionInfo{
 		{SessionID: "other"},
 	}, nil)
 
-	svc := session.NewService(recordsRepo, sessionsRepo, projectsRepo, nil)
+	svc := session.NewService(recordsRepo, sessionsRepo, projectsRepo, nil, nil)
 	result, err := svc.Activate(ctx, tenantID, session.ActivateRequest{RecordID: recordID})
 	require.NoError(t, err)
 	require.Len(t, result.Warnings, 1)
@@ -118,12 +129,60 @@ func TestSessionService_SyncSession(t *testing.T) {
 	}, nil)
 	sessionsRepo.On("Update", ctx, tenantID, mock.Anything).Return(nil)
 
-	svc := session.NewService(recordsRepo, sessionsRepo, projectsRepo, nil)
+	svc := session.NewService(recordsRepo, sessionsRepo, projectsRepo, nil, nil)
 	result, err := svc.SyncSession(ctx, tenantID, sessionID)
 	require.NoError(t, err)
 	require.Equal(t, int64(4), result.TickGap)
 }
 
+func TestSessionService_SyncSession_Changes(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+	sessionID := "sess1"
+	created := "r1"
+	edited := "r2"
+
+	recordsRepo := &mocks.RecordRepository{}
+	sessionsRepo := &mocks.SessionRepository{}
+	projectsRepo := &mocks.ProjectRepository{}
+	activitiesRepo := &mocks.ActivityRepository{}
+
+	sessionsRepo.On("Get", ctx, tenantID, sessionID).Return(&session.Session{
+		ID:            sessionID,
+		ProjectID:     "proj1",
+		LastSyncTick:  2,
+		ActiveRecords: []string{edited},
+	}, nil)
+	projectsRepo.On("Get", ctx, tenantID, "proj1").Return(&project.Project{
+		ID:   "proj1",
+		Tick: 6,
+	}, nil)
+	sessionsRepo.On("Update", ctx, tenantID, mock.Anything).Return(nil)
+	activitiesRepo.On("List", ctx, tenantID, activity.ListActivityOptions{
+		ProjectID: "proj1",
+		SinceTick: 2,
+	}).Return([]activity.ActivityEntry{
+		{RecordID: &created, ActivityType: activity.TypeRecordUpdated, Tick: 6},
+		{RecordID: &edited, ActivityType: activity.TypeStateTransition, Tick: 5},
+		{RecordID: &created, ActivityType: activity.TypeRecordCreated, Tick: 4},
+		{RecordID: &edited, ActivityType: activity.TypeRecordUpdated, Tick: 3},
+		{ActivityType: activity.TypeSessionStarted, Tick: 3},
+	}, nil)
+	recordsRepo.On("List", ctx, tenantID, record.ListRecordsOptions{
+		ProjectID: "proj1",
+		IDs:       []string{created, edited},
+	}).Return([]record.RecordRef{{ID: edited}, {ID: created}}, nil)
+
+	svc := session.NewService(recordsRepo, sessionsRepo, projectsRepo, activitiesRepo, nil)
+	result, err := svc.SyncSession(ctx, tenantID, sessionID)
+	require.NoError(t, err)
+	require.Equal(t, []session.Change{
+		{Type: session.ChangeCreated, Tick: 6, Record: record.RecordRef{ID: created}},
+		{Type: session.ChangeTransitioned, Tick: 5, Record: record.RecordRef{ID: edited}, Activated: true},
+	}, result.Changes)
+	require.False(t, result.ChangesTruncated)
+}
+
 func TestSessionService_SaveClose(t *testing.T) {
 	ctx := context.Background()
 	tenantID := "tenant1"
@@ -144,7 +203,7 @@ func TestSessionService_SaveClose(t *testing.T) {
 	sessionsRepo.On("Update", ctx, tenantID, mock.Anything).Return(nil)
 	sessionsRepo.On("Close", ctx, tenantID, sessionID).Return(nil)
 
-	svc := session.NewService(recordsRepo, sessionsRepo, projectsRepo, nil)
+	svc := session.NewService(recordsRepo, sessionsRepo, projectsRepo, nil, nil)
 	require.NoError(t, svc.SaveSession(ctx, tenantID, sessionID))
 	require.NoError(t, svc.CloseSession(ctx, tenantID, sessionID))
 }
@@ -179,13 +238,457 @@ func TestSessionService_Activate_WithExistingSession(t *testing.T) {
 		LastActivity: now,
 	}, nil)
 	sessionsRepo.On("Update", ctx, tenantID, mock.Anything).Return(nil)
+	sessionsRepo.On("GetContextTick", ctx, sessionID, recordID).Return(int64(0), repository.ErrNotFound)
 	sessionsRepo.On("AddActivation", ctx, sessionID, recordID, int64(9)).Return(nil)
+	sessionsRepo.On("SetContextTick", ctx, sessionID, recordID, int64(9)).Return(nil)
 	sessionsRepo.On("GetByRecordID", ctx, tenantID, recordID).Return([]session.SessionInfo{}, nil)
 
-	svc := session.NewService(recordsRepo, sessionsRepo, projectsRepo, nil)
+	svc := session.NewService(recordsRepo, sessionsRepo, projectsRepo, nil, nil)
 	_, err := svc.Activate(ctx, tenantID, session.ActivateRequest{
 		SessionID: sessionID,
 		RecordID:  recordID,
 	})
 	require.NoError(t, err)
 }
+
+func TestSessionService_Activate_OmitsUnchanged(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+	recordID := "r1"
+	parentID := "p1"
+	sessionID := "sess1"
+
+	recordsRepo := &mocks.RecordRepository{}
+	sessionsRepo := &mocks.SessionRepository{}
+	projectsRepo := &mocks.ProjectRepository{}
+
+	target := &record.Record{
+		ID:        recordID,
+		ProjectID: "proj1",
+		ParentID:  &parentID,
+		State:     record.StateOpen,
+		Tick:      3,
+	}
+	parent := &record.Record{ID: parentID, ProjectID: "proj1", Tick: 1}
+
+	children := []record.Record{
+		{ID: "c1", State: record.StateOpen, Tick: 4},
+		{ID: "c2", State: record.StateOpen, Tick: 8},
+	}
+	childRefs := []record.RecordRef{
+		{ID: "c1", State: record.StateOpen},
+		{ID: "c2", State: record.StateOpen},
+	}
+
+	recordsRepo.On("Get", ctx, tenantID, recordID).Return(target, nil)
+	recordsRepo.On("Get", ctx, tenantID, parentID).Return(parent, nil)
+	recordsRepo.On("GetChildren", ctx, tenantID, recordID).Return(children, nil)
+	recordsRepo.On("GetChildrenRefs", ctx, tenantID, recordID).Return(childRefs, nil)
+	recordsRepo.On("GetChildrenRefs", ctx, tenantID, parentID).Return([]record.RecordRef{{ID: recordID, State: record.StateOpen}}, nil)
+	recordsRepo.On("Ancestors", ctx, tenantID, []string{recordID}).Return(map[string][]record.Ancestor{
+		recordID: {{ID: parentID}},
+	}, nil)
+	recordsRepo.On("GetChildrenRefs", ctx, tenantID, "c1").Return([]record.RecordRef{}, nil)
+	recordsRepo.On("GetChildrenRefs", ctx, tenantID, "c2").Return([]record.RecordRef{}, nil)
+
+	projectsRepo.On("Get", ctx, tenantID, "proj1").Return(&project.Project{
+		ID:   "proj1",
+		Tick: 9,
+	}, nil)
+
+	sessionsRepo.On("Get", ctx, tenantID, sessionID).Return(&session.Session{
+		ID:        sessionID,
+		ProjectID: "proj1",
+	}, nil)
+	sessionsRepo.On("Update", ctx, tenantID, mock.Anything).Return(nil)
+	sessionsRepo.On("GetContextTick", ctx, sessionID, recordID).Return(int64(5), nil)
+	sessionsRepo.On("AddActivation", ctx, sessionID, recordID, int64(9)).Return(nil)
+	sessionsRepo.On("SetContextTick", ctx, sessionID, recordID, int64(9)).Return(nil)
+	sessionsRepo.On("GetByRecordID", ctx, tenantID, recordID).Return([]session.SessionInfo{}, nil)
+
+	svc := session.NewService(recordsRepo, sessionsRepo, projectsRepo, nil, nil)
+	result, err := svc.Activate(ctx, tenantID, session.ActivateRequest{
+		SessionID: sessionID,
+		RecordID:  recordID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(5), result.Context.SinceTick)
+	require.Nil(t, result.Context.Target)
+	require.Nil(t, result.Context.Parent)
+	require.Len(t, result.Context.OpenChildren, 1)
+	require.Equal(t, "c2", result.Context.OpenChildren[0].ID)
+
+	unchanged := make([]string, 0, len(result.Context.Unchanged))
+	for _, ref := range result.Context.Unchanged {
+		require.True(t, ref.Unchanged)
+		unchanged = append(unchanged, ref.ID)
+	}
+	require.ElementsMatch(t, []string{recordID, parentID, "c1"}, unchanged)
+
+	full, err := svc.Activate(ctx, tenantID, session.ActivateRequest{
+		SessionID: sessionID,
+		RecordID:  recordID,
+		Full:      true,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, full.Context.Target)
+	require.Len(t, full.Context.OpenChildren, 2)
+	require.Empty(t, full.Context.Unchanged)
+}
+
+func TestSessionService_Activate_MaxTokens(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+	recordID := "r1"
+
+	recordsRepo := &mocks.RecordRepository{}
+	sessionsRepo := &mocks.SessionRepository{}
+	projectsRepo := &mocks.ProjectRepository{}
+
+	body := strings.Repeat("word ", 80) // 100 tokens
+	target := &record.Record{ID: recordID, ProjectID: "proj1", Title: "r1", Body: body, State: record.StateOpen}
+	children := []record.Record{
+		{ID: "c1", Title: "c1", Body: body, State: record.StateOpen},
+		{ID: "c2", Title: "c2", Body: body, State: record.StateOpen},
+	}
+	childRefs := []record.RecordRef{
+		{ID: "c1", Title: "c1", State: record.StateOpen},
+		{ID: "c2", Title: "c2", State: record.StateOpen},
+		{ID: "c3", Title: "c3", State: record.StateResolved},
+	}
+
+	recordsRepo.On("Get", ctx, tenantID, recordID).Return(target, nil)
+	recordsRepo.On("GetChildren", ctx, tenantID, recordID).Return(children, nil)
+	recordsRepo.On("GetChildrenRefs", ctx, tenantID, recordID).Return(childRefs, nil)
+	for _, ref := range childRefs {
+		recordsRepo.On("GetChildrenRefs", ctx, tenantID, ref.ID).Return([]record.RecordRef{}, nil)
+	}
+	projectsRepo.On("Get", ctx, tenantID, "proj1").Return(&project.Project{ID: "proj1", Tick: 7}, nil)
+	sessionsRepo.On("Create", ctx, tenantID, mock.Anything).Return(nil)
+	sessionsRepo.On("AddActivation", ctx, mock.Anything, recordID, int64(7)).Return(nil)
+	sessionsRepo.On("SetContextTick", ctx, mock.Anything, recordID, int64(7)).Return(nil)
+	sessionsRepo.On("GetByRecordID", ctx, tenantID, recordID).Return([]session.SessionInfo{}, nil)
+
+	svc := session.NewService(recordsRepo, sessionsRepo, projectsRepo, nil, nil)
+
+	// The target and one open child fit; the other open child is demoted and
+	// the resolved child's ref no longer fits.
+	result, err := svc.Activate(ctx, tenantID, session.ActivateRequest{RecordID: recordID, MaxTokens: 320})
+	require.NoError(t, err)
+	bundle := result.Context
+	require.Equal(t, body, bundle.Target.Body)
+	require.Len(t, bundle.OpenChildren, 1)
+	require.Equal(t, "c1", bundle.OpenChildren[0].ID)
+	require.Len(t, bundle.OtherChildren, 1)
+	require.Equal(t, "c2", bundle.OtherChildren[0].ID)
+	require.NotNil(t, bundle.Budget)
+	require.Equal(t, 320, bundle.Budget.MaxTokens)
+	require.LessOrEqual(t, bundle.Budget.EstimatedTokens, 320)
+	require.Empty(t, bundle.Budget.Truncated)
+	require.Equal(t, []string{"c2"}, bundle.Budget.Demoted)
+	require.Equal(t, []string{"c3"}, bundle.Budget.Omitted)
+
+	// A budget smaller than the target truncates its body.
+	result, err = svc.Activate(ctx, tenantID, session.ActivateRequest{RecordID: recordID, MaxTokens: 50})
+	require.NoError(t, err)
+	bundle = result.Context
+	require.True(t, strings.HasSuffix(bundle.Target.Body, "[truncated]"))
+	require.Less(t, len(bundle.Target.Body), len(body))
+	require.Equal(t, []string{recordID}, bundle.Budget.Truncated)
+	require.Empty(t, bundle.OpenChildren)
+	require.ElementsMatch(t, []string{"c1", "c2", "c3"}, bundle.Budget.Omitted)
+
+	// Without a budget the bundle is whole.
+	result, err = svc.Activate(ctx, tenantID, session.ActivateRequest{RecordID: recordID})
+	require.NoError(t, err)
+	require.Nil(t, result.Context.Budget)
+	require.Len(t, result.Context.OpenChildren, 2)
+
+	_, err = svc.Activate(ctx, tenantID, session.ActivateRequest{RecordID: recordID, MaxTokens: -1})
+	require.ErrorIs(t, err, session.ErrInvalidInput)
+}
+
+func TestSessionService_Activate_Policy(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+	recordID := "r1"
+	parentID := "p1"
+
+	recordsRepo := &mocks.RecordRepository{}
+	sessionsRepo := &mocks.SessionRepository{}
+	projectsRepo := &mocks.ProjectRepository{}
+
+	target := &record.Record{
+		ID:        recordID,
+		ProjectID: "proj1",
+		ParentID:  &parentID,
+		State:     record.StateOpen,
+		Links:     []record.Link{{RecordID: "l1", Kind: record.RelationRelates}},
+	}
+	children := []record.Record{
+		{ID: "c1", State: record.StateOpen},
+		{ID: "c2", State: record.StateResolved},
+	}
+	childRefs := []record.RecordRef{
+		{ID: "c1", State: record.StateOpen},
+		{ID: "c2", State: record.StateResolved},
+	}
+
+	recordsRepo.On("Get", ctx, tenantID, recordID).Return(target, nil)
+	recordsRepo.On("GetChildren", ctx, tenantID, recordID).Return(children, nil)
+	recordsRepo.On("GetChildrenRefs", ctx, tenantID, recordID).Return(childRefs, nil)
+	recordsRepo.On("GetChildrenRefs", ctx, tenantID, parentID).Return([]record.RecordRef{
+		{ID: "s1", State: record.StateOpen},
+		{ID: recordID, State: record.StateOpen},
+	}, nil)
+
+	// The project loads resolved children in full and skips links; the
+	// request also leaves out the parent and grandchildren and adds siblings.
+	linksOff := false
+	projectsRepo.On("Get", ctx, tenantID, "proj1").Return(&project.Project{
+		ID:   "proj1",
+		Tick: 7,
+		ActivationPolicy: project.ActivationPolicy{
+			FullStates:   []record.RecordState{record.StateResolved},
+			IncludeLinks: &linksOff,
+		},
+	}, nil)
+
+	sessionsRepo.On("Create", ctx, tenantID, mock.Anything).Return(nil)
+	sessionsRepo.On("AddActivation", ctx, mock.Anything, recordID, int64(7)).Return(nil)
+	sessionsRepo.On("SetContextTick", ctx, mock.Anything, recordID, int64(7)).Return(nil)
+	sessionsRepo.On("GetByRecordID", ctx, tenantID, recordID).Return([]session.SessionInfo{}, nil)
+
+	ancestorDepth, descendantDepth := 0, 1
+	siblings := true
+	svc := session.NewService(recordsRepo, sessionsRepo, projectsRepo, nil, nil)
+	result, err := svc.Activate(ctx, tenantID, session.ActivateRequest{
+		RecordID: recordID,
+		Policy: project.ActivationPolicy{
+			AncestorDepth:   &ancestorDepth,
+			DescendantDepth: &descendantDepth,
+			IncludeSiblings: &siblings,
+		},
+	})
+	require.NoError(t, err)
+	bundle := result.Context
+	require.Nil(t, bundle.Parent)
+	require.Empty(t, bundle.Ancestors)
+	require.Len(t, bundle.OpenChildren, 1)
+	require.Equal(t, "c2", bundle.OpenChildren[0].ID)
+	require.Len(t, bundle.OtherChildren, 1)
+	require.Equal(t, "c1", bundle.OtherChildren[0].ID)
+	require.Empty(t, bundle.Grandchildren)
+	require.Nil(t, bundle.Links)
+	require.Len(t, bundle.Siblings, 1)
+	require.Equal(t, "s1", bundle.Siblings[0].ID)
+	recordsRepo.AssertNotCalled(t, "Get", ctx, tenantID, parentID)
+	recordsRepo.AssertNotCalled(t, "GetChildrenRefs", ctx, tenantID, "c1")
+
+	tooDeep := project.MaxActivationDepth + 1
+	_, err = svc.Activate(ctx, tenantID, session.ActivateRequest{
+		RecordID: recordID,
+		Policy:   project.ActivationPolicy{DescendantDepth: &tooDeep},
+	})
+	require.ErrorIs(t, err, project.ErrInvalidPolicy)
+}
+
+func TestSessionService_Activate_Batch(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+	rootID, parentID, childID := "root", "p1", "a1"
+
+	recordsRepo := &mocks.RecordRepository{}
+	sessionsRepo := &mocks.SessionRepository{}
+	projectsRepo := &mocks.ProjectRepository{}
+
+	root := &record.Record{ID: rootID, ProjectID: "proj1", State: record.StateOpen}
+	parent := &record.Record{ID: parentID, ProjectID: "proj1", ParentID: &rootID, State: record.StateOpen}
+	child := &record.Record{ID: childID, ProjectID: "proj1", ParentID: &parentID, State: record.StateOpen}
+
+	recordsRepo.On("Get", ctx, tenantID, rootID).Return(root, nil)
+	recordsRepo.On("Get", ctx, tenantID, parentID).Return(parent, nil)
+	recordsRepo.On("Get", ctx, tenantID, childID).Return(child, nil)
+	recordsRepo.On("Get", ctx, tenantID, "other").Return(&record.Record{ID: "other", ProjectID: "proj2"}, nil)
+	recordsRepo.On("GetChildren", ctx, tenantID, parentID).Return([]record.Record{*child, {ID: "b1", State: record.StateResolved}}, nil)
+	recordsRepo.On("GetChildrenRefs", ctx, tenantID, parentID).Return([]record.RecordRef{
+		{ID: childID, State: record.StateOpen},
+		{ID: "b1", State: record.StateResolved},
+	}, nil)
+	recordsRepo.On("GetChildren", ctx, tenantID, childID).Return([]record.Record{{ID: "c1", State: record.StateOpen}}, nil)
+	recordsRepo.On("GetChildrenRefs", ctx, tenantID, childID).Return([]record.RecordRef{{ID: "c1", State: record.StateOpen}}, nil)
+	recordsRepo.On("GetChildrenRefs", ctx, tenantID, "b1").Return([]record.RecordRef{}, nil)
+	recordsRepo.On("GetChildrenRefs", ctx, tenantID, "c1").Return([]record.RecordRef{}, nil)
+	recordsRepo.On("Ancestors", ctx, tenantID, []string{parentID}).Return(map[string][]record.Ancestor{
+		parentID: {{ID: rootID}},
+	}, nil)
+	recordsRepo.On("Ancestors", ctx, tenantID, []string{childID}).Return(map[string][]record.Ancestor{
+		childID: {{ID: rootID}, {ID: parentID}},
+	}, nil)
+
+	projectsRepo.On("Get", ctx, tenantID, "proj1").Return(&project.Project{ID: "proj1", Tick: 7}, nil)
+	sessionsRepo.On("Create", ctx, tenantID, mock.Anything).Return(nil)
+	sessionsRepo.On("AddActivation", ctx, mock.Anything, mock.Anything, int64(7)).Return(nil)
+	sessionsRepo.On("SetContextTick", ctx, mock.Anything, mock.Anything, int64(7)).Return(nil)
+	sessionsRepo.On("GetByRecordID", ctx, tenantID, parentID).Return([]session.SessionInfo{}, nil)
+	sessionsRepo.On("GetByRecordID", ctx, tenantID, childID).Return([]session.SessionInfo{{SessionID: "sess-other"}}, nil)
+
+	svc := session.NewService(recordsRepo, sessionsRepo, projectsRepo, nil, nil)
+	result, err := svc.Activate(ctx, tenantID, session.ActivateRequest{
+		RecordIDs: []string{parentID, childID, parentID},
+	})
+	require.NoError(t, err)
+	bundle := result.Context
+	require.Nil(t, bundle.Target)
+	require.Len(t, bundle.Targets, 2)
+	require.Equal(t, parentID, bundle.Targets[0].ID)
+	require.Equal(t, childID, bundle.Targets[1].ID)
+
+	// The child target is not repeated as the parent's open child, nor the
+	// parent target as the child's parent.
+	require.Len(t, bundle.Parents, 1)
+	require.Equal(t, rootID, bundle.Parents[0].ID)
+	require.Len(t, bundle.OpenChildren, 1)
+	require.Equal(t, "c1", bundle.OpenChildren[0].ID)
+	require.Len(t, bundle.OtherChildren, 1)
+	require.Equal(t, "b1", bundle.OtherChildren[0].ID)
+	require.Empty(t, bundle.Grandchildren)
+	require.Len(t, bundle.Paths[childID], 2)
+	require.Len(t, bundle.Paths[parentID], 1)
+
+	require.Empty(t, result.Warnings)
+	require.Equal(t, map[string][]string{childID: {"record active in session sess-other"}}, result.RecordWarnings)
+	sessionsRepo.AssertNumberOfCalls(t, "AddActivation", 2)
+	sessionsRepo.AssertNumberOfCalls(t, "SetContextTick", 2)
+
+	_, err = svc.Activate(ctx, tenantID, session.ActivateRequest{RecordIDs: []string{parentID, "other"}})
+	require.ErrorIs(t, err, session.ErrInvalidInput)
+
+	_, err = svc.Activate(ctx, tenantID, session.ActivateRequest{RecordID: parentID, RecordIDs: []string{childID}})
+	require.ErrorIs(t, err, session.ErrInvalidInput)
+}
+
+func TestSessionService_Deactivate(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+	sessionID := "sess1"
+
+	sessionsRepo := &mocks.SessionRepository{}
+	projectsRepo := &mocks.ProjectRepository{}
+	activitiesRepo := &mocks.ActivityRepository{}
+
+	sessionsRepo.On("Get", ctx, tenantID, sessionID).Return(&session.Session{
+		ID:        sessionID,
+		ProjectID: "proj1",
+	}, nil)
+	sessionsRepo.On("Get", ctx, tenantID, "missing").Return(nil, repository.ErrNotFound)
+	sessionsRepo.On("GetActivations", ctx, sessionID).Return([]string{"rec1", "rec2"}, nil)
+	sessionsRepo.On("RemoveActivation", ctx, sessionID, "rec1").Return(nil).Once()
+	sessionsRepo.On("Update", ctx, tenantID, mock.Anything).Return(nil)
+	projectsRepo.On("Get", ctx, tenantID, "proj1").Return(&project.Project{
+		ID:   "proj1",
+		Tick: 4,
+	}, nil)
+	activitiesRepo.On("Log", ctx, tenantID, mock.MatchedBy(func(entry *activity.ActivityEntry) bool {
+		return entry.ActivityType == activity.TypeDeactivation && *entry.RecordID == "rec1" && entry.Tick == 4
+	})).Return(nil).Once()
+
+	svc := session.NewService(nil, sessionsRepo, projectsRepo, activitiesRepo, nil)
+
+	result, err := svc.Deactivate(ctx, tenantID, sessionID, []string{"rec1", "rec1"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"rec1"}, result.Released)
+	require.Equal(t, []string{"rec2"}, result.ActiveRecords)
+
+	_, err = svc.Deactivate(ctx, tenantID, sessionID, []string{"rec3"})
+	require.ErrorIs(t, err, session.ErrRecordNotActive)
+
+	_, err = svc.Deactivate(ctx, tenantID, "missing", []string{"rec1"})
+	require.ErrorIs(t, err, session.ErrSessionNotFound)
+
+	_, err = svc.Deactivate(ctx, tenantID, sessionID, nil)
+	require.ErrorIs(t, err, session.ErrInvalidInput)
+
+	sessionsRepo.AssertExpectations(t)
+	activitiesRepo.AssertExpectations(t)
+}
+
+func TestSessionService_Sweep(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	staleSince := func(d time.Duration) *time.Time {
+		at := now.Add(-d)
+		return &at
+	}
+
+	sessionsRepo := &mocks.SessionRepository{}
+	projectsRepo := &mocks.ProjectRepository{}
+	activitiesRepo := &mocks.ActivityRepository{}
+
+	sessions := []session.Session{
+		{ID: "fresh", TenantID: "tenant1", ProjectID: "proj1", Status: session.StatusActive, LastSyncTick: 95, LastActivity: now},
+		{ID: "idle", TenantID: "tenant1", ProjectID: "proj1", Status: session.StatusActive, LastSyncTick: 100, LastActivity: now.Add(-3 * time.Hour)},
+		{ID: "behind", TenantID: "tenant1", ProjectID: "proj1", Status: session.StatusActive, LastSyncTick: 40, LastActivity: now},
+		{ID: "busy", TenantID: "tenant1", ProjectID: "proj1", Status: session.StatusActive, LastSyncTick: 100, LastActivity: now.Add(-5 * time.Hour)},
+		// Idle for long, but only just stale: the close period runs from
+		// when the session went stale.
+		{ID: "stale", TenantID: "tenant1", ProjectID: "proj1", Status: session.StatusStale, LastSyncTick: 100, LastActivity: now.Add(-40 * time.Hour), StaleAt: staleSince(time.Hour)},
+		{ID: "abandoned", TenantID: "tenant1", ProjectID: "proj1", Status: session.StatusStale, LastSyncTick: 100, LastActivity: now.Add(-30 * time.Hour), StaleAt: staleSince(28 * time.Hour)},
+		{ID: "resumed", TenantID: "tenant1", ProjectID: "proj1", Status: session.StatusStale, LastSyncTick: 100, LastActivity: now.Add(-30 * time.Hour), StaleAt: staleSince(28 * time.Hour)},
+	}
+	sessionsRepo.On("ListOpen", ctx).Return(sessions, nil)
+	projectsRepo.On("Get", ctx, "tenant1", "proj1").Return(&project.Project{ID: "proj1", Tick: 100}, nil).Once()
+	sessionsRepo.On("MarkStale", ctx, "tenant1", "idle", sessions[1].LastActivity, mock.Anything).Return(nil).Once()
+	sessionsRepo.On("MarkStale", ctx, "tenant1", "behind", sessions[2].LastActivity, mock.Anything).Return(nil).Once()
+	// busy and resumed were used after they were listed.
+	sessionsRepo.On("MarkStale", ctx, "tenant1", "busy", sessions[3].LastActivity, mock.Anything).Return(repository.ErrConflict).Once()
+	sessionsRepo.On("CloseStale", ctx, "tenant1", "abandoned", sessions[5].LastActivity).Return(nil).Once()
+	sessionsRepo.On("CloseStale", ctx, "tenant1", "resumed", sessions[6].LastActivity).Return(repository.ErrConflict).Once()
+	activitiesRepo.On("Log", ctx, "tenant1", mock.MatchedBy(func(entry *activity.ActivityEntry) bool {
+		return entry.ActivityType == activity.TypeSessionStale && *entry.SessionID == "idle" &&
+			strings.Contains(entry.Summary, "idle for 3h")
+	})).Return(nil).Once()
+	activitiesRepo.On("Log", ctx, "tenant1", mock.MatchedBy(func(entry *activity.ActivityEntry) bool {
+		return entry.ActivityType == activity.TypeSessionStale && *entry.SessionID == "behind" &&
+			strings.Contains(entry.Summary, "60 ticks behind")
+	})).Return(nil).Once()
+	activitiesRepo.On("Log", ctx, "tenant1", mock.MatchedBy(func(entry *activity.ActivityEntry) bool {
+		return entry.ActivityType == activity.TypeSessionClosed && *entry.SessionID == "abandoned" &&
+			strings.Contains(entry.Summary, "stale for 28h")
+	})).Return(nil).Once()
+
+	svc := session.NewService(nil, sessionsRepo, projectsRepo, activitiesRepo, nil)
+	result, err := svc.Sweep(ctx, session.SweepPolicy{
+		StaleAfter:   2 * time.Hour,
+		StaleTickGap: 50,
+		CloseAfter:   24 * time.Hour,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"idle", "behind"}, result.Staled)
+	require.Equal(t, []string{"abandoned"}, result.Closed)
+
+	sessionsRepo.AssertExpectations(t)
+	projectsRepo.AssertExpectations(t)
+	activitiesRepo.AssertExpectations(t)
+}
+
+func TestSessionService_ListSessions(t *testing.T) {
+	ctx := context.Background()
+	tenantID := "tenant1"
+
+	sessionsRepo := &mocks.SessionRepository{}
+	opts := session.ListSessionsOptions{ProjectID: "proj1", Status: session.StatusStale}
+	sessionsRepo.On("List", ctx, tenantID, opts).Return([]session.Session{
+		{ID: "sess1", ProjectID: "proj1", Status: session.StatusStale},
+	}, nil)
+	sessionsRepo.On("GetActivations", ctx, "sess1").Return(nil, nil)
+
+	svc := session.NewService(nil, sessionsRepo, nil, nil, nil)
+	sessions, err := svc.ListSessions(ctx, tenantID, opts)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.Equal(t, []string{}, sessions[0].ActiveRecords)
+
+	_, err = svc.ListSessions(ctx, tenantID, session.ListSessionsOptions{Status: "idle"})
+	require.ErrorIs(t, err, session.ErrInvalidInput)
+}
@@ -0,0 +1,108 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rpggio/trellis/internal/domain/activity"
+	"github.com/rpggio/trellis/internal/domain/project"
+	"github.com/rpggio/trellis/internal/repository"
+)
+
+// SweepPolicy sets when Sweep gives up on a session. An active session is
+// stale once it has been idle for StaleAfter or has fallen StaleTickGap
+// ticks behind its project. A stale session is closed once it has been
+// stale for CloseAfter. A zero threshold disables its check.
+type SweepPolicy struct {
+	StaleAfter   time.Duration
+	StaleTickGap int64
+	CloseAfter   time.Duration
+}
+
+// SweepResult lists the sessions a sweep marked stale and closed.
+type SweepResult struct {
+	Staled []string
+	Closed []string
+}
+
+// Sweep marks the abandoned sessions of every tenant stale and closes the
+// ones left stale past the policy's close period. Syncing, saving,
+// activating or writing records in a stale session makes it active again;
+// a session used while the sweep runs is left alone.
+func (s *Service) Sweep(ctx context.Context, policy SweepPolicy) (*SweepResult, error) {
+	sessions, err := s.sessions.ListOpen(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing open sessions: %w", err)
+	}
+
+	now := time.Now()
+	result := &SweepResult{Staled: make([]string, 0), Closed: make([]string, 0)}
+	projects := make(map[string]*project.Project)
+	for i := range sessions {
+		sess := &sessions[i]
+		proj, ok := projects[sess.ProjectID]
+		if !ok {
+			proj, err = s.projects.Get(ctx, sess.TenantID, sess.ProjectID)
+			if err != nil {
+				return nil, fmt.Errorf("loading project: %w", err)
+			}
+			projects[sess.ProjectID] = proj
+		}
+
+		if sess.Status == StatusStale {
+			if policy.CloseAfter <= 0 || sess.StaleAt == nil || now.Sub(*sess.StaleAt) < policy.CloseAfter {
+				continue
+			}
+			if err := s.sessions.CloseStale(ctx, sess.TenantID, sess.ID, sess.LastActivity); err != nil {
+				if errors.Is(err, repository.ErrConflict) {
+					continue
+				}
+				return nil, fmt.Errorf("closing session: %w", err)
+			}
+			if err := s.logActivity(ctx, sess.TenantID, &activity.ActivityEntry{
+				ProjectID:    proj.ID,
+				SessionID:    &sess.ID,
+				ActivityType: activity.TypeSessionClosed,
+				Summary:      fmt.Sprintf("closed stale session: stale for %s", now.Sub(*sess.StaleAt).Round(time.Minute)),
+				Tick:         proj.Tick,
+			}); err != nil {
+				return nil, err
+			}
+			result.Closed = append(result.Closed, sess.ID)
+			continue
+		}
+
+		idle := now.Sub(sess.LastActivity)
+		tickGap := proj.Tick - sess.LastSyncTick
+		var reason string
+		switch {
+		case policy.StaleAfter > 0 && idle >= policy.StaleAfter:
+			reason = fmt.Sprintf("idle for %s", idle.Round(time.Minute))
+		case policy.StaleTickGap > 0 && tickGap >= policy.StaleTickGap:
+			reason = fmt.Sprintf("%d ticks behind", tickGap)
+		default:
+			continue
+		}
+
+		if err := s.sessions.MarkStale(ctx, sess.TenantID, sess.ID, sess.LastActivity, now); err != nil {
+			if errors.Is(err, repository.ErrConflict) {
+				continue
+			}
+			return nil, fmt.Errorf("marking session stale: %w", err)
+		}
+		if err := s.logActivity(ctx, sess.TenantID, &activity.ActivityEntry{
+			ProjectID:    proj.ID,
+			SessionID:    &sess.ID,
+			ActivityType: activity.TypeSessionStale,
+			Summary:      "marked session stale: " + reason,
+			Tick:         proj.Tick,
+		}); err != nil {
+			return nil, err
+		}
+		result.Staled = append(result.Staled, sess.ID)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,80 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func similarity(a, b []float32) float64 {
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+func TestHashEmbedder(t *testing.T) {
+	e := NewHashEmbedder(0)
+	require.Equal(t, "local-hash-256", e.Model())
+
+	vectors, err := e.Embed(context.Background(), []string{
+		"Caching strategy for the session store",
+		"caching strategies for session stores",
+		"Quarterly budget review meeting",
+		"",
+	})
+	require.NoError(t, err)
+	require.Len(t, vectors, 4)
+	require.Len(t, vectors[0], DefaultDimensions)
+
+	var norm float64
+	for _, v := range vectors[0] {
+		norm += float64(v) * float64(v)
+	}
+	require.InDelta(t, 1, math.Sqrt(norm), 1e-5)
+
+	// Shared words and fragments make texts similar.
+	require.Greater(t, similarity(vectors[0], vectors[1]), similarity(vectors[0], vectors[2])+0.3)
+	require.Zero(t, similarity(vectors[3], vectors[3]))
+
+	again, err := e.Embed(context.Background(), []string{"Caching strategy for the session store"})
+	require.NoError(t, err)
+	require.Equal(t, vectors[0], again[0])
+}
+
+func TestOpenAIEmbedder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/embeddings", r.URL.Path)
+		require.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+
+		var req embeddingsRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, "small", req.Model)
+		require.Equal(t, []string{"a", "b"}, req.Input)
+
+		// Data may come back in any order.
+		_, _ = w.Write([]byte(`{"data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]}]}`))
+	}))
+	defer server.Close()
+
+	e := NewOpenAIEmbedder(server.URL+"/v1/", "small", "key", time.Second)
+	require.Equal(t, "small", e.Model())
+	vectors, err := e.Embed(context.Background(), []string{"a", "b"})
+	require.NoError(t, err)
+	require.Equal(t, [][]float32{{1, 0}, {0, 1}}, vectors)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not loaded", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	_, err = NewOpenAIEmbedder(failing.URL, "small", "", time.Second).Embed(context.Background(), []string{"a"})
+	require.ErrorContains(t, err, "model not loaded")
+}
@@ -0,0 +1,86 @@
+// Package embedding provides the embedding providers used by semantic
+// search.
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// DefaultDimensions is the vector size of the local embedder.
+const DefaultDimensions = 256
+
+// HashEmbedder embeds text locally by hashing its words and character
+// trigrams into a fixed number of dimensions. It needs no model or network
+// and is deterministic, so records embedded in one run compare with queries
+// embedded in the next. Texts sharing vocabulary and word fragments come out
+// similar; synonyms don't.
+type HashEmbedder struct {
+	dims int
+}
+
+// NewHashEmbedder creates a HashEmbedder producing vectors of dims
+// dimensions, or DefaultDimensions when dims is not positive.
+func NewHashEmbedder(dims int) *HashEmbedder {
+	if dims <= 0 {
+		dims = DefaultDimensions
+	}
+	return &HashEmbedder{dims: dims}
+}
+
+// Model identifies the embedder and its dimensions.
+func (e *HashEmbedder) Model() string {
+	return fmt.Sprintf("local-hash-%d", e.dims)
+}
+
+// Embed returns an L2-normalized vector for each text.
+func (e *HashEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = e.embed(text)
+	}
+	return vectors, nil
+}
+
+func (e *HashEmbedder) embed(text string) []float32 {
+	vector := make([]float32, e.dims)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		// Whole words count double so exact matches outweigh shared fragments.
+		e.add(vector, "w:"+word, 2)
+		padded := []rune(" " + word + " ")
+		for j := 0; j+3 <= len(padded); j++ {
+			e.add(vector, "t:"+string(padded[j:j+3]), 1)
+		}
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm > 0 {
+		scale := float32(1 / math.Sqrt(norm))
+		for i := range vector {
+			vector[i] *= scale
+		}
+	}
+	return vector
+}
+
+// add hashes feature to a dimension. A second hash bit picks the sign, so
+// colliding features tend to cancel rather than pile up.
+func (e *HashEmbedder) add(vector []float32, feature string, weight float32) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+	vector[sum%uint64(e.dims)] += weight
+}
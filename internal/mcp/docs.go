@@ -10,7 +10,7 @@ const serverInstructions = `Trellis Memory stores durable reasoning as Projects
 
 Core concepts (keep this mental model small):
 - Project: a container with a monotonic tick (logical clock). “Stale” means tick gap, not wall time.
-- Record: self-explaining reasoning unit in a parent/child tree (+ optional related[] links).
+- Record: self-explaining reasoning unit in a parent/child tree (+ typed links: relates, blocks, supersedes, depends_on, derived_from).
 - RecordRef: lightweight summary (no body) for browsing/search.
 - Session: a chat’s working context; tracks last synced tick and activated records.
 - Activation boundary: call activate(id) before doing serious reasoning or mutation; it returns a minimal ContextBundle.
@@ -27,9 +27,10 @@ Information flow principles:
 Rules of engagement (default workflow):
 1) Orient: call get_project_overview (default project unless project_id provided).
 2) Browse cheaply: use search_records / list_records / get_recent_activity / get_record_ref (prefer RecordRef over full bodies).
-3) Reason/mutate: call activate(record_id) to load Target + Parent + OPEN children (full), and refs for the rest.
-4) Write safely: create_record / update_record / transition.
-   - If update_record returns a conflict, reconcile explicitly; only retry with force=true after merging.
+3) Reason/mutate: call activate(record_id) to load Target + Parent + OPEN children (full), the ancestor path from the root, and refs for the rest.
+4) Write safely: create_record / update_record / transition (revert_record to undo an edit).
+   - If update_record returns a conflict, review conflict.merge and submit it with resolve_conflict; force=true is a last resort.
+   - A concurrent_session conflict means other sessions hold the record; ask the user before retrying with override=true.
    - If activate returns warnings about other sessions, proceed cautiously.
 5) Staleness: if tick_gap > 0 (overview) or staleness > 0 (sync_session), call sync_session before significant edits.
 6) Close the loop: close_session when done (save_session only when the user requests a checkpoint).
@@ -86,8 +87,11 @@ This server is designed for **progressive disclosure**: keep your baseline conte
 
 ## Capabilities & intentional limitations
 
-- ` + "`get_record_diff`" + ` is currently a placeholder (returns the current version for both sides; no computed diff yet).
+- ` + "`get_record_diff`" + ` compares stored versions. Versions are addressed by tick (listed by ` + "`get_record_history`" + `) or by ` + "`current`" + ` / ` + "`previous`" + ` / ` + "`activation`" + `.
 - Browse tools can return large result sets if you omit ` + "`limit`" + `; use limits to control token usage.
+- ` + "`list_records`" + ` pages are stable: pass ` + "`next_cursor`" + ` back as ` + "`cursor`" + ` and pages neither skip nor repeat records while others write. ` + "`search_records`" + ` cursors hold a position only, because hits are re-ranked on every call.
+- ` + "`get_project_overview`" + `, ` + "`list_records`" + `, ` + "`search_records`" + `, ` + "`get_tree`" + ` and ` + "`activate`" + ` accept ` + "`format=outline`" + `: the text content becomes an indented plaintext outline at about half the tokens of JSON, while the structured content is unchanged.
+- Outlines show 8-character short IDs. Every tool accepts a short ID (or any longer prefix) in place of a full ID; a prefix matching several records returns ` + "`AMBIGUOUS_ID`" + ` with the candidates.
 
 ## Where sizes live
 
@@ -187,7 +191,7 @@ If you need a stronger tree relationship, it’s also acceptable to make a concl
 
 When new work contradicts a prior conclusion:
 - make the contradiction explicit,
-- create a new conclusion that references the old one in ` + "`related[]`" + ` and explains what changed,
+- create a new conclusion that links to the old one with ` + "`link_records(kind=supersedes)`" + ` and explains what changed,
 - preserve the chain so “old → new” is navigable without chat transcripts.
 `,
 	},
@@ -206,6 +210,7 @@ When new work contradicts a prior conclusion:
 - **Record tree**: records can have ` + "`parent_id`" + ` and children. Use this to keep reasoning localized.
 - **RecordRef**: lightweight record pointer used for browsing/search (no body).
 - **Session**: a chat’s working context. Sessions help detect staleness and concurrent activity.
+- **Stale session**: a session the server found idle or far behind its project. It still holds its records, but warnings label it stale and it doesn't cause concurrent-session conflicts; syncing, activating or writing makes it active again, and the server closes it once it has stayed stale for a while. ` + "`list_sessions(status)`" + ` shows sessions by status.
 - **Activation**: the boundary between browsing and deep reasoning/mutation.
 
 ## Activation boundary (why it exists)
@@ -216,6 +221,22 @@ Record bodies are the expensive part of context. ` + "`activate(record_id)`" + `
 - parent record (full, if present)
 - OPEN children (full)
 - other children + grandchildren (refs)
+- linked records (refs), grouped by kind in ` + "`links`" + ` (outgoing) and ` + "`backlinks`" + ` (incoming)
+
+Re-activating a record in the same session only sends records modified since the session last loaded that bundle. Records you already hold come back in ` + "`unchanged`" + ` as refs (and ` + "`target`" + ` / ` + "`parent`" + ` are omitted when unchanged). Pass ` + "`full=true`" + ` if you no longer have them in context.
+
+To work across several records, pass ` + "`ids`" + ` (up to 20) instead of ` + "`id`" + `. All of them are activated at the same tick and their bundles merge into one: ` + "`targets`" + ` and ` + "`parents`" + ` replace ` + "`target`" + ` and ` + "`parent`" + `, ` + "`paths`" + ` maps each target id to its ancestor path, and each record appears once, in its fullest role. Warnings for each record are in ` + "`record_warnings`" + `.
+
+The bundle shape comes from an activation policy. Set a project's default with ` + "`update_project(activation_policy)`" + ` and override it per call with ` + "`activate(policy)`" + `; unset fields fall back to the project, then to the defaults above:
+
+- ` + "`ancestor_depth`" + ` (0-10, default 10): levels above the target; 0 drops the parent and ancestor path.
+- ` + "`descendant_depth`" + ` (0-10, default 2): levels below; levels past grandchildren come back as ` + "`descendants`" + ` refs.
+- ` + "`full_states`" + ` (default ` + "`[\"OPEN\"]`" + `): children in these states load with bodies in ` + "`open_children`" + `.
+- ` + "`include_links`" + ` (default true) and ` + "`include_siblings`" + ` (default false, returned as ` + "`siblings`" + ` refs).
+
+A spec-writing project might load RESOLVED children in full; a brainstorming one might use ` + "`descendant_depth: 1`" + ` with siblings.
+
+Hub records can have many OPEN children. Pass ` + "`max_tokens`" + ` to cap the bundle's estimated size (about 4 characters per token). It fills by priority: target, parent, OPEN children, then refs. Target and parent bodies are truncated (ending in ` + "`[truncated]`" + `), OPEN children that do not fit move to ` + "`other_children`" + ` as refs, and refs that do not fit are dropped. ` + "`context.budget`" + ` lists the ids in ` + "`truncated`" + `, ` + "`demoted`" + ` and ` + "`omitted`" + `, and a warning says how to fetch them.
 
 This keeps routine navigation cheap and makes “now I’m going to think/change things” explicit.
 
@@ -227,13 +248,16 @@ Records use ` + "`OPEN | LATER | RESOLVED | DISCARDED`" + `. State controls what
 
 - Prefer tick-based checks over wall-clock heuristics.
 - If you’re resuming work or see a tick gap, call ` + "`sync_session`" + ` before doing significant edits.
+- ` + "`sync_session`" + ` lists the records written since your last sync in ` + "`changes`" + ` (one entry per record, newest first). Entries with ` + "`activated=true`" + ` are records you hold; re-activate them before editing.
 
 ## Concurrency and conflicts
 
 This server is “single-writer intent”: concurrent edits aren’t forbidden, but they must be handled explicitly.
 
 - ` + "`activate`" + ` may return warnings if other sessions are active on the same record.
+- When you are done with a record, ` + "`deactivate(id)`" + ` releases it so other sessions stop seeing it as active. The session stays open.
 - ` + "`update_record`" + ` may return a **conflict** instead of a record. Treat this as “stop and reconcile”.
+- Update conflicts include a three-way ` + "`merge`" + `; finish it and submit with ` + "`resolve_conflict`" + `.
 - Use ` + "`force=true`" + ` only after you’ve compared versions and intentionally merged.
 
 ## Information flow (chat → records)
@@ -270,8 +294,13 @@ Use it to answer:
 ## 2) Find a target cheaply
 
 Use one of:
-- ` + "`search_records`" + ` (recommended; supply a query and a ` + "`limit`" + `)
-- ` + "`list_records`" + ` (e.g., list root records or children under a parent)
+- ` + "`search_records`" + ` (recommended; supply a query and a ` + "`limit`" + `). Hits come best match first; ` + "`highlight`" + ` and ` + "`snippet`" + ` show why each one matched, so you can pick without activating.
+  Narrow the query instead of paging: ` + "`type:question state:open \"cache invalidation\" -redis`" + `, ` + "`parent:<id>`" + ` (or ` + "`parent:root`" + `), ` + "`modified>tick:120`" + ` for what changed since a tick, ` + "`invalid*`" + ` for a prefix.
+  To ask "where did we decide X?" across projects, pass ` + "`all_projects=true`" + ` (or ` + "`project_ids`" + `); hits are ranked together and tagged with ` + "`project_id`" + ` / ` + "`project_name`" + `. ` + "`list_records`" + ` takes the same options.
+  When keywords miss because records use different words, pass ` + "`mode=semantic`" + ` (ranked by meaning) or ` + "`mode=hybrid`" + ` (keyword and semantic rankings fused); filters still apply.
+- ` + "`find_similar`" + ` (records nearest to a record id or draft text; check before creating something that may already exist elsewhere)
+- ` + "`list_records`" + ` (e.g., list root records or children under a parent). ` + "`sort`" + ` orders by ` + "`created`" + ` (default), ` + "`modified`" + `, ` + "`tick`" + `, ` + "`title`" + `, ` + "`state`" + ` or ` + "`children_open`" + `; ` + "`total`" + ` counts every match, and ` + "`changed_since_start`" + ` on later pages counts listed records written since the first one.
+- ` + "`get_tree`" + ` (a record's subtree, or the whole project, as nested refs in one call; nodes past ` + "`depth`" + ` collapse into a ` + "`descendant_count`" + `)
 - ` + "`get_recent_activity`" + ` (to see what changed without activating)
 - ` + "`get_record_ref`" + ` (when you already have an id)
 
@@ -298,15 +327,20 @@ Save on request: keep exploratory thinking in chat; persist only when the user a
 1) ` + "`activate(record_id)`" + ` to load a ContextBundle.
 
 2) Make changes:
-- Add a child record: ` + "`create_record(parent_id=target.id, type, title, summary, body)`" + `.
+- Add a child record: ` + "`create_record(parent_id=target.id, type, title, summary, body)`" + `. If the response lists ` + "`possible_duplicates`" + `, an OPEN record already says nearly the same thing; prefer continuing there (and delete the new record) unless the user wants both.
 - Update current record: ` + "`update_record(id, title/summary/body, related[])`" + `.
 - Transition state: ` + "`transition(id, to_state, reason)`" + `.
+- Reorganize: ` + "`move_record(id, parent_id)`" + ` reparents a record (activate it and the new parent first; omit ` + "`parent_id`" + ` to move it to the root).
+- Link records: ` + "`link_records(from_id, to_id, kind)`" + ` / ` + "`unlink_records`" + ` with kind ` + "`relates`" + ` (default), ` + "`blocks`" + `, ` + "`supersedes`" + `, ` + "`depends_on`" + ` or ` + "`derived_from`" + `. ` + "`related[]`" + ` on create/update sets the ` + "`relates`" + ` links.
+- Undo a bad edit: ` + "`revert_record(id, tick)`" + ` restores title/summary/body/state from an earlier version (find ticks with ` + "`get_record_history`" + `).
+- Remove a record created by mistake: ` + "`delete_record(id)`" + ` moves it and its whole subtree to the trash. ` + "`list_trash`" + ` shows what can be brought back with ` + "`restore_record(id)`" + `; trashed records are purged permanently after the retention window.
 
 3) Watch for conflicts:
-- If ` + "`update_record`" + ` returns ` + "`conflict`" + `, reconcile and retry (only then consider ` + "`force=true`" + `).
+- If ` + "`update_record`" + ` returns ` + "`conflict`" + `, resolve ` + "`conflict.merge`" + ` and submit it with ` + "`resolve_conflict`" + ` (only then consider ` + "`force=true`" + `).
 
 4) Keep sessions fresh:
 - If you see tick gap warnings (overview) or ` + "`sync_session`" + ` reports staleness > 0, sync before further edits.
+- ` + "`deactivate`" + ` records you have finished with so they stop raising warnings elsewhere.
 
 5) Close the loop:
 - ` + "`save_session`" + ` if the user requests a checkpoint.
@@ -327,17 +361,24 @@ Save on request: keep exploratory thinking in chat; persist only when the user a
 
 ## What a conflict means
 
-` + "`update_record`" + ` can return a ` + "`conflict`" + ` instead of an updated record. This usually means another session wrote to the record since your session’s last synced view.
+` + "`update_record`" + ` can return a ` + "`conflict`" + ` instead of an updated record. ` + "`conflict.conflict_type`" + ` says which kind:
+
+- ` + "`update`" + `: another session wrote to the record since your session activated it. Treat this as: **stop, compare, and reconcile**.
+- ` + "`concurrent_session`" + `: the record is active in other sessions (listed in ` + "`conflict.sessions`" + ` with their last activity). Nothing has been overwritten yet.
+
+` + "`revert_record`" + ` and ` + "`transition`" + ` return the same conflicts.
+
+## Concurrent sessions
 
-Treat this as: **stop, compare, and reconcile**.
+Tell the user which sessions hold the record and ask before writing. Only after they agree, retry with ` + "`override=true`" + `. Overrides are recorded in the activity log.
 
 ## Safe reconciliation protocol
 
 1) Show the user the conflict summary (or describe it succinctly).
-2) Compare your intended changes against ` + "`conflict.other_version`" + `.
-3) Create a merged update intentionally (title/summary/body).
-4) Retry ` + "`update_record`" + ` with the merged fields.
-5) Only if you *must* override and you understand the loss, retry with ` + "`force=true`" + `.
+2) Read ` + "`conflict.merge`" + `: a three-way merge of your proposed update and ` + "`conflict.other_version`" + ` against ` + "`conflict.base_version`" + ` (the version you activated). Fields listed in ` + "`merge.conflicts`" + ` contain ` + "`<<<<<<<`" + ` / ` + "`=======`" + ` / ` + "`>>>>>>>`" + ` markers where both sides changed the same lines.
+3) Edit the marked regions into the text you intend to keep.
+4) Call ` + "`resolve_conflict(id, remote_tick=merge.remote_tick, title, summary, body)`" + `. Text that still contains markers is rejected. If the record changed again since ` + "`remote_tick`" + `, you get a fresh conflict with a new merge.
+5) Only if you *must* override and you understand the loss, retry ` + "`update_record`" + ` with ` + "`force=true`" + `.
 
 ## When to use force
 
@@ -378,7 +419,7 @@ Use headings/bullets so the content compresses well:
 - Constraints: non-negotiables and trade-offs.
 - Options considered: 2–5 bullets max.
 - Decision / next steps: what we chose and what remains.
-- Links: related record ids in ` + "`related[]`" + ` (keep references explicit).
+- Links: link related records with ` + "`link_records`" + ` using the most specific kind (keep references explicit).
 
 ## Record completeness (the “Stranger Test”)
 
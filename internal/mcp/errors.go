@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/rpggio/trellis/internal/domain/project"
 	"github.com/rpggio/trellis/internal/domain/record"
 	"github.com/rpggio/trellis/internal/domain/session"
 )
@@ -26,6 +27,43 @@ func mapError(err error) error {
 		return fmt.Errorf("INVALID_TRANSITION: invalid state transition (hint: check valid transitions)")
 	case errors.Is(err, record.ErrConflict):
 		return fmt.Errorf("CONFLICT: record modified by another session (hint: sync and resolve)")
+	case errors.Is(err, record.ErrVersionNotFound):
+		return fmt.Errorf("VERSION_NOT_FOUND: no version of the record exists at that tick (hint: check get_record_history ticks)")
+	case errors.Is(err, record.ErrInvalidVersionRef):
+		return fmt.Errorf("INVALID_VERSION_REF: version must be a tick number, \"current\", \"previous\" or \"activation\"")
+	case errors.Is(err, record.ErrUnresolvedConflict):
+		return fmt.Errorf("UNRESOLVED_CONFLICT: merged text still contains conflict markers (hint: edit out <<<<<<< / >>>>>>> blocks)")
+	case errors.Is(err, record.ErrMoveCycle):
+		return fmt.Errorf("MOVE_CYCLE: record cannot be moved under itself or a descendant (hint: pick a parent outside its subtree)")
+	case errors.Is(err, record.ErrInvalidRelationKind):
+		return fmt.Errorf("INVALID_RELATION_KIND: kind must be relates, blocks, supersedes, depends_on or derived_from")
+	case errors.Is(err, record.ErrRelationNotFound):
+		return fmt.Errorf("RELATION_NOT_FOUND: no link of that kind between the records (hint: check the record's links)")
+	case errors.Is(err, record.ErrNotInTrash):
+		return fmt.Errorf("NOT_IN_TRASH: record is not in the trash (hint: use an id from list_trash)")
+	case errors.Is(err, record.ErrParentInTrash):
+		return fmt.Errorf("PARENT_IN_TRASH: parent record is still in the trash (hint: restore the parent first)")
+	case errors.Is(err, record.ErrInvalidQuery):
+		message := err.Error()
+		var queryErr *record.QueryError
+		if errors.As(err, &queryErr) {
+			message = queryErr.Error()
+		}
+		return fmt.Errorf("INVALID_QUERY: %s (hint: quote phrases, exclude with -term, filter with type:, state:, parent: or modified>tick:N)", message)
+	case errors.Is(err, record.ErrInvalidSearchMode):
+		return fmt.Errorf("INVALID_SEARCH_MODE: %s (hint: use keyword, semantic or hybrid)", err.Error())
+	case errors.Is(err, record.ErrSemanticSearchDisabled):
+		return fmt.Errorf("SEMANTIC_SEARCH_DISABLED: semantic search is not configured (hint: use mode=keyword)")
+	case errors.Is(err, record.ErrAmbiguousID):
+		return fmt.Errorf("AMBIGUOUS_ID: %s (hint: use one of the full ids)", err.Error())
+	case errors.Is(err, record.ErrInvalidCursor):
+		return fmt.Errorf("INVALID_CURSOR: %s (hint: pass next_cursor unchanged with the same sort, or start again without cursor)", err.Error())
+	case errors.Is(err, record.ErrInvalidSort):
+		return fmt.Errorf("INVALID_SORT: %s", err.Error())
+	case errors.Is(err, project.ErrInvalidPolicy):
+		return fmt.Errorf("INVALID_POLICY: %s (hint: depths are 0-%d; states are OPEN, LATER, RESOLVED or DISCARDED)", err.Error(), project.MaxActivationDepth)
+	case errors.Is(err, session.ErrRecordNotActive):
+		return fmt.Errorf("NOT_ACTIVE: %s (hint: list the session's active_records with list_sessions)", err.Error())
 	case errors.Is(err, session.ErrSessionNotFound):
 		return fmt.Errorf("SESSION_NOT_FOUND: session not found (hint: start a new session)")
 	default:
@@ -0,0 +1,96 @@
+package mcp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rpggio/trellis/internal/outline"
+	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Response formats of the browse tools. Both keep the JSON structured
+// content; outline replaces the text content with a plaintext outline.
+const (
+	formatJSON    = "json"
+	formatOutline = "outline"
+)
+
+func checkFormat(format string) error {
+	switch format {
+	case "", formatJSON, formatOutline:
+		return nil
+	}
+	return fmt.Errorf("INVALID_FORMAT: unknown format %q (hint: use json or outline)", format)
+}
+
+// outlineResult returns a result carrying the outline built by render when
+// format asks for one. Otherwise it returns nil and the SDK sends the JSON.
+func outlineResult(format string, render func() string) *sdkmcp.CallToolResult {
+	if format != formatOutline {
+		return nil
+	}
+	return &sdkmcp.CallToolResult{
+		Content: []sdkmcp.Content{&sdkmcp.TextContent{Text: render()}},
+	}
+}
+
+// envelope joins "key: value" fields into the first line of an outline.
+func envelope(fields ...string) string {
+	return strings.Join(fields, " | ") + "\n"
+}
+
+func listOutline(resp *ListRecordsResponse) string {
+	fields := []string{fmt.Sprintf("total: %d", resp.Total)}
+	if resp.ChangedSinceStart > 0 {
+		fields = append(fields, fmt.Sprintf("changed_since_start: %d", resp.ChangedSinceStart))
+	}
+	if resp.NextCursor != "" {
+		fields = append(fields, "next_cursor: "+resp.NextCursor)
+	}
+	return envelope(fields...) + "\n" + outline.Refs(resp.Records)
+}
+
+func searchOutline(resp *SearchRecordsResponse) string {
+	fields := []string{fmt.Sprintf("total: %d", resp.Total)}
+	if resp.NextCursor != "" {
+		fields = append(fields, "next_cursor: "+resp.NextCursor)
+	}
+	return envelope(fields...) + "\n" + outline.SearchResults(resp.Results)
+}
+
+func overviewOutline(resp *ProjectOverviewResponse) string {
+	var b strings.Builder
+	b.WriteString(envelope(
+		fmt.Sprintf("project: %s [%s]", resp.Project.Name, resp.Project.ID),
+		fmt.Sprintf("tick: %d", resp.Project.Tick),
+	))
+	for _, sess := range resp.OpenSessions {
+		active := make([]string, len(sess.ActiveRecords))
+		for i, id := range sess.ActiveRecords {
+			active[i] = outline.ShortID(id)
+		}
+		b.WriteString(envelope(
+			"session: "+sess.ID,
+			fmt.Sprintf("tick_gap: %d", sess.TickGap),
+			"active: "+strings.Join(active, ", "),
+		))
+	}
+	fmt.Fprintf(&b, "\n## Root records (%d)\n\n", len(resp.RootRecords))
+	b.WriteString(outline.Refs(resp.RootRecords))
+	return b.String()
+}
+
+func activateOutline(resp *ActivateResponse) string {
+	fields := []string{"session: " + resp.SessionID}
+	if resp.Context.SinceTick > 0 {
+		fields = append(fields, fmt.Sprintf("since_tick: %d", resp.Context.SinceTick))
+	}
+	var b strings.Builder
+	b.WriteString(envelope(fields...))
+	for _, warning := range resp.Warnings {
+		b.WriteString("warning: " + warning + "\n")
+	}
+	b.WriteString("\n")
+	b.WriteString(outline.Bundle(resp.Context))
+	return b.String()
+}
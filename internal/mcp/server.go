@@ -17,27 +17,42 @@ type ProjectService interface {
 	List(ctx context.Context, tenantID string) ([]project.ProjectSummary, error)
 	Get(ctx context.Context, tenantID, id string) (*project.Project, error)
 	GetDefault(ctx context.Context, tenantID string) (*project.Project, error)
+	Update(ctx context.Context, tenantID string, req project.UpdateRequest) (*project.Project, error)
 }
 
 // RecordService defines record operations needed by MCP.
 type RecordService interface {
-	Create(ctx context.Context, tenantID string, req record.CreateRequest) (*record.Record, error)
+	Create(ctx context.Context, tenantID string, req record.CreateRequest) (*record.Record, []record.PossibleDuplicate, error)
 	Update(ctx context.Context, tenantID string, req record.UpdateRequest) (*record.Record, *record.ConflictInfo, error)
-	Transition(ctx context.Context, tenantID string, req record.TransitionRequest) (*record.Record, error)
+	Revert(ctx context.Context, tenantID string, req record.RevertRequest) (*record.Record, *record.ConflictInfo, error)
+	ResolveConflict(ctx context.Context, tenantID string, req record.ResolveConflictRequest) (*record.Record, *record.ConflictInfo, error)
+	Transition(ctx context.Context, tenantID string, req record.TransitionRequest) (*record.Record, *record.ConflictInfo, error)
+	Move(ctx context.Context, tenantID string, req record.MoveRequest) (*record.Record, *record.ConflictInfo, error)
+	Link(ctx context.Context, tenantID string, req record.LinkRequest) (*record.Record, error)
+	Unlink(ctx context.Context, tenantID string, req record.LinkRequest) (*record.Record, error)
+	Delete(ctx context.Context, tenantID string, req record.DeleteRequest) (*record.TrashEntry, *record.ConflictInfo, error)
+	Restore(ctx context.Context, tenantID string, req record.RestoreRequest) (*record.Record, error)
+	ListTrash(ctx context.Context, tenantID string, opts record.ListTrashOptions) ([]record.TrashEntry, error)
 	Get(ctx context.Context, tenantID, id string) (*record.Record, error)
+	Diff(ctx context.Context, tenantID string, req record.DiffRequest) (*record.Record, *record.Record, error)
 	GetRef(ctx context.Context, tenantID, id string) (record.RecordRef, error)
-	List(ctx context.Context, tenantID string, opts record.ListRecordsOptions) ([]record.RecordRef, error)
-	Search(ctx context.Context, tenantID, projectID, query string, opts record.SearchOptions) ([]record.SearchResult, error)
+	List(ctx context.Context, tenantID string, opts record.ListRecordsOptions) (*record.ListResult, error)
+	Search(ctx context.Context, tenantID, query string, opts record.SearchOptions) (*record.SearchPage, error)
+	Tree(ctx context.Context, tenantID string, opts record.TreeOptions) ([]*record.TreeNode, error)
+	ResolveID(ctx context.Context, tenantID, id string) (string, error)
+	FindSimilar(ctx context.Context, tenantID string, req record.FindSimilarRequest, opts record.SearchOptions) ([]record.SearchResult, error)
 }
 
 // SessionService defines session operations needed by MCP.
 type SessionService interface {
 	Activate(ctx context.Context, tenantID string, req session.ActivateRequest) (*session.ActivateResult, error)
+	Deactivate(ctx context.Context, tenantID, sessionID string, recordIDs []string) (*session.DeactivateResult, error)
 	SyncSession(ctx context.Context, tenantID, sessionID string) (*session.SyncResult, error)
 	SaveSession(ctx context.Context, tenantID, sessionID string) error
 	CloseSession(ctx context.Context, tenantID, sessionID string) error
 	GetActiveSessionsForRecord(ctx context.Context, tenantID, recordID string) ([]session.SessionInfo, error)
 	ListActiveSessions(ctx context.Context, tenantID, projectID string) ([]session.SessionInfo, error)
+	ListSessions(ctx context.Context, tenantID string, opts session.ListSessionsOptions) ([]session.Session, error)
 }
 
 // ActivityService defines activity operations needed by MCP.
@@ -3,32 +3,34 @@ package mcp
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/rpggio/trellis/internal/domain/activity"
 	"github.com/rpggio/trellis/internal/domain/project"
 	"github.com/rpggio/trellis/internal/domain/record"
 	"github.com/rpggio/trellis/internal/domain/session"
+	"github.com/rpggio/trellis/internal/outline"
 	sdkmcp "github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
 // registerTools adds all currently supported MCP tools to the server.
 func registerTools(server *sdkmcp.Server, svc Services) {
-	// Projects (3 tools)
+	// Projects (4 tools)
 	registerProjectTools(server, svc)
 
-	// Orientation (4 tools)
+	// Orientation (7 tools)
 	registerOrientationTools(server, svc)
 
-	// Activation (2 tools)
+	// Activation (3 tools)
 	registerActivationTools(server, svc)
 
-	// Mutations (3 tools)
+	// Mutations (9 tools)
 	registerMutationTools(server, svc)
 
-	// Session Lifecycle (2 tools)
+	// Session Lifecycle (3 tools)
 	registerSessionTools(server, svc)
 
-	// History/Conflict (4 tools)
+	// History/Conflict (5 tools)
 	registerHistoryTools(server, svc)
 
 	// Utilities (7 tools) - minimal implementation
@@ -43,6 +45,74 @@ func getProjectOrDefault(ctx context.Context, svc ProjectService, tenantID, proj
 	return svc.Get(ctx, tenantID, projectID)
 }
 
+// resolveRecordIDs expands short record IDs, as shown in outlines, to full
+// IDs in place. Nil and empty IDs are left alone.
+func resolveRecordIDs(ctx context.Context, svc RecordService, tenantID string, ids ...*string) error {
+	for _, id := range ids {
+		if id == nil || *id == "" {
+			continue
+		}
+		full, err := svc.ResolveID(ctx, tenantID, *id)
+		if err != nil {
+			return err
+		}
+		*id = full
+	}
+	return nil
+}
+
+// relatedIDs returns id followed by pointers into related, so one call to
+// resolveRecordIDs expands them all in place.
+func relatedIDs(id *string, related []string) []*string {
+	ids := []*string{id}
+	for i := range related {
+		ids = append(ids, &related[i])
+	}
+	return ids
+}
+
+// projectScope resolves the projects a browse tool covers: every project
+// with all set (nil), the listed projects, or else the single (default)
+// project.
+func projectScope(ctx context.Context, svc ProjectService, tenantID, projectID string, projectIDs []string, all bool) ([]string, error) {
+	if all {
+		return nil, nil
+	}
+	if len(projectIDs) > 0 {
+		for _, id := range projectIDs {
+			if _, err := svc.Get(ctx, tenantID, id); err != nil {
+				return nil, err
+			}
+		}
+		return projectIDs, nil
+	}
+	proj, err := getProjectOrDefault(ctx, svc, tenantID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return []string{proj.ID}, nil
+}
+
+func diffRecords(from, to *record.Record) RecordDiff {
+	var diff RecordDiff
+	if from.Title != to.Title {
+		diff.Title = &FieldDiff{Old: from.Title, New: to.Title}
+	}
+	if from.Summary != to.Summary {
+		diff.Summary = &FieldDiff{Old: from.Summary, New: to.Summary}
+	}
+	if from.State != to.State {
+		diff.State = &StateFieldDiff{Old: from.State, New: to.State}
+	}
+	diff.Body = record.UnifiedDiff(
+		fmt.Sprintf("body@tick:%d", from.Tick),
+		fmt.Sprintf("body@tick:%d", to.Tick),
+		from.Body,
+		to.Body,
+	)
+	return diff
+}
+
 func stringValue(val *string) string {
 	if val == nil {
 		return ""
@@ -50,6 +120,52 @@ func stringValue(val *string) string {
 	return *val
 }
 
+func updateRecordResponse(rec *record.Record, conflict *record.ConflictInfo) *UpdateRecordResponse {
+	resp := &UpdateRecordResponse{Record: rec}
+	if conflict != nil {
+		resp.Record = nil
+		resp.Conflict = conflictResult(conflict)
+	}
+	return resp
+}
+
+func conflictResult(conflict *record.ConflictInfo) *RecordConflictResult {
+	return &RecordConflictResult{
+		ConflictType: conflict.ConflictType,
+		Message:      conflict.Message,
+		OtherVersion: conflict.RemoteVersion,
+		BaseVersion:  conflict.BaseVersion,
+		Merge:        conflict.Merge,
+		Sessions:     conflict.Sessions,
+	}
+}
+
+// activationPolicy returns the policy a tool was given, or an unset one.
+func activationPolicy(policy *project.ActivationPolicy) project.ActivationPolicy {
+	if policy == nil {
+		return project.ActivationPolicy{}
+	}
+	return *policy
+}
+
+// budgetWarning tells the agent what a token budget cut from the bundle of
+// recordID, empty for a batch, and how to fetch it.
+func budgetWarning(report *session.BudgetReport, recordID string) string {
+	var parts []string
+	if n := len(report.Truncated); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d bodies truncated (activate again with a larger max_tokens)", n))
+	}
+	if n := len(report.Demoted); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d open children sent as refs (activate one to read it)", n))
+	}
+	if n := len(report.Omitted); n > 0 && recordID != "" {
+		parts = append(parts, fmt.Sprintf("%d refs omitted (browse with get_tree id=%s or list_records parent_id=%s)", n, recordID, recordID))
+	} else if n > 0 {
+		parts = append(parts, fmt.Sprintf("%d refs omitted (browse with get_tree or list_records parent_id)", n))
+	}
+	return fmt.Sprintf("bundle cut to max_tokens=%d: %s", report.MaxTokens, strings.Join(parts, "; "))
+}
+
 // Project tools
 func registerProjectTools(server *sdkmcp.Server, svc Services) {
 	sdkmcp.AddTool(server, &sdkmcp.Tool{
@@ -58,9 +174,10 @@ func registerProjectTools(server *sdkmcp.Server, svc Services) {
 	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input CreateProjectParams) (*sdkmcp.CallToolResult, *project.Project, error) {
 		tenantID := getTenantID(ctx)
 		proj, err := svc.Projects.Create(ctx, tenantID, project.CreateRequest{
-			ID:          input.ID,
-			Name:        input.Name,
-			Description: input.Description,
+			ID:               input.ID,
+			Name:             input.Name,
+			Description:      input.Description,
+			ActivationPolicy: activationPolicy(input.ActivationPolicy),
 		})
 		return nil, proj, mapError(err)
 	})
@@ -100,14 +217,35 @@ func registerProjectTools(server *sdkmcp.Server, svc Services) {
 		proj, err := svc.Projects.Get(ctx, tenantID, input.ID)
 		return nil, proj, mapError(err)
 	})
+
+	sdkmcp.AddTool(server, &sdkmcp.Tool{
+		Name:        "update_project",
+		Description: "Update a project's name, description or default activation_policy (the default project if id is omitted). A given activation_policy replaces the stored one; unset policy fields use the built-in defaults.",
+	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input UpdateProjectParams) (*sdkmcp.CallToolResult, *project.Project, error) {
+		tenantID := getTenantID(ctx)
+		proj, err := getProjectOrDefault(ctx, svc.Projects, tenantID, input.ID)
+		if err != nil {
+			return nil, nil, mapError(err)
+		}
+		proj, err = svc.Projects.Update(ctx, tenantID, project.UpdateRequest{
+			ID:               proj.ID,
+			Name:             input.Name,
+			Description:      input.Description,
+			ActivationPolicy: input.ActivationPolicy,
+		})
+		return nil, proj, mapError(err)
+	})
 }
 
 // Orientation tools
 func registerOrientationTools(server *sdkmcp.Server, svc Services) {
 	sdkmcp.AddTool(server, &sdkmcp.Tool{
 		Name:        "get_project_overview",
-		Description: "Cold-start orientation: project tick + open sessions (with tick-gap warnings) + root record refs.",
+		Description: "Cold-start orientation: project tick + open sessions (with tick-gap warnings) + root record refs. format=outline returns the refs as a compact plaintext outline.",
 	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input GetProjectOverviewParams) (*sdkmcp.CallToolResult, *ProjectOverviewResponse, error) {
+		if err := checkFormat(input.Format); err != nil {
+			return nil, nil, err
+		}
 		tenantID := getTenantID(ctx)
 		proj, err := getProjectOrDefault(ctx, svc.Projects, tenantID, input.ProjectID)
 		if err != nil {
@@ -115,13 +253,14 @@ func registerOrientationTools(server *sdkmcp.Server, svc Services) {
 		}
 
 		rootID := ""
-		rootRecords, err := svc.Records.List(ctx, tenantID, record.ListRecordsOptions{
+		roots, err := svc.Records.List(ctx, tenantID, record.ListRecordsOptions{
 			ProjectID: proj.ID,
 			ParentID:  &rootID,
 		})
 		if err != nil {
 			return nil, nil, mapError(err)
 		}
+		rootRecords := roots.Records
 
 		sessions, err := svc.Sessions.ListActiveSessions(ctx, tenantID, proj.ID)
 		if err != nil {
@@ -148,62 +287,189 @@ func registerOrientationTools(server *sdkmcp.Server, svc Services) {
 			rootRecords = []record.RecordRef{}
 		}
 
-		return nil, &ProjectOverviewResponse{
+		resp := &ProjectOverviewResponse{
 			Project:      *proj,
 			OpenSessions: openSessions,
 			RootRecords:  rootRecords,
-		}, nil
+		}
+		return outlineResult(input.Format, func() string { return overviewOutline(resp) }), resp, nil
 	})
 
 	sdkmcp.AddTool(server, &sdkmcp.Tool{
 		Name:        "search_records",
-		Description: "Browse cheaply: full-text search returning RecordRef hits (use limit to control result size).",
+		Description: "Browse cheaply: full-text search returning RecordRef hits, best match first (title hits rank above summary and body hits). Each hit has a highlighted title and a body snippet with matches marked **like this**. Query syntax: words must all match, \"quoted phrases\", -excluded, prefix*, and filters type:question state:open parent:<id> (parent:root) modified>tick:120. Searches the default project, or project_ids / all_projects=true to rank hits from several projects together; every hit carries its project_id and project_name. include_path=true adds each hit's ancestors (id, title, type, state from the root down to its parent). mode=semantic ranks by meaning instead of keywords (finds records that use different words) and mode=hybrid fuses both rankings; filters still apply. Use limit to control page size; total counts every hit and next_cursor, passed back as cursor, fetches the next page (later pages leave out records created after the first page, so they cannot shift the pages; edited records are re-ranked). format=outline returns hits as a plaintext outline (about half the tokens of JSON) with short ids that every tool accepts.",
 	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input SearchRecordsParams) (*sdkmcp.CallToolResult, *SearchRecordsResponse, error) {
+		if err := checkFormat(input.Format); err != nil {
+			return nil, nil, err
+		}
 		tenantID := getTenantID(ctx)
-		proj, err := getProjectOrDefault(ctx, svc.Projects, tenantID, input.ProjectID)
+		projectIDs, err := projectScope(ctx, svc.Projects, tenantID, input.ProjectID, input.ProjectIDs, input.AllProjects)
 		if err != nil {
 			return nil, nil, mapError(err)
 		}
-		results, err := svc.Records.Search(ctx, tenantID, proj.ID, input.Query, record.SearchOptions{
-			States: input.States,
-			Types:  input.Types,
-			Limit:  input.Limit,
-			Offset: input.Offset,
+		page, err := svc.Records.Search(ctx, tenantID, input.Query, record.SearchOptions{
+			Mode:        input.Mode,
+			ProjectIDs:  projectIDs,
+			States:      input.States,
+			Types:       input.Types,
+			Limit:       input.Limit,
+			Offset:      input.Offset,
+			Cursor:      input.Cursor,
+			IncludePath: input.IncludePath,
 		})
 		if err != nil {
 			return nil, nil, mapError(err)
 		}
-		return nil, &SearchRecordsResponse{Results: results}, nil
+		results := page.Results
+		if results == nil {
+			results = []record.SearchResult{}
+		}
+		resp := &SearchRecordsResponse{
+			Results:    results,
+			NextCursor: page.NextCursor,
+			Total:      page.Total,
+		}
+		return outlineResult(input.Format, func() string { return searchOutline(resp) }), resp, nil
 	})
 
 	sdkmcp.AddTool(server, &sdkmcp.Tool{
 		Name:        "list_records",
-		Description: "Browse cheaply: list RecordRefs by parent/state/type (use limit/offset for pagination).",
+		Description: "Browse cheaply: list RecordRefs by parent/state/type. sort: created (newest first, default), modified, tick, title, state (OPEN first) or children_open (most open children first). Page with limit and pass next_cursor back as cursor; pages neither skip nor repeat records while others write, and changed_since_start counts listed records written since the first page. total counts every match. Lists the default project, or project_ids / all_projects=true for several projects; every ref carries its project_id and project_name. include_path=true adds each ref's ancestors, root first. format=outline returns refs as a plaintext outline (about half the tokens of JSON) with short ids that every tool accepts.",
 	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input ListRecordsParams) (*sdkmcp.CallToolResult, *ListRecordsResponse, error) {
+		if err := checkFormat(input.Format); err != nil {
+			return nil, nil, err
+		}
+		tenantID := getTenantID(ctx)
+		if err := resolveRecordIDs(ctx, svc.Records, tenantID, input.ParentID); err != nil {
+			return nil, nil, mapError(err)
+		}
+		projectIDs, err := projectScope(ctx, svc.Projects, tenantID, input.ProjectID, input.ProjectIDs, input.AllProjects)
+		if err != nil {
+			return nil, nil, mapError(err)
+		}
+		list, err := svc.Records.List(ctx, tenantID, record.ListRecordsOptions{
+			ProjectIDs:  projectIDs,
+			ParentID:    input.ParentID,
+			States:      input.States,
+			Types:       input.Types,
+			Sort:        input.Sort,
+			Limit:       input.Limit,
+			Offset:      input.Offset,
+			Cursor:      input.Cursor,
+			IncludePath: input.IncludePath,
+		})
+		if err != nil {
+			return nil, nil, mapError(err)
+		}
+		results := list.Records
+		if results == nil {
+			results = []record.RecordRef{}
+		}
+		resp := &ListRecordsResponse{
+			Records:           results,
+			NextCursor:        list.NextCursor,
+			Total:             list.Total,
+			ChangedSinceStart: list.Changed,
+		}
+		return outlineResult(input.Format, func() string { return listOutline(resp) }), resp, nil
+	})
+
+	sdkmcp.AddTool(server, &sdkmcp.Tool{
+		Name:         "get_tree",
+		Description:  "See structure in one call: the subtree under a record (id), or every tree of the project, as nested RecordRefs down to depth levels (default 3, max 20). Nodes at the depth limit are collapsed and carry descendant_count instead of children. states keeps only records in those states; a record in another state is left out with its subtree. format=outline renders the tree as an indented plaintext outline.",
+		OutputSchema: treeOutputSchema,
+	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input GetTreeParams) (*sdkmcp.CallToolResult, *GetTreeResponse, error) {
+		if err := checkFormat(input.Format); err != nil {
+			return nil, nil, err
+		}
+		tenantID := getTenantID(ctx)
+		if err := resolveRecordIDs(ctx, svc.Records, tenantID, &input.ID); err != nil {
+			return nil, nil, mapError(err)
+		}
+		opts := record.TreeOptions{
+			RootID: input.ID,
+			Depth:  input.Depth,
+			States: input.States,
+		}
+		if input.ID == "" {
+			proj, err := getProjectOrDefault(ctx, svc.Projects, tenantID, input.ProjectID)
+			if err != nil {
+				return nil, nil, mapError(err)
+			}
+			opts.ProjectID = proj.ID
+		}
+		nodes, err := svc.Records.Tree(ctx, tenantID, opts)
+		if err != nil {
+			return nil, nil, mapError(err)
+		}
+		if nodes == nil {
+			nodes = []*record.TreeNode{}
+		}
+		return outlineResult(input.Format, func() string { return outline.Tree(nodes) }), &GetTreeResponse{Nodes: nodes}, nil
+	})
+
+	sdkmcp.AddTool(server, &sdkmcp.Tool{
+		Name:        "find_similar",
+		Description: "Find the records nearest to an existing record (record_id) or to draft text, best match first, as RecordRef hits. Check before creating a record that may already be captured elsewhere. mode: keyword, semantic or hybrid (default when semantic search is available). Searches the default project, or project_ids / all_projects=true. Use limit to control result size.",
+	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input FindSimilarParams) (*sdkmcp.CallToolResult, *FindSimilarResponse, error) {
+		tenantID := getTenantID(ctx)
+		if err := resolveRecordIDs(ctx, svc.Records, tenantID, &input.RecordID); err != nil {
+			return nil, nil, mapError(err)
+		}
+		projectIDs, err := projectScope(ctx, svc.Projects, tenantID, input.ProjectID, input.ProjectIDs, input.AllProjects)
+		if err != nil {
+			return nil, nil, mapError(err)
+		}
+		results, err := svc.Records.FindSimilar(ctx, tenantID, record.FindSimilarRequest{
+			ID:   input.RecordID,
+			Text: input.Text,
+		}, record.SearchOptions{
+			Mode:       input.Mode,
+			ProjectIDs: projectIDs,
+			States:     input.States,
+			Types:      input.Types,
+			Limit:      input.Limit,
+		})
+		if err != nil {
+			return nil, nil, mapError(err)
+		}
+		if results == nil {
+			results = []record.SearchResult{}
+		}
+		return nil, &FindSimilarResponse{Results: results}, nil
+	})
+
+	sdkmcp.AddTool(server, &sdkmcp.Tool{
+		Name:        "list_trash",
+		Description: "List deleted records that can still be restored, most recently deleted first, with how many descendants were deleted with each (use limit/offset for pagination).",
+	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input ListTrashParams) (*sdkmcp.CallToolResult, *ListTrashResponse, error) {
 		tenantID := getTenantID(ctx)
 		proj, err := getProjectOrDefault(ctx, svc.Projects, tenantID, input.ProjectID)
 		if err != nil {
 			return nil, nil, mapError(err)
 		}
-		results, err := svc.Records.List(ctx, tenantID, record.ListRecordsOptions{
+		entries, err := svc.Records.ListTrash(ctx, tenantID, record.ListTrashOptions{
 			ProjectID: proj.ID,
-			ParentID:  input.ParentID,
-			States:    input.States,
-			Types:     input.Types,
 			Limit:     input.Limit,
 			Offset:    input.Offset,
 		})
 		if err != nil {
 			return nil, nil, mapError(err)
 		}
-		return nil, &ListRecordsResponse{Records: results}, nil
+		if entries == nil {
+			entries = []record.TrashEntry{}
+		}
+		return nil, &ListTrashResponse{Trash: entries}, nil
 	})
 
 	sdkmcp.AddTool(server, &sdkmcp.Tool{
 		Name:        "get_record_ref",
-		Description: "Get a lightweight RecordRef (summary view) by record id (no body).",
+		Description: "Get a lightweight RecordRef (summary view) by record id (no body), with its typed links and backlinks.",
 	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input GetRecordRefParams) (*sdkmcp.CallToolResult, record.RecordRef, error) {
 		tenantID := getTenantID(ctx)
+		if err := resolveRecordIDs(ctx, svc.Records, tenantID, &input.ID); err != nil {
+			return nil, record.RecordRef{}, mapError(err)
+		}
 		ref, err := svc.Records.GetRef(ctx, tenantID, input.ID)
 		return nil, ref, mapError(err)
 	})
@@ -213,29 +479,81 @@ func registerOrientationTools(server *sdkmcp.Server, svc Services) {
 func registerActivationTools(server *sdkmcp.Server, svc Services) {
 	sdkmcp.AddTool(server, &sdkmcp.Tool{
 		Name:        "activate",
-		Description: "Enter reasoning mode: create/continue a session and load a minimal ContextBundle for a record.",
+		Description: "Enter reasoning mode: create/continue a session and load a minimal ContextBundle for a record. Pass ids (up to 20) instead of id to activate several records at one tick: the bundles merge into one with targets, parents and paths (by target id), each record appearing once, and warnings per record in record_warnings. Re-activating within a session returns records you already hold as `unchanged` refs; pass full=true to reload everything. max_tokens caps the bundle's estimated size: the target and parent bodies are truncated, open children that do not fit come back as refs, and the remaining refs are dropped; context.budget lists what was cut. policy overrides the project's activation_policy: ancestor_depth, descendant_depth, full_states (children loaded with bodies), include_links, include_siblings. format=outline renders the bundle as plaintext: path, target with body, then sections of refs.",
 	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input ActivateParams) (*sdkmcp.CallToolResult, *ActivateResponse, error) {
+		if err := checkFormat(input.Format); err != nil {
+			return nil, nil, err
+		}
 		tenantID := getTenantID(ctx)
+		ids := []*string{&input.ID}
+		for i := range input.IDs {
+			ids = append(ids, &input.IDs[i])
+		}
+		if err := resolveRecordIDs(ctx, svc.Records, tenantID, ids...); err != nil {
+			return nil, nil, mapError(err)
+		}
 		sessionID := getSessionID(ctx)
 
 		result, err := svc.Sessions.Activate(ctx, tenantID, session.ActivateRequest{
 			SessionID: sessionID,
 			RecordID:  input.ID,
+			RecordIDs: input.IDs,
+			Full:      input.Full,
+			MaxTokens: input.MaxTokens,
+			Policy:    activationPolicy(input.Policy),
 		})
 		if err != nil {
 			return nil, nil, mapError(err)
 		}
 
-		return nil, &ActivateResponse{
-			SessionID: result.SessionID,
-			Context:   result.Context,
-			Warnings:  result.Warnings,
+		warnings := result.Warnings
+		if report := result.Context.Budget; report != nil && report.Cut() {
+			warnings = append(warnings, budgetWarning(report, input.ID))
+		}
+		resp := &ActivateResponse{
+			SessionID:      result.SessionID,
+			Context:        result.Context,
+			Warnings:       warnings,
+			RecordWarnings: result.RecordWarnings,
+		}
+		return outlineResult(input.Format, func() string { return activateOutline(resp) }), resp, nil
+	})
+
+	sdkmcp.AddTool(server, &sdkmcp.Tool{
+		Name:        "deactivate",
+		Description: "Release records (id, or ids) from the session once you are done with them, so other sessions stop seeing them as busy. Re-activating a released record sends its full bundle. Requires a session id context.",
+	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input DeactivateParams) (*sdkmcp.CallToolResult, *DeactivateResponse, error) {
+		tenantID := getTenantID(ctx)
+		ids := []*string{&input.ID}
+		for i := range input.IDs {
+			ids = append(ids, &input.IDs[i])
+		}
+		if err := resolveRecordIDs(ctx, svc.Records, tenantID, ids...); err != nil {
+			return nil, nil, mapError(err)
+		}
+		sessionID := getSessionID(ctx)
+		if input.SessionID != "" {
+			sessionID = input.SessionID
+		}
+
+		recordIDs := input.IDs
+		if input.ID != "" {
+			recordIDs = append([]string{input.ID}, recordIDs...)
+		}
+		result, err := svc.Sessions.Deactivate(ctx, tenantID, sessionID, recordIDs)
+		if err != nil {
+			return nil, nil, mapError(err)
+		}
+		return nil, &DeactivateResponse{
+			SessionID:     result.SessionID,
+			Released:      result.Released,
+			ActiveRecords: result.ActiveRecords,
 		}, nil
 	})
 
 	sdkmcp.AddTool(server, &sdkmcp.Tool{
 		Name:        "sync_session",
-		Description: "Refresh a session’s staleness (tick gap). Use when resuming work or before significant edits.",
+		Description: "Refresh a session’s staleness (tick gap) and list records created/updated/transitioned/moved/linked/deleted/restored since the last sync (activated=true marks records you hold). Use when resuming work or before significant edits.",
 	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input SyncSessionParams) (*sdkmcp.CallToolResult, *SyncSessionResponse, error) {
 		tenantID := getTenantID(ctx)
 		sessionID := getSessionID(ctx)
@@ -256,10 +574,12 @@ func registerActivationTools(server *sdkmcp.Server, svc Services) {
 		}
 
 		return nil, &SyncSessionResponse{
-			SessionID:     result.SessionID,
-			Staleness:     result.TickGap,
-			SessionStatus: result.Status,
-			Warning:       warning,
+			SessionID:        result.SessionID,
+			Staleness:        result.TickGap,
+			SessionStatus:    result.Status,
+			Changes:          result.Changes,
+			ChangesTruncated: result.ChangesTruncated,
+			Warning:          warning,
 		}, nil
 	})
 }
@@ -268,9 +588,12 @@ func registerActivationTools(server *sdkmcp.Server, svc Services) {
 func registerMutationTools(server *sdkmcp.Server, svc Services) {
 	sdkmcp.AddTool(server, &sdkmcp.Tool{
 		Name:        "create_record",
-		Description: "Create a record (optionally under parent_id). Use when the user asks to persist; write it to stand alone; see `trellis://docs/record-writing`. If a session is active, the record is auto-activated.",
+		Description: "Create a record (optionally under parent_id). Use when the user asks to persist; write it to stand alone; see `trellis://docs/record-writing`. If a session is active, the record is auto-activated. possible_duplicates lists OPEN records with a near-identical title and summary; if one already captures this, consider deleting the new record and working on the existing one.",
 	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input CreateRecordParams) (*sdkmcp.CallToolResult, *CreateRecordResponse, error) {
 		tenantID := getTenantID(ctx)
+		if err := resolveRecordIDs(ctx, svc.Records, tenantID, relatedIDs(input.ParentID, input.Related)...); err != nil {
+			return nil, nil, mapError(err)
+		}
 		sessionID := getSessionID(ctx)
 
 		proj, err := getProjectOrDefault(ctx, svc.Projects, tenantID, "")
@@ -278,7 +601,7 @@ func registerMutationTools(server *sdkmcp.Server, svc Services) {
 			return nil, nil, mapError(err)
 		}
 
-		rec, err := svc.Records.Create(ctx, tenantID, record.CreateRequest{
+		rec, duplicates, err := svc.Records.Create(ctx, tenantID, record.CreateRequest{
 			SessionID: sessionID,
 			ProjectID: proj.ID,
 			ParentID:  input.ParentID,
@@ -294,16 +617,20 @@ func registerMutationTools(server *sdkmcp.Server, svc Services) {
 		}
 
 		return nil, &CreateRecordResponse{
-			Record:        *rec,
-			AutoActivated: sessionID != "",
+			Record:             *rec,
+			AutoActivated:      sessionID != "",
+			PossibleDuplicates: duplicates,
 		}, nil
 	})
 
 	sdkmcp.AddTool(server, &sdkmcp.Tool{
 		Name:        "update_record",
-		Description: "Update an activated record when the user asks to persist changes. Keep it self-explaining; see `trellis://docs/record-writing`. May return a conflict unless force=true; requires a session id context.",
+		Description: "Update an activated record when the user asks to persist changes. Keep it self-explaining; see `trellis://docs/record-writing`. May return a conflict: `update` (changed since activation; retry with force=true after merging) or `concurrent_session` (active in other sessions; retry with override=true once the user agrees). Requires a session id context.",
 	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input UpdateRecordParams) (*sdkmcp.CallToolResult, *UpdateRecordResponse, error) {
 		tenantID := getTenantID(ctx)
+		if err := resolveRecordIDs(ctx, svc.Records, tenantID, relatedIDs(&input.ID, input.Related)...); err != nil {
+			return nil, nil, mapError(err)
+		}
 		sessionID := getSessionID(ctx)
 		if input.SessionID != "" {
 			sessionID = input.SessionID
@@ -317,37 +644,197 @@ func registerMutationTools(server *sdkmcp.Server, svc Services) {
 			Body:      input.Body,
 			Related:   input.Related,
 			Force:     input.Force,
+			Override:  input.Override,
 		})
 		if err != nil {
 			return nil, nil, mapError(err)
 		}
 
-		resp := &UpdateRecordResponse{Record: rec}
-		if conflict != nil && conflict.RemoteVersion != nil {
-			resp.Record = nil
-			resp.Conflict = &RecordConflictResult{
-				Message:      conflict.Message,
-				OtherVersion: *conflict.RemoteVersion,
-			}
+		return nil, updateRecordResponse(rec, conflict), nil
+	})
+
+	sdkmcp.AddTool(server, &sdkmcp.Tool{
+		Name:        "revert_record",
+		Description: "Restore an activated record's title/summary/body/state to the version at an earlier tick (see get_record_history). A state change must be a transition the transition tool allows. Written as a new change; returns conflicts like update_record (force/override).",
+	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input RevertRecordParams) (*sdkmcp.CallToolResult, *UpdateRecordResponse, error) {
+		tenantID := getTenantID(ctx)
+		if err := resolveRecordIDs(ctx, svc.Records, tenantID, &input.ID); err != nil {
+			return nil, nil, mapError(err)
+		}
+		sessionID := getSessionID(ctx)
+		if input.SessionID != "" {
+			sessionID = input.SessionID
+		}
+
+		rec, conflict, err := svc.Records.Revert(ctx, tenantID, record.RevertRequest{
+			SessionID: sessionID,
+			ID:        input.ID,
+			Tick:      input.Tick,
+			Force:     input.Force,
+			Override:  input.Override,
+		})
+		if err != nil {
+			return nil, nil, mapError(err)
 		}
-		return nil, resp, nil
+
+		return nil, updateRecordResponse(rec, conflict), nil
 	})
 
 	sdkmcp.AddTool(server, &sdkmcp.Tool{
 		Name:        "transition",
-		Description: "Transition an activated record to a new workflow state (OPEN/LATER/RESOLVED/DISCARDED).",
-	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input TransitionParams) (*sdkmcp.CallToolResult, *record.Record, error) {
+		Description: "Transition an activated record to a new workflow state (OPEN/LATER/RESOLVED/DISCARDED). Returns a concurrent_session conflict if other sessions hold the record, unless override=true.",
+	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input TransitionParams) (*sdkmcp.CallToolResult, *UpdateRecordResponse, error) {
 		tenantID := getTenantID(ctx)
+		if err := resolveRecordIDs(ctx, svc.Records, tenantID, &input.ID, input.ResolvedBy); err != nil {
+			return nil, nil, mapError(err)
+		}
 		sessionID := getSessionID(ctx)
 
-		rec, err := svc.Records.Transition(ctx, tenantID, record.TransitionRequest{
+		rec, conflict, err := svc.Records.Transition(ctx, tenantID, record.TransitionRequest{
 			SessionID:  sessionID,
 			ID:         input.ID,
 			ToState:    input.ToState,
 			Reason:     input.Reason,
 			ResolvedBy: input.ResolvedBy,
+			Override:   input.Override,
 		})
-		return nil, rec, mapError(err)
+		if err != nil {
+			return nil, nil, mapError(err)
+		}
+
+		return nil, updateRecordResponse(rec, conflict), nil
+	})
+
+	sdkmcp.AddTool(server, &sdkmcp.Tool{
+		Name:        "move_record",
+		Description: "Move an activated record under a new parent_id (also activated, same project), or to the project root when parent_id is omitted. Rejects moving a record under itself or a descendant. Returns conflicts like update_record (force/override), also when a descendant is active in another session.",
+	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input MoveRecordParams) (*sdkmcp.CallToolResult, *UpdateRecordResponse, error) {
+		tenantID := getTenantID(ctx)
+		if err := resolveRecordIDs(ctx, svc.Records, tenantID, &input.ID, input.ParentID); err != nil {
+			return nil, nil, mapError(err)
+		}
+		sessionID := getSessionID(ctx)
+		if input.SessionID != "" {
+			sessionID = input.SessionID
+		}
+
+		rec, conflict, err := svc.Records.Move(ctx, tenantID, record.MoveRequest{
+			SessionID: sessionID,
+			ID:        input.ID,
+			ParentID:  input.ParentID,
+			Force:     input.Force,
+			Override:  input.Override,
+		})
+		if err != nil {
+			return nil, nil, mapError(err)
+		}
+
+		return nil, updateRecordResponse(rec, conflict), nil
+	})
+
+	sdkmcp.AddTool(server, &sdkmcp.Tool{
+		Name:        "delete_record",
+		Description: "Move an activated record and all of its descendants to the trash. Trashed records disappear from lists, search and activation until restored with restore_record. Returns conflicts like update_record (force/override), also when a descendant is active in another session.",
+	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input DeleteRecordParams) (*sdkmcp.CallToolResult, *DeleteRecordResponse, error) {
+		tenantID := getTenantID(ctx)
+		if err := resolveRecordIDs(ctx, svc.Records, tenantID, &input.ID); err != nil {
+			return nil, nil, mapError(err)
+		}
+		sessionID := getSessionID(ctx)
+		if input.SessionID != "" {
+			sessionID = input.SessionID
+		}
+
+		entry, conflict, err := svc.Records.Delete(ctx, tenantID, record.DeleteRequest{
+			SessionID: sessionID,
+			ID:        input.ID,
+			Force:     input.Force,
+			Override:  input.Override,
+		})
+		if err != nil {
+			return nil, nil, mapError(err)
+		}
+
+		if conflict != nil {
+			return nil, &DeleteRecordResponse{Conflict: conflictResult(conflict)}, nil
+		}
+		return nil, &DeleteRecordResponse{Deleted: entry}, nil
+	})
+
+	sdkmcp.AddTool(server, &sdkmcp.Tool{
+		Name:        "restore_record",
+		Description: "Restore a record from the trash (see list_trash) together with the descendants deleted with it, and activate it in the session. Fails if its parent is still in the trash.",
+	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input RestoreRecordParams) (*sdkmcp.CallToolResult, *record.Record, error) {
+		tenantID := getTenantID(ctx)
+		if err := resolveRecordIDs(ctx, svc.Records, tenantID, &input.ID); err != nil {
+			return nil, nil, mapError(err)
+		}
+		sessionID := getSessionID(ctx)
+		if input.SessionID != "" {
+			sessionID = input.SessionID
+		}
+
+		rec, err := svc.Records.Restore(ctx, tenantID, record.RestoreRequest{
+			SessionID: sessionID,
+			ID:        input.ID,
+		})
+		if err != nil {
+			return nil, nil, mapError(err)
+		}
+
+		return nil, rec, nil
+	})
+
+	sdkmcp.AddTool(server, &sdkmcp.Tool{
+		Name:        "link_records",
+		Description: "Link an activated record (from_id) to another record (to_id). kind is one of relates (default), blocks, supersedes, depends_on, derived_from. The source record takes a new tick, so sessions holding it see the change. Returns the source record with its links and backlinks.",
+	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input LinkRecordsParams) (*sdkmcp.CallToolResult, *record.Record, error) {
+		tenantID := getTenantID(ctx)
+		if err := resolveRecordIDs(ctx, svc.Records, tenantID, &input.FromID, &input.ToID); err != nil {
+			return nil, nil, mapError(err)
+		}
+		sessionID := getSessionID(ctx)
+		if input.SessionID != "" {
+			sessionID = input.SessionID
+		}
+
+		rec, err := svc.Records.Link(ctx, tenantID, record.LinkRequest{
+			SessionID: sessionID,
+			FromID:    input.FromID,
+			ToID:      input.ToID,
+			Kind:      input.Kind,
+		})
+		if err != nil {
+			return nil, nil, mapError(err)
+		}
+
+		return nil, rec, nil
+	})
+
+	sdkmcp.AddTool(server, &sdkmcp.Tool{
+		Name:        "unlink_records",
+		Description: "Remove a link of the given kind (default relates) from an activated record (from_id) to to_id. Returns the source record with its remaining links.",
+	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input LinkRecordsParams) (*sdkmcp.CallToolResult, *record.Record, error) {
+		tenantID := getTenantID(ctx)
+		if err := resolveRecordIDs(ctx, svc.Records, tenantID, &input.FromID, &input.ToID); err != nil {
+			return nil, nil, mapError(err)
+		}
+		sessionID := getSessionID(ctx)
+		if input.SessionID != "" {
+			sessionID = input.SessionID
+		}
+
+		rec, err := svc.Records.Unlink(ctx, tenantID, record.LinkRequest{
+			SessionID: sessionID,
+			FromID:    input.FromID,
+			ToID:      input.ToID,
+			Kind:      input.Kind,
+		})
+		if err != nil {
+			return nil, nil, mapError(err)
+		}
+
+		return nil, rec, nil
 	})
 }
 
@@ -388,6 +875,44 @@ func registerSessionTools(server *sdkmcp.Server, svc Services) {
 		}
 		return nil, map[string]string{"status": "closed"}, nil
 	})
+
+	sdkmcp.AddTool(server, &sdkmcp.Tool{
+		Name:        "list_sessions",
+		Description: "List a project's sessions (default project unless project_id), most recently active first, with their active records and tick gap. Filter with status: active, stale (idle sessions found by the server's sweeper; syncing or activating makes them active again) or closed. Use limit to cap the list.",
+	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input ListSessionsParams) (*sdkmcp.CallToolResult, *ListSessionsResponse, error) {
+		tenantID := getTenantID(ctx)
+
+		proj, err := getProjectOrDefault(ctx, svc.Projects, tenantID, input.ProjectID)
+		if err != nil {
+			return nil, nil, mapError(err)
+		}
+
+		sessions, err := svc.Sessions.ListSessions(ctx, tenantID, session.ListSessionsOptions{
+			ProjectID: proj.ID,
+			Status:    input.Status,
+			Limit:     input.Limit,
+		})
+		if err != nil {
+			return nil, nil, mapError(err)
+		}
+
+		resp := make([]SessionSummary, 0, len(sessions))
+		for _, sess := range sessions {
+			resp = append(resp, SessionSummary{
+				ID:            sess.ID,
+				ProjectID:     sess.ProjectID,
+				Status:        sess.Status,
+				ActiveRecords: sess.ActiveRecords,
+				LastSyncTick:  sess.LastSyncTick,
+				TickGap:       proj.Tick - sess.LastSyncTick,
+				CreatedAt:     sess.CreatedAt,
+				LastActivity:  sess.LastActivity,
+				StaleAt:       sess.StaleAt,
+				ClosedAt:      sess.ClosedAt,
+			})
+		}
+		return nil, &ListSessionsResponse{Sessions: resp}, nil
+	})
 }
 
 // History and conflict resolution tools
@@ -397,6 +922,9 @@ func registerHistoryTools(server *sdkmcp.Server, svc Services) {
 		Description: "Get recent change history entries for a record (lightweight, derived from activity log).",
 	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input GetRecordHistoryParams) (*sdkmcp.CallToolResult, *GetRecordHistoryResponse, error) {
 		tenantID := getTenantID(ctx)
+		if err := resolveRecordIDs(ctx, svc.Records, tenantID, &input.ID); err != nil {
+			return nil, nil, mapError(err)
+		}
 
 		entries, err := svc.Activity.GetRecentActivity(ctx, tenantID, activity.ListActivityOptions{
 			RecordID: &input.ID,
@@ -410,6 +938,7 @@ func registerHistoryTools(server *sdkmcp.Server, svc Services) {
 		for _, entry := range entries {
 			resp = append(resp, RecordHistoryEntry{
 				Timestamp:  entry.CreatedAt,
+				Tick:       entry.Tick,
 				SessionID:  stringValue(entry.SessionID),
 				ChangeType: string(entry.ActivityType),
 				Summary:    entry.Summary,
@@ -420,28 +949,71 @@ func registerHistoryTools(server *sdkmcp.Server, svc Services) {
 
 	sdkmcp.AddTool(server, &sdkmcp.Tool{
 		Name:        "get_record_diff",
-		Description: "Placeholder: returns the current record for both versions; no computed diff yet.",
+		Description: "Compare two versions of a record. from/to accept a tick (see get_record_history), \"current\", \"previous\", or \"activation\" (the version your session activated); to defaults to current.",
 	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input GetRecordDiffParams) (*sdkmcp.CallToolResult, *RecordDiffResponse, error) {
 		tenantID := getTenantID(ctx)
+		if err := resolveRecordIDs(ctx, svc.Records, tenantID, &input.ID); err != nil {
+			return nil, nil, mapError(err)
+		}
+		sessionID := getSessionID(ctx)
+		if input.SessionID != "" {
+			sessionID = input.SessionID
+		}
 
-		current, err := svc.Records.Get(ctx, tenantID, input.ID)
+		from, to, err := svc.Records.Diff(ctx, tenantID, record.DiffRequest{
+			SessionID: sessionID,
+			ID:        input.ID,
+			From:      input.From,
+			To:        input.To,
+		})
 		if err != nil {
 			return nil, nil, mapError(err)
 		}
 
-		// Simple implementation - just return current version (no actual diff yet)
 		return nil, &RecordDiffResponse{
-			FromVersion: *current,
-			ToVersion:   *current,
-			Diff:        RecordDiff{},
+			FromVersion: *from,
+			ToVersion:   *to,
+			Diff:        diffRecords(from, to),
 		}, nil
 	})
 
+	sdkmcp.AddTool(server, &sdkmcp.Tool{
+		Name:        "resolve_conflict",
+		Description: "Write a merged version after an update conflict. Start from conflict.merge, edit out every <<<<<<< / >>>>>>> block, and pass remote_tick from the conflict. Omitted fields keep the remote value; returns a fresh conflict if the record moved again.",
+	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input ResolveConflictParams) (*sdkmcp.CallToolResult, *UpdateRecordResponse, error) {
+		tenantID := getTenantID(ctx)
+		if err := resolveRecordIDs(ctx, svc.Records, tenantID, &input.ID); err != nil {
+			return nil, nil, mapError(err)
+		}
+		sessionID := getSessionID(ctx)
+		if input.SessionID != "" {
+			sessionID = input.SessionID
+		}
+
+		rec, conflict, err := svc.Records.ResolveConflict(ctx, tenantID, record.ResolveConflictRequest{
+			SessionID:  sessionID,
+			ID:         input.ID,
+			RemoteTick: input.RemoteTick,
+			Title:      input.Title,
+			Summary:    input.Summary,
+			Body:       input.Body,
+			Override:   input.Override,
+		})
+		if err != nil {
+			return nil, nil, mapError(err)
+		}
+
+		return nil, updateRecordResponse(rec, conflict), nil
+	})
+
 	sdkmcp.AddTool(server, &sdkmcp.Tool{
 		Name:        "get_active_sessions",
 		Description: "Get active sessions currently associated with a record (useful for concurrency awareness).",
 	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input GetActiveSessionsParams) (*sdkmcp.CallToolResult, *GetActiveSessionsResponse, error) {
 		tenantID := getTenantID(ctx)
+		if err := resolveRecordIDs(ctx, svc.Records, tenantID, &input.RecordID); err != nil {
+			return nil, nil, mapError(err)
+		}
 		sessionID := getSessionID(ctx)
 
 		sessions, err := svc.Sessions.GetActiveSessionsForRecord(ctx, tenantID, input.RecordID)
@@ -455,6 +1027,7 @@ func registerHistoryTools(server *sdkmcp.Server, svc Services) {
 				SessionID:    sess.SessionID,
 				LastActivity: sess.LastActivity,
 				IsCurrent:    sess.SessionID == sessionID,
+				Stale:        sess.Stale,
 			})
 		}
 		return nil, &GetActiveSessionsResponse{Sessions: resp}, nil
@@ -465,6 +1038,9 @@ func registerHistoryTools(server *sdkmcp.Server, svc Services) {
 		Description: "Get recent activity for a project or record without activating record bodies.",
 	}, func(ctx context.Context, req *sdkmcp.CallToolRequest, input GetRecentActivityParams) (*sdkmcp.CallToolResult, *GetRecentActivityResponse, error) {
 		tenantID := getTenantID(ctx)
+		if err := resolveRecordIDs(ctx, svc.Records, tenantID, input.RecordID); err != nil {
+			return nil, nil, mapError(err)
+		}
 
 		opts := activity.ListActivityOptions{
 			ProjectID: input.ProjectID,
@@ -10,9 +10,17 @@ import (
 )
 
 type CreateProjectParams struct {
-	ID          string `json:"id,omitempty"`
-	Name        string `json:"name"`
-	Description string `json:"description,omitempty"`
+	ID               string                    `json:"id,omitempty"`
+	Name             string                    `json:"name"`
+	Description      string                    `json:"description,omitempty"`
+	ActivationPolicy *project.ActivationPolicy `json:"activation_policy,omitempty"`
+}
+
+type UpdateProjectParams struct {
+	ID               string                    `json:"id,omitempty"`
+	Name             *string                   `json:"name,omitempty"`
+	Description      *string                   `json:"description,omitempty"`
+	ActivationPolicy *project.ActivationPolicy `json:"activation_policy,omitempty"`
 }
 
 type GetProjectParams struct {
@@ -21,24 +29,63 @@ type GetProjectParams struct {
 
 type GetProjectOverviewParams struct {
 	ProjectID string `json:"project_id,omitempty"`
+	Format    string `json:"format,omitempty"`
 }
 
 type SearchRecordsParams struct {
-	ProjectID string               `json:"project_id,omitempty"`
-	Query     string               `json:"query"`
-	States    []record.RecordState `json:"states,omitempty"`
-	Types     []string             `json:"types,omitempty"`
-	Limit     int                  `json:"limit,omitempty"`
-	Offset    int                  `json:"offset,omitempty"`
+	ProjectID   string               `json:"project_id,omitempty"`
+	ProjectIDs  []string             `json:"project_ids,omitempty"`
+	AllProjects bool                 `json:"all_projects,omitempty"`
+	Query       string               `json:"query"`
+	Mode        record.SearchMode    `json:"mode,omitempty"`
+	States      []record.RecordState `json:"states,omitempty"`
+	Types       []string             `json:"types,omitempty"`
+	Limit       int                  `json:"limit,omitempty"`
+	Offset      int                  `json:"offset,omitempty"`
+	Cursor      string               `json:"cursor,omitempty"`
+	IncludePath bool                 `json:"include_path,omitempty"`
+	Format      string               `json:"format,omitempty"`
+}
+
+type FindSimilarParams struct {
+	RecordID    string               `json:"record_id,omitempty"`
+	Text        string               `json:"text,omitempty"`
+	ProjectID   string               `json:"project_id,omitempty"`
+	ProjectIDs  []string             `json:"project_ids,omitempty"`
+	AllProjects bool                 `json:"all_projects,omitempty"`
+	Mode        record.SearchMode    `json:"mode,omitempty"`
+	States      []record.RecordState `json:"states,omitempty"`
+	Types       []string             `json:"types,omitempty"`
+	Limit       int                  `json:"limit,omitempty"`
 }
 
 type ListRecordsParams struct {
+	ProjectID   string               `json:"project_id,omitempty"`
+	ProjectIDs  []string             `json:"project_ids,omitempty"`
+	AllProjects bool                 `json:"all_projects,omitempty"`
+	ParentID    *string              `json:"parent_id,omitempty"`
+	States      []record.RecordState `json:"states,omitempty"`
+	Types       []string             `json:"types,omitempty"`
+	Sort        record.ListSort      `json:"sort,omitempty"`
+	Limit       int                  `json:"limit,omitempty"`
+	Offset      int                  `json:"offset,omitempty"`
+	Cursor      string               `json:"cursor,omitempty"`
+	IncludePath bool                 `json:"include_path,omitempty"`
+	Format      string               `json:"format,omitempty"`
+}
+
+type GetTreeParams struct {
+	ID        string               `json:"id,omitempty"`
 	ProjectID string               `json:"project_id,omitempty"`
-	ParentID  *string              `json:"parent_id,omitempty"`
+	Depth     int                  `json:"depth,omitempty"`
 	States    []record.RecordState `json:"states,omitempty"`
-	Types     []string             `json:"types,omitempty"`
-	Limit     int                  `json:"limit,omitempty"`
-	Offset    int                  `json:"offset,omitempty"`
+	Format    string               `json:"format,omitempty"`
+}
+
+type ListTrashParams struct {
+	ProjectID string `json:"project_id,omitempty"`
+	Limit     int    `json:"limit,omitempty"`
+	Offset    int    `json:"offset,omitempty"`
 }
 
 type GetRecordRefParams struct {
@@ -46,7 +93,18 @@ type GetRecordRefParams struct {
 }
 
 type ActivateParams struct {
-	ID string `json:"id"`
+	ID        string                    `json:"id,omitempty"`
+	IDs       []string                  `json:"ids,omitempty"`
+	Full      bool                      `json:"full,omitempty"`
+	MaxTokens int                       `json:"max_tokens,omitempty"`
+	Policy    *project.ActivationPolicy `json:"policy,omitempty"`
+	Format    string                    `json:"format,omitempty"`
+}
+
+type DeactivateParams struct {
+	ID        string   `json:"id,omitempty"`
+	IDs       []string `json:"ids,omitempty"`
+	SessionID string   `json:"session_id,omitempty"`
 }
 
 type SyncSessionParams struct {
@@ -71,6 +129,15 @@ type UpdateRecordParams struct {
 	Body      *string  `json:"body,omitempty"`
 	Related   []string `json:"related,omitempty"`
 	Force     bool     `json:"force,omitempty"`
+	Override  bool     `json:"override,omitempty"`
+}
+
+type RevertRecordParams struct {
+	ID        string `json:"id"`
+	SessionID string `json:"session_id,omitempty"`
+	Tick      int64  `json:"tick"`
+	Force     bool   `json:"force,omitempty"`
+	Override  bool   `json:"override,omitempty"`
 }
 
 type TransitionParams struct {
@@ -78,6 +145,34 @@ type TransitionParams struct {
 	ToState    record.RecordState `json:"to_state"`
 	Reason     *string            `json:"reason,omitempty"`
 	ResolvedBy *string            `json:"resolved_by,omitempty"`
+	Override   bool               `json:"override,omitempty"`
+}
+
+type MoveRecordParams struct {
+	ID        string  `json:"id"`
+	SessionID string  `json:"session_id,omitempty"`
+	ParentID  *string `json:"parent_id,omitempty"`
+	Force     bool    `json:"force,omitempty"`
+	Override  bool    `json:"override,omitempty"`
+}
+
+type DeleteRecordParams struct {
+	ID        string `json:"id"`
+	SessionID string `json:"session_id,omitempty"`
+	Force     bool   `json:"force,omitempty"`
+	Override  bool   `json:"override,omitempty"`
+}
+
+type RestoreRecordParams struct {
+	ID        string `json:"id"`
+	SessionID string `json:"session_id,omitempty"`
+}
+
+type LinkRecordsParams struct {
+	FromID    string              `json:"from_id"`
+	ToID      string              `json:"to_id"`
+	Kind      record.RelationKind `json:"kind,omitempty"`
+	SessionID string              `json:"session_id,omitempty"`
 }
 
 type SaveSessionParams struct {
@@ -88,6 +183,12 @@ type CloseSessionParams struct {
 	SessionID string `json:"session_id,omitempty"`
 }
 
+type ListSessionsParams struct {
+	ProjectID string                `json:"project_id,omitempty"`
+	Status    session.SessionStatus `json:"status,omitempty"`
+	Limit     int                   `json:"limit,omitempty"`
+}
+
 type GetRecordHistoryParams struct {
 	ID    string `json:"id"`
 	Since string `json:"since,omitempty"`
@@ -95,9 +196,20 @@ type GetRecordHistoryParams struct {
 }
 
 type GetRecordDiffParams struct {
-	ID   string `json:"id"`
-	From string `json:"from"`
-	To   string `json:"to,omitempty"`
+	ID        string `json:"id"`
+	SessionID string `json:"session_id,omitempty"`
+	From      string `json:"from"`
+	To        string `json:"to,omitempty"`
+}
+
+type ResolveConflictParams struct {
+	ID         string  `json:"id"`
+	SessionID  string  `json:"session_id,omitempty"`
+	RemoteTick int64   `json:"remote_tick"`
+	Title      *string `json:"title,omitempty"`
+	Summary    *string `json:"summary,omitempty"`
+	Body       *string `json:"body,omitempty"`
+	Override   bool    `json:"override,omitempty"`
 }
 
 type GetActiveSessionsParams struct {
@@ -126,11 +238,49 @@ type ListProjectsResponse struct {
 }
 
 type SearchRecordsResponse struct {
+	Results    []record.SearchResult `json:"results"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+	Total      int                   `json:"total"`
+}
+
+type FindSimilarResponse struct {
 	Results []record.SearchResult `json:"results"`
 }
 
 type ListRecordsResponse struct {
-	Records []record.RecordRef `json:"records"`
+	Records           []record.RecordRef `json:"records"`
+	NextCursor        string             `json:"next_cursor,omitempty"`
+	Total             int                `json:"total"`
+	ChangedSinceStart int                `json:"changed_since_start,omitempty"`
+}
+
+type GetTreeResponse struct {
+	Nodes []*record.TreeNode `json:"nodes"`
+}
+
+// treeOutputSchema describes GetTreeResponse. Tree nodes nest, which
+// schema inference rejects as a cycle, so the schema is written out.
+var treeOutputSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"nodes": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/$defs/node"}},
+	},
+	"required": []string{"nodes"},
+	"$defs": map[string]any{
+		"node": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"record":           map[string]any{"type": "object"},
+				"children":         map[string]any{"type": "array", "items": map[string]any{"$ref": "#/$defs/node"}},
+				"descendant_count": map[string]any{"type": "integer"},
+			},
+			"required": []string{"record"},
+		},
+	},
+}
+
+type ListTrashResponse struct {
+	Trash []record.TrashEntry `json:"trash"`
 }
 
 type GetRecordHistoryResponse struct {
@@ -141,6 +291,23 @@ type GetActiveSessionsResponse struct {
 	Sessions []ActiveSessionStatus `json:"sessions"`
 }
 
+type ListSessionsResponse struct {
+	Sessions []SessionSummary `json:"sessions"`
+}
+
+type SessionSummary struct {
+	ID            string                `json:"id"`
+	ProjectID     string                `json:"project_id"`
+	Status        session.SessionStatus `json:"status"`
+	ActiveRecords []string              `json:"active_records"`
+	LastSyncTick  int64                 `json:"last_sync_tick"`
+	TickGap       int64                 `json:"tick_gap"`
+	CreatedAt     time.Time             `json:"created_at"`
+	LastActivity  time.Time             `json:"last_activity"`
+	StaleAt       *time.Time            `json:"stale_at,omitempty"`
+	ClosedAt      *time.Time            `json:"closed_at,omitempty"`
+}
+
 type GetRecentActivityResponse struct {
 	Activity []ActivityEntryResponse `json:"activity"`
 }
@@ -159,8 +326,9 @@ type ProjectSessionStatus struct {
 }
 
 type CreateRecordResponse struct {
-	Record        record.Record `json:"record"`
-	AutoActivated bool          `json:"auto_activated"`
+	Record             record.Record              `json:"record"`
+	AutoActivated      bool                       `json:"auto_activated"`
+	PossibleDuplicates []record.PossibleDuplicate `json:"possible_duplicates,omitempty"`
 }
 
 type UpdateRecordResponse struct {
@@ -168,26 +336,45 @@ type UpdateRecordResponse struct {
 	Conflict *RecordConflictResult `json:"conflict,omitempty"`
 }
 
+type DeleteRecordResponse struct {
+	Deleted  *record.TrashEntry    `json:"deleted,omitempty"`
+	Conflict *RecordConflictResult `json:"conflict,omitempty"`
+}
+
 type RecordConflictResult struct {
-	Message      string        `json:"message"`
-	OtherVersion record.Record `json:"other_version"`
+	ConflictType string               `json:"conflict_type"`
+	Message      string               `json:"message"`
+	OtherVersion *record.Record       `json:"other_version,omitempty"`
+	BaseVersion  *record.Record       `json:"base_version,omitempty"`
+	Merge        *record.MergeResult  `json:"merge,omitempty"`
+	Sessions     []record.SessionInfo `json:"sessions,omitempty"`
 }
 
 type ActivateResponse struct {
-	SessionID string                `json:"session_id"`
-	Context   session.ContextBundle `json:"context"`
-	Warnings  []string              `json:"warnings,omitempty"`
+	SessionID      string                `json:"session_id"`
+	Context        session.ContextBundle `json:"context"`
+	Warnings       []string              `json:"warnings,omitempty"`
+	RecordWarnings map[string][]string   `json:"record_warnings,omitempty"`
+}
+
+type DeactivateResponse struct {
+	SessionID     string   `json:"session_id"`
+	Released      []string `json:"released"`
+	ActiveRecords []string `json:"active_records"`
 }
 
 type SyncSessionResponse struct {
-	SessionID     string                `json:"session_id"`
-	Staleness     int64                 `json:"staleness"`
-	SessionStatus session.SessionStatus `json:"session_status"`
-	Warning       string                `json:"warning,omitempty"`
+	SessionID        string                `json:"session_id"`
+	Staleness        int64                 `json:"staleness"`
+	SessionStatus    session.SessionStatus `json:"session_status"`
+	Changes          []session.Change      `json:"changes,omitempty"`
+	ChangesTruncated bool                  `json:"changes_truncated,omitempty"`
+	Warning          string                `json:"warning,omitempty"`
 }
 
 type RecordHistoryEntry struct {
 	Timestamp  time.Time `json:"timestamp"`
+	Tick       int64     `json:"tick"`
 	SessionID  string    `json:"session_id,omitempty"`
 	ChangeType string    `json:"change_type"`
 	Summary    string    `json:"summary"`
@@ -221,6 +408,7 @@ type ActiveSessionStatus struct {
 	SessionID    string    `json:"session_id"`
 	LastActivity time.Time `json:"last_activity"`
 	IsCurrent    bool      `json:"is_current"`
+	Stale        bool      `json:"stale,omitempty"`
 }
 
 type ActivityEntryResponse struct {
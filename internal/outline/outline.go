@@ -0,0 +1,246 @@
+// Package outline renders record references and context bundles as an
+// indented plaintext outline, which costs agents about half the tokens of
+// the JSON form (see docs/0118-plaintext-outline-analysis.md).
+//
+// Each record is a header line, "[id] (state) Title", followed by its
+// summary indented one level. IDs are shortened to record.ShortIDLength
+// characters, which every tool accepts in place of the full ID. The state
+// is a single letter, O, L, R or D, with "+n" added when n children are
+// open. Children are indented two spaces below their parent and siblings
+// are separated by a blank line.
+package outline
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rpggio/trellis/internal/domain/record"
+	"github.com/rpggio/trellis/internal/domain/session"
+)
+
+// ShortID returns the prefix of id shown in outlines.
+func ShortID(id string) string {
+	if len(id) <= record.ShortIDLength {
+		return id
+	}
+	return id[:record.ShortIDLength]
+}
+
+// Refs renders references as an outline. A ref listed after its parent is
+// nested under it; the others stay at the top level in the given order.
+func Refs(refs []record.RecordRef) string {
+	listed := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		listed[ref.ID] = true
+	}
+	children := make(map[string][]record.RecordRef)
+	var top []record.RecordRef
+	for _, ref := range refs {
+		if ref.ParentID != nil && listed[*ref.ParentID] {
+			children[*ref.ParentID] = append(children[*ref.ParentID], ref)
+			continue
+		}
+		top = append(top, ref)
+	}
+
+	var w writer
+	var write func(ref record.RecordRef, depth int)
+	write = func(ref record.RecordRef, depth int) {
+		w.ref(ref, depth)
+		for _, child := range children[ref.ID] {
+			write(child, depth+1)
+		}
+	}
+	for _, ref := range top {
+		write(ref, 0)
+	}
+	return w.String()
+}
+
+// SearchResults renders search hits, best first, each with its snippet
+// quoted below the summary.
+func SearchResults(results []record.SearchResult) string {
+	var w writer
+	for _, result := range results {
+		w.ref(result.Record, 0)
+		if result.Snippet != "" {
+			w.line(1, "> "+strings.Join(strings.Fields(result.Snippet), " "))
+		}
+	}
+	return w.String()
+}
+
+// Tree renders nested tree nodes. A collapsed node shows how many
+// descendants it hides.
+func Tree(nodes []*record.TreeNode) string {
+	var w writer
+	var write func(node *record.TreeNode, depth int)
+	write = func(node *record.TreeNode, depth int) {
+		w.ref(node.Record, depth)
+		if node.Descendants > 0 {
+			w.line(depth+1, fmt.Sprintf("[+%d descendants]", node.Descendants))
+		}
+		for _, child := range node.Children {
+			write(child, depth+1)
+		}
+	}
+	for _, node := range nodes {
+		write(node, 0)
+	}
+	return w.String()
+}
+
+// Bundle renders a context bundle: the ancestor path, the target with its
+// body, then a section for each group of related records. Full records
+// carry their bodies; the rest are references. A merged bundle has a path
+// line per target and sections for its targets and parents.
+func Bundle(bundle session.ContextBundle) string {
+	var w writer
+	if len(bundle.Ancestors) > 0 {
+		w.line(0, "path: "+path(bundle.Ancestors))
+	}
+	for _, target := range bundle.Targets {
+		if ancestors := bundle.Paths[target.ID]; len(ancestors) > 0 {
+			w.line(0, fmt.Sprintf("path [%s]: %s", ShortID(target.ID), path(ancestors)))
+		}
+	}
+	if bundle.Target != nil {
+		w.record(bundle.Target, len(bundle.OpenChildren))
+	}
+	if len(bundle.Targets) > 0 {
+		w.section("Targets", len(bundle.Targets))
+		for i := range bundle.Targets {
+			w.record(&bundle.Targets[i], 0)
+		}
+	}
+	if bundle.Parent != nil {
+		w.section("Parent", 1)
+		w.record(bundle.Parent, 0)
+	}
+	if len(bundle.Parents) > 0 {
+		w.section("Parents", len(bundle.Parents))
+		for i := range bundle.Parents {
+			w.record(&bundle.Parents[i], 0)
+		}
+	}
+	if len(bundle.OpenChildren) > 0 {
+		w.section("Open children", len(bundle.OpenChildren))
+		for i := range bundle.OpenChildren {
+			w.record(&bundle.OpenChildren[i], 0)
+		}
+	}
+	w.refSection("Other children", bundle.OtherChildren)
+	w.refSection("Grandchildren", bundle.Grandchildren)
+	w.refSection("Descendants", bundle.Descendants)
+	w.refSection("Siblings", bundle.Siblings)
+	for _, kind := range record.RelationKinds {
+		w.refSection("Links: "+string(kind), bundle.Links[kind])
+	}
+	for _, kind := range record.RelationKinds {
+		w.refSection("Backlinks: "+string(kind), bundle.Backlinks[kind])
+	}
+	w.refSection("Unchanged", bundle.Unchanged)
+	return w.String()
+}
+
+// path renders an ancestor path as "[id] Title > [id] Title".
+func path(ancestors []record.Ancestor) string {
+	crumbs := make([]string, len(ancestors))
+	for i, ancestor := range ancestors {
+		crumbs[i] = fmt.Sprintf("[%s] %s", ShortID(ancestor.ID), ancestor.Title)
+	}
+	return strings.Join(crumbs, " > ")
+}
+
+// writer builds an outline, keeping a blank line between blocks.
+type writer struct {
+	b strings.Builder
+}
+
+func (w *writer) String() string {
+	return w.b.String()
+}
+
+// block starts a new block, separated from the previous one.
+func (w *writer) block() {
+	if w.b.Len() > 0 {
+		w.b.WriteString("\n")
+	}
+}
+
+func (w *writer) line(depth int, text string) {
+	w.b.WriteString(strings.Repeat("  ", depth))
+	w.b.WriteString(text)
+	w.b.WriteString("\n")
+}
+
+// text writes each line of text at depth, dropping blank lines at either
+// end.
+func (w *writer) text(depth int, text string) {
+	text = strings.Trim(text, "\n")
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			w.b.WriteString("\n")
+			continue
+		}
+		w.line(depth, strings.TrimRight(line, " \t\r"))
+	}
+}
+
+func (w *writer) header(depth int, id string, state record.RecordState, openChildren int, title string) {
+	w.block()
+	w.line(depth, fmt.Sprintf("[%s] %s %s", ShortID(id), marker(state, openChildren), title))
+}
+
+func (w *writer) ref(ref record.RecordRef, depth int) {
+	w.header(depth, ref.ID, ref.State, ref.OpenChildrenCount, ref.Title)
+	w.text(depth+1, ref.Summary)
+}
+
+// record writes a full record: header, summary and, after a blank line,
+// its body.
+func (w *writer) record(rec *record.Record, openChildren int) {
+	w.header(0, rec.ID, rec.State, openChildren, rec.Title)
+	w.text(1, rec.Summary)
+	if strings.TrimSpace(rec.Body) != "" {
+		w.b.WriteString("\n")
+		w.text(1, rec.Body)
+	}
+}
+
+func (w *writer) section(title string, count int) {
+	w.block()
+	w.line(0, fmt.Sprintf("## %s (%d)", title, count))
+}
+
+func (w *writer) refSection(title string, refs []record.RecordRef) {
+	if len(refs) == 0 {
+		return
+	}
+	w.section(title, len(refs))
+	for _, ref := range refs {
+		w.ref(ref, 0)
+	}
+}
+
+// marker returns the state marker of a header, such as (O) or (O+2).
+func marker(state record.RecordState, openChildren int) string {
+	letter := "?"
+	switch state {
+	case record.StateOpen:
+		letter = "O"
+	case record.StateLater:
+		letter = "L"
+	case record.StateResolved:
+		letter = "R"
+	case record.StateDiscarded:
+		letter = "D"
+	}
+	if openChildren > 0 {
+		return fmt.Sprintf("(%s+%d)", letter, openChildren)
+	}
+	return "(" + letter + ")"
+}
@@ -0,0 +1,132 @@
+package outline
+
+import (
+	"testing"
+
+	"github.com/rpggio/trellis/internal/domain/record"
+	"github.com/rpggio/trellis/internal/domain/session"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr(s string) *string {
+	return &s
+}
+
+func TestRefs(t *testing.T) {
+	refs := []record.RecordRef{
+		{ID: "11111111-aaaa", State: record.StateOpen, Title: "Cache invalidation approach", Summary: "Leaning toward events.\nNeed pub/sub.", OpenChildrenCount: 1},
+		{ID: "22222222-bbbb", ParentID: ptr("11111111-aaaa"), State: record.StateOpen, Title: "Redis pub/sub", Summary: "Ops cost?"},
+		{ID: "33333333-cccc", ParentID: ptr("11111111-aaaa"), State: record.StateResolved, Title: "Use hybrid invalidation"},
+		{ID: "44444444-dddd", ParentID: ptr("elsewhere"), State: record.StateLater, Title: "Benchmarks", Summary: "Blocked."},
+	}
+
+	require.Equal(t, `[11111111] (O+1) Cache invalidation approach
+  Leaning toward events.
+  Need pub/sub.
+
+  [22222222] (O) Redis pub/sub
+    Ops cost?
+
+  [33333333] (R) Use hybrid invalidation
+
+[44444444] (L) Benchmarks
+  Blocked.
+`, Refs(refs))
+	require.Empty(t, Refs(nil))
+}
+
+func TestSearchResultsAndTree(t *testing.T) {
+	results := []record.SearchResult{{
+		Record:  record.RecordRef{ID: "11111111-aaaa", State: record.StateDiscarded, Title: "TTL only", Summary: "Rejected."},
+		Snippet: "...too **stale**\nfor inventory...",
+	}}
+	require.Equal(t, `[11111111] (D) TTL only
+  Rejected.
+  > ...too **stale** for inventory...
+`, SearchResults(results))
+
+	tree := []*record.TreeNode{{
+		Record: record.RecordRef{ID: "11111111-aaaa", State: record.StateOpen, Title: "Root"},
+		Children: []*record.TreeNode{
+			{Record: record.RecordRef{ID: "22222222-bbbb", State: record.StateOpen, Title: "Child"}, Descendants: 3},
+		},
+	}}
+	require.Equal(t, `[11111111] (O) Root
+
+  [22222222] (O) Child
+    [+3 descendants]
+`, Tree(tree))
+}
+
+func TestBundle(t *testing.T) {
+	bundle := session.ContextBundle{
+		Ancestors: []record.Ancestor{{ID: "00000000-root", Title: "Root"}, {ID: "11111111-aaaa", Title: "Parent"}},
+		Target:    &record.Record{ID: "22222222-bbbb", State: record.StateOpen, Title: "Target", Summary: "Sum", Body: "Para one.\n\nPara two."},
+		Parent:    &record.Record{ID: "11111111-aaaa", State: record.StateOpen, Title: "Parent", Summary: "Parent sum"},
+		OpenChildren: []record.Record{
+			{ID: "33333333-cccc", State: record.StateOpen, Title: "Open child", Summary: "Child sum", Body: "Child body"},
+		},
+		OtherChildren: []record.RecordRef{{ID: "44444444-dddd", State: record.StateResolved, Title: "Done child"}},
+		Links: map[record.RelationKind][]record.RecordRef{
+			record.RelationBlocks: {{ID: "55555555-eeee", State: record.StateOpen, Title: "Blocked"}},
+		},
+	}
+
+	require.Equal(t, `path: [00000000] Root > [11111111] Parent
+
+[22222222] (O+1) Target
+  Sum
+
+  Para one.
+
+  Para two.
+
+## Parent (1)
+
+[11111111] (O) Parent
+  Parent sum
+
+## Open children (1)
+
+[33333333] (O) Open child
+  Child sum
+
+  Child body
+
+## Other children (1)
+
+[44444444] (R) Done child
+
+## Links: blocks (1)
+
+[55555555] (O) Blocked
+`, Bundle(bundle))
+}
+
+func TestBundleMerged(t *testing.T) {
+	bundle := session.ContextBundle{
+		Targets: []record.Record{
+			{ID: "11111111-aaaa", State: record.StateOpen, Title: "First", Summary: "One"},
+			{ID: "22222222-bbbb", State: record.StateLater, Title: "Second", Summary: "Two"},
+		},
+		Paths: map[string][]record.Ancestor{
+			"22222222-bbbb": {{ID: "00000000-root", Title: "Root"}},
+		},
+		Parents: []record.Record{{ID: "00000000-root", State: record.StateOpen, Title: "Root"}},
+	}
+
+	require.Equal(t, `path [22222222]: [00000000] Root
+
+## Targets (2)
+
+[11111111] (O) First
+  One
+
+[22222222] (L) Second
+  Two
+
+## Parents (1)
+
+[00000000] (O) Root
+`, Bundle(bundle))
+}
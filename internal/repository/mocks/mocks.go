@@ -2,6 +2,7 @@ package mocks
 
 import (
 	"context"
+	"time"
 
 	"github.com/rpggio/trellis/internal/domain/activity"
 	"github.com/rpggio/trellis/internal/domain/project"
@@ -36,6 +37,11 @@ func (m *ProjectRepository) GetDefault(ctx context.Context, tenantID string) (*p
 	return nil, args.Error(1)
 }
 
+func (m *ProjectRepository) Update(ctx context.Context, tenantID string, proj *project.Project) error {
+	args := m.Called(ctx, tenantID, proj)
+	return args.Error(0)
+}
+
 func (m *ProjectRepository) List(ctx context.Context, tenantID string) ([]project.ProjectSummary, error) {
 	args := m.Called(ctx, tenantID)
 	if list, ok := args.Get(0).([]project.ProjectSummary); ok {
@@ -49,6 +55,14 @@ func (m *ProjectRepository) IncrementTick(ctx context.Context, tenantID, project
 	return args.Get(0).(int64), args.Error(1)
 }
 
+func (m *ProjectRepository) Ticks(ctx context.Context, tenantID string, projectIDs []string) (map[string]int64, error) {
+	args := m.Called(ctx, tenantID, projectIDs)
+	if ticks, ok := args.Get(0).(map[string]int64); ok {
+		return ticks, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 // RecordRepository is a mock for repository.RecordRepository.
 type RecordRepository struct {
 	mock.Mock
@@ -77,6 +91,32 @@ func (m *RecordRepository) Delete(ctx context.Context, tenantID, id string) erro
 	return args.Error(0)
 }
 
+func (m *RecordRepository) SoftDelete(ctx context.Context, tenantID, id string, deletedAt time.Time) (int, error) {
+	args := m.Called(ctx, tenantID, id, deletedAt)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *RecordRepository) GetTrashed(ctx context.Context, tenantID, id string) (*record.Record, error) {
+	args := m.Called(ctx, tenantID, id)
+	if rec, ok := args.Get(0).(*record.Record); ok {
+		return rec, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *RecordRepository) Restore(ctx context.Context, tenantID, id string) (int, error) {
+	args := m.Called(ctx, tenantID, id)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *RecordRepository) ListTrash(ctx context.Context, tenantID string, opts record.ListTrashOptions) ([]record.TrashEntry, error) {
+	args := m.Called(ctx, tenantID, opts)
+	if list, ok := args.Get(0).([]record.TrashEntry); ok {
+		return list, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *RecordRepository) List(ctx context.Context, tenantID string, opts record.ListRecordsOptions) ([]record.RecordRef, error) {
 	args := m.Called(ctx, tenantID, opts)
 	if list, ok := args.Get(0).([]record.RecordRef); ok {
@@ -85,6 +125,35 @@ func (m *RecordRepository) List(ctx context.Context, tenantID string, opts recor
 	return nil, args.Error(1)
 }
 
+func (m *RecordRepository) Count(ctx context.Context, tenantID string, opts record.ListRecordsOptions) (int, error) {
+	args := m.Called(ctx, tenantID, opts)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *RecordRepository) Tree(ctx context.Context, tenantID string, opts record.TreeOptions) ([]record.TreeNode, error) {
+	args := m.Called(ctx, tenantID, opts)
+	if nodes, ok := args.Get(0).([]record.TreeNode); ok {
+		return nodes, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *RecordRepository) Ancestors(ctx context.Context, tenantID string, ids []string) (map[string][]record.Ancestor, error) {
+	args := m.Called(ctx, tenantID, ids)
+	if paths, ok := args.Get(0).(map[string][]record.Ancestor); ok {
+		return paths, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *RecordRepository) MatchIDPrefix(ctx context.Context, tenantID, prefix string, limit int) ([]string, error) {
+	args := m.Called(ctx, tenantID, prefix, limit)
+	if ids, ok := args.Get(0).([]string); ok {
+		return ids, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *RecordRepository) GetChildren(ctx context.Context, tenantID, parentID string) ([]record.Record, error) {
 	args := m.Called(ctx, tenantID, parentID)
 	if list, ok := args.Get(0).([]record.Record); ok {
@@ -109,11 +178,45 @@ func (m *RecordRepository) GetRelated(ctx context.Context, tenantID, recordID st
 	return nil, args.Error(1)
 }
 
-func (m *RecordRepository) AddRelation(ctx context.Context, fromRecordID, toRecordID string) error {
-	args := m.Called(ctx, fromRecordID, toRecordID)
+func (m *RecordRepository) GetLinks(ctx context.Context, tenantID, recordID string) ([]record.Link, error) {
+	args := m.Called(ctx, tenantID, recordID)
+	if list, ok := args.Get(0).([]record.Link); ok {
+		return list, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *RecordRepository) GetBacklinks(ctx context.Context, tenantID, recordID string) ([]record.Link, error) {
+	args := m.Called(ctx, tenantID, recordID)
+	if list, ok := args.Get(0).([]record.Link); ok {
+		return list, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *RecordRepository) AddRelation(ctx context.Context, fromRecordID, toRecordID string, kind record.RelationKind) error {
+	args := m.Called(ctx, fromRecordID, toRecordID, kind)
 	return args.Error(0)
 }
 
+func (m *RecordRepository) RemoveRelation(ctx context.Context, fromRecordID, toRecordID string, kind record.RelationKind) error {
+	args := m.Called(ctx, fromRecordID, toRecordID, kind)
+	return args.Error(0)
+}
+
+func (m *RecordRepository) SaveVersion(ctx context.Context, tenantID string, rec *record.Record) error {
+	args := m.Called(ctx, tenantID, rec)
+	return args.Error(0)
+}
+
+func (m *RecordRepository) GetVersionAt(ctx context.Context, tenantID, id string, tick int64) (*record.Record, error) {
+	args := m.Called(ctx, tenantID, id, tick)
+	if rec, ok := args.Get(0).(*record.Record); ok {
+		return rec, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 // SessionRepository is a mock for repository.SessionRepository.
 type SessionRepository struct {
 	mock.Mock
@@ -142,6 +245,21 @@ func (m *SessionRepository) Close(ctx context.Context, tenantID, id string) erro
 	return args.Error(0)
 }
 
+func (m *SessionRepository) MarkStale(ctx context.Context, tenantID, id string, lastActivity, staleAt time.Time) error {
+	args := m.Called(ctx, tenantID, id, lastActivity, staleAt)
+	return args.Error(0)
+}
+
+func (m *SessionRepository) CloseStale(ctx context.Context, tenantID, id string, lastActivity time.Time) error {
+	args := m.Called(ctx, tenantID, id, lastActivity)
+	return args.Error(0)
+}
+
+func (m *SessionRepository) Touch(ctx context.Context, tenantID, id string, tick int64, at time.Time) error {
+	args := m.Called(ctx, tenantID, id, tick, at)
+	return args.Error(0)
+}
+
 func (m *SessionRepository) ListActive(ctx context.Context, tenantID, projectID string) ([]session.SessionInfo, error) {
 	args := m.Called(ctx, tenantID, projectID)
 	if list, ok := args.Get(0).([]session.SessionInfo); ok {
@@ -150,6 +268,22 @@ func (m *SessionRepository) ListActive(ctx context.Context, tenantID, projectID
 	return nil, args.Error(1)
 }
 
+func (m *SessionRepository) List(ctx context.Context, tenantID string, opts session.ListSessionsOptions) ([]session.Session, error) {
+	args := m.Called(ctx, tenantID, opts)
+	if list, ok := args.Get(0).([]session.Session); ok {
+		return list, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *SessionRepository) ListOpen(ctx context.Context) ([]session.Session, error) {
+	args := m.Called(ctx)
+	if list, ok := args.Get(0).([]session.Session); ok {
+		return list, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *SessionRepository) GetByRecordID(ctx context.Context, tenantID, recordID string) ([]session.SessionInfo, error) {
 	args := m.Called(ctx, tenantID, recordID)
 	if list, ok := args.Get(0).([]session.SessionInfo); ok {
@@ -163,6 +297,11 @@ func (m *SessionRepository) AddActivation(ctx context.Context, sessionID, record
 	return args.Error(0)
 }
 
+func (m *SessionRepository) RemoveActivation(ctx context.Context, sessionID, recordID string) error {
+	args := m.Called(ctx, sessionID, recordID)
+	return args.Error(0)
+}
+
 func (m *SessionRepository) GetActivations(ctx context.Context, sessionID string) ([]string, error) {
 	args := m.Called(ctx, sessionID)
 	if list, ok := args.Get(0).([]string); ok {
@@ -176,6 +315,16 @@ func (m *SessionRepository) GetActivationTick(ctx context.Context, sessionID, re
 	return args.Get(0).(int64), args.Error(1)
 }
 
+func (m *SessionRepository) SetContextTick(ctx context.Context, sessionID, recordID string, tick int64) error {
+	args := m.Called(ctx, sessionID, recordID, tick)
+	return args.Error(0)
+}
+
+func (m *SessionRepository) GetContextTick(ctx context.Context, sessionID, recordID string) (int64, error) {
+	args := m.Called(ctx, sessionID, recordID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 // ActivityRepository is a mock for repository.ActivityRepository.
 type ActivityRepository struct {
 	mock.Mock
@@ -199,10 +348,41 @@ type SearchRepository struct {
 	mock.Mock
 }
 
-func (m *SearchRepository) Search(ctx context.Context, tenantID, projectID, query string, opts record.SearchOptions) ([]record.SearchResult, error) {
-	args := m.Called(ctx, tenantID, projectID, query, opts)
+func (m *SearchRepository) Search(ctx context.Context, tenantID string, query record.Query, opts record.SearchOptions) ([]record.SearchResult, error) {
+	args := m.Called(ctx, tenantID, query, opts)
 	if list, ok := args.Get(0).([]record.SearchResult); ok {
 		return list, args.Error(1)
 	}
 	return nil, args.Error(1)
 }
+
+func (m *SearchRepository) Count(ctx context.Context, tenantID string, query record.Query, opts record.SearchOptions) (int, error) {
+	args := m.Called(ctx, tenantID, query, opts)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *SearchRepository) EmbeddingHash(ctx context.Context, recordID, model string) (string, error) {
+	args := m.Called(ctx, recordID, model)
+	return args.String(0), args.Error(1)
+}
+
+func (m *SearchRepository) SaveEmbedding(ctx context.Context, recordID, model, contentHash string, vector []float32) error {
+	args := m.Called(ctx, recordID, model, contentHash, vector)
+	return args.Error(0)
+}
+
+func (m *SearchRepository) MissingEmbeddings(ctx context.Context, tenantID, model string, limit int) ([]record.Record, error) {
+	args := m.Called(ctx, tenantID, model, limit)
+	if list, ok := args.Get(0).([]record.Record); ok {
+		return list, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *SearchRepository) SearchEmbeddings(ctx context.Context, tenantID, model string, query record.Query, opts record.SearchOptions) ([]record.EmbeddedRef, error) {
+	args := m.Called(ctx, tenantID, model, query, opts)
+	if list, ok := args.Get(0).([]record.EmbeddedRef); ok {
+		return list, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
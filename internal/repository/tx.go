@@ -0,0 +1,10 @@
+package repository
+
+import "context"
+
+// Transactor runs a unit of work. Repositories called with the context
+// passed to fn take part in the same transaction, which commits when fn
+// returns nil and rolls back otherwise.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
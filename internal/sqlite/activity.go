@@ -33,7 +33,7 @@ func (r *ActivityRepository) Log(ctx context.Context, tenantID string, entry *ac
 		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	result, err := r.db.ExecContext(ctx, query,
+	result, err := r.db.conn(ctx).ExecContext(ctx, query,
 		tenantID,
 		entry.ProjectID,
 		entry.SessionID,
@@ -88,6 +88,10 @@ func (r *ActivityRepository) List(ctx context.Context, tenantID string, opts act
 		conditions = append(conditions, "activity_type = ?")
 		args = append(args, *opts.ActivityType)
 	}
+	if opts.SinceTick > 0 {
+		conditions = append(conditions, "tick > ?")
+		args = append(args, opts.SinceTick)
+	}
 
 	if len(conditions) > 0 {
 		query += " AND " + joinConditions(conditions)
@@ -104,7 +108,7 @@ func (r *ActivityRepository) List(ctx context.Context, tenantID string, opts act
 		args = append(args, opts.Offset)
 	}
 
-	rows, err := r.db.QueryContext(ctx, query, args...)
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list activity: %w", err)
 	}
@@ -39,6 +39,11 @@ func TestActivityRepository_LogList(t *testing.T) {
 	require.Len(t, entries, 2)
 	require.Equal(t, entry2.ActivityType, entries[0].ActivityType)
 	require.Equal(t, entry1.ActivityType, entries[1].ActivityType)
+
+	entries, err = repo.List(ctx, "tenant1", activity.ListActivityOptions{ProjectID: "p1", SinceTick: 1})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, entry2.ActivityType, entries[0].ActivityType)
 }
 
 func TestActivityRepository_FiltersAndTenantIsolation(t *testing.T) {
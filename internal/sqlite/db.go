@@ -3,6 +3,9 @@ package sqlite
 import (
 	"database/sql"
 	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
 
 	"github.com/rpggio/trellis/migrations"
 	_ "modernc.org/sqlite"
@@ -11,6 +14,7 @@ import (
 // DB wraps a SQLite database connection
 type DB struct {
 	*sql.DB
+	trigram bool // records_fts_trigram is maintained, see ConfigureFTS
 }
 
 // New creates a new SQLite database connection
@@ -25,20 +29,60 @@ func New(dataSourceName string) (*DB, error) {
 		return nil, fmt.Errorf("failed to enable foreign keys: %w", err)
 	}
 
-	return &DB{db}, nil
+	return &DB{DB: db}, nil
 }
 
-// RunMigrations runs the migrations directly (for testing)
-// In production, migrations should be run via the migrate CLI or embed package
+// RunMigrations applies all embedded up migrations that have not been applied yet.
+// Applied versions are tracked in the schema_migrations table.
 func (db *DB) RunMigrations() error {
-	migration, err := migrations.FS.ReadFile("001_initial_schema.up.sql")
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version TEXT PRIMARY KEY,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
 	if err != nil {
-		return fmt.Errorf("failed to read migrations: %w", err)
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
 	}
 
-	_, err = db.Exec(string(migration))
+	names, err := fs.Glob(migrations.FS, "*.up.sql")
 	if err != nil {
-		return fmt.Errorf("failed to run migrations: %w", err)
+		return fmt.Errorf("failed to list migrations: %w", err)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version := strings.TrimSuffix(name, ".up.sql")
+
+		var applied bool
+		err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = ?)`, version).Scan(&applied)
+		if err != nil {
+			return fmt.Errorf("failed to check migration %s: %w", version, err)
+		}
+		if applied {
+			continue
+		}
+
+		migration, err := migrations.FS.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s: %w", version, err)
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %s: %w", version, err)
+		}
+		if _, err := tx.Exec(string(migration)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to run migration %s: %w", version, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %s: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %s: %w", version, err)
+		}
 	}
 
 	return nil
@@ -41,6 +41,9 @@ func TestMigrations(t *testing.T) {
 		"activity_log",
 		"records_fts",
 		"api_keys",
+		"record_versions",
+		"record_embeddings",
+		"schema_migrations",
 	}
 
 	for _, table := range tables {
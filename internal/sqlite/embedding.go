@@ -0,0 +1,158 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/rpggio/trellis/internal/domain/record"
+)
+
+// EmbeddingHash returns the content hash of the record's embedding for the
+// model, or "" when it has none
+func (r *SearchRepository) EmbeddingHash(ctx context.Context, recordID, model string) (string, error) {
+	var hash string
+	err := r.db.conn(ctx).QueryRowContext(ctx,
+		`SELECT content_hash FROM record_embeddings WHERE record_id = ? AND model = ?`,
+		recordID, model,
+	).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get embedding hash: %w", err)
+	}
+	return hash, nil
+}
+
+// SaveEmbedding stores the record's embedding for the model, replacing any
+// previous one
+func (r *SearchRepository) SaveEmbedding(ctx context.Context, recordID, model, contentHash string, vector []float32) error {
+	query := `
+		INSERT INTO record_embeddings (record_id, model, content_hash, dimensions, vector, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (record_id, model) DO UPDATE SET
+			content_hash = excluded.content_hash,
+			dimensions = excluded.dimensions,
+			vector = excluded.vector,
+			updated_at = excluded.updated_at
+	`
+	_, err := r.db.conn(ctx).ExecContext(ctx, query,
+		recordID, model, contentHash, len(vector), encodeVector(vector), time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save embedding: %w", err)
+	}
+	return nil
+}
+
+// MissingEmbeddings returns up to limit live records that have no embedding
+// for the model
+func (r *SearchRepository) MissingEmbeddings(ctx context.Context, tenantID, model string, limit int) ([]record.Record, error) {
+	query := `
+		SELECT r.id, r.project_id, r.title, r.summary, r.body
+		FROM records r
+		LEFT JOIN record_embeddings e ON e.record_id = r.id AND e.model = ?
+		WHERE r.tenant_id = ? AND r.deleted_at IS NULL AND e.record_id IS NULL
+		ORDER BY r.rowid
+		LIMIT ?
+	`
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, model, tenantID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list records without embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	var records []record.Record
+	for rows.Next() {
+		rec := record.Record{TenantID: tenantID}
+		if err := rows.Scan(&rec.ID, &rec.ProjectID, &rec.Title, &rec.Summary, &rec.Body); err != nil {
+			return nil, fmt.Errorf("failed to scan record: %w", err)
+		}
+		records = append(records, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating records: %w", err)
+	}
+
+	return records, nil
+}
+
+// SearchEmbeddings returns the embeddings for the model of every record
+// matching the query's filters and exclusions. The query's terms are not
+// matched; ranking by similarity is left to the caller.
+func (r *SearchRepository) SearchEmbeddings(ctx context.Context, tenantID, model string, query record.Query, opts record.SearchOptions) ([]record.EmbeddedRef, error) {
+	conditions, whereArgs := searchConditions(tenantID, query, opts)
+	sqlQuery := `
+		SELECT
+			r.id, r.type, r.title, r.summary, r.state, r.parent_id, r.project_id, COALESCE(p.name, ''),
+			(SELECT COUNT(*) FROM records c WHERE c.parent_id = r.id AND c.tenant_id = r.tenant_id AND c.deleted_at IS NULL) as children_count,
+			(SELECT COUNT(*) FROM records c WHERE c.parent_id = r.id AND c.tenant_id = r.tenant_id AND c.deleted_at IS NULL AND c.state = 'OPEN') as open_children_count,
+			e.vector
+		FROM records r
+		JOIN record_embeddings e ON e.record_id = r.id AND e.model = ?
+		LEFT JOIN projects p ON p.id = r.project_id AND p.tenant_id = r.tenant_id
+		WHERE ` + strings.Join(conditions, " AND ")
+	args := append([]interface{}{model}, whereArgs...)
+
+	rows, err := r.db.conn(ctx).QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	var results []record.EmbeddedRef
+	for rows.Next() {
+		var result record.EmbeddedRef
+		var blob []byte
+		err := rows.Scan(
+			&result.Ref.ID,
+			&result.Ref.Type,
+			&result.Ref.Title,
+			&result.Ref.Summary,
+			&result.Ref.State,
+			&result.Ref.ParentID,
+			&result.Ref.ProjectID,
+			&result.Ref.ProjectName,
+			&result.Ref.ChildrenCount,
+			&result.Ref.OpenChildrenCount,
+			&blob,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan embedding: %w", err)
+		}
+		if result.Vector, err = decodeVector(blob); err != nil {
+			return nil, fmt.Errorf("failed to decode embedding of %s: %w", result.Ref.ID, err)
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating embeddings: %w", err)
+	}
+
+	return results, nil
+}
+
+// encodeVector stores a vector as little-endian float32s
+func encodeVector(vector []float32) []byte {
+	blob := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(blob[4*i:], math.Float32bits(v))
+	}
+	return blob
+}
+
+func decodeVector(blob []byte) ([]float32, error) {
+	if len(blob)%4 != 0 {
+		return nil, fmt.Errorf("vector blob has %d bytes, not a multiple of 4", len(blob))
+	}
+	vector := make([]float32, len(blob)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(blob[4*i:]))
+	}
+	return vector, nil
+}
@@ -0,0 +1,212 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// Tokenizers for the records_fts index
+const (
+	// TokenizerUnicode61 matches whole words, case and accent insensitive
+	TokenizerUnicode61 = "unicode61"
+	// TokenizerPorter also matches other forms of a word, so "caching"
+	// finds "cache"
+	TokenizerPorter = "porter"
+)
+
+// FTSConfig selects how records are indexed for full-text search. Trigram
+// maintains a second index that matches any substring of at least three
+// characters, such as "textBund" in ContextBundle.
+type FTSConfig struct {
+	Tokenizer string
+	Trigram   bool
+}
+
+// ftsTables are the full-text indexes over records
+var ftsTables = []string{"records_fts", "records_fts_trigram"}
+
+var tokenizeOption = regexp.MustCompile(`tokenize\s*=\s*'([^']*)'`)
+
+// ConfigureFTS makes the full-text indexes match cfg. records_fts is
+// recreated and rebuilt when its tokenizer changes, and the trigram index
+// is created and filled, or dropped, as needed. It reports whether any
+// index was rebuilt.
+func (db *DB) ConfigureFTS(ctx context.Context, cfg FTSConfig) (bool, error) {
+	tokenize, err := ftsTokenize(cfg.Tokenizer)
+	if err != nil {
+		return false, err
+	}
+
+	rebuilt := false
+	err = db.WithinTx(ctx, func(ctx context.Context) error {
+		current, err := db.tableSQL(ctx, "records_fts")
+		if err != nil {
+			return err
+		}
+		currentTokenize := TokenizerUnicode61
+		if match := tokenizeOption.FindStringSubmatch(current); match != nil {
+			currentTokenize = match[1]
+		}
+		if currentTokenize != tokenize {
+			if err := db.recreateFTS(ctx, "records_fts", tokenize); err != nil {
+				return err
+			}
+			rebuilt = true
+		}
+
+		trigram, err := db.tableSQL(ctx, "records_fts_trigram")
+		if err != nil {
+			return err
+		}
+		switch {
+		case cfg.Trigram && trigram == "":
+			if err := db.recreateFTS(ctx, "records_fts_trigram", "trigram"); err != nil {
+				return err
+			}
+			if err := db.execAll(ctx, trigramTriggers); err != nil {
+				return fmt.Errorf("failed to create trigram triggers: %w", err)
+			}
+			rebuilt = true
+		case !cfg.Trigram && trigram != "":
+			if err := db.execAll(ctx, dropTrigram); err != nil {
+				return fmt.Errorf("failed to drop trigram index: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	db.trigram = cfg.Trigram
+	return rebuilt, nil
+}
+
+// RebuildFTS rebuilds the full-text indexes from the records table,
+// repairing any drift from rows written outside the app
+func (db *DB) RebuildFTS(ctx context.Context) error {
+	return db.WithinTx(ctx, func(ctx context.Context) error {
+		tables, err := db.ftsTables(ctx)
+		if err != nil {
+			return err
+		}
+		for _, table := range tables {
+			if _, err := db.conn(ctx).ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s(%s) VALUES('rebuild')`, table, table)); err != nil {
+				return fmt.Errorf("failed to rebuild %s: %w", table, err)
+			}
+		}
+		return nil
+	})
+}
+
+// CheckFTS verifies that the full-text indexes are intact and match the
+// records table. It returns an error naming the first index that doesn't.
+func (db *DB) CheckFTS(ctx context.Context) error {
+	tables, err := db.ftsTables(ctx)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		// A rank of 1 also compares the index with the content table.
+		query := fmt.Sprintf(`INSERT INTO %s(%s, rank) VALUES('integrity-check', 1)`, table, table)
+		if _, err := db.conn(ctx).ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("%s failed integrity check (run admin fts-rebuild): %w", table, err)
+		}
+	}
+	return nil
+}
+
+// ftsTables returns the full-text indexes that exist
+func (db *DB) ftsTables(ctx context.Context) ([]string, error) {
+	var tables []string
+	for _, table := range ftsTables {
+		sql, err := db.tableSQL(ctx, table)
+		if err != nil {
+			return nil, err
+		}
+		if sql != "" {
+			tables = append(tables, table)
+		}
+	}
+	return tables, nil
+}
+
+// tableSQL returns the CREATE statement of a table, or "" if it doesn't exist
+func (db *DB) tableSQL(ctx context.Context, name string) (string, error) {
+	var sql string
+	err := db.conn(ctx).QueryRowContext(ctx,
+		`SELECT COALESCE((SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?), '')`, name,
+	).Scan(&sql)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up %s: %w", name, err)
+	}
+	return sql, nil
+}
+
+// recreateFTS replaces a full-text index over records with one using the
+// given tokenizer and fills it. Triggers on records refer to the index by
+// name, so they keep working.
+func (db *DB) recreateFTS(ctx context.Context, table, tokenize string) error {
+	statements := []string{
+		fmt.Sprintf(`DROP TABLE IF EXISTS %s`, table),
+		fmt.Sprintf(`CREATE VIRTUAL TABLE %s USING fts5(
+			title,
+			summary,
+			body,
+			content='records',
+			content_rowid='rowid',
+			tokenize='%s'
+		)`, table, tokenize),
+		fmt.Sprintf(`INSERT INTO %s(%s) VALUES('rebuild')`, table, table),
+	}
+	if err := db.execAll(ctx, statements); err != nil {
+		return fmt.Errorf("failed to recreate %s: %w", table, err)
+	}
+	return nil
+}
+
+func (db *DB) execAll(ctx context.Context, statements []string) error {
+	for _, stmt := range statements {
+		if _, err := db.conn(ctx).ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ftsTokenize(tokenizer string) (string, error) {
+	switch tokenizer {
+	case "", TokenizerUnicode61:
+		return TokenizerUnicode61, nil
+	case TokenizerPorter:
+		return "porter unicode61", nil
+	default:
+		return "", fmt.Errorf("unknown FTS tokenizer %q (use %s or %s)", tokenizer, TokenizerUnicode61, TokenizerPorter)
+	}
+}
+
+// trigramTriggers keep records_fts_trigram in step with records, like the
+// records_fts triggers of the initial schema
+var trigramTriggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS records_trigram_ai AFTER INSERT ON records BEGIN
+		INSERT INTO records_fts_trigram(rowid, title, summary, body)
+		VALUES (new.rowid, new.title, new.summary, new.body);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS records_trigram_ad AFTER DELETE ON records BEGIN
+		INSERT INTO records_fts_trigram(records_fts_trigram, rowid, title, summary, body)
+		VALUES('delete', old.rowid, old.title, old.summary, old.body);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS records_trigram_au AFTER UPDATE ON records BEGIN
+		INSERT INTO records_fts_trigram(records_fts_trigram, rowid, title, summary, body)
+		VALUES('delete', old.rowid, old.title, old.summary, old.body);
+		INSERT INTO records_fts_trigram(rowid, title, summary, body)
+		VALUES (new.rowid, new.title, new.summary, new.body);
+	END`,
+}
+
+var dropTrigram = []string{
+	`DROP TRIGGER IF EXISTS records_trigram_ai`,
+	`DROP TRIGGER IF EXISTS records_trigram_ad`,
+	`DROP TRIGGER IF EXISTS records_trigram_au`,
+	`DROP TABLE IF EXISTS records_fts_trigram`,
+}
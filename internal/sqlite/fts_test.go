@@ -0,0 +1,98 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rpggio/trellis/internal/domain/record"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDB_ConfigureFTS(t *testing.T) {
+	db := NewTestDB(t)
+	ctx := context.Background()
+	insertProject(t, db, "p1", "tenant1")
+
+	repo := NewRecordRepository(db)
+	now := time.Now()
+	create := func(id, title, body string) {
+		t.Helper()
+		require.NoError(t, repo.Create(ctx, "tenant1", &record.Record{
+			ID: id, ProjectID: "p1", Type: "note", Title: title, Summary: "Summary", Body: body,
+			State: record.StateOpen, CreatedAt: now, ModifiedAt: now, Tick: 1,
+		}))
+	}
+	create("r1", "Caching layer", "Keeps lookups fast.")
+	create("r2", "Activation", "Returns a ContextBundle.")
+
+	searchRepo := NewSearchRepository(db, DefaultSearchWeights)
+	ids := func(query string) []string {
+		t.Helper()
+		results, err := searchRepo.Search(ctx, "tenant1", parseQuery(t, query), record.SearchOptions{})
+		require.NoError(t, err)
+		ids := make([]string, len(results))
+		for i, result := range results {
+			ids[i] = result.Record.ID
+		}
+		return ids
+	}
+
+	require.Empty(t, ids("cache"))
+	require.Empty(t, ids("textbundle"))
+
+	rebuilt, err := db.ConfigureFTS(ctx, FTSConfig{Tokenizer: TokenizerPorter})
+	require.NoError(t, err)
+	require.True(t, rebuilt)
+	require.Equal(t, []string{"r1"}, ids("cache"))
+
+	rebuilt, err = db.ConfigureFTS(ctx, FTSConfig{Tokenizer: TokenizerPorter})
+	require.NoError(t, err)
+	require.False(t, rebuilt)
+
+	rebuilt, err = db.ConfigureFTS(ctx, FTSConfig{Tokenizer: TokenizerPorter, Trigram: true})
+	require.NoError(t, err)
+	require.True(t, rebuilt)
+	require.Equal(t, []string{"r2"}, ids("textbundle"))
+
+	// Records written later are indexed too, and word matches rank above
+	// substring matches.
+	create("r3", "Bundle format", "How a bundle is laid out.")
+	require.Equal(t, []string{"r3", "r2"}, ids("bundle"))
+
+	_, err = db.ConfigureFTS(ctx, FTSConfig{})
+	require.NoError(t, err)
+	require.Empty(t, ids("textbundle"))
+	require.Equal(t, []string{"r3"}, ids("bundle"))
+	var tables int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name LIKE 'records_trigram_%' OR name = 'records_fts_trigram'`).Scan(&tables))
+	require.Zero(t, tables)
+
+	_, err = db.ConfigureFTS(ctx, FTSConfig{Tokenizer: "snowball"})
+	require.ErrorContains(t, err, "unknown FTS tokenizer")
+}
+
+func TestDB_RebuildAndCheckFTS(t *testing.T) {
+	db := NewTestDB(t)
+	ctx := context.Background()
+	insertProject(t, db, "p1", "tenant1")
+	_, err := db.ConfigureFTS(ctx, FTSConfig{Trigram: true})
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, NewRecordRepository(db).Create(ctx, "tenant1", &record.Record{
+		ID: "r1", ProjectID: "p1", Type: "note", Title: "Title", Summary: "Summary", Body: "Body",
+		State: record.StateOpen, CreatedAt: now, ModifiedAt: now, Tick: 1,
+	}))
+	require.NoError(t, db.CheckFTS(ctx))
+
+	// An edit that bypasses the triggers leaves the index out of step.
+	_, err = db.Exec(`DROP TRIGGER records_au`)
+	require.NoError(t, err)
+	_, err = db.Exec(`UPDATE records SET title = 'Edited by hand' WHERE id = 'r1'`)
+	require.NoError(t, err)
+	require.ErrorContains(t, db.CheckFTS(ctx), "records_fts failed integrity check")
+
+	require.NoError(t, db.RebuildFTS(ctx))
+	require.NoError(t, db.CheckFTS(ctx))
+}
@@ -3,7 +3,9 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/rpggio/trellis/internal/domain/project"
 	"github.com/rpggio/trellis/internal/repository"
@@ -21,17 +23,23 @@ func NewProjectRepository(db *DB) *ProjectRepository {
 
 // Create creates a new project
 func (r *ProjectRepository) Create(ctx context.Context, tenantID string, proj *project.Project) error {
+	policy, err := encodePolicy(proj.ActivationPolicy)
+	if err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO projects (id, tenant_id, name, description, tick, created_at)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO projects (id, tenant_id, name, description, tick, activation_policy, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err := r.db.ExecContext(ctx, query,
+	_, err = r.db.conn(ctx).ExecContext(ctx, query,
 		proj.ID,
 		tenantID,
 		proj.Name,
 		proj.Description,
 		proj.Tick,
+		policy,
 		proj.CreatedAt,
 	)
 
@@ -45,59 +53,60 @@ func (r *ProjectRepository) Create(ctx context.Context, tenantID string, proj *p
 // Get retrieves a project by ID
 func (r *ProjectRepository) Get(ctx context.Context, tenantID, id string) (*project.Project, error) {
 	query := `
-		SELECT id, tenant_id, name, description, tick, created_at
+		SELECT id, tenant_id, name, description, tick, activation_policy, created_at
 		FROM projects
 		WHERE id = ? AND tenant_id = ?
 	`
 
-	var proj project.Project
-	err := r.db.QueryRowContext(ctx, query, id, tenantID).Scan(
-		&proj.ID,
-		&proj.TenantID,
-		&proj.Name,
-		&proj.Description,
-		&proj.Tick,
-		&proj.CreatedAt,
-	)
-
-	if err == sql.ErrNoRows {
-		return nil, repository.ErrNotFound
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to get project: %w", err)
-	}
-
-	return &proj, nil
+	return scanProject(r.db.conn(ctx).QueryRowContext(ctx, query, id, tenantID), "failed to get project")
 }
 
 // GetDefault retrieves the default project for a tenant (the first created project)
 func (r *ProjectRepository) GetDefault(ctx context.Context, tenantID string) (*project.Project, error) {
 	query := `
-		SELECT id, tenant_id, name, description, tick, created_at
+		SELECT id, tenant_id, name, description, tick, activation_policy, created_at
 		FROM projects
 		WHERE tenant_id = ?
 		ORDER BY created_at ASC
 		LIMIT 1
 	`
 
-	var proj project.Project
-	err := r.db.QueryRowContext(ctx, query, tenantID).Scan(
-		&proj.ID,
-		&proj.TenantID,
-		&proj.Name,
-		&proj.Description,
-		&proj.Tick,
-		&proj.CreatedAt,
-	)
+	return scanProject(r.db.conn(ctx).QueryRowContext(ctx, query, tenantID), "failed to get default project")
+}
 
-	if err == sql.ErrNoRows {
-		return nil, repository.ErrNotFound
+// Update saves a project's name, description and activation policy
+func (r *ProjectRepository) Update(ctx context.Context, tenantID string, proj *project.Project) error {
+	policy, err := encodePolicy(proj.ActivationPolicy)
+	if err != nil {
+		return err
 	}
+
+	query := `
+		UPDATE projects
+		SET name = ?, description = ?, activation_policy = ?
+		WHERE id = ? AND tenant_id = ?
+	`
+
+	result, err := r.db.conn(ctx).ExecContext(ctx, query,
+		proj.Name,
+		proj.Description,
+		policy,
+		proj.ID,
+		tenantID,
+	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get default project: %w", err)
+		return fmt.Errorf("failed to update project: %w", err)
 	}
 
-	return &proj, nil
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return repository.ErrNotFound
+	}
+
+	return nil
 }
 
 // List returns all projects for a tenant with summary information
@@ -113,14 +122,14 @@ func (r *ProjectRepository) List(ctx context.Context, tenantID string) ([]projec
 			COUNT(DISTINCT CASE WHEN r.state = 'OPEN' THEN r.id END) as open_records,
 			COUNT(DISTINCT s.id) as active_sessions
 		FROM projects p
-		LEFT JOIN records r ON r.project_id = p.id AND r.tenant_id = p.tenant_id
+		LEFT JOIN records r ON r.project_id = p.id AND r.tenant_id = p.tenant_id AND r.deleted_at IS NULL
 		LEFT JOIN sessions s ON s.project_id = p.id AND s.tenant_id = p.tenant_id AND s.status = 'active'
 		WHERE p.tenant_id = ?
 		GROUP BY p.id, p.name, p.description, p.tick, p.created_at
 		ORDER BY p.created_at DESC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, tenantID)
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, tenantID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list projects: %w", err)
 	}
@@ -154,49 +163,123 @@ func (r *ProjectRepository) List(ctx context.Context, tenantID string) ([]projec
 
 // IncrementTick atomically increments the project tick and returns the new value
 func (r *ProjectRepository) IncrementTick(ctx context.Context, tenantID, projectID string) (int64, error) {
-	tx, err := r.db.BeginTx(ctx, nil)
+	var newTick int64
+	err := r.db.WithinTx(ctx, func(ctx context.Context) error {
+		// Update the tick
+		updateQuery := `
+			UPDATE projects
+			SET tick = tick + 1
+			WHERE id = ? AND tenant_id = ?
+		`
+
+		result, err := r.db.conn(ctx).ExecContext(ctx, updateQuery, projectID, tenantID)
+		if err != nil {
+			return fmt.Errorf("failed to increment tick: %w", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+
+		if rowsAffected == 0 {
+			return repository.ErrNotFound
+		}
+
+		// Get the new tick value
+		selectQuery := `
+			SELECT tick
+			FROM projects
+			WHERE id = ? AND tenant_id = ?
+		`
+
+		if err := r.db.conn(ctx).QueryRowContext(ctx, selectQuery, projectID, tenantID).Scan(&newTick); err != nil {
+			return fmt.Errorf("failed to get new tick: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+		return 0, err
 	}
-	defer tx.Rollback()
 
-	// Update the tick
-	updateQuery := `
-		UPDATE projects
-		SET tick = tick + 1
-		WHERE id = ? AND tenant_id = ?
-	`
+	return newTick, nil
+}
 
-	result, err := tx.ExecContext(ctx, updateQuery, projectID, tenantID)
-	if err != nil {
-		return 0, fmt.Errorf("failed to increment tick: %w", err)
+// Ticks returns the current tick of each project in projectIDs, or of every
+// project of the tenant when projectIDs is empty
+func (r *ProjectRepository) Ticks(ctx context.Context, tenantID string, projectIDs []string) (map[string]int64, error) {
+	query := `SELECT id, tick FROM projects WHERE tenant_id = ?`
+	args := []interface{}{tenantID}
+	if len(projectIDs) > 0 {
+		placeholders := make([]string, len(projectIDs))
+		for i, id := range projectIDs {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		query += fmt.Sprintf(" AND id IN (%s)", strings.Join(placeholders, ","))
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, args...)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+		return nil, fmt.Errorf("failed to get project ticks: %w", err)
 	}
+	defer rows.Close()
 
-	if rowsAffected == 0 {
-		return 0, repository.ErrNotFound
+	ticks := map[string]int64{}
+	for rows.Next() {
+		var id string
+		var tick int64
+		if err := rows.Scan(&id, &tick); err != nil {
+			return nil, fmt.Errorf("failed to scan project tick: %w", err)
+		}
+		ticks[id] = tick
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating project ticks: %w", err)
 	}
 
-	// Get the new tick value
-	selectQuery := `
-		SELECT tick
-		FROM projects
-		WHERE id = ? AND tenant_id = ?
-	`
+	return ticks, nil
+}
 
-	var newTick int64
-	err = tx.QueryRowContext(ctx, selectQuery, projectID, tenantID).Scan(&newTick)
+// scanProject scans a project row, decoding its activation policy
+func scanProject(row *sql.Row, failure string) (*project.Project, error) {
+	var proj project.Project
+	var policy sql.NullString
+	err := row.Scan(
+		&proj.ID,
+		&proj.TenantID,
+		&proj.Name,
+		&proj.Description,
+		&proj.Tick,
+		&policy,
+		&proj.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
 	if err != nil {
-		return 0, fmt.Errorf("failed to get new tick: %w", err)
+		return nil, fmt.Errorf("%s: %w", failure, err)
 	}
 
-	if err = tx.Commit(); err != nil {
-		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	if policy.Valid {
+		if err := json.Unmarshal([]byte(policy.String), &proj.ActivationPolicy); err != nil {
+			return nil, fmt.Errorf("failed to decode activation policy: %w", err)
+		}
 	}
 
-	return newTick, nil
+	return &proj, nil
+}
+
+// encodePolicy encodes an activation policy for storage; an unset policy is
+// stored as NULL
+func encodePolicy(policy project.ActivationPolicy) (sql.NullString, error) {
+	if policy.IsZero() {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to encode activation policy: %w", err)
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
 }
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/rpggio/trellis/internal/domain/project"
+	"github.com/rpggio/trellis/internal/domain/record"
 	"github.com/rpggio/trellis/internal/repository"
 	"github.com/stretchr/testify/require"
 )
@@ -63,6 +64,49 @@ func TestProjectRepository_Get(t *testing.T) {
 	require.Equal(t, repository.ErrNotFound, err)
 }
 
+func TestProjectRepository_Update(t *testing.T) {
+	db := NewTestDB(t)
+	repo := NewProjectRepository(db)
+	ctx := context.Background()
+
+	proj := &project.Project{
+		ID:        "p1",
+		TenantID:  "tenant1",
+		Name:      "Test Project",
+		CreatedAt: time.Now(),
+	}
+	require.NoError(t, repo.Create(ctx, "tenant1", proj))
+
+	retrieved, err := repo.Get(ctx, "tenant1", "p1")
+	require.NoError(t, err)
+	require.True(t, retrieved.ActivationPolicy.IsZero())
+
+	depth := 1
+	siblings := true
+	proj.Name = "Renamed"
+	proj.ActivationPolicy = project.ActivationPolicy{
+		DescendantDepth: &depth,
+		FullStates:      []record.RecordState{record.StateOpen, record.StateLater},
+		IncludeSiblings: &siblings,
+	}
+	require.NoError(t, repo.Update(ctx, "tenant1", proj))
+
+	retrieved, err = repo.Get(ctx, "tenant1", "p1")
+	require.NoError(t, err)
+	require.Equal(t, "Renamed", retrieved.Name)
+	require.Equal(t, proj.ActivationPolicy, retrieved.ActivationPolicy)
+	require.Nil(t, retrieved.ActivationPolicy.AncestorDepth)
+
+	proj.ActivationPolicy = project.ActivationPolicy{}
+	require.NoError(t, repo.Update(ctx, "tenant1", proj))
+	retrieved, err = repo.GetDefault(ctx, "tenant1")
+	require.NoError(t, err)
+	require.True(t, retrieved.ActivationPolicy.IsZero())
+
+	err = repo.Update(ctx, "tenant2", proj)
+	require.ErrorIs(t, err, repository.ErrNotFound)
+}
+
 func TestProjectRepository_TenantIsolation(t *testing.T) {
 	db := NewTestDB(t)
 	repo := NewProjectRepository(db)
@@ -236,3 +280,24 @@ func TestProjectRepository_IncrementTick_Multiple(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, int64(numIncrements), retrieved.Tick)
 }
+
+func TestProjectRepository_Ticks(t *testing.T) {
+	db := NewTestDB(t)
+	repo := NewProjectRepository(db)
+	ctx := context.Background()
+
+	for _, id := range []string{"p1", "p2"} {
+		require.NoError(t, repo.Create(ctx, "tenant1", &project.Project{ID: id, Name: id, CreatedAt: time.Now()}))
+	}
+	require.NoError(t, repo.Create(ctx, "tenant2", &project.Project{ID: "p3", Name: "p3", CreatedAt: time.Now()}))
+	_, err := repo.IncrementTick(ctx, "tenant1", "p2")
+	require.NoError(t, err)
+
+	ticks, err := repo.Ticks(ctx, "tenant1", nil)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"p1": 0, "p2": 1}, ticks)
+
+	ticks, err = repo.Ticks(ctx, "tenant1", []string{"p2", "p3"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"p2": 1}, ticks)
+}
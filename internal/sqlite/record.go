@@ -6,7 +6,10 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rpggio/trellis/internal/domain/record"
 	"github.com/rpggio/trellis/internal/repository"
@@ -31,39 +34,40 @@ func (r *RecordRepository) Create(ctx context.Context, tenantID string, rec *rec
 		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err := r.db.ExecContext(ctx, query,
-		rec.ID,
-		tenantID,
-		rec.ProjectID,
-		rec.Type,
-		rec.Title,
-		rec.Summary,
-		rec.Body,
-		rec.State,
-		rec.ParentID,
-		rec.ResolvedBy,
-		rec.CreatedAt,
-		rec.ModifiedAt,
-		rec.Tick,
-	)
+	// The record and its relations are written together.
+	return r.db.WithinTx(ctx, func(ctx context.Context) error {
+		_, err := r.db.conn(ctx).ExecContext(ctx, query,
+			rec.ID,
+			tenantID,
+			rec.ProjectID,
+			rec.Type,
+			rec.Title,
+			rec.Summary,
+			rec.Body,
+			rec.State,
+			rec.ParentID,
+			rec.ResolvedBy,
+			rec.CreatedAt,
+			rec.ModifiedAt,
+			rec.Tick,
+		)
 
-	if err != nil {
-		if isForeignKeyViolation(err) {
-			return repository.ErrForeignKeyViolation
+		if err != nil {
+			if isForeignKeyViolation(err) {
+				return repository.ErrForeignKeyViolation
+			}
+			return fmt.Errorf("failed to create record: %w", err)
 		}
-		return fmt.Errorf("failed to create record: %w", err)
-	}
 
-	// Add relations if any
-	if len(rec.Related) > 0 {
+		// Add relations if any
 		for _, relatedID := range rec.Related {
-			if err := r.AddRelation(ctx, rec.ID, relatedID); err != nil {
+			if err := r.AddRelation(ctx, rec.ID, relatedID, record.RelationRelates); err != nil {
 				return fmt.Errorf("failed to add relation: %w", err)
 			}
 		}
-	}
 
-	return nil
+		return nil
+	})
 }
 
 // Get retrieves a record by ID
@@ -73,11 +77,11 @@ func (r *RecordRepository) Get(ctx context.Context, tenantID, id string) (*recor
 			id, tenant_id, project_id, type, title, summary, body,
 			state, parent_id, resolved_by, created_at, modified_at, tick
 		FROM records
-		WHERE id = ? AND tenant_id = ?
+		WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL
 	`
 
 	var rec record.Record
-	err := r.db.QueryRowContext(ctx, query, id, tenantID).Scan(
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, id, tenantID).Scan(
 		&rec.ID,
 		&rec.TenantID,
 		&rec.ProjectID,
@@ -107,34 +111,107 @@ func (r *RecordRepository) Get(ctx context.Context, tenantID, id string) (*recor
 	}
 	rec.Related = related
 
+	if rec.Links, err = r.GetLinks(ctx, tenantID, id); err != nil {
+		return nil, err
+	}
+	if rec.Backlinks, err = r.GetBacklinks(ctx, tenantID, id); err != nil {
+		return nil, err
+	}
+
 	return &rec, nil
 }
 
-// Update updates a record with optimistic concurrency control
+// Update updates a record with optimistic concurrency control. When
+// rec.Related is non-nil it replaces the record's outgoing "relates" links.
 func (r *RecordRepository) Update(ctx context.Context, tenantID string, rec *record.Record, expectedTick int64) error {
 	query := `
 		UPDATE records
 		SET type = ?, title = ?, summary = ?, body = ?,
-		    state = ?, resolved_by = ?, modified_at = ?, tick = ?
+		    state = ?, parent_id = ?, resolved_by = ?, modified_at = ?, tick = ?
 		WHERE id = ? AND tenant_id = ? AND tick = ?
 	`
 
-	result, err := r.db.ExecContext(ctx, query,
-		rec.Type,
-		rec.Title,
-		rec.Summary,
-		rec.Body,
-		rec.State,
-		rec.ResolvedBy,
-		rec.ModifiedAt,
-		rec.Tick,
-		rec.ID,
-		tenantID,
-		expectedTick,
-	)
+	return r.db.WithinTx(ctx, func(ctx context.Context) error {
+		result, err := r.db.conn(ctx).ExecContext(ctx, query,
+			rec.Type,
+			rec.Title,
+			rec.Summary,
+			rec.Body,
+			rec.State,
+			rec.ParentID,
+			rec.ResolvedBy,
+			rec.ModifiedAt,
+			rec.Tick,
+			rec.ID,
+			tenantID,
+			expectedTick,
+		)
+
+		if err != nil {
+			return fmt.Errorf("failed to update record: %w", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+
+		if rowsAffected == 0 {
+			// Check if record exists
+			var exists bool
+			checkQuery := `SELECT EXISTS(SELECT 1 FROM records WHERE id = ? AND tenant_id = ?)`
+			err = r.db.conn(ctx).QueryRowContext(ctx, checkQuery, rec.ID, tenantID).Scan(&exists)
+			if err != nil {
+				return fmt.Errorf("failed to check record existence: %w", err)
+			}
+
+			if !exists {
+				return repository.ErrNotFound
+			}
 
+			// Record exists but tick doesn't match - conflict
+			return repository.ErrConflict
+		}
+
+		if rec.Related != nil {
+			return r.setRelated(ctx, rec.ID, rec.Related)
+		}
+		return nil
+	})
+}
+
+// setRelated makes related the exact set of a record's outgoing "relates" links
+func (r *RecordRepository) setRelated(ctx context.Context, recordID string, related []string) error {
+	query := `DELETE FROM record_relations WHERE from_record_id = ? AND kind = ?`
+	args := []interface{}{recordID, record.RelationRelates}
+	if len(related) > 0 {
+		placeholders := make([]string, len(related))
+		for i, id := range related {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		query += fmt.Sprintf(" AND to_record_id NOT IN (%s)", strings.Join(placeholders, ","))
+	}
+
+	if _, err := r.db.conn(ctx).ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to remove relations: %w", err)
+	}
+
+	for _, relatedID := range related {
+		if err := r.AddRelation(ctx, recordID, relatedID, record.RelationRelates); err != nil {
+			return fmt.Errorf("failed to add relation: %w", err)
+		}
+	}
+	return nil
+}
+
+// Delete deletes a record
+func (r *RecordRepository) Delete(ctx context.Context, tenantID, id string) error {
+	query := `DELETE FROM records WHERE id = ? AND tenant_id = ?`
+
+	result, err := r.db.conn(ctx).ExecContext(ctx, query, id, tenantID)
 	if err != nil {
-		return fmt.Errorf("failed to update record: %w", err)
+		return fmt.Errorf("failed to delete record: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
@@ -143,99 +220,298 @@ func (r *RecordRepository) Update(ctx context.Context, tenantID string, rec *rec
 	}
 
 	if rowsAffected == 0 {
-		// Check if record exists
-		var exists bool
-		checkQuery := `SELECT EXISTS(SELECT 1 FROM records WHERE id = ? AND tenant_id = ?)`
-		err = r.db.QueryRowContext(ctx, checkQuery, rec.ID, tenantID).Scan(&exists)
+		return repository.ErrNotFound
+	}
+
+	return nil
+}
+
+// SoftDelete moves a record and its live descendants to the trash and
+// returns how many records were trashed. Session activations of the trashed
+// records are dropped.
+func (r *RecordRepository) SoftDelete(ctx context.Context, tenantID, id string, deletedAt time.Time) (int, error) {
+	query := `
+		WITH RECURSIVE subtree(id) AS (
+			SELECT id FROM records WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL
+			UNION
+			SELECT c.id FROM records c
+			JOIN subtree s ON c.parent_id = s.id
+			WHERE c.tenant_id = ? AND c.deleted_at IS NULL
+		)
+		UPDATE records
+		SET deleted_at = ?, deleted_root = ?
+		WHERE id IN (SELECT id FROM subtree)
+	`
+
+	var count int
+	err := r.db.WithinTx(ctx, func(ctx context.Context) error {
+		result, err := r.db.conn(ctx).ExecContext(ctx, query, id, tenantID, tenantID, deletedAt.UTC(), id)
+		if err != nil {
+			return fmt.Errorf("failed to delete record: %w", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
 		if err != nil {
-			return fmt.Errorf("failed to check record existence: %w", err)
+			return fmt.Errorf("failed to get rows affected: %w", err)
 		}
 
-		if !exists {
+		if rowsAffected == 0 {
 			return repository.ErrNotFound
 		}
+		count = int(rowsAffected)
+
+		activationsQuery := `
+			DELETE FROM session_activations
+			WHERE record_id IN (SELECT id FROM records WHERE deleted_root = ? AND tenant_id = ?)
+		`
+		if _, err := r.db.conn(ctx).ExecContext(ctx, activationsQuery, id, tenantID); err != nil {
+			return fmt.Errorf("failed to remove activations: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// GetTrashed retrieves a record that was deleted directly (not as part of
+// another record's subtree)
+func (r *RecordRepository) GetTrashed(ctx context.Context, tenantID, id string) (*record.Record, error) {
+	query := `
+		SELECT
+			id, tenant_id, project_id, type, title, summary, body,
+			state, parent_id, resolved_by, created_at, modified_at, tick, deleted_at
+		FROM records
+		WHERE id = ? AND tenant_id = ? AND deleted_root = id
+	`
 
-		// Record exists but tick doesn't match - conflict
-		return repository.ErrConflict
+	var rec record.Record
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, id, tenantID).Scan(
+		&rec.ID,
+		&rec.TenantID,
+		&rec.ProjectID,
+		&rec.Type,
+		&rec.Title,
+		&rec.Summary,
+		&rec.Body,
+		&rec.State,
+		&rec.ParentID,
+		&rec.ResolvedBy,
+		&rec.CreatedAt,
+		&rec.ModifiedAt,
+		&rec.Tick,
+		&rec.DeletedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trashed record: %w", err)
 	}
 
-	return nil
+	return &rec, nil
 }
 
-// Delete deletes a record
-func (r *RecordRepository) Delete(ctx context.Context, tenantID, id string) error {
-	query := `DELETE FROM records WHERE id = ? AND tenant_id = ?`
+// Restore takes a directly deleted record and the subtree trashed with it
+// out of the trash and returns how many records were restored
+func (r *RecordRepository) Restore(ctx context.Context, tenantID, id string) (int, error) {
+	query := `
+		UPDATE records
+		SET deleted_at = NULL, deleted_root = NULL
+		WHERE deleted_root = ? AND tenant_id = ?
+	`
 
-	result, err := r.db.ExecContext(ctx, query, id, tenantID)
+	result, err := r.db.conn(ctx).ExecContext(ctx, query, id, tenantID)
 	if err != nil {
-		return fmt.Errorf("failed to delete record: %w", err)
+		return 0, fmt.Errorf("failed to restore record: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
 	if rowsAffected == 0 {
-		return repository.ErrNotFound
+		return 0, repository.ErrNotFound
 	}
 
-	return nil
+	return int(rowsAffected), nil
 }
 
-// List returns records matching the given options as lightweight references
-func (r *RecordRepository) List(ctx context.Context, tenantID string, opts record.ListRecordsOptions) ([]record.RecordRef, error) {
+// ListTrash returns directly deleted records, most recently deleted first
+func (r *RecordRepository) ListTrash(ctx context.Context, tenantID string, opts record.ListTrashOptions) ([]record.TrashEntry, error) {
 	query := `
 		SELECT
-			r.id, r.type, r.title, r.summary, r.state, r.parent_id,
-			COUNT(DISTINCT c.id) as children_count,
-			COUNT(DISTINCT CASE WHEN c.state = 'OPEN' THEN c.id END) as open_children_count
+			r.id, r.type, r.title, r.summary, r.state, r.parent_id, r.deleted_at,
+			(SELECT COUNT(*) FROM records d WHERE d.deleted_root = r.id AND d.id != r.id) as descendants
 		FROM records r
-		LEFT JOIN records c ON c.parent_id = r.id AND c.tenant_id = r.tenant_id
-		WHERE r.tenant_id = ?
+		WHERE r.tenant_id = ? AND r.deleted_root = r.id
 	`
-
 	args := []interface{}{tenantID}
-	conditions := []string{}
 
 	if opts.ProjectID != "" {
-		conditions = append(conditions, "r.project_id = ?")
+		query += " AND r.project_id = ?"
 		args = append(args, opts.ProjectID)
 	}
 
-	if opts.ParentID != nil {
-		if *opts.ParentID == "" {
-			conditions = append(conditions, "r.parent_id IS NULL")
-		} else {
-			conditions = append(conditions, "r.parent_id = ?")
-			args = append(args, *opts.ParentID)
-		}
+	query += " ORDER BY r.deleted_at DESC"
+
+	if opts.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, opts.Limit)
 	}
 
-	if len(opts.States) > 0 {
-		placeholders := make([]string, len(opts.States))
-		for i, state := range opts.States {
-			placeholders[i] = "?"
-			args = append(args, state)
+	if opts.Offset > 0 {
+		query += " OFFSET ?"
+		args = append(args, opts.Offset)
+	}
+
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trash: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []record.TrashEntry
+	for rows.Next() {
+		var entry record.TrashEntry
+		err := rows.Scan(
+			&entry.Record.ID,
+			&entry.Record.Type,
+			&entry.Record.Title,
+			&entry.Record.Summary,
+			&entry.Record.State,
+			&entry.Record.ParentID,
+			&entry.DeletedAt,
+			&entry.Descendants,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan trash entry: %w", err)
 		}
-		conditions = append(conditions, fmt.Sprintf("r.state IN (%s)", strings.Join(placeholders, ",")))
+		entries = append(entries, entry)
 	}
 
-	if len(opts.Types) > 0 {
-		placeholders := make([]string, len(opts.Types))
-		for i, typ := range opts.Types {
-			placeholders[i] = "?"
-			args = append(args, typ)
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating trash rows: %w", err)
+	}
+
+	return entries, nil
+}
+
+// PurgeTrash permanently removes records of every tenant that were trashed
+// before the cutoff, along with their relations, versions and activations.
+// It returns how many records were removed.
+func (r *RecordRepository) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	purged := `SELECT id FROM records WHERE deleted_at IS NOT NULL AND deleted_at < ?`
+	statements := []struct {
+		query  string
+		action string
+	}{
+		{`DELETE FROM record_relations WHERE from_record_id IN (` + purged + `) OR to_record_id IN (` + purged + `)`, "remove relations"},
+		{`DELETE FROM record_versions WHERE record_id IN (` + purged + `)`, "remove versions"},
+		{`DELETE FROM session_activations WHERE record_id IN (` + purged + `)`, "remove activations"},
+		{`UPDATE records SET resolved_by = NULL WHERE resolved_by IN (` + purged + `) AND id NOT IN (` + purged + `)`, "clear resolved_by"},
+		{`UPDATE records SET parent_id = NULL WHERE parent_id IN (` + purged + `) AND id NOT IN (` + purged + `)`, "detach children"},
+	}
+
+	cutoff := before.UTC()
+	var count int
+	err := r.db.WithinTx(ctx, func(ctx context.Context) error {
+		for _, stmt := range statements {
+			args := make([]interface{}, strings.Count(stmt.query, "?"))
+			for i := range args {
+				args[i] = cutoff
+			}
+			if _, err := r.db.conn(ctx).ExecContext(ctx, stmt.query, args...); err != nil {
+				return fmt.Errorf("failed to %s: %w", stmt.action, err)
+			}
 		}
-		conditions = append(conditions, fmt.Sprintf("r.type IN (%s)", strings.Join(placeholders, ",")))
+
+		result, err := r.db.conn(ctx).ExecContext(ctx, `DELETE FROM records WHERE deleted_at IS NOT NULL AND deleted_at < ?`, cutoff)
+		if err != nil {
+			return fmt.Errorf("failed to purge records: %w", err)
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		count = int(rowsAffected)
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	if len(conditions) > 0 {
-		query += " AND " + strings.Join(conditions, " AND ")
+	return count, nil
+}
+
+// listSort is how List orders records for a sort option
+type listSort struct {
+	key     string // SQL expression over r, the records row
+	desc    bool
+	numeric bool // the key is an integer, so cursor keys are parsed as one
+}
+
+var listSorts = map[record.ListSort]listSort{
+	record.SortCreated:  {key: "CAST(r.created_at AS TEXT)", desc: true},
+	record.SortModified: {key: "CAST(r.modified_at AS TEXT)", desc: true},
+	record.SortTick:     {key: "r.tick", desc: true, numeric: true},
+	record.SortTitle:    {key: "LOWER(r.title)"},
+	record.SortState: {
+		key:     "CASE r.state WHEN 'OPEN' THEN 0 WHEN 'LATER' THEN 1 WHEN 'RESOLVED' THEN 2 ELSE 3 END",
+		numeric: true,
+	},
+	record.SortChildrenOpen: {
+		key:     "(SELECT COUNT(*) FROM records c WHERE c.parent_id = r.id AND c.tenant_id = r.tenant_id AND c.deleted_at IS NULL AND c.state = 'OPEN')",
+		desc:    true,
+		numeric: true,
+	},
+}
+
+// List returns records matching the given options as lightweight references,
+// ordered by opts.Sort and starting after opts.After when it is set. Each
+// ref's SortKey is its position in that order.
+func (r *RecordRepository) List(ctx context.Context, tenantID string, opts record.ListRecordsOptions) ([]record.RecordRef, error) {
+	order, ok := listSorts[opts.Sort]
+	if opts.Sort == "" {
+		order, ok = listSorts[record.SortCreated], true
 	}
+	if !ok {
+		return nil, fmt.Errorf("unknown sort order %q", opts.Sort)
+	}
+
+	conditions, args := listConditions(tenantID, opts)
 
-	query += " GROUP BY r.id, r.type, r.title, r.summary, r.state, r.parent_id"
-	query += " ORDER BY r.created_at DESC"
+	direction, compare := "ASC", ">"
+	if order.desc {
+		direction, compare = "DESC", "<"
+	}
+	if opts.After != nil {
+		var key interface{} = opts.After.Key
+		if order.numeric {
+			parsed, err := strconv.ParseInt(opts.After.Key, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: key %q is not a number", record.ErrInvalidCursor, opts.After.Key)
+			}
+			key = parsed
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s %s ? OR (%s = ? AND r.id %s ?))", order.key, compare, order.key, compare))
+		args = append(args, key, key, opts.After.ID)
+	}
+
+	query := `
+		SELECT
+			r.id, r.type, r.title, r.summary, r.state, r.parent_id, r.project_id, COALESCE(p.name, ''),
+			(SELECT COUNT(*) FROM records c WHERE c.parent_id = r.id AND c.tenant_id = r.tenant_id AND c.deleted_at IS NULL) as children_count,
+			(SELECT COUNT(*) FROM records c WHERE c.parent_id = r.id AND c.tenant_id = r.tenant_id AND c.deleted_at IS NULL AND c.state = 'OPEN') as open_children_count,
+			CAST(` + order.key + ` AS TEXT) as sort_key
+		FROM records r
+		LEFT JOIN projects p ON p.id = r.project_id AND p.tenant_id = r.tenant_id
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY ` + order.key + " " + direction + ", r.id " + direction
 
 	if opts.Limit > 0 {
 		query += " LIMIT ?"
@@ -243,11 +519,14 @@ func (r *RecordRepository) List(ctx context.Context, tenantID string, opts recor
 	}
 
 	if opts.Offset > 0 {
+		if opts.Limit <= 0 {
+			query += " LIMIT -1"
+		}
 		query += " OFFSET ?"
 		args = append(args, opts.Offset)
 	}
 
-	rows, err := r.db.QueryContext(ctx, query, args...)
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list records: %w", err)
 	}
@@ -263,8 +542,11 @@ func (r *RecordRepository) List(ctx context.Context, tenantID string, opts recor
 			&ref.Summary,
 			&ref.State,
 			&ref.ParentID,
+			&ref.ProjectID,
+			&ref.ProjectName,
 			&ref.ChildrenCount,
 			&ref.OpenChildrenCount,
+			&ref.SortKey,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan record ref: %w", err)
@@ -279,6 +561,93 @@ func (r *RecordRepository) List(ctx context.Context, tenantID string, opts recor
 	return refs, nil
 }
 
+// Count returns how many records match the options, ignoring the sort,
+// cursor and paging
+func (r *RecordRepository) Count(ctx context.Context, tenantID string, opts record.ListRecordsOptions) (int, error) {
+	conditions, args := listConditions(tenantID, opts)
+	query := `SELECT COUNT(*) FROM records r WHERE ` + strings.Join(conditions, " AND ")
+
+	var count int
+	if err := r.db.conn(ctx).QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count records: %w", err)
+	}
+	return count, nil
+}
+
+// listConditions returns the WHERE conditions and arguments selecting the
+// records of a listing, over records aliased as r
+func listConditions(tenantID string, opts record.ListRecordsOptions) ([]string, []interface{}) {
+	conditions := []string{"r.tenant_id = ?", "r.deleted_at IS NULL"}
+	args := []interface{}{tenantID}
+
+	if opts.ProjectID != "" {
+		conditions = append(conditions, "r.project_id = ?")
+		args = append(args, opts.ProjectID)
+	}
+
+	if len(opts.ProjectIDs) > 0 {
+		placeholders := make([]string, len(opts.ProjectIDs))
+		for i, id := range opts.ProjectIDs {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		conditions = append(conditions, fmt.Sprintf("r.project_id IN (%s)", strings.Join(placeholders, ",")))
+	}
+
+	if len(opts.IDs) > 0 {
+		placeholders := make([]string, len(opts.IDs))
+		for i, id := range opts.IDs {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		conditions = append(conditions, fmt.Sprintf("r.id IN (%s)", strings.Join(placeholders, ",")))
+	}
+
+	if opts.ParentID != nil {
+		if *opts.ParentID == "" {
+			conditions = append(conditions, "r.parent_id IS NULL")
+		} else {
+			conditions = append(conditions, "r.parent_id = ?")
+			args = append(args, *opts.ParentID)
+		}
+	}
+
+	if len(opts.States) > 0 {
+		placeholders := make([]string, len(opts.States))
+		for i, state := range opts.States {
+			placeholders[i] = "?"
+			args = append(args, state)
+		}
+		conditions = append(conditions, fmt.Sprintf("r.state IN (%s)", strings.Join(placeholders, ",")))
+	}
+
+	if len(opts.Types) > 0 {
+		placeholders := make([]string, len(opts.Types))
+		for i, typ := range opts.Types {
+			placeholders[i] = "?"
+			args = append(args, typ)
+		}
+		conditions = append(conditions, fmt.Sprintf("r.type IN (%s)", strings.Join(placeholders, ",")))
+	}
+
+	if len(opts.ChangedSince) > 0 {
+		// Sorted so the statement text is stable.
+		projectIDs := make([]string, 0, len(opts.ChangedSince))
+		for id := range opts.ChangedSince {
+			projectIDs = append(projectIDs, id)
+		}
+		sort.Strings(projectIDs)
+		changed := make([]string, len(projectIDs))
+		for i, id := range projectIDs {
+			changed[i] = "(r.project_id = ? AND r.tick > ?)"
+			args = append(args, id, opts.ChangedSince[id])
+		}
+		conditions = append(conditions, "("+strings.Join(changed, " OR ")+")")
+	}
+
+	return conditions, args
+}
+
 // GetChildren returns all child records (full content)
 func (r *RecordRepository) GetChildren(ctx context.Context, tenantID, parentID string) ([]record.Record, error) {
 	query := `
@@ -286,11 +655,11 @@ func (r *RecordRepository) GetChildren(ctx context.Context, tenantID, parentID s
 			id, tenant_id, project_id, type, title, summary, body,
 			state, parent_id, resolved_by, created_at, modified_at, tick
 		FROM records
-		WHERE parent_id = ? AND tenant_id = ?
+		WHERE parent_id = ? AND tenant_id = ? AND deleted_at IS NULL
 		ORDER BY created_at ASC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, parentID, tenantID)
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, parentID, tenantID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get children: %w", err)
 	}
@@ -343,13 +712,13 @@ func (r *RecordRepository) GetChildrenRefs(ctx context.Context, tenantID, parent
 			COUNT(DISTINCT c.id) as children_count,
 			COUNT(DISTINCT CASE WHEN c.state = 'OPEN' THEN c.id END) as open_children_count
 		FROM records r
-		LEFT JOIN records c ON c.parent_id = r.id AND c.tenant_id = r.tenant_id
-		WHERE r.parent_id = ? AND r.tenant_id = ?
+		LEFT JOIN records c ON c.parent_id = r.id AND c.tenant_id = r.tenant_id AND c.deleted_at IS NULL
+		WHERE r.parent_id = ? AND r.tenant_id = ? AND r.deleted_at IS NULL
 		GROUP BY r.id, r.type, r.title, r.summary, r.state, r.parent_id
 		ORDER BY r.created_at ASC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, parentID, tenantID)
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, parentID, tenantID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get children refs: %w", err)
 	}
@@ -381,16 +750,18 @@ func (r *RecordRepository) GetChildrenRefs(ctx context.Context, tenantID, parent
 	return refs, nil
 }
 
-// GetRelated returns IDs of related records (non-hierarchical relationships)
+// GetRelated returns IDs of records this record "relates" to
 func (r *RecordRepository) GetRelated(ctx context.Context, tenantID, recordID string) ([]string, error) {
 	query := `
 		SELECT rr.to_record_id
 		FROM record_relations rr
 		JOIN records r ON r.id = rr.from_record_id
-		WHERE rr.from_record_id = ? AND r.tenant_id = ?
+		JOIN records t ON t.id = rr.to_record_id AND t.deleted_at IS NULL
+		WHERE rr.from_record_id = ? AND rr.kind = ? AND r.tenant_id = ?
+		ORDER BY rr.created_at ASC, rr.to_record_id ASC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, recordID, tenantID)
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, recordID, record.RelationRelates, tenantID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get related records: %w", err)
 	}
@@ -412,14 +783,63 @@ func (r *RecordRepository) GetRelated(ctx context.Context, tenantID, recordID st
 	return related, nil
 }
 
-// AddRelation adds a non-hierarchical relation between two records
-func (r *RecordRepository) AddRelation(ctx context.Context, fromRecordID, toRecordID string) error {
+// GetLinks returns the record's outgoing links of every kind
+func (r *RecordRepository) GetLinks(ctx context.Context, tenantID, recordID string) ([]record.Link, error) {
 	query := `
-		INSERT INTO record_relations (from_record_id, to_record_id)
-		VALUES (?, ?)
+		SELECT rr.kind, rr.to_record_id
+		FROM record_relations rr
+		JOIN records r ON r.id = rr.from_record_id
+		JOIN records t ON t.id = rr.to_record_id AND t.deleted_at IS NULL
+		WHERE rr.from_record_id = ? AND r.tenant_id = ?
+		ORDER BY rr.kind ASC, rr.created_at ASC, rr.to_record_id ASC
 	`
+	return r.queryLinks(ctx, query, recordID, tenantID)
+}
+
+// GetBacklinks returns links from other records to this one
+func (r *RecordRepository) GetBacklinks(ctx context.Context, tenantID, recordID string) ([]record.Link, error) {
+	query := `
+		SELECT rr.kind, rr.from_record_id
+		FROM record_relations rr
+		JOIN records r ON r.id = rr.from_record_id
+		WHERE rr.to_record_id = ? AND r.tenant_id = ? AND r.deleted_at IS NULL
+		ORDER BY rr.kind ASC, rr.created_at ASC, rr.from_record_id ASC
+	`
+	return r.queryLinks(ctx, query, recordID, tenantID)
+}
 
-	_, err := r.db.ExecContext(ctx, query, fromRecordID, toRecordID)
+func (r *RecordRepository) queryLinks(ctx context.Context, query string, args ...interface{}) ([]record.Link, error) {
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []record.Link
+	for rows.Next() {
+		var link record.Link
+		if err := rows.Scan(&link.Kind, &link.RecordID); err != nil {
+			return nil, fmt.Errorf("failed to scan link: %w", err)
+		}
+		links = append(links, link)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating link rows: %w", err)
+	}
+
+	return links, nil
+}
+
+// AddRelation links two records with a relation of the given kind. Adding
+// an existing relation is a no-op.
+func (r *RecordRepository) AddRelation(ctx context.Context, fromRecordID, toRecordID string, kind record.RelationKind) error {
+	query := `
+		INSERT OR IGNORE INTO record_relations (from_record_id, to_record_id, kind)
+		VALUES (?, ?, ?)
+	`
+
+	_, err := r.db.conn(ctx).ExecContext(ctx, query, fromRecordID, toRecordID, kind)
 	if err != nil {
 		if isForeignKeyViolation(err) {
 			return repository.ErrForeignKeyViolation
@@ -429,3 +849,126 @@ func (r *RecordRepository) AddRelation(ctx context.Context, fromRecordID, toReco
 
 	return nil
 }
+
+// RemoveRelation deletes a relation of the given kind between two records
+func (r *RecordRepository) RemoveRelation(ctx context.Context, fromRecordID, toRecordID string, kind record.RelationKind) error {
+	query := `
+		DELETE FROM record_relations
+		WHERE from_record_id = ? AND to_record_id = ? AND kind = ?
+	`
+
+	result, err := r.db.conn(ctx).ExecContext(ctx, query, fromRecordID, toRecordID, kind)
+	if err != nil {
+		return fmt.Errorf("failed to remove relation: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return repository.ErrNotFound
+	}
+
+	return nil
+}
+
+// SaveVersion stores a snapshot of a record keyed by its current tick
+func (r *RecordRepository) SaveVersion(ctx context.Context, tenantID string, rec *record.Record) error {
+	query := `
+		INSERT OR IGNORE INTO record_versions (
+			record_id, tenant_id, tick, type, title, summary, body,
+			state, parent_id, resolved_by, modified_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := r.db.conn(ctx).ExecContext(ctx, query,
+		rec.ID,
+		tenantID,
+		rec.Tick,
+		rec.Type,
+		rec.Title,
+		rec.Summary,
+		rec.Body,
+		rec.State,
+		rec.ParentID,
+		rec.ResolvedBy,
+		rec.ModifiedAt,
+	)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return repository.ErrForeignKeyViolation
+		}
+		return fmt.Errorf("failed to save record version: %w", err)
+	}
+
+	return nil
+}
+
+// GetVersionAt returns the latest stored version of a record at or before the given tick
+func (r *RecordRepository) GetVersionAt(ctx context.Context, tenantID, id string, tick int64) (*record.Record, error) {
+	query := `
+		SELECT
+			v.record_id, v.tenant_id, r.project_id, v.type, v.title, v.summary, v.body,
+			v.state, v.parent_id, v.resolved_by, r.created_at, v.modified_at, v.tick
+		FROM record_versions v
+		JOIN records r ON r.id = v.record_id
+		WHERE v.record_id = ? AND v.tenant_id = ? AND v.tick <= ?
+		ORDER BY v.tick DESC
+		LIMIT 1
+	`
+
+	var rec record.Record
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, id, tenantID, tick).Scan(
+		&rec.ID,
+		&rec.TenantID,
+		&rec.ProjectID,
+		&rec.Type,
+		&rec.Title,
+		&rec.Summary,
+		&rec.Body,
+		&rec.State,
+		&rec.ParentID,
+		&rec.ResolvedBy,
+		&rec.CreatedAt,
+		&rec.ModifiedAt,
+		&rec.Tick,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get record version: %w", err)
+	}
+
+	return &rec, nil
+}
+
+// MatchIDPrefix returns up to limit IDs of records, live or trashed, that
+// start with prefix
+func (r *RecordRepository) MatchIDPrefix(ctx context.Context, tenantID, prefix string, limit int) ([]string, error) {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+	rows, err := r.db.conn(ctx).QueryContext(ctx,
+		`SELECT id FROM records WHERE tenant_id = ? AND id LIKE ? ESCAPE '\' ORDER BY id LIMIT ?`,
+		tenantID, escaped+"%", limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to match record id: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan record id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating record ids: %w", err)
+	}
+	return ids, nil
+}
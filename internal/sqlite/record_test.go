@@ -103,6 +103,47 @@ func TestRecordRepository_UpdateAndConflict(t *testing.T) {
 	require.Equal(t, repository.ErrNotFound, err)
 }
 
+func TestRecordRepository_UpdateParent(t *testing.T) {
+	db := NewTestDB(t)
+	ctx := context.Background()
+	insertProject(t, db, "p1", "tenant1")
+
+	repo := NewRecordRepository(db)
+	now := time.Now()
+	for i, id := range []string{"a", "b"} {
+		require.NoError(t, repo.Create(ctx, "tenant1", &record.Record{
+			ID:         id,
+			ProjectID:  "p1",
+			Type:       "note",
+			Title:      id,
+			Summary:    "Summary",
+			Body:       "Body",
+			State:      record.StateOpen,
+			CreatedAt:  now,
+			ModifiedAt: now,
+			Tick:       int64(i + 1),
+		}))
+	}
+
+	b, err := repo.Get(ctx, "tenant1", "b")
+	require.NoError(t, err)
+	b.ParentID = stringPtr("a")
+	b.Tick = 3
+	require.NoError(t, repo.Update(ctx, "tenant1", b, 2))
+
+	children, err := repo.GetChildrenRefs(ctx, "tenant1", "a")
+	require.NoError(t, err)
+	require.Len(t, children, 1)
+	require.Equal(t, "b", children[0].ID)
+
+	b.ParentID = nil
+	b.Tick = 4
+	require.NoError(t, repo.Update(ctx, "tenant1", b, 3))
+	b, err = repo.Get(ctx, "tenant1", "b")
+	require.NoError(t, err)
+	require.Nil(t, b.ParentID)
+}
+
 func TestRecordRepository_ListFilters(t *testing.T) {
 	db := NewTestDB(t)
 	ctx := context.Background()
@@ -127,6 +168,10 @@ func TestRecordRepository_ListFilters(t *testing.T) {
 	refs, err := repo.List(ctx, "tenant1", opts)
 	require.NoError(t, err)
 	require.Len(t, refs, 2)
+
+	refs, err = repo.List(ctx, "tenant1", record.ListRecordsOptions{IDs: []string{"r2", "r3", "missing"}})
+	require.NoError(t, err)
+	require.Len(t, refs, 2)
 }
 
 func TestRecordRepository_ChildrenAndRelations(t *testing.T) {
@@ -178,7 +223,7 @@ func TestRecordRepository_ChildrenAndRelations(t *testing.T) {
 	require.NoError(t, repo.Create(ctx, "tenant1", child))
 	require.NoError(t, repo.Create(ctx, "tenant1", related))
 
-	require.NoError(t, repo.AddRelation(ctx, "parent", "related"))
+	require.NoError(t, repo.AddRelation(ctx, "parent", "related", record.RelationRelates))
 
 	children, err := repo.GetChildren(ctx, "tenant1", "parent")
 	require.NoError(t, err)
@@ -194,10 +239,70 @@ func TestRecordRepository_ChildrenAndRelations(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, []string{"related"}, relatedIDs)
 
-	err = repo.AddRelation(ctx, "parent", "missing")
+	err = repo.AddRelation(ctx, "parent", "missing", record.RelationRelates)
 	require.Equal(t, repository.ErrForeignKeyViolation, err)
 }
 
+func TestRecordRepository_TypedLinks(t *testing.T) {
+	db := NewTestDB(t)
+	ctx := context.Background()
+	insertProject(t, db, "p1", "tenant1")
+
+	repo := NewRecordRepository(db)
+	now := time.Now()
+	for i, id := range []string{"a", "b", "c"} {
+		require.NoError(t, repo.Create(ctx, "tenant1", &record.Record{
+			ID:         id,
+			ProjectID:  "p1",
+			Type:       "note",
+			Title:      id,
+			Summary:    "Summary",
+			Body:       "Body",
+			State:      record.StateOpen,
+			CreatedAt:  now,
+			ModifiedAt: now,
+			Tick:       int64(i + 1),
+		}))
+	}
+
+	require.NoError(t, repo.AddRelation(ctx, "a", "b", record.RelationBlocks))
+	require.NoError(t, repo.AddRelation(ctx, "a", "b", record.RelationBlocks))
+	require.NoError(t, repo.AddRelation(ctx, "a", "b", record.RelationRelates))
+	require.NoError(t, repo.AddRelation(ctx, "c", "a", record.RelationSupersedes))
+
+	a, err := repo.Get(ctx, "tenant1", "a")
+	require.NoError(t, err)
+	require.Equal(t, []string{"b"}, a.Related)
+	require.Equal(t, []record.Link{
+		{Kind: record.RelationBlocks, RecordID: "b"},
+		{Kind: record.RelationRelates, RecordID: "b"},
+	}, a.Links)
+	require.Equal(t, []record.Link{{Kind: record.RelationSupersedes, RecordID: "c"}}, a.Backlinks)
+
+	backlinks, err := repo.GetBacklinks(ctx, "tenant1", "b")
+	require.NoError(t, err)
+	require.Len(t, backlinks, 2)
+
+	// Update replaces "relates" links only.
+	a.Related = []string{"c"}
+	a.Tick = 4
+	require.NoError(t, repo.Update(ctx, "tenant1", a, 1))
+	links, err := repo.GetLinks(ctx, "tenant1", "a")
+	require.NoError(t, err)
+	require.Equal(t, []record.Link{
+		{Kind: record.RelationBlocks, RecordID: "b"},
+		{Kind: record.RelationRelates, RecordID: "c"},
+	}, links)
+
+	require.NoError(t, repo.RemoveRelation(ctx, "a", "b", record.RelationBlocks))
+	err = repo.RemoveRelation(ctx, "a", "b", record.RelationBlocks)
+	require.Equal(t, repository.ErrNotFound, err)
+
+	links, err = repo.GetLinks(ctx, "tenant1", "a")
+	require.NoError(t, err)
+	require.Equal(t, []record.Link{{Kind: record.RelationRelates, RecordID: "c"}}, links)
+}
+
 func TestRecordRepository_Delete(t *testing.T) {
 	db := NewTestDB(t)
 	ctx := context.Background()
@@ -228,6 +333,255 @@ func TestRecordRepository_Delete(t *testing.T) {
 	require.Equal(t, repository.ErrNotFound, err)
 }
 
+func TestRecordRepository_Trash(t *testing.T) {
+	db := NewTestDB(t)
+	ctx := context.Background()
+	insertProject(t, db, "p1", "tenant1")
+
+	repo := NewRecordRepository(db)
+	searchRepo := NewSearchRepository(db, DefaultSearchWeights)
+	now := time.Now()
+	parents := map[string]*string{"a": nil, "b": stringPtr("a"), "c": stringPtr("b"), "d": nil}
+	for i, id := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, repo.Create(ctx, "tenant1", &record.Record{
+			ID:         id,
+			ProjectID:  "p1",
+			ParentID:   parents[id],
+			Type:       "note",
+			Title:      "Trashable " + id,
+			Summary:    "Summary",
+			Body:       "Body",
+			State:      record.StateOpen,
+			CreatedAt:  now,
+			ModifiedAt: now,
+			Tick:       int64(i + 1),
+		}))
+	}
+	require.NoError(t, repo.AddRelation(ctx, "a", "c", record.RelationBlocks))
+
+	count, err := repo.SoftDelete(ctx, "tenant1", "b", now)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	_, err = repo.Get(ctx, "tenant1", "c")
+	require.Equal(t, repository.ErrNotFound, err)
+	children, err := repo.GetChildrenRefs(ctx, "tenant1", "a")
+	require.NoError(t, err)
+	require.Empty(t, children)
+	links, err := repo.GetLinks(ctx, "tenant1", "a")
+	require.NoError(t, err)
+	require.Empty(t, links)
+	refs, err := repo.List(ctx, "tenant1", record.ListRecordsOptions{ProjectID: "p1"})
+	require.NoError(t, err)
+	require.Len(t, refs, 2)
+	results, err := searchRepo.Search(ctx, "tenant1", parseQuery(t, "trashable"), record.SearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	_, err = repo.SoftDelete(ctx, "tenant1", "b", now)
+	require.Equal(t, repository.ErrNotFound, err)
+
+	// Only the record deleted directly is in the trash; c went with it.
+	_, err = repo.GetTrashed(ctx, "tenant1", "c")
+	require.Equal(t, repository.ErrNotFound, err)
+	trashed, err := repo.GetTrashed(ctx, "tenant1", "b")
+	require.NoError(t, err)
+	require.NotNil(t, trashed.DeletedAt)
+	entries, err := repo.ListTrash(ctx, "tenant1", record.ListTrashOptions{ProjectID: "p1"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "b", entries[0].Record.ID)
+	require.Equal(t, 1, entries[0].Descendants)
+
+	_, err = repo.Restore(ctx, "tenant1", "c")
+	require.Equal(t, repository.ErrNotFound, err)
+	count, err = repo.Restore(ctx, "tenant1", "b")
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	_, err = repo.Get(ctx, "tenant1", "c")
+	require.NoError(t, err)
+	results, err = searchRepo.Search(ctx, "tenant1", parseQuery(t, "trashable"), record.SearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+
+	// Purge removes only records trashed before the cutoff.
+	b, err := repo.Get(ctx, "tenant1", "b")
+	require.NoError(t, err)
+	require.NoError(t, repo.SaveVersion(ctx, "tenant1", b))
+	_, err = repo.SoftDelete(ctx, "tenant1", "b", now.Add(-48*time.Hour))
+	require.NoError(t, err)
+	_, err = repo.SoftDelete(ctx, "tenant1", "d", now)
+	require.NoError(t, err)
+
+	purged, err := repo.PurgeTrash(ctx, now.Add(-24*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 2, purged)
+
+	_, err = repo.GetTrashed(ctx, "tenant1", "b")
+	require.Equal(t, repository.ErrNotFound, err)
+	_, err = repo.GetVersionAt(ctx, "tenant1", "b", 10)
+	require.Equal(t, repository.ErrNotFound, err)
+	entries, err = repo.ListTrash(ctx, "tenant1", record.ListTrashOptions{ProjectID: "p1"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "d", entries[0].Record.ID)
+	results, err = searchRepo.Search(ctx, "tenant1", parseQuery(t, "trashable"), record.SearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+}
+
+func TestRecordRepository_Versions(t *testing.T) {
+	db := NewTestDB(t)
+	ctx := context.Background()
+	insertProject(t, db, "p1", "tenant1")
+
+	repo := NewRecordRepository(db)
+	now := time.Now()
+	rec := &record.Record{
+		ID:         "r1",
+		ProjectID:  "p1",
+		Type:       "question",
+		Title:      "First",
+		Summary:    "Summary",
+		Body:       "Body",
+		State:      record.StateOpen,
+		CreatedAt:  now,
+		ModifiedAt: now,
+		Tick:       2,
+	}
+	require.NoError(t, repo.Create(ctx, "tenant1", rec))
+	require.NoError(t, repo.SaveVersion(ctx, "tenant1", rec))
+
+	updated := *rec
+	updated.Title = "Second"
+	updated.Tick = 5
+	require.NoError(t, repo.Update(ctx, "tenant1", &updated, 2))
+
+	version, err := repo.GetVersionAt(ctx, "tenant1", "r1", 4)
+	require.NoError(t, err)
+	require.Equal(t, "First", version.Title)
+	require.Equal(t, int64(2), version.Tick)
+	require.Equal(t, "p1", version.ProjectID)
+
+	_, err = repo.GetVersionAt(ctx, "tenant1", "r1", 1)
+	require.Equal(t, repository.ErrNotFound, err)
+
+	_, err = repo.GetVersionAt(ctx, "tenant2", "r1", 4)
+	require.Equal(t, repository.ErrNotFound, err)
+}
+
+func TestRecordRepository_ListSortAndKeyset(t *testing.T) {
+	db := NewTestDB(t)
+	ctx := context.Background()
+	insertProject(t, db, "p1", "tenant1")
+
+	repo := NewRecordRepository(db)
+	now := time.Now()
+	records := []*record.Record{
+		{ID: "r1", ProjectID: "p1", Type: "question", Title: "beta", Summary: "S", Body: "B", State: record.StateResolved, CreatedAt: now, ModifiedAt: now, Tick: 1},
+		{ID: "r2", ProjectID: "p1", Type: "question", Title: "Alpha", Summary: "S", Body: "B", State: record.StateOpen, CreatedAt: now, ModifiedAt: now, Tick: 4},
+		{ID: "r3", ProjectID: "p1", Type: "question", Title: "gamma", Summary: "S", Body: "B", State: record.StateLater, CreatedAt: now, ModifiedAt: now, Tick: 3},
+		{ID: "r4", ProjectID: "p1", ParentID: stringPtr("r3"), Type: "note", Title: "delta", Summary: "S", Body: "B", State: record.StateOpen, CreatedAt: now, ModifiedAt: now, Tick: 2},
+	}
+	for _, rec := range records {
+		require.NoError(t, repo.Create(ctx, "tenant1", rec))
+	}
+
+	ids := func(refs []record.RecordRef) []string {
+		var out []string
+		for _, ref := range refs {
+			out = append(out, ref.ID)
+		}
+		return out
+	}
+	for sort, want := range map[record.ListSort][]string{
+		record.SortCreated:      {"r4", "r3", "r2", "r1"},
+		record.SortTick:         {"r2", "r3", "r4", "r1"},
+		record.SortTitle:        {"r2", "r1", "r4", "r3"},
+		record.SortState:        {"r2", "r4", "r3", "r1"},
+		record.SortChildrenOpen: {"r3", "r4", "r2", "r1"},
+	} {
+		refs, err := repo.List(ctx, "tenant1", record.ListRecordsOptions{Sort: sort})
+		require.NoError(t, err)
+		require.Equal(t, want, ids(refs), sort)
+
+		// Walking the listing two at a time visits every record once.
+		var walked []string
+		opts := record.ListRecordsOptions{Sort: sort, Limit: 2}
+		for {
+			page, err := repo.List(ctx, "tenant1", opts)
+			require.NoError(t, err)
+			if len(page) == 0 {
+				break
+			}
+			walked = append(walked, ids(page)...)
+			last := page[len(page)-1]
+			opts.After = &record.Cursor{Sort: sort, Key: last.SortKey, ID: last.ID}
+		}
+		require.Equal(t, want, walked, sort)
+	}
+
+	// A record created between pages doesn't shift the next page.
+	first, err := repo.List(ctx, "tenant1", record.ListRecordsOptions{Sort: record.SortTitle, Limit: 2})
+	require.NoError(t, err)
+	require.NoError(t, repo.Create(ctx, "tenant1", &record.Record{
+		ID: "r5", ProjectID: "p1", Type: "note", Title: "aardvark", Summary: "S", Body: "B", State: record.StateOpen, CreatedAt: now, ModifiedAt: now, Tick: 5,
+	}))
+	last := first[len(first)-1]
+	next, err := repo.List(ctx, "tenant1", record.ListRecordsOptions{
+		Sort:  record.SortTitle,
+		Limit: 2,
+		After: &record.Cursor{Sort: record.SortTitle, Key: last.SortKey, ID: last.ID},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"r4", "r3"}, ids(next))
+
+	_, err = repo.List(ctx, "tenant1", record.ListRecordsOptions{Sort: record.SortTick, After: &record.Cursor{Key: "x", ID: "r1"}})
+	require.ErrorIs(t, err, record.ErrInvalidCursor)
+
+	total, err := repo.Count(ctx, "tenant1", record.ListRecordsOptions{ProjectID: "p1", States: []record.RecordState{record.StateOpen}})
+	require.NoError(t, err)
+	require.Equal(t, 3, total)
+
+	changed, err := repo.Count(ctx, "tenant1", record.ListRecordsOptions{ProjectID: "p1", ChangedSince: map[string]int64{"p1": 3}})
+	require.NoError(t, err)
+	require.Equal(t, 2, changed)
+}
+
+func TestRecordRepository_MatchIDPrefix(t *testing.T) {
+	db := NewTestDB(t)
+	ctx := context.Background()
+	insertProject(t, db, "p1", "tenant1")
+
+	repo := NewRecordRepository(db)
+	now := time.Now()
+	for _, id := range []string{"abcd1234-1", "abcd1234-2", "abcd9999-1", "ab%d0000-1"} {
+		require.NoError(t, repo.Create(ctx, "tenant1", &record.Record{
+			ID: id, ProjectID: "p1", Type: "note", Title: "T", Summary: "S", Body: "B", State: record.StateOpen, CreatedAt: now, ModifiedAt: now, Tick: 1,
+		}))
+	}
+	_, err := repo.SoftDelete(ctx, "tenant1", "abcd9999-1", now)
+	require.NoError(t, err)
+
+	ids, err := repo.MatchIDPrefix(ctx, "tenant1", "abcd1234", 5)
+	require.NoError(t, err)
+	require.Equal(t, []string{"abcd1234-1", "abcd1234-2"}, ids)
+
+	// Trashed records match, so they can be restored by short id.
+	ids, err = repo.MatchIDPrefix(ctx, "tenant1", "abcd9", 5)
+	require.NoError(t, err)
+	require.Equal(t, []string{"abcd9999-1"}, ids)
+
+	// LIKE wildcards in the prefix match only themselves.
+	ids, err = repo.MatchIDPrefix(ctx, "tenant1", "ab%d", 5)
+	require.NoError(t, err)
+	require.Equal(t, []string{"ab%d0000-1"}, ids)
+
+	ids, err = repo.MatchIDPrefix(ctx, "tenant2", "abcd", 5)
+	require.NoError(t, err)
+	require.Empty(t, ids)
+}
+
 func insertProject(t *testing.T, db *DB, id, tenantID string) {
 	t.Helper()
 	_, err := db.Exec(
@@ -3,62 +3,110 @@ package sqlite
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/rpggio/trellis/internal/domain/record"
 )
 
+// Markers placed around matched terms in highlights and snippets
+const (
+	matchOpen  = "**"
+	matchClose = "**"
+)
+
+// snippetTokens is the approximate length of a body snippet, in tokens
+const snippetTokens = 16
+
+// SearchWeights are the BM25 weights of the indexed columns. A higher
+// weight makes a match in that column count for more.
+type SearchWeights struct {
+	Title   float64
+	Summary float64
+	Body    float64
+}
+
+// DefaultSearchWeights rank a title hit above a summary hit above a body hit
+var DefaultSearchWeights = SearchWeights{Title: 10, Summary: 4, Body: 1}
+
 // SearchRepository implements repository.SearchRepository for SQLite
 type SearchRepository struct {
-	db *DB
+	db      *DB
+	weights SearchWeights
 }
 
-// NewSearchRepository creates a new SearchRepository
-func NewSearchRepository(db *DB) *SearchRepository {
-	return &SearchRepository{db: db}
+// NewSearchRepository creates a new SearchRepository that ranks with the
+// given column weights
+func NewSearchRepository(db *DB, weights SearchWeights) *SearchRepository {
+	return &SearchRepository{db: db, weights: weights}
 }
 
-// Search performs a full-text search over records
-func (r *SearchRepository) Search(ctx context.Context, tenantID, projectID, query string, opts record.SearchOptions) ([]record.SearchResult, error) {
-	baseQuery := `
-		SELECT
-			r.id, r.type, r.title, r.summary, r.state, r.parent_id,
-			(SELECT COUNT(*) FROM records c WHERE c.parent_id = r.id AND c.tenant_id = r.tenant_id) as children_count,
-			(SELECT COUNT(*) FROM records c WHERE c.parent_id = r.id AND c.tenant_id = r.tenant_id AND c.state = 'OPEN') as open_children_count,
+// Search performs a full-text search over records, best matches first.
+// Results from several projects are ranked together. A query without text
+// terms only filters, returning recently modified records first.
+func (r *SearchRepository) Search(ctx context.Context, tenantID string, query record.Query, opts record.SearchOptions) ([]record.SearchResult, error) {
+	selectColumns := `
 			0.0 as rank,
+			r.title as highlight,
 			'' as snippet
-		FROM records_fts
-		JOIN records r ON r.rowid = records_fts.rowid
-		WHERE r.tenant_id = ? AND r.project_id = ? AND records_fts MATCH ?
+		FROM records r
+		LEFT JOIN projects p ON p.id = r.project_id AND p.tenant_id = r.tenant_id
 	`
+	var args []interface{}
+	conditions, whereArgs := searchConditions(tenantID, query, opts)
+	orderBy := " ORDER BY r.tick DESC"
 
-	args := []interface{}{tenantID, projectID, query}
-	conditions := []string{}
-
-	if len(opts.States) > 0 {
-		placeholders := make([]string, len(opts.States))
-		for i, state := range opts.States {
-			placeholders[i] = "?"
-			args = append(args, state)
-		}
-		conditions = append(conditions, fmt.Sprintf("r.state IN (%s)", strings.Join(placeholders, ",")))
-	}
-
-	if len(opts.Types) > 0 {
-		placeholders := make([]string, len(opts.Types))
-		for i, typ := range opts.Types {
-			placeholders[i] = "?"
-			args = append(args, typ)
+	if query.HasText() {
+		// hits holds the matching rowids. With the trigram index, records
+		// that only match as substrings follow the word matches.
+		hits := `
+			SELECT rowid, -bm25(records_fts, ?, ?, ?) as rank,
+				highlight(records_fts, 0, ?, ?) as highlight,
+				snippet(records_fts, 2, ?, ?, '…', ?) as snippet,
+				0 as tier
+			FROM records_fts WHERE records_fts MATCH ?
+		`
+		args = append(args,
+			r.weights.Title, r.weights.Summary, r.weights.Body,
+			matchOpen, matchClose,
+			matchOpen, matchClose, snippetTokens,
+			query.FTSExpression(),
+		)
+		if r.db.trigram {
+			hits += `
+			UNION ALL
+			SELECT rowid, -bm25(records_fts_trigram, ?, ?, ?),
+				highlight(records_fts_trigram, 0, ?, ?),
+				snippet(records_fts_trigram, 2, ?, ?, '…', ?),
+				1
+			FROM records_fts_trigram WHERE records_fts_trigram MATCH ?
+				AND rowid NOT IN (SELECT rowid FROM records_fts WHERE records_fts MATCH ?)
+			`
+			args = append(args,
+				r.weights.Title, r.weights.Summary, r.weights.Body,
+				matchOpen, matchClose,
+				matchOpen, matchClose, snippetTokens,
+				query.SubstringFTSExpression(), query.FTSExpression(),
+			)
 		}
-		conditions = append(conditions, fmt.Sprintf("r.type IN (%s)", strings.Join(placeholders, ",")))
-	}
-
-	if len(conditions) > 0 {
-		baseQuery += " AND " + strings.Join(conditions, " AND ")
+		selectColumns = `
+			h.rank,
+			h.highlight,
+			h.snippet
+		FROM (` + hits + `) h
+		JOIN records r ON r.rowid = h.rowid
+		LEFT JOIN projects p ON p.id = r.project_id AND p.tenant_id = r.tenant_id
+		`
+		orderBy = " ORDER BY h.tier, h.rank DESC"
 	}
 
-	baseQuery += " GROUP BY r.id, r.type, r.title, r.summary, r.state, r.parent_id"
-	baseQuery += " ORDER BY rank"
+	baseQuery := `
+		SELECT
+			r.id, r.type, r.title, r.summary, r.state, r.parent_id, r.project_id, COALESCE(p.name, ''),
+			(SELECT COUNT(*) FROM records c WHERE c.parent_id = r.id AND c.tenant_id = r.tenant_id AND c.deleted_at IS NULL) as children_count,
+			(SELECT COUNT(*) FROM records c WHERE c.parent_id = r.id AND c.tenant_id = r.tenant_id AND c.deleted_at IS NULL AND c.state = 'OPEN') as open_children_count,
+	` + selectColumns + " WHERE " + strings.Join(conditions, " AND ") + orderBy
+	args = append(args, whereArgs...)
 
 	if opts.Limit > 0 {
 		baseQuery += " LIMIT ?"
@@ -69,7 +117,7 @@ func (r *SearchRepository) Search(ctx context.Context, tenantID, projectID, quer
 		args = append(args, opts.Offset)
 	}
 
-	rows, err := r.db.QueryContext(ctx, baseQuery, args...)
+	rows, err := r.db.conn(ctx).QueryContext(ctx, baseQuery, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search records: %w", err)
 	}
@@ -85,9 +133,12 @@ func (r *SearchRepository) Search(ctx context.Context, tenantID, projectID, quer
 			&result.Record.Summary,
 			&result.Record.State,
 			&result.Record.ParentID,
+			&result.Record.ProjectID,
+			&result.Record.ProjectName,
 			&result.Record.ChildrenCount,
 			&result.Record.OpenChildrenCount,
 			&result.Rank,
+			&result.Highlight,
 			&result.Snippet,
 		)
 		if err != nil {
@@ -102,3 +153,105 @@ func (r *SearchRepository) Search(ctx context.Context, tenantID, projectID, quer
 
 	return results, nil
 }
+
+// Count returns how many records Search would find without a limit
+func (r *SearchRepository) Count(ctx context.Context, tenantID string, query record.Query, opts record.SearchOptions) (int, error) {
+	conditions, args := searchConditions(tenantID, query, opts)
+	if query.HasText() {
+		match := "r.rowid IN (SELECT rowid FROM records_fts WHERE records_fts MATCH ?)"
+		args = append(args, query.FTSExpression())
+		if r.db.trigram {
+			match = "(" + match + " OR r.rowid IN (SELECT rowid FROM records_fts_trigram WHERE records_fts_trigram MATCH ?))"
+			args = append(args, query.SubstringFTSExpression())
+		}
+		conditions = append(conditions, match)
+	}
+
+	var count int
+	sqlQuery := `SELECT COUNT(*) FROM records r WHERE ` + strings.Join(conditions, " AND ")
+	if err := r.db.conn(ctx).QueryRowContext(ctx, sqlQuery, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count search results: %w", err)
+	}
+	return count, nil
+}
+
+// searchConditions returns the WHERE conditions and arguments for the
+// query's exclusions and field filters and the search options, over records
+// aliased as r.
+func searchConditions(tenantID string, query record.Query, opts record.SearchOptions) ([]string, []interface{}) {
+	conditions := []string{"r.tenant_id = ?", "r.deleted_at IS NULL"}
+	args := []interface{}{tenantID}
+
+	if len(opts.ProjectIDs) > 0 {
+		placeholders := make([]string, len(opts.ProjectIDs))
+		for i, id := range opts.ProjectIDs {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		conditions = append(conditions, fmt.Sprintf("r.project_id IN (%s)", strings.Join(placeholders, ",")))
+	}
+
+	if len(query.Excluded) > 0 {
+		conditions = append(conditions, "r.rowid NOT IN (SELECT rowid FROM records_fts WHERE records_fts MATCH ?)")
+		args = append(args, query.ExcludedFTSExpression())
+	}
+
+	for _, states := range [][]record.RecordState{query.States, opts.States} {
+		if len(states) > 0 {
+			placeholders := make([]string, len(states))
+			for i, state := range states {
+				placeholders[i] = "?"
+				args = append(args, state)
+			}
+			conditions = append(conditions, fmt.Sprintf("r.state IN (%s)", strings.Join(placeholders, ",")))
+		}
+	}
+
+	for _, types := range [][]string{query.Types, opts.Types} {
+		if len(types) > 0 {
+			placeholders := make([]string, len(types))
+			for i, typ := range types {
+				placeholders[i] = "?"
+				args = append(args, typ)
+			}
+			conditions = append(conditions, fmt.Sprintf("r.type IN (%s)", strings.Join(placeholders, ",")))
+		}
+	}
+
+	if query.ParentID != nil {
+		if *query.ParentID == "" {
+			conditions = append(conditions, "r.parent_id IS NULL")
+		} else {
+			conditions = append(conditions, "r.parent_id = ?")
+			args = append(args, *query.ParentID)
+		}
+	}
+
+	if query.ModifiedAfter != nil {
+		conditions = append(conditions, "r.tick > ?")
+		args = append(args, *query.ModifiedAfter)
+	}
+	if query.ModifiedBefore != nil {
+		conditions = append(conditions, "r.tick < ?")
+		args = append(args, *query.ModifiedBefore)
+	}
+
+	if len(opts.ExistedAt) > 0 {
+		// A record existed at a tick if it was last written by then or
+		// has a version from then. Sorted so the statement text is stable.
+		projectIDs := make([]string, 0, len(opts.ExistedAt))
+		for id := range opts.ExistedAt {
+			projectIDs = append(projectIDs, id)
+		}
+		sort.Strings(projectIDs)
+		existed := make([]string, len(projectIDs))
+		for i, id := range projectIDs {
+			existed[i] = `(r.project_id = ? AND (r.tick <= ? OR EXISTS (
+				SELECT 1 FROM record_versions v WHERE v.record_id = r.id AND v.tick <= ?)))`
+			args = append(args, id, opts.ExistedAt[id], opts.ExistedAt[id])
+		}
+		conditions = append(conditions, "("+strings.Join(existed, " OR ")+")")
+	}
+
+	return conditions, args
+}
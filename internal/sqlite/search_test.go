@@ -30,8 +30,8 @@ func TestSearchRepository_Search(t *testing.T) {
 	}
 	require.NoError(t, repo.Create(ctx, "tenant1", rec))
 
-	searchRepo := NewSearchRepository(db)
-	results, err := searchRepo.Search(ctx, "tenant1", "p1", "unique", record.SearchOptions{})
+	searchRepo := NewSearchRepository(db, DefaultSearchWeights)
+	results, err := searchRepo.Search(ctx, "tenant1", parseQuery(t, "unique"), record.SearchOptions{})
 	require.NoError(t, err)
 	require.Len(t, results, 1)
 	require.Equal(t, "r1", results[0].Record.ID)
@@ -73,9 +73,228 @@ func TestSearchRepository_TenantIsolation(t *testing.T) {
 	}
 	require.NoError(t, repo.Create(ctx, "tenant2", rec2))
 
-	searchRepo := NewSearchRepository(db)
-	results, err := searchRepo.Search(ctx, "tenant1", "p1", "shared", record.SearchOptions{})
+	searchRepo := NewSearchRepository(db, DefaultSearchWeights)
+	results, err := searchRepo.Search(ctx, "tenant1", parseQuery(t, "shared"), record.SearchOptions{})
 	require.NoError(t, err)
 	require.Len(t, results, 1)
 	require.Equal(t, "r1", results[0].Record.ID)
 }
+
+func TestSearchRepository_RankAndSnippet(t *testing.T) {
+	db := NewTestDB(t)
+	ctx := context.Background()
+	insertProject(t, db, "p1", "tenant1")
+
+	repo := NewRecordRepository(db)
+	now := time.Now()
+	records := []*record.Record{
+		{ID: "body", Title: "Storage notes", Summary: "Summary", Body: "We weighed several options over many weeks of discussion and a long series of prototypes before finally settling on sqlite for local storage of records."},
+		{ID: "summary", Title: "Persistence", Summary: "Use sqlite", Body: "Details follow."},
+		{ID: "title", Title: "Why sqlite", Summary: "Summary", Body: "Embedded and simple."},
+	}
+	for i, rec := range records {
+		rec.ProjectID = "p1"
+		rec.Type = "note"
+		rec.State = record.StateOpen
+		rec.CreatedAt = now
+		rec.ModifiedAt = now
+		rec.Tick = int64(i + 1)
+		require.NoError(t, repo.Create(ctx, "tenant1", rec))
+	}
+
+	searchRepo := NewSearchRepository(db, DefaultSearchWeights)
+	results, err := searchRepo.Search(ctx, "tenant1", parseQuery(t, "sqlite"), record.SearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	require.Equal(t, "title", results[0].Record.ID)
+	require.Equal(t, "summary", results[1].Record.ID)
+	require.Equal(t, "body", results[2].Record.ID)
+	require.Greater(t, results[0].Rank, results[1].Rank)
+	require.Equal(t, "Why **sqlite**", results[0].Highlight)
+	require.Contains(t, results[2].Snippet, "**sqlite**")
+	require.NotContains(t, results[2].Snippet, "We weighed")
+
+	// With the body weighted highest the order flips.
+	searchRepo = NewSearchRepository(db, SearchWeights{Title: 1, Summary: 1, Body: 20})
+	results, err = searchRepo.Search(ctx, "tenant1", parseQuery(t, "sqlite"), record.SearchOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "body", results[0].Record.ID)
+}
+
+func TestSearchRepository_QueryFilters(t *testing.T) {
+	db := NewTestDB(t)
+	ctx := context.Background()
+	insertProject(t, db, "p1", "tenant1")
+
+	repo := NewRecordRepository(db)
+	now := time.Now()
+	records := []*record.Record{
+		{ID: "q1", Type: "question", State: record.StateOpen, Title: "Cache invalidation", Body: "When should the cache be invalidated?"},
+		{ID: "q2", Type: "question", State: record.StateResolved, ParentID: stringPtr("q1"), Title: "Redis cache", Body: "Invalidation through redis pub/sub."},
+		{ID: "n1", Type: "note", State: record.StateOpen, Title: "Cache notes", Body: "Cache invalidation is hard."},
+	}
+	for i, rec := range records {
+		rec.ProjectID = "p1"
+		rec.Summary = "Summary"
+		rec.CreatedAt = now
+		rec.ModifiedAt = now
+		rec.Tick = int64(i + 1)
+		require.NoError(t, repo.Create(ctx, "tenant1", rec))
+	}
+
+	searchRepo := NewSearchRepository(db, DefaultSearchWeights)
+	ids := func(query string) []string {
+		t.Helper()
+		results, err := searchRepo.Search(ctx, "tenant1", parseQuery(t, query), record.SearchOptions{})
+		require.NoError(t, err)
+		ids := make([]string, len(results))
+		for i, result := range results {
+			ids[i] = result.Record.ID
+		}
+		return ids
+	}
+
+	require.ElementsMatch(t, []string{"q1", "q2"}, ids("type:question cache"))
+	require.ElementsMatch(t, []string{"q1", "n1"}, ids("state:open"))
+	require.ElementsMatch(t, []string{"q1", "n1"}, ids(`"cache invalidation" -redis`))
+	require.ElementsMatch(t, []string{"q1"}, ids(`"cache invalidation" -redis -notes`))
+	require.ElementsMatch(t, []string{"q2"}, ids("parent:q1"))
+	require.ElementsMatch(t, []string{"q1", "n1"}, ids("parent:root"))
+	require.ElementsMatch(t, []string{"q2", "n1"}, ids("modified>tick:1"))
+	require.ElementsMatch(t, []string{"q1", "q2"}, ids("modified<=tick:2"))
+	require.ElementsMatch(t, []string{"q1", "q2", "n1"}, ids("invalidat*"))
+	// Punctuation that is FTS5 syntax is searched as text.
+	require.ElementsMatch(t, []string{"q2"}, ids("pub/sub (redis) -"))
+}
+
+func parseQuery(t *testing.T, query string) record.Query {
+	t.Helper()
+	parsed, err := record.ParseQuery(query)
+	require.NoError(t, err)
+	return parsed
+}
+
+func TestSearchRepository_CrossProject(t *testing.T) {
+	db := NewTestDB(t)
+	ctx := context.Background()
+	insertProject(t, db, "p1", "tenant1")
+	insertProject(t, db, "p2", "tenant1")
+	insertProject(t, db, "p3", "tenant1")
+
+	repo := NewRecordRepository(db)
+	now := time.Now()
+	records := []*record.Record{
+		{ID: "r1", ProjectID: "p1", Title: "Decision log", Body: "We decided to shard by tenant."},
+		{ID: "r2", ProjectID: "p2", Title: "Sharding decided", Body: "Shard by region."},
+		{ID: "r3", ProjectID: "p3", Title: "Unrelated", Body: "We decided nothing yet."},
+	}
+	for i, rec := range records {
+		rec.Type = "note"
+		rec.Summary = "Summary"
+		rec.State = record.StateOpen
+		rec.CreatedAt = now
+		rec.ModifiedAt = now
+		rec.Tick = int64(i + 1)
+		require.NoError(t, repo.Create(ctx, "tenant1", rec))
+	}
+
+	searchRepo := NewSearchRepository(db, DefaultSearchWeights)
+	results, err := searchRepo.Search(ctx, "tenant1", parseQuery(t, "decided"), record.SearchOptions{
+		ProjectIDs: []string{"p1", "p2"},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	// The title hit in p2 outranks the body hit in p1.
+	require.Equal(t, "r2", results[0].Record.ID)
+	require.Equal(t, "p2", results[0].Record.ProjectID)
+	require.Equal(t, "Project", results[0].Record.ProjectName)
+	require.Equal(t, "p1", results[1].Record.ProjectID)
+
+	results, err = searchRepo.Search(ctx, "tenant1", parseQuery(t, "decided"), record.SearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+
+	refs, err := repo.List(ctx, "tenant1", record.ListRecordsOptions{ProjectIDs: []string{"p2", "p3"}})
+	require.NoError(t, err)
+	require.Len(t, refs, 2)
+	for _, ref := range refs {
+		require.Contains(t, []string{"p2", "p3"}, ref.ProjectID)
+		require.Equal(t, "Project", ref.ProjectName)
+	}
+}
+
+func TestSearchRepository_Embeddings(t *testing.T) {
+	db := NewTestDB(t)
+	ctx := context.Background()
+	insertProject(t, db, "p1", "tenant1")
+
+	repo := NewRecordRepository(db)
+	now := time.Now()
+	records := []*record.Record{
+		{ID: "r1", Type: "note", Title: "Caching"},
+		{ID: "r2", Type: "question", Title: "Sharding"},
+		{ID: "r3", Type: "note", Title: "Budget"},
+	}
+	for i, rec := range records {
+		rec.ProjectID = "p1"
+		rec.Summary = "Summary"
+		rec.State = record.StateOpen
+		rec.CreatedAt = now
+		rec.ModifiedAt = now
+		rec.Tick = int64(i + 1)
+		require.NoError(t, repo.Create(ctx, "tenant1", rec))
+	}
+
+	searchRepo := NewSearchRepository(db, DefaultSearchWeights)
+	missing, err := searchRepo.MissingEmbeddings(ctx, "tenant1", "m1", 10)
+	require.NoError(t, err)
+	require.Len(t, missing, 3)
+	require.Equal(t, "Caching", missing[0].Title)
+
+	hash, err := searchRepo.EmbeddingHash(ctx, "r1", "m1")
+	require.NoError(t, err)
+	require.Empty(t, hash)
+
+	require.NoError(t, searchRepo.SaveEmbedding(ctx, "r1", "m1", "h1", []float32{1, 0.5}))
+	require.NoError(t, searchRepo.SaveEmbedding(ctx, "r1", "m1", "h2", []float32{1, -0.25}))
+	require.NoError(t, searchRepo.SaveEmbedding(ctx, "r2", "m1", "h1", []float32{0, 1}))
+	require.NoError(t, searchRepo.SaveEmbedding(ctx, "r3", "m2", "h1", []float32{0, 1}))
+
+	hash, err = searchRepo.EmbeddingHash(ctx, "r1", "m1")
+	require.NoError(t, err)
+	require.Equal(t, "h2", hash)
+
+	missing, err = searchRepo.MissingEmbeddings(ctx, "tenant1", "m1", 10)
+	require.NoError(t, err)
+	require.Len(t, missing, 1)
+	require.Equal(t, "r3", missing[0].ID)
+
+	embedded, err := searchRepo.SearchEmbeddings(ctx, "tenant1", "m1", record.Query{}, record.SearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, embedded, 2)
+	for _, e := range embedded {
+		if e.Ref.ID == "r1" {
+			require.Equal(t, []float32{1, -0.25}, e.Vector)
+			require.Equal(t, "Project", e.Ref.ProjectName)
+		}
+	}
+
+	// Filters and trash apply to candidates.
+	embedded, err = searchRepo.SearchEmbeddings(ctx, "tenant1", "m1", parseQuery(t, "type:question"), record.SearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, embedded, 1)
+	require.Equal(t, "r2", embedded[0].Ref.ID)
+
+	_, err = repo.SoftDelete(ctx, "tenant1", "r2", now)
+	require.NoError(t, err)
+	embedded, err = searchRepo.SearchEmbeddings(ctx, "tenant1", "m1", record.Query{}, record.SearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, embedded, 1)
+
+	// Purging a record drops its embeddings.
+	_, err = repo.PurgeTrash(ctx, now.Add(time.Hour))
+	require.NoError(t, err)
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM record_embeddings WHERE record_id = 'r2'`).Scan(&count))
+	require.Zero(t, count)
+}
@@ -25,20 +25,21 @@ func (r *SessionRepository) Create(ctx context.Context, tenantID string, sess *s
 	query := `
 		INSERT INTO sessions (
 			id, tenant_id, project_id, status, parent_session,
-			last_sync_tick, created_at, last_activity, closed_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			last_sync_tick, created_at, last_activity, stale_at, closed_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err := r.db.ExecContext(ctx, query,
+	_, err := r.db.conn(ctx).ExecContext(ctx, query,
 		sess.ID,
 		tenantID,
 		sess.ProjectID,
 		sess.Status,
 		sess.ParentSession,
 		sess.LastSyncTick,
-		sess.CreatedAt,
-		sess.LastActivity,
-		sess.ClosedAt,
+		sess.CreatedAt.UTC(),
+		sess.LastActivity.UTC(),
+		utcTime(sess.StaleAt),
+		utcTime(sess.ClosedAt),
 	)
 	if err != nil {
 		if isForeignKeyViolation(err) {
@@ -55,15 +56,15 @@ func (r *SessionRepository) Get(ctx context.Context, tenantID, id string) (*sess
 	query := `
 		SELECT
 			id, tenant_id, project_id, status, parent_session,
-			last_sync_tick, created_at, last_activity, closed_at
+			last_sync_tick, created_at, last_activity, stale_at, closed_at
 		FROM sessions
 		WHERE id = ? AND tenant_id = ?
 	`
 
 	var sess session.Session
 	var parentSession sql.NullString
-	var closedAt sql.NullTime
-	err := r.db.QueryRowContext(ctx, query, id, tenantID).Scan(
+	var staleAt, closedAt sql.NullTime
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, id, tenantID).Scan(
 		&sess.ID,
 		&sess.TenantID,
 		&sess.ProjectID,
@@ -72,6 +73,7 @@ func (r *SessionRepository) Get(ctx context.Context, tenantID, id string) (*sess
 		&sess.LastSyncTick,
 		&sess.CreatedAt,
 		&sess.LastActivity,
+		&staleAt,
 		&closedAt,
 	)
 	if err == sql.ErrNoRows {
@@ -84,6 +86,9 @@ func (r *SessionRepository) Get(ctx context.Context, tenantID, id string) (*sess
 	if parentSession.Valid {
 		sess.ParentSession = &parentSession.String
 	}
+	if staleAt.Valid {
+		sess.StaleAt = &staleAt.Time
+	}
 	if closedAt.Valid {
 		sess.ClosedAt = &closedAt.Time
 	}
@@ -102,16 +107,17 @@ func (r *SessionRepository) Update(ctx context.Context, tenantID string, sess *s
 	query := `
 		UPDATE sessions
 		SET status = ?, parent_session = ?, last_sync_tick = ?,
-		    last_activity = ?, closed_at = ?
+		    last_activity = ?, stale_at = ?, closed_at = ?
 		WHERE id = ? AND tenant_id = ?
 	`
 
-	result, err := r.db.ExecContext(ctx, query,
+	result, err := r.db.conn(ctx).ExecContext(ctx, query,
 		sess.Status,
 		sess.ParentSession,
 		sess.LastSyncTick,
-		sess.LastActivity,
-		sess.ClosedAt,
+		sess.LastActivity.UTC(),
+		utcTime(sess.StaleAt),
+		utcTime(sess.ClosedAt),
 		sess.ID,
 		tenantID,
 	)
@@ -135,14 +141,14 @@ func (r *SessionRepository) Update(ctx context.Context, tenantID string, sess *s
 
 // Close marks a session as closed
 func (r *SessionRepository) Close(ctx context.Context, tenantID, id string) error {
-	now := time.Now()
+	now := time.Now().UTC()
 	query := `
 		UPDATE sessions
 		SET status = ?, closed_at = ?, last_activity = ?
 		WHERE id = ? AND tenant_id = ?
 	`
 
-	result, err := r.db.ExecContext(ctx, query, session.StatusClosed, now, now, id, tenantID)
+	result, err := r.db.conn(ctx).ExecContext(ctx, query, session.StatusClosed, now, now, id, tenantID)
 	if err != nil {
 		return fmt.Errorf("failed to close session: %w", err)
 	}
@@ -158,6 +164,88 @@ func (r *SessionRepository) Close(ctx context.Context, tenantID, id string) erro
 	return nil
 }
 
+// MarkStale marks an active session stale as of staleAt, provided its last
+// activity is still lastActivity as read from the repository. It returns
+// repository.ErrConflict when the session is gone, no longer active or was
+// used in the meantime.
+func (r *SessionRepository) MarkStale(ctx context.Context, tenantID, id string, lastActivity, staleAt time.Time) error {
+	query := `
+		UPDATE sessions
+		SET status = ?, stale_at = ?
+		WHERE id = ? AND tenant_id = ? AND status = ? AND last_activity = ?
+	`
+
+	return r.execConditional(ctx, query, session.StatusStale, staleAt.UTC(), id, tenantID, session.StatusActive, lastActivity.Round(0))
+}
+
+// CloseStale closes a stale session, provided its last activity is still
+// lastActivity as read from the repository. It returns
+// repository.ErrConflict when the session is gone, no longer stale or was
+// used in the meantime.
+func (r *SessionRepository) CloseStale(ctx context.Context, tenantID, id string, lastActivity time.Time) error {
+	query := `
+		UPDATE sessions
+		SET status = ?, closed_at = ?
+		WHERE id = ? AND tenant_id = ? AND status = ? AND last_activity = ?
+	`
+
+	return r.execConditional(ctx, query, session.StatusClosed, time.Now().UTC(), id, tenantID, session.StatusStale, lastActivity.Round(0))
+}
+
+// Touch records activity in an open session at time at and makes a stale
+// session active again. tick is the project tick of a write the session
+// just made, or 0; when it directly follows the session's sync tick the
+// session has seen every write up to it, so the sync tick moves to it.
+// Closed and unknown sessions are left alone.
+func (r *SessionRepository) Touch(ctx context.Context, tenantID, id string, tick int64, at time.Time) error {
+	query := `
+		UPDATE sessions
+		SET last_activity = ?, status = ?, stale_at = NULL,
+		    last_sync_tick = CASE WHEN ? > 0 AND last_sync_tick = ? - 1 THEN ? ELSE last_sync_tick END
+		WHERE id = ? AND tenant_id = ? AND status IN (?, ?)
+	`
+
+	_, err := r.db.conn(ctx).ExecContext(ctx, query,
+		at.UTC(), session.StatusActive,
+		tick, tick, tick,
+		id, tenantID, session.StatusActive, session.StatusStale,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to touch session: %w", err)
+	}
+	return nil
+}
+
+// utcTime returns t in UTC. Session timestamps are stored in UTC, without a
+// monotonic clock reading, so a value read back compares equal to the
+// stored text.
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// execConditional runs an update that must change exactly the one session
+// its conditions select
+func (r *SessionRepository) execConditional(ctx context.Context, query string, args ...interface{}) error {
+	result, err := r.db.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return repository.ErrConflict
+	}
+
+	return nil
+}
+
 // ListActive returns active sessions for a project
 func (r *SessionRepository) ListActive(ctx context.Context, tenantID, projectID string) ([]session.SessionInfo, error) {
 	query := `
@@ -167,7 +255,7 @@ func (r *SessionRepository) ListActive(ctx context.Context, tenantID, projectID
 		ORDER BY last_activity DESC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, tenantID, projectID)
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, tenantID, projectID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list sessions: %w", err)
 	}
@@ -188,17 +276,103 @@ func (r *SessionRepository) ListActive(ctx context.Context, tenantID, projectID
 	return sessions, nil
 }
 
+// List returns a tenant's sessions matching opts, most recently active first
+func (r *SessionRepository) List(ctx context.Context, tenantID string, opts session.ListSessionsOptions) ([]session.Session, error) {
+	query := `
+		SELECT
+			id, tenant_id, project_id, status, parent_session,
+			last_sync_tick, created_at, last_activity, stale_at, closed_at
+		FROM sessions
+		WHERE tenant_id = ?
+	`
+	args := []interface{}{tenantID}
+	if opts.ProjectID != "" {
+		query += " AND project_id = ?"
+		args = append(args, opts.ProjectID)
+	}
+	if opts.Status != "" {
+		query += " AND status = ?"
+		args = append(args, opts.Status)
+	}
+	query += " ORDER BY last_activity DESC"
+	if opts.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, opts.Limit)
+	}
+
+	return r.querySessions(ctx, query, args...)
+}
+
+// ListOpen returns the active and stale sessions of every tenant
+func (r *SessionRepository) ListOpen(ctx context.Context) ([]session.Session, error) {
+	query := `
+		SELECT
+			id, tenant_id, project_id, status, parent_session,
+			last_sync_tick, created_at, last_activity, stale_at, closed_at
+		FROM sessions
+		WHERE status IN ('active', 'stale')
+		ORDER BY last_activity
+	`
+
+	return r.querySessions(ctx, query)
+}
+
+// querySessions runs a session query and scans its rows, without activations
+func (r *SessionRepository) querySessions(ctx context.Context, query string, args ...interface{}) ([]session.Session, error) {
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []session.Session
+	for rows.Next() {
+		var sess session.Session
+		var parentSession sql.NullString
+		var staleAt, closedAt sql.NullTime
+		if err := rows.Scan(
+			&sess.ID,
+			&sess.TenantID,
+			&sess.ProjectID,
+			&sess.Status,
+			&parentSession,
+			&sess.LastSyncTick,
+			&sess.CreatedAt,
+			&sess.LastActivity,
+			&staleAt,
+			&closedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		if parentSession.Valid {
+			sess.ParentSession = &parentSession.String
+		}
+		if staleAt.Valid {
+			sess.StaleAt = &staleAt.Time
+		}
+		if closedAt.Valid {
+			sess.ClosedAt = &closedAt.Time
+		}
+		sessions = append(sessions, sess)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
 // GetByRecordID returns active or stale sessions where a record is activated
 func (r *SessionRepository) GetByRecordID(ctx context.Context, tenantID, recordID string) ([]session.SessionInfo, error) {
 	query := `
-		SELECT s.id, s.created_at, s.last_activity, s.last_sync_tick
+		SELECT s.id, s.created_at, s.last_activity, s.last_sync_tick, s.status = 'stale'
 		FROM sessions s
 		JOIN session_activations sa ON sa.session_id = s.id
 		WHERE s.tenant_id = ? AND sa.record_id = ? AND s.status IN ('active', 'stale')
 		ORDER BY s.last_activity DESC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, tenantID, recordID)
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, tenantID, recordID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get sessions by record: %w", err)
 	}
@@ -207,7 +381,7 @@ func (r *SessionRepository) GetByRecordID(ctx context.Context, tenantID, recordI
 	var sessions []session.SessionInfo
 	for rows.Next() {
 		var info session.SessionInfo
-		if err := rows.Scan(&info.SessionID, &info.CreatedAt, &info.LastActivity, &info.LastSyncTick); err != nil {
+		if err := rows.Scan(&info.SessionID, &info.CreatedAt, &info.LastActivity, &info.LastSyncTick, &info.Stale); err != nil {
 			return nil, fmt.Errorf("failed to scan session info: %w", err)
 		}
 		sessions = append(sessions, info)
@@ -226,7 +400,7 @@ func (r *SessionRepository) AddActivation(ctx context.Context, sessionID, record
 		VALUES (?, ?, ?, ?)
 	`
 
-	_, err := r.db.ExecContext(ctx, query, sessionID, recordID, tick, time.Now())
+	_, err := r.db.conn(ctx).ExecContext(ctx, query, sessionID, recordID, tick, time.Now())
 	if err != nil {
 		if isForeignKeyViolation(err) {
 			return repository.ErrForeignKeyViolation
@@ -237,7 +411,7 @@ func (r *SessionRepository) AddActivation(ctx context.Context, sessionID, record
 				SET activation_tick = ?, activated_at = ?
 				WHERE session_id = ? AND record_id = ?
 			`
-			if _, updateErr := r.db.ExecContext(ctx, updateQuery, tick, time.Now(), sessionID, recordID); updateErr != nil {
+			if _, updateErr := r.db.conn(ctx).ExecContext(ctx, updateQuery, tick, time.Now(), sessionID, recordID); updateErr != nil {
 				return fmt.Errorf("failed to refresh activation: %w", updateErr)
 			}
 			return nil
@@ -248,6 +422,30 @@ func (r *SessionRepository) AddActivation(ctx context.Context, sessionID, record
 	return nil
 }
 
+// RemoveActivation releases a record from a session, dropping its context
+// tick with it
+func (r *SessionRepository) RemoveActivation(ctx context.Context, sessionID, recordID string) error {
+	query := `
+		DELETE FROM session_activations
+		WHERE session_id = ? AND record_id = ?
+	`
+
+	result, err := r.db.conn(ctx).ExecContext(ctx, query, sessionID, recordID)
+	if err != nil {
+		return fmt.Errorf("failed to remove activation: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return repository.ErrNotFound
+	}
+
+	return nil
+}
+
 // GetActivations returns all record IDs activated in a session
 func (r *SessionRepository) GetActivations(ctx context.Context, sessionID string) ([]string, error) {
 	query := `
@@ -257,7 +455,7 @@ func (r *SessionRepository) GetActivations(ctx context.Context, sessionID string
 		ORDER BY activated_at ASC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, sessionID)
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, sessionID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get activations: %w", err)
 	}
@@ -287,7 +485,7 @@ func (r *SessionRepository) GetActivationTick(ctx context.Context, sessionID, re
 	`
 
 	var tick int64
-	err := r.db.QueryRowContext(ctx, query, sessionID, recordID).Scan(&tick)
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, sessionID, recordID).Scan(&tick)
 	if err == sql.ErrNoRows {
 		return 0, repository.ErrNotFound
 	}
@@ -298,6 +496,50 @@ func (r *SessionRepository) GetActivationTick(ctx context.Context, sessionID, re
 	return tick, nil
 }
 
+// SetContextTick records the tick at which a session was sent a record's context bundle
+func (r *SessionRepository) SetContextTick(ctx context.Context, sessionID, recordID string, tick int64) error {
+	query := `
+		UPDATE session_activations
+		SET context_tick = ?
+		WHERE session_id = ? AND record_id = ?
+	`
+
+	result, err := r.db.conn(ctx).ExecContext(ctx, query, tick, sessionID, recordID)
+	if err != nil {
+		return fmt.Errorf("failed to set context tick: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return repository.ErrNotFound
+	}
+
+	return nil
+}
+
+// GetContextTick returns the tick at which a session was last sent a record's context bundle
+func (r *SessionRepository) GetContextTick(ctx context.Context, sessionID, recordID string) (int64, error) {
+	query := `
+		SELECT context_tick
+		FROM session_activations
+		WHERE session_id = ? AND record_id = ?
+	`
+
+	var tick sql.NullInt64
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, sessionID, recordID).Scan(&tick)
+	if err == sql.ErrNoRows || (err == nil && !tick.Valid) {
+		return 0, repository.ErrNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get context tick: %w", err)
+	}
+
+	return tick.Int64, nil
+}
+
 func (r *SessionRepository) getActivationsForTenant(ctx context.Context, tenantID, sessionID string) ([]string, error) {
 	query := `
 		SELECT sa.record_id
@@ -307,7 +549,7 @@ func (r *SessionRepository) getActivationsForTenant(ctx context.Context, tenantI
 		ORDER BY sa.activated_at ASC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, sessionID, tenantID)
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, sessionID, tenantID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get activations: %w", err)
 	}
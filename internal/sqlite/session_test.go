@@ -147,6 +147,43 @@ func TestSessionRepository_Activations(t *testing.T) {
 
 	_, err = repo.GetActivationTick(ctx, "s1", "missing")
 	require.Equal(t, repository.ErrNotFound, err)
+
+	require.NoError(t, repo.RemoveActivation(ctx, "s1", "r1"))
+	records, err = repo.GetActivations(ctx, "s1")
+	require.NoError(t, err)
+	require.Empty(t, records)
+	require.Equal(t, repository.ErrNotFound, repo.RemoveActivation(ctx, "s1", "r1"))
+}
+
+func TestSessionRepository_ContextTick(t *testing.T) {
+	db := NewTestDB(t)
+	ctx := context.Background()
+	insertProject(t, db, "p1", "tenant1")
+	insertRecord(t, db, "r1", "p1", "tenant1")
+
+	repo := NewSessionRepository(db)
+	now := time.Now()
+	sess := &session.Session{
+		ID:           "s1",
+		ProjectID:    "p1",
+		Status:       session.StatusActive,
+		LastSyncTick: 0,
+		CreatedAt:    now,
+		LastActivity: now,
+	}
+
+	require.NoError(t, repo.Create(ctx, "tenant1", sess))
+	require.Equal(t, repository.ErrNotFound, repo.SetContextTick(ctx, "s1", "r1", 1))
+
+	require.NoError(t, repo.AddActivation(ctx, "s1", "r1", 1))
+	_, err := repo.GetContextTick(ctx, "s1", "r1")
+	require.Equal(t, repository.ErrNotFound, err)
+
+	require.NoError(t, repo.SetContextTick(ctx, "s1", "r1", 3))
+	require.NoError(t, repo.AddActivation(ctx, "s1", "r1", 4))
+	tick, err := repo.GetContextTick(ctx, "s1", "r1")
+	require.NoError(t, err)
+	require.Equal(t, int64(3), tick)
 }
 
 func TestSessionRepository_TenantIsolation(t *testing.T) {
@@ -179,3 +216,142 @@ func insertRecord(t *testing.T, db *DB, id, projectID, tenantID string) {
 	)
 	require.NoError(t, err)
 }
+
+func TestSessionRepository_List(t *testing.T) {
+	db := NewTestDB(t)
+	ctx := context.Background()
+	insertProject(t, db, "p1", "tenant1")
+	insertProject(t, db, "p2", "tenant1")
+	insertProject(t, db, "p3", "tenant2")
+	insertRecord(t, db, "r1", "p1", "tenant1")
+
+	repo := NewSessionRepository(db)
+	now := time.Now()
+	for i, sess := range []session.Session{
+		{ID: "s1", ProjectID: "p1", Status: session.StatusActive},
+		{ID: "s2", ProjectID: "p1", Status: session.StatusStale},
+		{ID: "s3", ProjectID: "p1", Status: session.StatusClosed},
+		{ID: "s4", ProjectID: "p2", Status: session.StatusActive},
+	} {
+		sess.CreatedAt = now
+		sess.LastActivity = now.Add(-time.Duration(i) * time.Hour)
+		require.NoError(t, repo.Create(ctx, "tenant1", &sess))
+	}
+	require.NoError(t, repo.Create(ctx, "tenant2", &session.Session{
+		ID: "s5", ProjectID: "p3", Status: session.StatusActive, CreatedAt: now, LastActivity: now,
+	}))
+
+	ids := func(sessions []session.Session) []string {
+		out := make([]string, len(sessions))
+		for i, sess := range sessions {
+			out[i] = sess.ID
+		}
+		return out
+	}
+
+	all, err := repo.List(ctx, "tenant1", session.ListSessionsOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"s1", "s2", "s3", "s4"}, ids(all))
+
+	stale, err := repo.List(ctx, "tenant1", session.ListSessionsOptions{ProjectID: "p1", Status: session.StatusStale})
+	require.NoError(t, err)
+	require.Equal(t, []string{"s2"}, ids(stale))
+
+	limited, err := repo.List(ctx, "tenant1", session.ListSessionsOptions{ProjectID: "p1", Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{"s1", "s2"}, ids(limited))
+
+	open, err := repo.ListOpen(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"s1", "s2", "s4", "s5"}, ids(open))
+	for _, sess := range open {
+		require.NotEmpty(t, sess.TenantID)
+	}
+
+	require.NoError(t, repo.AddActivation(ctx, "s1", "r1", 1))
+	require.NoError(t, repo.AddActivation(ctx, "s2", "r1", 1))
+	infos, err := repo.GetByRecordID(ctx, "tenant1", "r1")
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	require.False(t, infos[0].Stale)
+	require.True(t, infos[1].Stale)
+}
+
+func TestSessionRepository_MarkStaleCloseStale(t *testing.T) {
+	db := NewTestDB(t)
+	ctx := context.Background()
+	insertProject(t, db, "p1", "tenant1")
+
+	repo := NewSessionRepository(db)
+	listed := time.Now().Add(-time.Hour)
+	require.NoError(t, repo.Create(ctx, "tenant1", &session.Session{
+		ID: "s1", ProjectID: "p1", Status: session.StatusActive, CreatedAt: listed, LastActivity: listed,
+	}))
+	loaded, err := repo.Get(ctx, "tenant1", "s1")
+	require.NoError(t, err)
+	require.Nil(t, loaded.StaleAt)
+
+	// Activity after the sweep read the session wins.
+	used := *loaded
+	used.LastActivity = time.Now()
+	require.NoError(t, repo.Update(ctx, "tenant1", &used))
+	require.Equal(t, repository.ErrConflict, repo.MarkStale(ctx, "tenant1", "s1", loaded.LastActivity, time.Now()))
+
+	loaded, err = repo.Get(ctx, "tenant1", "s1")
+	require.NoError(t, err)
+	staleAt := time.Now()
+	require.NoError(t, repo.MarkStale(ctx, "tenant1", "s1", loaded.LastActivity, staleAt))
+	require.Equal(t, repository.ErrConflict, repo.MarkStale(ctx, "tenant1", "s1", loaded.LastActivity, staleAt))
+
+	stale, err := repo.Get(ctx, "tenant1", "s1")
+	require.NoError(t, err)
+	require.Equal(t, session.StatusStale, stale.Status)
+	require.NotNil(t, stale.StaleAt)
+	require.WithinDuration(t, staleAt, *stale.StaleAt, time.Second)
+
+	require.Equal(t, repository.ErrConflict, repo.CloseStale(ctx, "tenant1", "s1", listed))
+	require.NoError(t, repo.CloseStale(ctx, "tenant1", "s1", stale.LastActivity))
+	closed, err := repo.Get(ctx, "tenant1", "s1")
+	require.NoError(t, err)
+	require.Equal(t, session.StatusClosed, closed.Status)
+	require.NotNil(t, closed.ClosedAt)
+	require.Equal(t, repository.ErrConflict, repo.CloseStale(ctx, "tenant1", "s1", stale.LastActivity))
+}
+
+func TestSessionRepository_Touch(t *testing.T) {
+	db := NewTestDB(t)
+	ctx := context.Background()
+	insertProject(t, db, "p1", "tenant1")
+
+	repo := NewSessionRepository(db)
+	then := time.Now().Add(-time.Hour)
+	staleAt := then
+	require.NoError(t, repo.Create(ctx, "tenant1", &session.Session{
+		ID: "s1", ProjectID: "p1", Status: session.StatusStale, LastSyncTick: 4,
+		CreatedAt: then, LastActivity: then, StaleAt: &staleAt,
+	}))
+
+	// The next tick is the session's own write, so it has seen it.
+	now := time.Now()
+	require.NoError(t, repo.Touch(ctx, "tenant1", "s1", 5, now))
+	sess, err := repo.Get(ctx, "tenant1", "s1")
+	require.NoError(t, err)
+	require.Equal(t, session.StatusActive, sess.Status)
+	require.Nil(t, sess.StaleAt)
+	require.Equal(t, int64(5), sess.LastSyncTick)
+	require.WithinDuration(t, now, sess.LastActivity, time.Second)
+
+	// Ticks it hasn't seen keep the sync tick where it is.
+	require.NoError(t, repo.Touch(ctx, "tenant1", "s1", 8, now))
+	require.NoError(t, repo.Touch(ctx, "tenant1", "s1", 0, now))
+	sess, err = repo.Get(ctx, "tenant1", "s1")
+	require.NoError(t, err)
+	require.Equal(t, int64(5), sess.LastSyncTick)
+
+	require.NoError(t, repo.Close(ctx, "tenant1", "s1"))
+	require.NoError(t, repo.Touch(ctx, "tenant1", "s1", 6, now))
+	sess, err = repo.Get(ctx, "tenant1", "s1")
+	require.NoError(t, err)
+	require.Equal(t, session.StatusClosed, sess.Status)
+	require.Equal(t, int64(5), sess.LastSyncTick)
+}
@@ -0,0 +1,164 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rpggio/trellis/internal/domain/record"
+	"github.com/rpggio/trellis/internal/repository"
+)
+
+// Tree returns the nodes of a record's subtree, or of a project's whole
+// tree, down to opts.Depth levels, parents before children and siblings
+// oldest first. Nodes come back flat: Record.ParentID links them. A node at
+// the depth limit carries the number of matching descendants below it.
+func (r *RecordRepository) Tree(ctx context.Context, tenantID string, opts record.TreeOptions) ([]record.TreeNode, error) {
+	stateFilter := ""
+	var stateArgs []interface{}
+	if len(opts.States) > 0 {
+		placeholders := make([]string, len(opts.States))
+		for i, state := range opts.States {
+			placeholders[i] = "?"
+			stateArgs = append(stateArgs, state)
+		}
+		stateFilter = fmt.Sprintf(" AND c.state IN (%s)", strings.Join(placeholders, ","))
+	}
+
+	// The walk covers the whole filtered tree so nodes at the depth limit
+	// can count what lies below them. anchor is the node at the limit
+	// that each deeper record hangs from.
+	var start string
+	var args []interface{}
+	if opts.RootID != "" {
+		start = `SELECT id, 0, CASE WHEN ? = 0 THEN id END FROM records
+			WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL`
+		args = append(args, opts.Depth, opts.RootID, tenantID)
+	} else {
+		start = `SELECT c.id, 1, CASE WHEN ? = 1 THEN c.id END FROM records c
+			WHERE c.project_id = ? AND c.tenant_id = ? AND c.parent_id IS NULL AND c.deleted_at IS NULL` + stateFilter
+		args = append(args, opts.Depth, opts.ProjectID, tenantID)
+		args = append(args, stateArgs...)
+	}
+	args = append(args, opts.Depth, tenantID)
+	args = append(args, stateArgs...)
+	args = append(args, tenantID, tenantID, opts.Depth)
+
+	query := `
+		WITH RECURSIVE tree(id, depth, anchor) AS (
+			` + start + `
+			UNION ALL
+			SELECT c.id, t.depth + 1, COALESCE(t.anchor, CASE WHEN t.depth + 1 = ? THEN c.id END)
+			FROM records c
+			JOIN tree t ON c.parent_id = t.id
+			WHERE c.tenant_id = ? AND c.deleted_at IS NULL` + stateFilter + `
+		)
+		SELECT
+			r.id, r.type, r.title, r.summary, r.state, r.parent_id, r.project_id, COALESCE(p.name, ''),
+			COALESCE(cc.children_count, 0), COALESCE(cc.open_children_count, 0),
+			COALESCE(d.descendants, 0)
+		FROM tree t
+		JOIN records r ON r.id = t.id
+		LEFT JOIN projects p ON p.id = r.project_id AND p.tenant_id = r.tenant_id
+		LEFT JOIN (
+			SELECT parent_id, COUNT(*) as children_count, SUM(state = 'OPEN') as open_children_count
+			FROM records
+			WHERE tenant_id = ? AND deleted_at IS NULL AND parent_id IN (SELECT id FROM tree)
+			GROUP BY parent_id
+		) cc ON cc.parent_id = t.id
+		LEFT JOIN (
+			SELECT anchor, COUNT(*) - 1 as descendants FROM tree WHERE anchor IS NOT NULL GROUP BY anchor
+		) d ON d.anchor = t.id
+		WHERE r.tenant_id = ? AND t.depth <= ?
+		ORDER BY t.depth ASC, r.created_at ASC, r.id ASC
+	`
+
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get record tree: %w", err)
+	}
+	defer rows.Close()
+
+	var nodes []record.TreeNode
+	for rows.Next() {
+		var node record.TreeNode
+		err := rows.Scan(
+			&node.Record.ID,
+			&node.Record.Type,
+			&node.Record.Title,
+			&node.Record.Summary,
+			&node.Record.State,
+			&node.Record.ParentID,
+			&node.Record.ProjectID,
+			&node.Record.ProjectName,
+			&node.Record.ChildrenCount,
+			&node.Record.OpenChildrenCount,
+			&node.Descendants,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan tree node: %w", err)
+		}
+		nodes = append(nodes, node)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating tree rows: %w", err)
+	}
+
+	if opts.RootID != "" && len(nodes) == 0 {
+		return nil, repository.ErrNotFound
+	}
+	return nodes, nil
+}
+
+// Ancestors returns the path from the root down to the parent of each of
+// the given records, keyed by record ID. Root records have no entry.
+func (r *RecordRepository) Ancestors(ctx context.Context, tenantID string, ids []string) (map[string][]record.Ancestor, error) {
+	paths := make(map[string][]record.Ancestor)
+	if len(ids) == 0 {
+		return paths, nil
+	}
+
+	placeholders := make([]string, len(ids))
+	args := []interface{}{tenantID}
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args = append(args, id)
+	}
+	args = append(args, tenantID, tenantID)
+
+	query := `
+		WITH RECURSIVE path(record_id, id, depth) AS (
+			SELECT r.id, r.parent_id, 1 FROM records r
+			WHERE r.tenant_id = ? AND r.id IN (` + strings.Join(placeholders, ",") + `) AND r.parent_id IS NOT NULL
+			UNION ALL
+			SELECT p.record_id, a.parent_id, p.depth + 1
+			FROM path p
+			JOIN records a ON a.id = p.id
+			WHERE a.tenant_id = ? AND a.parent_id IS NOT NULL
+		)
+		SELECT p.record_id, a.id, a.title, a.type, a.state
+		FROM path p
+		JOIN records a ON a.id = p.id
+		WHERE a.tenant_id = ?
+		ORDER BY p.record_id, p.depth DESC
+	`
+
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ancestors: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var recordID string
+		var ancestor record.Ancestor
+		if err := rows.Scan(&recordID, &ancestor.ID, &ancestor.Title, &ancestor.Type, &ancestor.State); err != nil {
+			return nil, fmt.Errorf("failed to scan ancestor: %w", err)
+		}
+		paths[recordID] = append(paths[recordID], ancestor)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating ancestor rows: %w", err)
+	}
+	return paths, nil
+}
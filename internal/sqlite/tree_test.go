@@ -0,0 +1,108 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rpggio/trellis/internal/domain/record"
+	"github.com/rpggio/trellis/internal/repository"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordRepository_Tree(t *testing.T) {
+	db := NewTestDB(t)
+	ctx := context.Background()
+	insertProject(t, db, "p1", "tenant1")
+
+	repo := NewRecordRepository(db)
+	start := time.Now()
+	records := []struct {
+		id, parent string
+		state      record.RecordState
+	}{
+		{"a", "", record.StateOpen},
+		{"b", "a", record.StateOpen},
+		{"c", "a", record.StateResolved},
+		{"d", "b", record.StateOpen},
+		{"e", "d", record.StateOpen},
+		{"f", "", record.StateResolved},
+	}
+	for i, rec := range records {
+		var parentID *string
+		if rec.parent != "" {
+			parentID = stringPtr(rec.parent)
+		}
+		at := start.Add(time.Duration(i) * time.Second)
+		require.NoError(t, repo.Create(ctx, "tenant1", &record.Record{
+			ID: rec.id, ProjectID: "p1", ParentID: parentID, Type: "question", Title: rec.id,
+			Summary: "S", Body: "B", State: rec.state, CreatedAt: at, ModifiedAt: at, Tick: int64(i + 1),
+		}))
+	}
+
+	type row struct {
+		id          string
+		descendants int
+	}
+	rows := func(nodes []record.TreeNode) []row {
+		var out []row
+		for _, node := range nodes {
+			out = append(out, row{node.Record.ID, node.Descendants})
+		}
+		return out
+	}
+
+	nodes, err := repo.Tree(ctx, "tenant1", record.TreeOptions{ProjectID: "p1", Depth: 1})
+	require.NoError(t, err)
+	require.Equal(t, []row{{"a", 4}, {"f", 0}}, rows(nodes))
+	require.Equal(t, 2, nodes[0].Record.ChildrenCount)
+	require.Equal(t, 1, nodes[0].Record.OpenChildrenCount)
+	require.Equal(t, "Project", nodes[0].Record.ProjectName)
+
+	nodes, err = repo.Tree(ctx, "tenant1", record.TreeOptions{RootID: "a", Depth: 2})
+	require.NoError(t, err)
+	require.Equal(t, []row{{"a", 0}, {"b", 0}, {"c", 0}, {"d", 1}}, rows(nodes))
+
+	// A filtered out record takes its subtree with it.
+	nodes, err = repo.Tree(ctx, "tenant1", record.TreeOptions{ProjectID: "p1", Depth: 10, States: []record.RecordState{record.StateOpen}})
+	require.NoError(t, err)
+	require.Equal(t, []row{{"a", 0}, {"b", 0}, {"d", 0}, {"e", 0}}, rows(nodes))
+
+	_, err = repo.Tree(ctx, "tenant1", record.TreeOptions{RootID: "missing", Depth: 1})
+	require.Equal(t, repository.ErrNotFound, err)
+	_, err = repo.Tree(ctx, "tenant2", record.TreeOptions{RootID: "a", Depth: 1})
+	require.Equal(t, repository.ErrNotFound, err)
+}
+
+func TestRecordRepository_Ancestors(t *testing.T) {
+	db := NewTestDB(t)
+	ctx := context.Background()
+	insertProject(t, db, "p1", "tenant1")
+
+	repo := NewRecordRepository(db)
+	now := time.Now()
+	for _, rec := range []struct{ id, parent string }{{"a", ""}, {"b", "a"}, {"c", "b"}, {"d", "a"}} {
+		var parentID *string
+		if rec.parent != "" {
+			parentID = stringPtr(rec.parent)
+		}
+		require.NoError(t, repo.Create(ctx, "tenant1", &record.Record{
+			ID: rec.id, ProjectID: "p1", ParentID: parentID, Type: "question", Title: "T" + rec.id,
+			Summary: "S", Body: "B", State: record.StateOpen, CreatedAt: now, ModifiedAt: now, Tick: 1,
+		}))
+	}
+
+	paths, err := repo.Ancestors(ctx, "tenant1", []string{"a", "c", "d"})
+	require.NoError(t, err)
+	require.Equal(t, map[string][]record.Ancestor{
+		"c": {
+			{ID: "a", Title: "Ta", Type: "question", State: record.StateOpen},
+			{ID: "b", Title: "Tb", Type: "question", State: record.StateOpen},
+		},
+		"d": {{ID: "a", Title: "Ta", Type: "question", State: record.StateOpen}},
+	}, paths)
+
+	paths, err = repo.Ancestors(ctx, "tenant2", []string{"c"})
+	require.NoError(t, err)
+	require.Empty(t, paths)
+}
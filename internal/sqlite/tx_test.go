@@ -0,0 +1,64 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithinTx_CommitAndRollback(t *testing.T) {
+	db := NewTestDB(t)
+	repo := NewProjectRepository(db)
+	ctx := context.Background()
+	insertProject(t, db, "p1", "tenant1")
+
+	err := db.WithinTx(ctx, func(ctx context.Context) error {
+		_, err := repo.IncrementTick(ctx, "tenant1", "p1")
+		return err
+	})
+	require.NoError(t, err)
+
+	failure := errors.New("boom")
+	err = db.WithinTx(ctx, func(ctx context.Context) error {
+		tick, err := repo.IncrementTick(ctx, "tenant1", "p1")
+		require.NoError(t, err)
+		require.Equal(t, int64(2), tick)
+		return failure
+	})
+	require.ErrorIs(t, err, failure)
+
+	require.Equal(t, int64(1), projectTick(t, ctx, db, "p1"))
+}
+
+func TestWithinTx_NestedJoinsOuter(t *testing.T) {
+	db := NewTestDB(t)
+	repo := NewProjectRepository(db)
+	ctx := context.Background()
+	insertProject(t, db, "p1", "tenant1")
+
+	failure := errors.New("boom")
+	err := db.WithinTx(ctx, func(ctx context.Context) error {
+		err := db.WithinTx(ctx, func(ctx context.Context) error {
+			_, err := repo.IncrementTick(ctx, "tenant1", "p1")
+			return err
+		})
+		require.NoError(t, err)
+
+		// Reads inside the transaction see the uncommitted write.
+		require.Equal(t, int64(1), projectTick(t, ctx, db, "p1"))
+		return failure
+	})
+	require.ErrorIs(t, err, failure)
+
+	require.Equal(t, int64(0), projectTick(t, ctx, db, "p1"))
+}
+
+func projectTick(t *testing.T, ctx context.Context, db *DB, id string) int64 {
+	t.Helper()
+	var tick int64
+	err := db.conn(ctx).QueryRowContext(ctx, `SELECT tick FROM projects WHERE id = ?`, id).Scan(&tick)
+	require.NoError(t, err)
+	return tick
+}
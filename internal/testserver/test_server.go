@@ -15,6 +15,7 @@ import (
 	"github.com/rpggio/trellis/internal/domain/project"
 	"github.com/rpggio/trellis/internal/domain/record"
 	"github.com/rpggio/trellis/internal/domain/session"
+	"github.com/rpggio/trellis/internal/embedding"
 	"github.com/rpggio/trellis/internal/mcp"
 	"github.com/rpggio/trellis/internal/sqlite"
 	"github.com/stretchr/testify/require"
@@ -53,12 +54,12 @@ func NewWithTransport(t *testing.T, token, tenantID string, mode TransportMode)
 	recordRepo := sqlite.NewRecordRepository(db)
 	sessionRepo := sqlite.NewSessionRepository(db)
 	activityRepo := sqlite.NewActivityRepository(db)
-	searchRepo := sqlite.NewSearchRepository(db)
+	searchRepo := sqlite.NewSearchRepository(db, sqlite.DefaultSearchWeights)
 
 	projectSvc := project.NewService(projectRepo, nil)
 	activitySvc := activity.NewService(activityRepo, nil)
-	recordSvc := record.NewService(recordRepo, sessionRepo, projectRepo, activityRepo, searchRepo, nil)
-	sessionSvc := session.NewService(recordRepo, sessionRepo, projectRepo, nil)
+	recordSvc := record.NewService(recordRepo, sessionRepo, projectRepo, activityRepo, searchRepo, embedding.NewHashEmbedder(0), db, nil)
+	sessionSvc := session.NewService(recordRepo, sessionRepo, projectRepo, activityRepo, nil)
 
 	// Create MCP server with SDK
 	resolver := &apiKeyResolver{db: db}
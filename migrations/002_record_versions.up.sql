@@ -0,0 +1,18 @@
+-- Record versions (snapshot of a record before each write)
+CREATE TABLE IF NOT EXISTS record_versions (
+    record_id TEXT NOT NULL,
+    tenant_id TEXT NOT NULL,
+    tick INTEGER NOT NULL,
+    type TEXT NOT NULL,
+    title TEXT NOT NULL,
+    summary TEXT NOT NULL,
+    body TEXT NOT NULL,
+    state TEXT NOT NULL,
+    parent_id TEXT,
+    resolved_by TEXT,
+    modified_at TIMESTAMP,
+    archived_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (record_id, tick),
+    FOREIGN KEY (record_id) REFERENCES records(id)
+);
+CREATE INDEX IF NOT EXISTS idx_tenant_record_versions ON record_versions(tenant_id);
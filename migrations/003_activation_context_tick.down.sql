@@ -0,0 +1 @@
+ALTER TABLE session_activations DROP COLUMN context_tick;
@@ -0,0 +1,2 @@
+-- Project tick at which a session was last sent the context bundle for a record
+ALTER TABLE session_activations ADD COLUMN context_tick INTEGER;
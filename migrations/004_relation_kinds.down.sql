@@ -0,0 +1,13 @@
+DROP INDEX IF EXISTS idx_relations_to;
+CREATE TABLE record_relations_untyped (
+    from_record_id TEXT NOT NULL,
+    to_record_id TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (from_record_id, to_record_id),
+    FOREIGN KEY (from_record_id) REFERENCES records(id),
+    FOREIGN KEY (to_record_id) REFERENCES records(id)
+);
+INSERT OR IGNORE INTO record_relations_untyped (from_record_id, to_record_id, created_at)
+    SELECT from_record_id, to_record_id, created_at FROM record_relations;
+DROP TABLE record_relations;
+ALTER TABLE record_relations_untyped RENAME TO record_relations;
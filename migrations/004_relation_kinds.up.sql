@@ -0,0 +1,15 @@
+-- Typed record relations; a pair of records may be linked once per kind
+CREATE TABLE record_relations_typed (
+    from_record_id TEXT NOT NULL,
+    to_record_id TEXT NOT NULL,
+    kind TEXT NOT NULL DEFAULT 'relates',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (from_record_id, to_record_id, kind),
+    FOREIGN KEY (from_record_id) REFERENCES records(id),
+    FOREIGN KEY (to_record_id) REFERENCES records(id)
+);
+INSERT INTO record_relations_typed (from_record_id, to_record_id, created_at)
+    SELECT from_record_id, to_record_id, created_at FROM record_relations;
+DROP TABLE record_relations;
+ALTER TABLE record_relations_typed RENAME TO record_relations;
+CREATE INDEX IF NOT EXISTS idx_relations_to ON record_relations(to_record_id);
@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS records_ad;
+CREATE TRIGGER records_ad AFTER DELETE ON records BEGIN
+    DELETE FROM records_fts WHERE rowid = old.rowid;
+END;
+
+DROP INDEX IF EXISTS idx_deleted_root;
+ALTER TABLE records DROP COLUMN deleted_root;
+ALTER TABLE records DROP COLUMN deleted_at;
@@ -0,0 +1,13 @@
+-- Soft deletion: deleted_root is the record whose deletion trashed this one,
+-- so a subtree is restored as a unit
+ALTER TABLE records ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE records ADD COLUMN deleted_root TEXT;
+CREATE INDEX IF NOT EXISTS idx_deleted_root ON records(deleted_root);
+
+-- Remove index entries using the old values; the content row is gone by the
+-- time an AFTER DELETE trigger runs
+DROP TRIGGER IF EXISTS records_ad;
+CREATE TRIGGER records_ad AFTER DELETE ON records BEGIN
+    INSERT INTO records_fts(records_fts, rowid, title, summary, body)
+    VALUES('delete', old.rowid, old.title, old.summary, old.body);
+END;
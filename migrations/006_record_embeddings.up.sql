@@ -0,0 +1,13 @@
+-- Embedding vectors for semantic search, one per record and embedding model.
+-- content_hash identifies the text that was embedded so unchanged records
+-- are not embedded again.
+CREATE TABLE IF NOT EXISTS record_embeddings (
+    record_id TEXT NOT NULL,
+    model TEXT NOT NULL,
+    content_hash TEXT NOT NULL,
+    dimensions INTEGER NOT NULL,
+    vector BLOB NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (record_id, model),
+    FOREIGN KEY (record_id) REFERENCES records(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+-- Default activation policy of a project, as JSON; NULL uses the built-in policy
+ALTER TABLE projects ADD COLUMN activation_policy TEXT;
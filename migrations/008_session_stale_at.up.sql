@@ -0,0 +1,8 @@
+-- The sweeper matches last_activity exactly, so drop the monotonic clock
+-- reading older versions stored with it
+UPDATE sessions SET last_activity = substr(last_activity, 1, instr(last_activity, ' m=') - 1)
+WHERE instr(last_activity, ' m=') > 0;
+
+-- When the sweeper marked a session stale; NULL while the session is active
+ALTER TABLE sessions ADD COLUMN stale_at TIMESTAMP;
+UPDATE sessions SET stale_at = last_activity WHERE status = 'stale';
@@ -292,7 +292,7 @@ func TestStdioFunctional_HistoryAndActivity(t *testing.T) {
 
 	diff := s.callTool(t, "get_record_diff", map[string]any{
 		"id":   root.Record.ID,
-		"from": "last_save",
+		"from": "previous",
 	})
 	require.NotEmpty(t, diff)
 
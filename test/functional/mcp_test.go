@@ -2,11 +2,16 @@ package functional_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/rpggio/trellis/internal/domain/session"
+	"github.com/rpggio/trellis/internal/sqlite"
 	"github.com/rpggio/trellis/internal/testserver"
 	"github.com/stretchr/testify/require"
 )
@@ -107,6 +112,28 @@ func callTool(t *testing.T, ts *testserver.TestServer, sessionID, toolName strin
 	return json.RawMessage(toolResult.Content[0].Text)
 }
 
+// callToolError makes a tools/call RPC call that must fail and returns the error text
+func callToolError(t *testing.T, ts *testserver.TestServer, sessionID, toolName string, args any) string {
+	t.Helper()
+
+	resp := rpcCall(t, ts, sessionID, "tools/call", map[string]any{
+		"name":      toolName,
+		"arguments": args,
+	})
+	require.Nil(t, resp.Error, "RPC error: %v", resp.Error)
+
+	var toolResult struct {
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+		IsError bool `json:"isError"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Result, &toolResult))
+	require.True(t, toolResult.IsError, "expected %s to fail", toolName)
+	require.NotEmpty(t, toolResult.Content)
+	return toolResult.Content[0].Text
+}
+
 func TestFunctional_Authentication(t *testing.T) {
 	ts := testserver.New(t, "token", "tenant1")
 
@@ -256,8 +283,23 @@ func TestFunctional_ConflictAndActiveSessions(t *testing.T) {
 	}
 	require.NoError(t, json.Unmarshal(s2, &sess2))
 
-	update1 := callTool(t, ts, sess1.SessionID, "update_record", map[string]any{"id": root.Record.ID, "title": "A"})
-	require.NotEmpty(t, update1)
+	blocked := callTool(t, ts, sess1.SessionID, "update_record", map[string]any{"id": root.Record.ID, "title": "A"})
+	var blockedResp struct {
+		Conflict *struct {
+			ConflictType string `json:"conflict_type"`
+			Sessions     []struct {
+				SessionID string `json:"session_id"`
+			} `json:"sessions"`
+		} `json:"conflict"`
+	}
+	require.NoError(t, json.Unmarshal(blocked, &blockedResp))
+	require.NotNil(t, blockedResp.Conflict)
+	require.Equal(t, "concurrent_session", blockedResp.Conflict.ConflictType)
+	require.Len(t, blockedResp.Conflict.Sessions, 1)
+	require.Equal(t, sess2.SessionID, blockedResp.Conflict.Sessions[0].SessionID)
+
+	update1 := callTool(t, ts, sess1.SessionID, "update_record", map[string]any{"id": root.Record.ID, "title": "A", "override": true})
+	require.Contains(t, string(update1), `"record"`)
 
 	update2 := callTool(t, ts, sess2.SessionID, "update_record", map[string]any{"id": root.Record.ID, "title": "B"})
 	require.Contains(t, string(update2), "conflict")
@@ -266,6 +308,129 @@ func TestFunctional_ConflictAndActiveSessions(t *testing.T) {
 	require.NotEmpty(t, activeSessions)
 }
 
+func TestFunctional_ResolveConflict(t *testing.T) {
+	ts := testserver.New(t, "token", "tenant1")
+	initializeSession(t, ts)
+
+	rootResp := callTool(t, ts, "", "create_record", map[string]any{
+		"type":    "question",
+		"title":   "Root",
+		"summary": "Root summary",
+		"body":    "intro\nplan: A\noutro",
+	})
+	var root struct {
+		Record struct {
+			ID string `json:"id"`
+		} `json:"record"`
+	}
+	require.NoError(t, json.Unmarshal(rootResp, &root))
+
+	s1 := callTool(t, ts, "", "activate", map[string]any{"id": root.Record.ID})
+	var sess1 struct {
+		SessionID string `json:"session_id"`
+	}
+	require.NoError(t, json.Unmarshal(s1, &sess1))
+
+	s2 := callTool(t, ts, "", "activate", map[string]any{"id": root.Record.ID})
+	var sess2 struct {
+		SessionID string `json:"session_id"`
+	}
+	require.NoError(t, json.Unmarshal(s2, &sess2))
+
+	_ = callTool(t, ts, sess2.SessionID, "update_record", map[string]any{"id": root.Record.ID, "title": "Remote title", "override": true})
+	_ = callTool(t, ts, sess2.SessionID, "close_session", map[string]any{})
+
+	conflictResp := callTool(t, ts, sess1.SessionID, "update_record", map[string]any{"id": root.Record.ID, "body": "intro\nplan: B\noutro"})
+	var conflicted struct {
+		Conflict *struct {
+			ConflictType string `json:"conflict_type"`
+			Merge        *struct {
+				RemoteTick int64    `json:"remote_tick"`
+				Title      string   `json:"title"`
+				Summary    string   `json:"summary"`
+				Body       string   `json:"body"`
+				Conflicts  []string `json:"conflicts"`
+			} `json:"merge"`
+		} `json:"conflict"`
+	}
+	require.NoError(t, json.Unmarshal(conflictResp, &conflicted))
+	require.NotNil(t, conflicted.Conflict)
+	require.Equal(t, "update", conflicted.Conflict.ConflictType)
+	merge := conflicted.Conflict.Merge
+	require.NotNil(t, merge)
+	require.Empty(t, merge.Conflicts)
+	require.Equal(t, "Remote title", merge.Title)
+	require.Equal(t, "intro\nplan: B\noutro", merge.Body)
+
+	resolvedResp := callTool(t, ts, sess1.SessionID, "resolve_conflict", map[string]any{
+		"id":          root.Record.ID,
+		"remote_tick": merge.RemoteTick,
+		"title":       merge.Title,
+		"summary":     merge.Summary,
+		"body":        merge.Body,
+	})
+	var resolved struct {
+		Record *struct {
+			Title string `json:"title"`
+			Body  string `json:"body"`
+		} `json:"record"`
+	}
+	require.NoError(t, json.Unmarshal(resolvedResp, &resolved))
+	require.NotNil(t, resolved.Record)
+	require.Equal(t, "Remote title", resolved.Record.Title)
+	require.Equal(t, "intro\nplan: B\noutro", resolved.Record.Body)
+
+	history := callTool(t, ts, "", "get_record_history", map[string]any{"id": root.Record.ID})
+	require.Contains(t, string(history), "conflict_resolved")
+}
+
+func TestFunctional_MergeBaseFollowsOwnWrites(t *testing.T) {
+	ts := testserver.New(t, "token", "tenant1")
+	initializeSession(t, ts)
+
+	var root struct {
+		Record struct {
+			ID string `json:"id"`
+		} `json:"record"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "create_record", map[string]any{
+		"type": "question", "title": "Root", "summary": "S", "body": "one",
+	}), &root))
+	var sess1, sess2 struct {
+		SessionID string `json:"session_id"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "activate", map[string]any{"id": root.Record.ID}), &sess1))
+
+	// Writes elsewhere in the project and the session's own writes don't
+	// count as remote changes.
+	_ = callTool(t, ts, "", "create_record", map[string]any{"type": "note", "title": "Other", "summary": "S", "body": "B"})
+	type updated struct {
+		Record *struct {
+			Tick int64 `json:"tick"`
+		} `json:"record"`
+		Conflict *struct {
+			BaseVersion *struct {
+				Body string `json:"body"`
+			} `json:"base_version"`
+		} `json:"conflict"`
+	}
+	for _, body := range []string{"two", "three"} {
+		var resp updated
+		require.NoError(t, json.Unmarshal(callTool(t, ts, sess1.SessionID, "update_record", map[string]any{"id": root.Record.ID, "body": body}), &resp))
+		require.Nil(t, resp.Conflict)
+		require.NotNil(t, resp.Record)
+	}
+
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "activate", map[string]any{"id": root.Record.ID}), &sess2))
+	_ = callTool(t, ts, sess2.SessionID, "update_record", map[string]any{"id": root.Record.ID, "title": "Remote", "override": true})
+
+	var resp updated
+	require.NoError(t, json.Unmarshal(callTool(t, ts, sess1.SessionID, "update_record", map[string]any{"id": root.Record.ID, "body": "four", "override": true}), &resp))
+	require.NotNil(t, resp.Conflict)
+	require.NotNil(t, resp.Conflict.BaseVersion)
+	require.Equal(t, "three", resp.Conflict.BaseVersion.Body)
+}
+
 func TestFunctional_ContextLoadingAndSearch(t *testing.T) {
 	ts := testserver.New(t, "token", "tenant1")
 	initializeSession(t, ts)
@@ -325,6 +490,155 @@ func TestFunctional_ContextLoadingAndSearch(t *testing.T) {
 
 	search := callTool(t, ts, "", "search_records", map[string]any{"query": "Target"})
 	require.NotEmpty(t, search)
+
+	var filtered struct {
+		Results []struct {
+			Record struct {
+				Title string `json:"title"`
+			} `json:"record"`
+		} `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "search_records", map[string]any{
+		"query": "type:note state:resolved child -open",
+	}), &filtered))
+	require.Len(t, filtered.Results, 1)
+	require.Equal(t, "Resolved child", filtered.Results[0].Record.Title)
+
+	errText := callToolError(t, ts, "", "search_records", map[string]any{"query": `state:pending "child`})
+	require.Contains(t, errText, "INVALID_QUERY")
+	require.Contains(t, errText, `unknown state "pending"`)
+}
+
+func TestFunctional_ReactivationOmitsUnchanged(t *testing.T) {
+	ts := testserver.New(t, "token", "tenant1")
+	initializeSession(t, ts)
+
+	rootResp := callTool(t, ts, "", "create_record", map[string]any{
+		"type":    "question",
+		"title":   "Root",
+		"summary": "Root summary",
+		"body":    "Root body",
+	})
+	var root struct {
+		Record struct {
+			ID string `json:"id"`
+		} `json:"record"`
+	}
+	require.NoError(t, json.Unmarshal(rootResp, &root))
+
+	activation := callTool(t, ts, "", "activate", map[string]any{"id": root.Record.ID})
+	var sess struct {
+		SessionID string `json:"session_id"`
+	}
+	require.NoError(t, json.Unmarshal(activation, &sess))
+
+	callTool(t, ts, sess.SessionID, "create_record", map[string]any{
+		"parent_id": root.Record.ID,
+		"type":      "note",
+		"title":     "Child",
+		"summary":   "Child summary",
+		"body":      "Child body",
+	})
+
+	type bundle struct {
+		Context struct {
+			Target *struct {
+				ID string `json:"id"`
+			} `json:"target"`
+			OpenChildren []struct {
+				Title string `json:"title"`
+			} `json:"open_children"`
+			Unchanged []struct {
+				ID        string `json:"id"`
+				Unchanged bool   `json:"unchanged"`
+			} `json:"unchanged"`
+		} `json:"context"`
+	}
+
+	var second bundle
+	require.NoError(t, json.Unmarshal(callTool(t, ts, sess.SessionID, "activate", map[string]any{"id": root.Record.ID}), &second))
+	require.Nil(t, second.Context.Target)
+	require.Len(t, second.Context.OpenChildren, 1)
+	require.Len(t, second.Context.Unchanged, 1)
+	require.Equal(t, root.Record.ID, second.Context.Unchanged[0].ID)
+	require.True(t, second.Context.Unchanged[0].Unchanged)
+
+	var third bundle
+	require.NoError(t, json.Unmarshal(callTool(t, ts, sess.SessionID, "activate", map[string]any{"id": root.Record.ID}), &third))
+	require.Empty(t, third.Context.OpenChildren)
+	require.Len(t, third.Context.Unchanged, 2)
+
+	var full bundle
+	require.NoError(t, json.Unmarshal(callTool(t, ts, sess.SessionID, "activate", map[string]any{"id": root.Record.ID, "full": true}), &full))
+	require.NotNil(t, full.Context.Target)
+	require.Len(t, full.Context.OpenChildren, 1)
+	require.Empty(t, full.Context.Unchanged)
+}
+
+func TestFunctional_SyncSessionChanges(t *testing.T) {
+	ts := testserver.New(t, "token", "tenant1")
+	initializeSession(t, ts)
+
+	rootResp := callTool(t, ts, "", "create_record", map[string]any{
+		"type":    "question",
+		"title":   "Root",
+		"summary": "Root summary",
+		"body":    "Root body",
+	})
+	var root struct {
+		Record struct {
+			ID string `json:"id"`
+		} `json:"record"`
+	}
+	require.NoError(t, json.Unmarshal(rootResp, &root))
+
+	otherResp := callTool(t, ts, "", "create_record", map[string]any{
+		"type":    "question",
+		"title":   "Other",
+		"summary": "Other summary",
+		"body":    "Other body",
+	})
+	var other struct {
+		Record struct {
+			ID string `json:"id"`
+		} `json:"record"`
+	}
+	require.NoError(t, json.Unmarshal(otherResp, &other))
+
+	s1 := callTool(t, ts, "", "activate", map[string]any{"id": root.Record.ID})
+	var sess1 struct {
+		SessionID string `json:"session_id"`
+	}
+	require.NoError(t, json.Unmarshal(s1, &sess1))
+
+	s2 := callTool(t, ts, "", "activate", map[string]any{"id": other.Record.ID})
+	var sess2 struct {
+		SessionID string `json:"session_id"`
+	}
+	require.NoError(t, json.Unmarshal(s2, &sess2))
+
+	callTool(t, ts, sess2.SessionID, "update_record", map[string]any{"id": other.Record.ID, "title": "Other v2"})
+	callTool(t, ts, sess2.SessionID, "update_record", map[string]any{"id": other.Record.ID, "title": "Other v3"})
+
+	syncResp := callTool(t, ts, "", "sync_session", map[string]any{"session_id": sess1.SessionID})
+	var sync struct {
+		Staleness int64 `json:"staleness"`
+		Changes   []struct {
+			Type   string `json:"type"`
+			Record struct {
+				ID    string `json:"id"`
+				Title string `json:"title"`
+			} `json:"record"`
+			Activated bool `json:"activated"`
+		} `json:"changes"`
+	}
+	require.NoError(t, json.Unmarshal(syncResp, &sync))
+	require.Equal(t, int64(2), sync.Staleness)
+	require.Len(t, sync.Changes, 1)
+	require.Equal(t, "updated", sync.Changes[0].Type)
+	require.Equal(t, other.Record.ID, sync.Changes[0].Record.ID)
+	require.Equal(t, "Other v3", sync.Changes[0].Record.Title)
+	require.False(t, sync.Changes[0].Activated)
 }
 
 func TestFunctional_HistoryDiffAndActivity(t *testing.T) {
@@ -355,13 +669,473 @@ func TestFunctional_HistoryDiffAndActivity(t *testing.T) {
 	history := callTool(t, ts, "", "get_record_history", map[string]any{"id": root.Record.ID})
 	require.NotEmpty(t, history)
 
-	diff := callTool(t, ts, "", "get_record_diff", map[string]any{"id": root.Record.ID, "from": "last_save"})
-	require.NotEmpty(t, diff)
+	diffResp := callTool(t, ts, "", "get_record_diff", map[string]any{"id": root.Record.ID, "from": "previous"})
+	var diff struct {
+		FromVersion struct {
+			Title string `json:"title"`
+		} `json:"from_version"`
+		Diff struct {
+			Title *struct {
+				Old string `json:"old"`
+				New string `json:"new"`
+			} `json:"title"`
+		} `json:"diff"`
+	}
+	require.NoError(t, json.Unmarshal(diffResp, &diff))
+	require.Equal(t, "Root", diff.FromVersion.Title)
+	require.NotNil(t, diff.Diff.Title)
+	require.Equal(t, "New", diff.Diff.Title.New)
 
 	activityResp := callTool(t, ts, "", "get_recent_activity", map[string]any{})
 	require.NotEmpty(t, activityResp)
 }
 
+func TestFunctional_RevertRecord(t *testing.T) {
+	ts := testserver.New(t, "token", "tenant1")
+	initializeSession(t, ts)
+
+	rootResp := callTool(t, ts, "", "create_record", map[string]any{
+		"type":    "question",
+		"title":   "Root",
+		"summary": "Root summary",
+		"body":    "Careful body",
+	})
+	var root struct {
+		Record struct {
+			ID   string `json:"id"`
+			Tick int64  `json:"tick"`
+		} `json:"record"`
+	}
+	require.NoError(t, json.Unmarshal(rootResp, &root))
+
+	activation := callTool(t, ts, "", "activate", map[string]any{"id": root.Record.ID})
+	var sess struct {
+		SessionID string `json:"session_id"`
+	}
+	require.NoError(t, json.Unmarshal(activation, &sess))
+
+	_ = callTool(t, ts, sess.SessionID, "update_record", map[string]any{"id": root.Record.ID, "body": "Sloppy body"})
+	_ = callTool(t, ts, sess.SessionID, "activate", map[string]any{"id": root.Record.ID})
+
+	revertResp := callTool(t, ts, sess.SessionID, "revert_record", map[string]any{"id": root.Record.ID, "tick": root.Record.Tick})
+	var reverted struct {
+		Record *struct {
+			Body string `json:"body"`
+			Tick int64  `json:"tick"`
+		} `json:"record"`
+	}
+	require.NoError(t, json.Unmarshal(revertResp, &reverted))
+	require.NotNil(t, reverted.Record)
+	require.Equal(t, "Careful body", reverted.Record.Body)
+	require.Greater(t, reverted.Record.Tick, root.Record.Tick+1)
+
+	history := callTool(t, ts, "", "get_record_history", map[string]any{"id": root.Record.ID})
+	require.Contains(t, string(history), "record_reverted")
+}
+
+func TestFunctional_LinkRecords(t *testing.T) {
+	ts := testserver.New(t, "token", "tenant1")
+	initializeSession(t, ts)
+
+	aResp := callTool(t, ts, "", "create_record", map[string]any{
+		"type":    "question",
+		"title":   "A",
+		"summary": "A summary",
+		"body":    "A body",
+	})
+	var a struct {
+		Record struct {
+			ID string `json:"id"`
+		} `json:"record"`
+	}
+	require.NoError(t, json.Unmarshal(aResp, &a))
+
+	activation := callTool(t, ts, "", "activate", map[string]any{"id": a.Record.ID})
+	var sess struct {
+		SessionID string `json:"session_id"`
+	}
+	require.NoError(t, json.Unmarshal(activation, &sess))
+
+	bResp := callTool(t, ts, sess.SessionID, "create_record", map[string]any{
+		"type":    "note",
+		"title":   "B",
+		"summary": "B summary",
+		"body":    "B body",
+	})
+	var b struct {
+		Record struct {
+			ID string `json:"id"`
+		} `json:"record"`
+	}
+	require.NoError(t, json.Unmarshal(bResp, &b))
+
+	type linkedRecord struct {
+		Links []struct {
+			Kind     string `json:"kind"`
+			RecordID string `json:"record_id"`
+		} `json:"links"`
+	}
+
+	linked := callTool(t, ts, sess.SessionID, "link_records", map[string]any{
+		"from_id": b.Record.ID,
+		"to_id":   a.Record.ID,
+		"kind":    "blocks",
+	})
+	var afterLink linkedRecord
+	require.NoError(t, json.Unmarshal(linked, &afterLink))
+	require.Len(t, afterLink.Links, 1)
+	require.Equal(t, "blocks", afterLink.Links[0].Kind)
+	require.Equal(t, a.Record.ID, afterLink.Links[0].RecordID)
+
+	// related on update_record sets the "relates" links.
+	_ = callTool(t, ts, sess.SessionID, "update_record", map[string]any{"id": b.Record.ID, "related": []string{a.Record.ID}})
+	got := callTool(t, ts, "", "get_record_ref", map[string]any{"id": b.Record.ID})
+	var afterUpdate linkedRecord
+	require.NoError(t, json.Unmarshal(got, &afterUpdate))
+	require.Len(t, afterUpdate.Links, 2)
+
+	aRef := callTool(t, ts, "", "get_record_ref", map[string]any{"id": a.Record.ID})
+	require.Contains(t, string(aRef), `"backlinks"`)
+
+	bundleResp := callTool(t, ts, sess.SessionID, "activate", map[string]any{"id": a.Record.ID, "full": true})
+	var bundle struct {
+		Context struct {
+			Backlinks map[string][]struct {
+				ID string `json:"id"`
+			} `json:"backlinks"`
+		} `json:"context"`
+	}
+	require.NoError(t, json.Unmarshal(bundleResp, &bundle))
+	require.Len(t, bundle.Context.Backlinks["blocks"], 1)
+	require.Equal(t, b.Record.ID, bundle.Context.Backlinks["blocks"][0].ID)
+	require.Len(t, bundle.Context.Backlinks["relates"], 1)
+
+	unlinked := callTool(t, ts, sess.SessionID, "unlink_records", map[string]any{
+		"from_id": b.Record.ID,
+		"to_id":   a.Record.ID,
+		"kind":    "blocks",
+	})
+	var afterUnlink linkedRecord
+	require.NoError(t, json.Unmarshal(unlinked, &afterUnlink))
+	require.Len(t, afterUnlink.Links, 1)
+	require.Equal(t, "relates", afterUnlink.Links[0].Kind)
+
+	// A link change takes a tick: other sessions holding the source see it
+	// in sync, and their unsynced edits conflict with it.
+	var watcher struct {
+		SessionID string `json:"session_id"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "activate", map[string]any{"id": b.Record.ID}), &watcher))
+	_ = callTool(t, ts, sess.SessionID, "link_records", map[string]any{
+		"from_id": b.Record.ID,
+		"to_id":   a.Record.ID,
+		"kind":    "blocks",
+	})
+
+	var sync struct {
+		Changes []struct {
+			Type   string `json:"type"`
+			Record struct {
+				ID string `json:"id"`
+			} `json:"record"`
+		} `json:"changes"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "sync_session", map[string]any{"session_id": watcher.SessionID}), &sync))
+	require.Len(t, sync.Changes, 1)
+	require.Equal(t, "linked", sync.Changes[0].Type)
+	require.Equal(t, b.Record.ID, sync.Changes[0].Record.ID)
+
+	var updated struct {
+		Conflict *struct {
+			ConflictType string `json:"conflict_type"`
+		} `json:"conflict"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, watcher.SessionID, "update_record", map[string]any{
+		"id":      b.Record.ID,
+		"summary": "Edited elsewhere",
+	}), &updated))
+	require.NotNil(t, updated.Conflict)
+	require.Equal(t, "update", updated.Conflict.ConflictType)
+}
+
+func TestFunctional_MoveRecord(t *testing.T) {
+	ts := testserver.New(t, "token", "tenant1")
+	initializeSession(t, ts)
+
+	type created struct {
+		Record struct {
+			ID       string  `json:"id"`
+			ParentID *string `json:"parent_id"`
+		} `json:"record"`
+	}
+
+	var root created
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "create_record", map[string]any{
+		"type":    "question",
+		"title":   "Root",
+		"summary": "Root summary",
+		"body":    "Root body",
+	}), &root))
+
+	activation := callTool(t, ts, "", "activate", map[string]any{"id": root.Record.ID})
+	var sess struct {
+		SessionID string `json:"session_id"`
+	}
+	require.NoError(t, json.Unmarshal(activation, &sess))
+
+	var a, b created
+	for _, rec := range []*created{&a, &b} {
+		require.NoError(t, json.Unmarshal(callTool(t, ts, sess.SessionID, "create_record", map[string]any{
+			"parent_id": root.Record.ID,
+			"type":      "note",
+			"title":     "Child",
+			"summary":   "Child summary",
+			"body":      "Child body",
+		}), rec))
+	}
+
+	var moved struct {
+		Record *struct {
+			ParentID *string `json:"parent_id"`
+		} `json:"record"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, sess.SessionID, "move_record", map[string]any{
+		"id":        b.Record.ID,
+		"parent_id": a.Record.ID,
+	}), &moved))
+	require.NotNil(t, moved.Record)
+	require.Equal(t, a.Record.ID, *moved.Record.ParentID)
+
+	errText := callToolError(t, ts, sess.SessionID, "move_record", map[string]any{
+		"id":        root.Record.ID,
+		"parent_id": b.Record.ID,
+	})
+	require.Contains(t, errText, "MOVE_CYCLE")
+
+	moved.Record = nil
+	require.NoError(t, json.Unmarshal(callTool(t, ts, sess.SessionID, "move_record", map[string]any{
+		"id": b.Record.ID,
+	}), &moved))
+	require.NotNil(t, moved.Record)
+	require.Nil(t, moved.Record.ParentID)
+
+	history := callTool(t, ts, "", "get_record_history", map[string]any{"id": b.Record.ID})
+	require.Contains(t, string(history), "record_moved")
+}
+
+func TestFunctional_DeleteRestoreRecord(t *testing.T) {
+	ts := testserver.New(t, "token", "tenant1")
+	initializeSession(t, ts)
+
+	type created struct {
+		Record struct {
+			ID string `json:"id"`
+		} `json:"record"`
+	}
+
+	var root created
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "create_record", map[string]any{
+		"type":    "question",
+		"title":   "Root",
+		"summary": "Root summary",
+		"body":    "Root body",
+	}), &root))
+
+	activation := callTool(t, ts, "", "activate", map[string]any{"id": root.Record.ID})
+	var sess struct {
+		SessionID string `json:"session_id"`
+	}
+	require.NoError(t, json.Unmarshal(activation, &sess))
+
+	var child, grandchild created
+	require.NoError(t, json.Unmarshal(callTool(t, ts, sess.SessionID, "create_record", map[string]any{
+		"parent_id": root.Record.ID,
+		"type":      "note",
+		"title":     "Accidental",
+		"summary":   "Created by mistake",
+		"body":      "Accidental body",
+	}), &child))
+	require.NoError(t, json.Unmarshal(callTool(t, ts, sess.SessionID, "create_record", map[string]any{
+		"parent_id": child.Record.ID,
+		"type":      "note",
+		"title":     "Accidental detail",
+		"summary":   "Also by mistake",
+		"body":      "Detail body",
+	}), &grandchild))
+
+	// A descendant active in another session blocks the delete like the
+	// record itself does.
+	var watcher struct {
+		SessionID string `json:"session_id"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "activate", map[string]any{"id": grandchild.Record.ID}), &watcher))
+
+	var deleted struct {
+		Deleted *struct {
+			Record struct {
+				ID string `json:"id"`
+			} `json:"record"`
+			Descendants int `json:"descendants"`
+		} `json:"deleted"`
+		Conflict *struct {
+			ConflictType string `json:"conflict_type"`
+		} `json:"conflict"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, sess.SessionID, "delete_record", map[string]any{
+		"id": child.Record.ID,
+	}), &deleted))
+	require.Nil(t, deleted.Deleted)
+	require.NotNil(t, deleted.Conflict)
+	require.Equal(t, "concurrent_session", deleted.Conflict.ConflictType)
+
+	deleted.Conflict = nil
+	require.NoError(t, json.Unmarshal(callTool(t, ts, sess.SessionID, "delete_record", map[string]any{
+		"id":       child.Record.ID,
+		"override": true,
+	}), &deleted))
+	require.Nil(t, deleted.Conflict)
+	require.Equal(t, child.Record.ID, deleted.Deleted.Record.ID)
+	require.Equal(t, 1, deleted.Deleted.Descendants)
+
+	// Every trashed record shows the delete in its history and in sync.
+	history := callTool(t, ts, "", "get_record_history", map[string]any{"id": grandchild.Record.ID})
+	require.Contains(t, string(history), "record_deleted")
+
+	var sync struct {
+		Changes []struct {
+			Type   string `json:"type"`
+			Record struct {
+				ID string `json:"id"`
+			} `json:"record"`
+		} `json:"changes"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "sync_session", map[string]any{"session_id": watcher.SessionID}), &sync))
+	changed := make(map[string]string, len(sync.Changes))
+	for _, change := range sync.Changes {
+		changed[change.Record.ID] = change.Type
+	}
+	require.Equal(t, map[string]string{child.Record.ID: "deleted", grandchild.Record.ID: "deleted"}, changed)
+
+	var listed struct {
+		Records []struct {
+			ID string `json:"id"`
+		} `json:"records"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "list_records", map[string]any{}), &listed))
+	require.Len(t, listed.Records, 1)
+	require.Equal(t, root.Record.ID, listed.Records[0].ID)
+
+	var search struct {
+		Results []any `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "search_records", map[string]any{"query": "accidental"}), &search))
+	require.Empty(t, search.Results)
+
+	errText := callToolError(t, ts, "", "activate", map[string]any{"id": grandchild.Record.ID})
+	require.Contains(t, errText, "not found")
+
+	var trash struct {
+		Trash []struct {
+			Record struct {
+				ID string `json:"id"`
+			} `json:"record"`
+			Descendants int `json:"descendants"`
+		} `json:"trash"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "list_trash", map[string]any{}), &trash))
+	require.Len(t, trash.Trash, 1)
+	require.Equal(t, child.Record.ID, trash.Trash[0].Record.ID)
+
+	errText = callToolError(t, ts, sess.SessionID, "restore_record", map[string]any{"id": grandchild.Record.ID})
+	require.Contains(t, errText, "NOT_IN_TRASH")
+
+	var restored struct {
+		ID string `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, sess.SessionID, "restore_record", map[string]any{
+		"id": child.Record.ID,
+	}), &restored))
+	require.Equal(t, child.Record.ID, restored.ID)
+
+	// Other sessions see the restored subtree reappear.
+	sync.Changes = nil
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "sync_session", map[string]any{"session_id": watcher.SessionID}), &sync))
+	changed = make(map[string]string, len(sync.Changes))
+	for _, change := range sync.Changes {
+		changed[change.Record.ID] = change.Type
+	}
+	require.Equal(t, map[string]string{child.Record.ID: "restored", grandchild.Record.ID: "restored"}, changed)
+
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "search_records", map[string]any{"query": "accidental"}), &search))
+	require.Len(t, search.Results, 2)
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "list_trash", map[string]any{}), &trash))
+	require.Empty(t, trash.Trash)
+
+	// The restored record is active in the session again.
+	_ = callTool(t, ts, sess.SessionID, "update_record", map[string]any{
+		"id":      child.Record.ID,
+		"summary": "Kept after all",
+	})
+}
+
+func TestFunctional_CrossProjectBrowse(t *testing.T) {
+	ts := testserver.New(t, "token", "tenant1")
+	initializeSession(t, ts)
+
+	var projects [2]struct {
+		ID string `json:"id"`
+	}
+	for i, name := range []string{"Main", "Side"} {
+		require.NoError(t, json.Unmarshal(callTool(t, ts, "", "create_project", map[string]any{"name": name}), &projects[i]))
+	}
+
+	// New records go to the default (first) project.
+	_ = callTool(t, ts, "", "create_record", map[string]any{
+		"type":    "conclusion",
+		"title":   "Decided on sharding",
+		"summary": "Shard by tenant",
+		"body":    "Sharding body",
+	})
+
+	type refs struct {
+		Results []struct {
+			Record struct {
+				ProjectID   string `json:"project_id"`
+				ProjectName string `json:"project_name"`
+			} `json:"record"`
+		} `json:"results"`
+		Records []struct {
+			ProjectName string `json:"project_name"`
+		} `json:"records"`
+	}
+
+	var side refs
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "search_records", map[string]any{
+		"query":       "sharding",
+		"project_ids": []string{projects[1].ID},
+	}), &side))
+	require.Empty(t, side.Results)
+
+	var all refs
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "search_records", map[string]any{
+		"query":        "sharding",
+		"all_projects": true,
+	}), &all))
+	require.Len(t, all.Results, 1)
+	require.Equal(t, projects[0].ID, all.Results[0].Record.ProjectID)
+	require.Equal(t, "Main", all.Results[0].Record.ProjectName)
+
+	var listed refs
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "list_records", map[string]any{
+		"project_ids": []string{projects[0].ID, projects[1].ID},
+	}), &listed))
+	require.Len(t, listed.Records, 1)
+	require.Equal(t, "Main", listed.Records[0].ProjectName)
+
+	errText := callToolError(t, ts, "", "list_records", map[string]any{"project_ids": []string{"missing"}})
+	require.Contains(t, errText, "not found")
+}
+
 func TestFunctional_TenantIsolation(t *testing.T) {
 	ts := testserver.New(t, "token", "tenant1")
 	require.NoError(t, ts.AddAPIKey("token2", "tenant2"))
@@ -556,3 +1330,769 @@ func TestFunctional_DocumentationResources(t *testing.T) {
 	require.Equal(t, "trellis://docs/reasoning-model", readResult.Contents[0].URI)
 	require.Contains(t, readResult.Contents[0].Text, "threads")
 }
+
+func TestFunctional_SemanticSearch(t *testing.T) {
+	ts := testserver.New(t, "token", "tenant1")
+	initializeSession(t, ts)
+	_ = callTool(t, ts, "", "create_project", map[string]any{"name": "Main"})
+
+	for _, rec := range []map[string]any{
+		{"type": "note", "title": "Caching layer", "summary": "Cache hot session lookups", "body": "An LRU cache in front of the session store."},
+		{"type": "note", "title": "Quarterly budget", "summary": "Spending plan", "body": "Hardware and travel."},
+	} {
+		_ = callTool(t, ts, "", "create_record", rec)
+	}
+
+	type hits struct {
+		Results []struct {
+			Record struct {
+				Title string `json:"title"`
+			} `json:"record"`
+		} `json:"results"`
+	}
+
+	// Keyword search needs the exact word; semantic search matches fragments.
+	var keyword hits
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "search_records", map[string]any{"query": "caches"}), &keyword))
+	require.Empty(t, keyword.Results)
+
+	var semantic hits
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "search_records", map[string]any{
+		"query": "caches",
+		"mode":  "semantic",
+	}), &semantic))
+	require.Len(t, semantic.Results, 2)
+	require.Equal(t, "Caching layer", semantic.Results[0].Record.Title)
+
+	var hybrid hits
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "search_records", map[string]any{
+		"query": "budget",
+		"mode":  "hybrid",
+		"limit": 1,
+	}), &hybrid))
+	require.Len(t, hybrid.Results, 1)
+	require.Equal(t, "Quarterly budget", hybrid.Results[0].Record.Title)
+
+	errText := callToolError(t, ts, "", "search_records", map[string]any{"query": "budget", "mode": "fuzzy"})
+	require.Contains(t, errText, "INVALID_SEARCH_MODE")
+}
+
+func TestFunctional_FindSimilarAndDuplicates(t *testing.T) {
+	ts := testserver.New(t, "token", "tenant1")
+	initializeSession(t, ts)
+	_ = callTool(t, ts, "", "create_project", map[string]any{"name": "Main"})
+
+	type created struct {
+		Record struct {
+			ID string `json:"id"`
+		} `json:"record"`
+		PossibleDuplicates []struct {
+			Record struct {
+				ID string `json:"id"`
+			} `json:"record"`
+			Similarity float64 `json:"similarity"`
+		} `json:"possible_duplicates"`
+	}
+
+	var first created
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "create_record", map[string]any{
+		"type":    "question",
+		"title":   "Should we cache session lookups?",
+		"summary": "Session lookups hit the database on every request",
+		"body":    "Measure before adding a cache.",
+	}), &first))
+	require.Empty(t, first.PossibleDuplicates)
+
+	var other created
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "create_record", map[string]any{
+		"type":    "question",
+		"title":   "Which regions do we deploy to?",
+		"summary": "Latency for European users",
+		"body":    "Pick regions.",
+	}), &other))
+	require.Empty(t, other.PossibleDuplicates)
+
+	var second created
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "create_record", map[string]any{
+		"type":    "question",
+		"title":   "Cache session lookups?",
+		"summary": "Session lookups hit the database on every request",
+		"body":    "Same question, asked again.",
+	}), &second))
+	require.Len(t, second.PossibleDuplicates, 1)
+	require.Equal(t, first.Record.ID, second.PossibleDuplicates[0].Record.ID)
+	require.Greater(t, second.PossibleDuplicates[0].Similarity, 0.7)
+
+	type similar struct {
+		Results []struct {
+			Record struct {
+				ID string `json:"id"`
+			} `json:"record"`
+		} `json:"results"`
+	}
+
+	var byID similar
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "find_similar", map[string]any{
+		"record_id": first.Record.ID,
+		"limit":     1,
+	}), &byID))
+	require.Len(t, byID.Results, 1)
+	require.Equal(t, second.Record.ID, byID.Results[0].Record.ID)
+
+	var byText similar
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "find_similar", map[string]any{
+		"text": "deploy regions for europe",
+		"mode": "keyword",
+	}), &byText))
+	require.NotEmpty(t, byText.Results)
+	require.Equal(t, other.Record.ID, byText.Results[0].Record.ID)
+
+	errText := callToolError(t, ts, "", "find_similar", map[string]any{})
+	require.Contains(t, errText, "record id or text")
+}
+
+func TestFunctional_ListSortAndCursor(t *testing.T) {
+	ts := testserver.New(t, "token", "tenant1")
+	initializeSession(t, ts)
+	_ = callTool(t, ts, "", "create_project", map[string]any{"name": "Main"})
+
+	for _, title := range []string{"Delta", "alpha", "Charlie", "bravo"} {
+		_ = callTool(t, ts, "", "create_record", map[string]any{"type": "note", "title": title, "summary": "S", "body": "B"})
+	}
+
+	type page struct {
+		Records []struct {
+			Title string `json:"title"`
+		} `json:"records"`
+		NextCursor        string `json:"next_cursor"`
+		Total             int    `json:"total"`
+		ChangedSinceStart int    `json:"changed_since_start"`
+	}
+	list := func(args map[string]any) page {
+		var p page
+		require.NoError(t, json.Unmarshal(callTool(t, ts, "", "list_records", args), &p))
+		return p
+	}
+
+	first := list(map[string]any{"sort": "title", "limit": 2})
+	require.Equal(t, 4, first.Total)
+	require.Len(t, first.Records, 2)
+	require.Equal(t, "alpha", first.Records[0].Title)
+	require.Equal(t, "bravo", first.Records[1].Title)
+	require.NotEmpty(t, first.NextCursor)
+
+	// A record sorting before the cursor doesn't shift the next page.
+	_ = callTool(t, ts, "", "create_record", map[string]any{"type": "note", "title": "Aardvark", "summary": "S", "body": "B"})
+
+	second := list(map[string]any{"sort": "title", "limit": 2, "cursor": first.NextCursor})
+	require.Len(t, second.Records, 2)
+	require.Equal(t, "Charlie", second.Records[0].Title)
+	require.Equal(t, "Delta", second.Records[1].Title)
+	require.Equal(t, 5, second.Total)
+	require.Equal(t, 1, second.ChangedSinceStart)
+	require.Empty(t, second.NextCursor)
+
+	errText := callToolError(t, ts, "", "list_records", map[string]any{"sort": "tick", "cursor": first.NextCursor})
+	require.Contains(t, errText, "INVALID_CURSOR")
+	errText = callToolError(t, ts, "", "list_records", map[string]any{"sort": "size"})
+	require.Contains(t, errText, "INVALID_SORT")
+
+	var hits struct {
+		Results    []json.RawMessage `json:"results"`
+		NextCursor string            `json:"next_cursor"`
+		Total      int               `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "search_records", map[string]any{"query": "S", "limit": 3}), &hits))
+	require.Len(t, hits.Results, 3)
+	require.Equal(t, 5, hits.Total)
+	require.NotEmpty(t, hits.NextCursor)
+	var more struct {
+		Results    []json.RawMessage `json:"results"`
+		NextCursor string            `json:"next_cursor"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "search_records", map[string]any{"query": "S", "limit": 3, "cursor": hits.NextCursor}), &more))
+	require.Len(t, more.Results, 2)
+	require.Empty(t, more.NextCursor)
+}
+
+func TestFunctional_GetTree(t *testing.T) {
+	ts := testserver.New(t, "token", "tenant1")
+	initializeSession(t, ts)
+	_ = callTool(t, ts, "", "create_project", map[string]any{"name": "Main"})
+
+	type created struct {
+		Record struct {
+			ID string `json:"id"`
+		} `json:"record"`
+	}
+	var root created
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "create_record", map[string]any{
+		"type": "question", "title": "Root", "summary": "S", "body": "B",
+	}), &root))
+
+	var activation struct {
+		SessionID string `json:"session_id"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "activate", map[string]any{"id": root.Record.ID}), &activation))
+
+	parentID := root.Record.ID
+	for _, title := range []string{"Child", "Grandchild", "Great-grandchild"} {
+		var rec created
+		require.NoError(t, json.Unmarshal(callTool(t, ts, activation.SessionID, "create_record", map[string]any{
+			"parent_id": parentID, "type": "question", "title": title, "summary": "S", "body": "B",
+		}), &rec))
+		_ = callTool(t, ts, activation.SessionID, "activate", map[string]any{"id": rec.Record.ID})
+		parentID = rec.Record.ID
+	}
+
+	type node struct {
+		Record struct {
+			Title string `json:"title"`
+		} `json:"record"`
+		Children []struct {
+			Record struct {
+				Title string `json:"title"`
+			} `json:"record"`
+			Children        []json.RawMessage `json:"children"`
+			DescendantCount int               `json:"descendant_count"`
+		} `json:"children"`
+	}
+	var tree struct {
+		Nodes []node `json:"nodes"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "get_tree", map[string]any{"depth": 2}), &tree))
+	require.Len(t, tree.Nodes, 1)
+	require.Equal(t, "Root", tree.Nodes[0].Record.Title)
+	require.Len(t, tree.Nodes[0].Children, 1)
+	child := tree.Nodes[0].Children[0]
+	require.Equal(t, "Child", child.Record.Title)
+	require.Empty(t, child.Children)
+	require.Equal(t, 2, child.DescendantCount)
+
+	tree.Nodes = nil
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "get_tree", map[string]any{"id": root.Record.ID, "depth": 1}), &tree))
+	require.Len(t, tree.Nodes, 1)
+	require.Equal(t, 2, tree.Nodes[0].Children[0].DescendantCount)
+
+	errText := callToolError(t, ts, "", "get_tree", map[string]any{"id": "missing"})
+	require.Contains(t, errText, "RECORD_NOT_FOUND")
+}
+
+func TestFunctional_AncestorPaths(t *testing.T) {
+	ts := testserver.New(t, "token", "tenant1")
+	initializeSession(t, ts)
+	_ = callTool(t, ts, "", "create_project", map[string]any{"name": "Main"})
+
+	type created struct {
+		Record struct {
+			ID string `json:"id"`
+		} `json:"record"`
+	}
+	var root created
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "create_record", map[string]any{
+		"type": "question", "title": "Root", "summary": "S", "body": "B",
+	}), &root))
+	var activation struct {
+		SessionID string `json:"session_id"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "activate", map[string]any{"id": root.Record.ID}), &activation))
+
+	parentID := root.Record.ID
+	var leaf created
+	for _, title := range []string{"Middle", "Leaf"} {
+		require.NoError(t, json.Unmarshal(callTool(t, ts, activation.SessionID, "create_record", map[string]any{
+			"parent_id": parentID, "type": "question", "title": title, "summary": "S", "body": "B",
+		}), &leaf))
+		_ = callTool(t, ts, activation.SessionID, "activate", map[string]any{"id": leaf.Record.ID})
+		parentID = leaf.Record.ID
+	}
+
+	type ancestor struct {
+		Title string `json:"title"`
+		State string `json:"state"`
+	}
+	var bundle struct {
+		Context struct {
+			Ancestors []ancestor `json:"ancestors"`
+		} `json:"context"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "activate", map[string]any{"id": leaf.Record.ID}), &bundle))
+	require.Equal(t, []ancestor{{"Root", "OPEN"}, {"Middle", "OPEN"}}, bundle.Context.Ancestors)
+
+	var listed struct {
+		Records []struct {
+			Title     string     `json:"title"`
+			Ancestors []ancestor `json:"ancestors"`
+		} `json:"records"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "list_records", map[string]any{"sort": "title", "include_path": true}), &listed))
+	require.Len(t, listed.Records, 3)
+	require.Equal(t, "Leaf", listed.Records[0].Title)
+	require.Len(t, listed.Records[0].Ancestors, 2)
+	require.Empty(t, listed.Records[2].Ancestors)
+
+	var hits struct {
+		Results []struct {
+			Record struct {
+				Ancestors []ancestor `json:"ancestors"`
+			} `json:"record"`
+		} `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "search_records", map[string]any{"query": "Leaf", "include_path": true}), &hits))
+	require.Len(t, hits.Results, 1)
+	require.Equal(t, []ancestor{{"Root", "OPEN"}, {"Middle", "OPEN"}}, hits.Results[0].Record.Ancestors)
+}
+
+func TestFunctional_OutlineFormat(t *testing.T) {
+	ts := testserver.New(t, "token", "tenant1")
+	initializeSession(t, ts)
+	_ = callTool(t, ts, "", "create_project", map[string]any{"name": "Main"})
+
+	var root struct {
+		Record struct {
+			ID string `json:"id"`
+		} `json:"record"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "create_record", map[string]any{
+		"type": "question", "title": "Cache invalidation approach", "summary": "Leaning toward events.", "body": "Body text.",
+	}), &root))
+	shortID := root.Record.ID[:8]
+
+	text := string(callTool(t, ts, "", "list_records", map[string]any{"format": "outline"}))
+	require.Equal(t, "total: 1\n\n["+shortID+"] (O) Cache invalidation approach\n  Leaning toward events.\n", text)
+
+	// Structured content still carries the JSON.
+	resp := rpcCall(t, ts, "", "tools/call", map[string]any{
+		"name":      "list_records",
+		"arguments": map[string]any{"format": "outline"},
+	})
+	require.Nil(t, resp.Error)
+	var result struct {
+		StructuredContent struct {
+			Records []struct {
+				ID string `json:"id"`
+			} `json:"records"`
+		} `json:"structuredContent"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Result, &result))
+	require.Len(t, result.StructuredContent.Records, 1)
+	require.Equal(t, root.Record.ID, result.StructuredContent.Records[0].ID)
+
+	// Short ids from the outline work wherever a record id is taken.
+	text = string(callTool(t, ts, "", "activate", map[string]any{"id": shortID, "format": "outline"}))
+	require.True(t, strings.HasPrefix(text, "session: "), text)
+	require.Contains(t, text, "["+shortID+"] (O) Cache invalidation approach\n  Leaning toward events.\n\n  Body text.\n")
+
+	text = string(callTool(t, ts, "", "search_records", map[string]any{"query": "body", "format": "outline"}))
+	require.Contains(t, text, "  > **Body** text.")
+	text = string(callTool(t, ts, "", "get_tree", map[string]any{"id": shortID, "format": "outline"}))
+	require.Equal(t, "["+shortID+"] (O) Cache invalidation approach\n  Leaning toward events.\n", text)
+	text = string(callTool(t, ts, "", "get_project_overview", map[string]any{"format": "outline"}))
+	require.Contains(t, text, "## Root records (1)")
+
+	errText := callToolError(t, ts, "", "list_records", map[string]any{"format": "yaml"})
+	require.Contains(t, errText, "INVALID_FORMAT")
+}
+
+func TestFunctional_ShortIDReferences(t *testing.T) {
+	ts := testserver.New(t, "token", "tenant1")
+	initializeSession(t, ts)
+	_ = callTool(t, ts, "", "create_project", map[string]any{"name": "Main"})
+
+	type created struct {
+		Record struct {
+			ID string `json:"id"`
+		} `json:"record"`
+	}
+	var parent created
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "create_record", map[string]any{
+		"type": "question", "title": "Parent", "summary": "Parent summary", "body": "Parent body",
+	}), &parent))
+	shortID := parent.Record.ID[:8]
+
+	var sess struct {
+		SessionID string `json:"session_id"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "activate", map[string]any{"id": shortID}), &sess))
+
+	type linkedRecord struct {
+		Record struct {
+			ID         string   `json:"id"`
+			ResolvedBy *string  `json:"resolved_by"`
+			Related    []string `json:"related"`
+		} `json:"record"`
+	}
+
+	// related on create_record and update_record takes short ids.
+	var child linkedRecord
+	require.NoError(t, json.Unmarshal(callTool(t, ts, sess.SessionID, "create_record", map[string]any{
+		"parent_id": shortID, "type": "note", "title": "Child", "summary": "Child summary", "body": "Child body",
+		"related": []string{shortID},
+	}), &child))
+	require.Equal(t, []string{parent.Record.ID}, child.Record.Related)
+
+	var other created
+	require.NoError(t, json.Unmarshal(callTool(t, ts, sess.SessionID, "create_record", map[string]any{
+		"type": "note", "title": "Other", "summary": "Other summary", "body": "Other body",
+	}), &other))
+	var updated linkedRecord
+	require.NoError(t, json.Unmarshal(callTool(t, ts, sess.SessionID, "update_record", map[string]any{
+		"id": other.Record.ID[:8], "related": []string{shortID, child.Record.ID[:8]},
+	}), &updated))
+	require.ElementsMatch(t, []string{parent.Record.ID, child.Record.ID}, updated.Record.Related)
+
+	// resolved_by on transition takes a short id.
+	var resolved linkedRecord
+	require.NoError(t, json.Unmarshal(callTool(t, ts, sess.SessionID, "transition", map[string]any{
+		"id": other.Record.ID, "to_state": "RESOLVED", "resolved_by": child.Record.ID[:8],
+	}), &resolved))
+	require.NotNil(t, resolved.Record.ResolvedBy)
+	require.Equal(t, child.Record.ID, *resolved.Record.ResolvedBy)
+
+	// So does the parent: search filter.
+	var search struct {
+		Results []struct {
+			Record struct {
+				ID string `json:"id"`
+			} `json:"record"`
+		} `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "search_records", map[string]any{"query": "parent:" + shortID}), &search))
+	require.Len(t, search.Results, 1)
+	require.Equal(t, child.Record.ID, search.Results[0].Record.ID)
+}
+
+func TestFunctional_ActivateMaxTokens(t *testing.T) {
+	ts := testserver.New(t, "token", "tenant1")
+	initializeSession(t, ts)
+	_ = callTool(t, ts, "", "create_project", map[string]any{"name": "Main"})
+
+	type created struct {
+		Record struct {
+			ID string `json:"id"`
+		} `json:"record"`
+	}
+	body := strings.Repeat("A long paragraph of reasoning. ", 40)
+	var hub created
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "create_record", map[string]any{
+		"type": "question", "title": "Hub", "summary": "S", "body": body,
+	}), &hub))
+	var activation struct {
+		SessionID string `json:"session_id"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "activate", map[string]any{"id": hub.Record.ID}), &activation))
+	for _, title := range []string{"One", "Two", "Three"} {
+		_ = callTool(t, ts, activation.SessionID, "create_record", map[string]any{
+			"parent_id": hub.Record.ID, "type": "question", "title": title, "summary": "S", "body": body,
+		})
+	}
+
+	var bundle struct {
+		Context struct {
+			Target struct {
+				Body string `json:"body"`
+			} `json:"target"`
+			OpenChildren  []struct{ ID string } `json:"open_children"`
+			OtherChildren []struct{ ID string } `json:"other_children"`
+			Budget        struct {
+				MaxTokens int      `json:"max_tokens"`
+				Truncated []string `json:"truncated"`
+				Demoted   []string `json:"demoted"`
+				Omitted   []string `json:"omitted"`
+			} `json:"budget"`
+		} `json:"context"`
+		Warnings []string `json:"warnings"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "activate", map[string]any{"id": hub.Record.ID, "max_tokens": 800}), &bundle))
+	require.Equal(t, body, bundle.Context.Target.Body)
+	require.Len(t, bundle.Context.OpenChildren, 1)
+	require.Len(t, bundle.Context.OtherChildren, 2)
+	require.Equal(t, 800, bundle.Context.Budget.MaxTokens)
+	require.Len(t, bundle.Context.Budget.Demoted, 2)
+	require.Empty(t, bundle.Context.Budget.Truncated)
+	require.NotEmpty(t, bundle.Warnings)
+	require.Contains(t, bundle.Warnings[len(bundle.Warnings)-1], "2 open children sent as refs")
+
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "activate", map[string]any{"id": hub.Record.ID, "max_tokens": 100}), &bundle))
+	require.True(t, strings.HasSuffix(bundle.Context.Target.Body, "[truncated]"))
+	require.Equal(t, []string{hub.Record.ID}, bundle.Context.Budget.Truncated)
+
+	errText := callToolError(t, ts, "", "activate", map[string]any{"id": hub.Record.ID, "max_tokens": -5})
+	require.Contains(t, errText, "max_tokens")
+}
+
+func TestFunctional_ActivationPolicy(t *testing.T) {
+	ts := testserver.New(t, "token", "tenant1")
+	initializeSession(t, ts)
+	_ = callTool(t, ts, "", "create_project", map[string]any{"name": "Main"})
+
+	var updated struct {
+		Name             string `json:"name"`
+		ActivationPolicy struct {
+			IncludeSiblings *bool `json:"include_siblings"`
+		} `json:"activation_policy"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "update_project", map[string]any{
+		"activation_policy": map[string]any{"include_siblings": true, "include_links": false},
+	}), &updated))
+	require.Equal(t, "Main", updated.Name)
+	require.NotNil(t, updated.ActivationPolicy.IncludeSiblings)
+	require.True(t, *updated.ActivationPolicy.IncludeSiblings)
+
+	type created struct {
+		Record struct {
+			ID string `json:"id"`
+		} `json:"record"`
+	}
+	var first, second created
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "create_record", map[string]any{
+		"type": "question", "title": "First", "summary": "S", "body": "B",
+	}), &first))
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "create_record", map[string]any{
+		"type": "question", "title": "Second", "summary": "S", "body": "B",
+	}), &second))
+
+	type bundle struct {
+		Context struct {
+			Siblings []struct {
+				ID string `json:"id"`
+			} `json:"siblings"`
+		} `json:"context"`
+	}
+	var withSiblings bundle
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "activate", map[string]any{"id": first.Record.ID}), &withSiblings))
+	require.Len(t, withSiblings.Context.Siblings, 1)
+	require.Equal(t, second.Record.ID, withSiblings.Context.Siblings[0].ID)
+
+	var withoutSiblings bundle
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "activate", map[string]any{
+		"id": first.Record.ID, "policy": map[string]any{"include_siblings": false},
+	}), &withoutSiblings))
+	require.Empty(t, withoutSiblings.Context.Siblings)
+
+	errText := callToolError(t, ts, "", "activate", map[string]any{
+		"id": first.Record.ID, "policy": map[string]any{"full_states": []string{"DONE"}},
+	})
+	require.Contains(t, errText, "INVALID_POLICY")
+}
+
+func TestFunctional_BatchActivate(t *testing.T) {
+	ts := testserver.New(t, "token", "tenant1")
+	initializeSession(t, ts)
+	_ = callTool(t, ts, "", "create_project", map[string]any{"name": "Main"})
+
+	type created struct {
+		Record struct {
+			ID string `json:"id"`
+		} `json:"record"`
+	}
+	var root created
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "create_record", map[string]any{
+		"type": "question", "title": "Root", "summary": "S", "body": "B",
+	}), &root))
+	var activation struct {
+		SessionID string `json:"session_id"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "activate", map[string]any{"id": root.Record.ID}), &activation))
+	children := make([]created, 2)
+	for i, title := range []string{"Left", "Right"} {
+		require.NoError(t, json.Unmarshal(callTool(t, ts, activation.SessionID, "create_record", map[string]any{
+			"parent_id": root.Record.ID, "type": "question", "title": title, "summary": "S", "body": "B",
+		}), &children[i]))
+	}
+
+	type full struct {
+		ID string `json:"id"`
+	}
+	var batch struct {
+		SessionID string `json:"session_id"`
+		Context   struct {
+			Target       *full            `json:"target"`
+			Targets      []full           `json:"targets"`
+			Parents      []full           `json:"parents"`
+			OpenChildren []full           `json:"open_children"`
+			Paths        map[string][]any `json:"paths"`
+		} `json:"context"`
+		RecordWarnings map[string][]string `json:"record_warnings"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "activate", map[string]any{
+		"ids": []string{children[0].Record.ID, children[1].Record.ID},
+	}), &batch))
+	require.Nil(t, batch.Context.Target)
+	require.Equal(t, []full{{children[0].Record.ID}, {children[1].Record.ID}}, batch.Context.Targets)
+	require.Equal(t, []full{{root.Record.ID}}, batch.Context.Parents)
+	require.Empty(t, batch.Context.OpenChildren)
+	require.Len(t, batch.Context.Paths, 2)
+	// Both children are active in the session that created them.
+	require.Len(t, batch.RecordWarnings, 2)
+
+	var sessions struct {
+		Sessions []struct {
+			SessionID string `json:"session_id"`
+		} `json:"sessions"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "get_active_sessions", map[string]any{"record_id": children[1].Record.ID}), &sessions))
+	ids := make([]string, 0, len(sessions.Sessions))
+	for _, sess := range sessions.Sessions {
+		ids = append(ids, sess.SessionID)
+	}
+	require.Contains(t, ids, batch.SessionID)
+
+	errText := callToolError(t, ts, "", "activate", map[string]any{"id": root.Record.ID, "ids": []string{children[0].Record.ID}})
+	require.Contains(t, errText, "either one record ID or a list")
+}
+
+func TestFunctional_Deactivate(t *testing.T) {
+	ts := testserver.New(t, "token", "tenant1")
+	initializeSession(t, ts)
+
+	var root struct {
+		Record struct {
+			ID string `json:"id"`
+		} `json:"record"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "create_record", map[string]any{
+		"type": "question", "title": "Root", "summary": "S", "body": "B",
+	}), &root))
+
+	type activation struct {
+		SessionID string   `json:"session_id"`
+		Warnings  []string `json:"warnings"`
+	}
+	var first activation
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "activate", map[string]any{"id": root.Record.ID}), &first))
+	require.Empty(t, first.Warnings)
+
+	var second activation
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "activate", map[string]any{"id": root.Record.ID}), &second))
+	require.Len(t, second.Warnings, 1)
+	require.Contains(t, second.Warnings[0], first.SessionID)
+
+	var released struct {
+		SessionID     string   `json:"session_id"`
+		Released      []string `json:"released"`
+		ActiveRecords []string `json:"active_records"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, first.SessionID, "deactivate", map[string]any{"id": root.Record.ID}), &released))
+	require.Equal(t, first.SessionID, released.SessionID)
+	require.Equal(t, []string{root.Record.ID}, released.Released)
+	require.Empty(t, released.ActiveRecords)
+
+	var third activation
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "activate", map[string]any{"id": root.Record.ID}), &third))
+	for _, warning := range third.Warnings {
+		require.NotContains(t, warning, first.SessionID)
+	}
+
+	errText := callToolError(t, ts, first.SessionID, "deactivate", map[string]any{"id": root.Record.ID})
+	require.Contains(t, errText, "NOT_ACTIVE")
+
+	var recent struct {
+		Activity []struct {
+			Type string `json:"type"`
+		} `json:"activity"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "get_recent_activity", map[string]any{}), &recent))
+	types := make([]string, 0, len(recent.Activity))
+	for _, entry := range recent.Activity {
+		types = append(types, entry.Type)
+	}
+	require.Contains(t, types, "activation")
+	require.Contains(t, types, "deactivation")
+}
+
+func TestFunctional_ListSessionsAndSweep(t *testing.T) {
+	ts := testserver.New(t, "token", "tenant1")
+	initializeSession(t, ts)
+
+	var root struct {
+		Record struct {
+			ID string `json:"id"`
+		} `json:"record"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "create_record", map[string]any{
+		"type": "question", "title": "Root", "summary": "S", "body": "B",
+	}), &root))
+
+	type activation struct {
+		SessionID string   `json:"session_id"`
+		Warnings  []string `json:"warnings"`
+	}
+	var abandoned, idle activation
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "activate", map[string]any{"id": root.Record.ID}), &abandoned))
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "activate", map[string]any{"id": root.Record.ID}), &idle))
+
+	// Session timestamps are stored in UTC, which the sweeper relies on.
+	now := time.Now().UTC()
+	_, err := ts.DB.Exec(`UPDATE sessions SET status = 'stale', stale_at = ?, last_activity = ? WHERE id = ?`,
+		now.Add(-30*time.Hour), now.Add(-48*time.Hour), abandoned.SessionID)
+	require.NoError(t, err)
+	_, err = ts.DB.Exec(`UPDATE sessions SET last_activity = ? WHERE id = ?`, now.Add(-3*time.Hour), idle.SessionID)
+	require.NoError(t, err)
+
+	sweeper := session.NewService(
+		sqlite.NewRecordRepository(ts.DB),
+		sqlite.NewSessionRepository(ts.DB),
+		sqlite.NewProjectRepository(ts.DB),
+		sqlite.NewActivityRepository(ts.DB),
+		nil,
+	)
+	result, err := sweeper.Sweep(context.Background(), session.SweepPolicy{
+		StaleAfter: 2 * time.Hour,
+		CloseAfter: 24 * time.Hour,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{idle.SessionID}, result.Staled)
+	require.Equal(t, []string{abandoned.SessionID}, result.Closed)
+
+	type listed struct {
+		Sessions []struct {
+			ID            string   `json:"id"`
+			Status        string   `json:"status"`
+			ActiveRecords []string `json:"active_records"`
+		} `json:"sessions"`
+	}
+	var stale listed
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "list_sessions", map[string]any{"status": "stale"}), &stale))
+	require.Len(t, stale.Sessions, 1)
+	require.Equal(t, idle.SessionID, stale.Sessions[0].ID)
+	require.Equal(t, []string{root.Record.ID}, stale.Sessions[0].ActiveRecords)
+
+	var closed listed
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "list_sessions", map[string]any{"status": "closed"}), &closed))
+	require.Len(t, closed.Sessions, 1)
+	require.Equal(t, abandoned.SessionID, closed.Sessions[0].ID)
+
+	// The closed session no longer warns; the stale one is labelled.
+	var fresh activation
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "activate", map[string]any{"id": root.Record.ID}), &fresh))
+	require.Equal(t, []string{"record active in stale session " + idle.SessionID}, fresh.Warnings)
+
+	var recent struct {
+		Activity []struct {
+			Type      string `json:"type"`
+			SessionID string `json:"session_id"`
+			Summary   string `json:"summary"`
+		} `json:"activity"`
+	}
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "get_recent_activity", map[string]any{}), &recent))
+	swept := make(map[string]string)
+	for _, entry := range recent.Activity {
+		if entry.Type == "session_stale" || entry.Type == "session_closed" {
+			swept[entry.SessionID] = entry.Type + ": " + entry.Summary
+		}
+	}
+	require.Equal(t, map[string]string{
+		idle.SessionID:      "session_stale: marked session stale: idle for 3h0m0s",
+		abandoned.SessionID: "session_closed: closed stale session: stale for 30h0m0s",
+	}, swept)
+
+	// Syncing brings the stale session back.
+	_ = callTool(t, ts, idle.SessionID, "sync_session", map[string]any{"session_id": idle.SessionID})
+	var active listed
+	require.NoError(t, json.Unmarshal(callTool(t, ts, "", "list_sessions", map[string]any{"status": "active"}), &active))
+	require.Len(t, active.Sessions, 2)
+
+	errText := callToolError(t, ts, "", "list_sessions", map[string]any{"status": "idle"})
+	require.Contains(t, errText, "unknown status")
+}
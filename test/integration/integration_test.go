@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/rpggio/trellis/internal/domain/activity"
 	"github.com/rpggio/trellis/internal/domain/project"
 	"github.com/rpggio/trellis/internal/domain/record"
 	"github.com/rpggio/trellis/internal/domain/session"
+	"github.com/rpggio/trellis/internal/embedding"
 	"github.com/rpggio/trellis/internal/sqlite"
 	"github.com/stretchr/testify/require"
 )
@@ -40,12 +42,12 @@ func newTestEnv(t *testing.T) *testEnv {
 	recordRepo := sqlite.NewRecordRepository(db)
 	sessionRepo := sqlite.NewSessionRepository(db)
 	activityRepo := sqlite.NewActivityRepository(db)
-	searchRepo := sqlite.NewSearchRepository(db)
+	searchRepo := sqlite.NewSearchRepository(db, sqlite.DefaultSearchWeights)
 
 	projectSvc := project.NewService(projectRepo, nil)
 	activitySvc := activity.NewService(activityRepo, nil)
-	recordSvc := record.NewService(recordRepo, sessionRepo, projectRepo, activityRepo, searchRepo, nil)
-	sessionSvc := session.NewService(recordRepo, sessionRepo, projectRepo, nil)
+	recordSvc := record.NewService(recordRepo, sessionRepo, projectRepo, activityRepo, searchRepo, embedding.NewHashEmbedder(0), db, nil)
+	sessionSvc := session.NewService(recordRepo, sessionRepo, projectRepo, activityRepo, nil)
 
 	return &testEnv{
 		db:           db,
@@ -69,7 +71,7 @@ func TestIntegration_ColdStartWorkflow(t *testing.T) {
 	proj, err := env.projectSvc.Create(ctx, tenantID, project.CreateRequest{Name: "Demo"})
 	require.NoError(t, err)
 
-	root, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
+	root, _, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
 		ProjectID: proj.ID,
 		Type:      "question",
 		Title:     "Root",
@@ -81,7 +83,7 @@ func TestIntegration_ColdStartWorkflow(t *testing.T) {
 	activation, err := env.sessionSvc.Activate(ctx, tenantID, session.ActivateRequest{RecordID: root.ID})
 	require.NoError(t, err)
 
-	child, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
+	child, _, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
 		SessionID: activation.SessionID,
 		ProjectID: proj.ID,
 		ParentID:  &root.ID,
@@ -102,7 +104,7 @@ func TestIntegration_ConflictDetection(t *testing.T) {
 	proj, err := env.projectSvc.Create(ctx, tenantID, project.CreateRequest{Name: "Demo"})
 	require.NoError(t, err)
 
-	root, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
+	root, _, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
 		ProjectID: proj.ID,
 		Type:      "question",
 		Title:     "Root",
@@ -123,6 +125,19 @@ func TestIntegration_ConflictDetection(t *testing.T) {
 		Title:     &newTitle,
 	})
 	require.NoError(t, err)
+	require.Nil(t, updated)
+	require.NotNil(t, conflict)
+	require.Equal(t, record.ConflictConcurrentSession, conflict.ConflictType)
+	require.Len(t, conflict.Sessions, 1)
+	require.Equal(t, sess2.SessionID, conflict.Sessions[0].SessionID)
+
+	updated, conflict, err = env.recordSvc.Update(ctx, tenantID, record.UpdateRequest{
+		SessionID: sess1.SessionID,
+		ID:        root.ID,
+		Title:     &newTitle,
+		Override:  true,
+	})
+	require.NoError(t, err)
 	require.NotNil(t, updated)
 	require.Nil(t, conflict)
 
@@ -135,6 +150,16 @@ func TestIntegration_ConflictDetection(t *testing.T) {
 	require.NoError(t, err)
 	require.Nil(t, updated)
 	require.NotNil(t, conflict)
+	require.Equal(t, record.ConflictUpdate, conflict.ConflictType)
+
+	entries, err := env.activitySvc.GetRecentActivity(ctx, tenantID, activity.ListActivityOptions{ProjectID: proj.ID})
+	require.NoError(t, err)
+	types := make([]activity.ActivityType, 0, len(entries))
+	for _, entry := range entries {
+		types = append(types, entry.ActivityType)
+	}
+	require.Contains(t, types, activity.TypeConflictDetected)
+	require.Contains(t, types, activity.TypeConflictResolved)
 }
 
 func TestIntegration_StateTransitions(t *testing.T) {
@@ -145,7 +170,7 @@ func TestIntegration_StateTransitions(t *testing.T) {
 	proj, err := env.projectSvc.Create(ctx, tenantID, project.CreateRequest{Name: "Demo"})
 	require.NoError(t, err)
 
-	root, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
+	root, _, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
 		ProjectID: proj.ID,
 		Type:      "question",
 		Title:     "Root",
@@ -154,7 +179,7 @@ func TestIntegration_StateTransitions(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	resolver, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
+	resolver, _, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
 		ProjectID: proj.ID,
 		Type:      "note",
 		Title:     "Resolver",
@@ -167,7 +192,7 @@ func TestIntegration_StateTransitions(t *testing.T) {
 	require.NoError(t, err)
 
 	reason := "needs more info"
-	updated, err := env.recordSvc.Transition(ctx, tenantID, record.TransitionRequest{
+	updated, _, err := env.recordSvc.Transition(ctx, tenantID, record.TransitionRequest{
 		SessionID: activation.SessionID,
 		ID:        root.ID,
 		ToState:   record.StateLater,
@@ -176,7 +201,7 @@ func TestIntegration_StateTransitions(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, record.StateLater, updated.State)
 
-	updated, err = env.recordSvc.Transition(ctx, tenantID, record.TransitionRequest{
+	updated, _, err = env.recordSvc.Transition(ctx, tenantID, record.TransitionRequest{
 		SessionID: activation.SessionID,
 		ID:        root.ID,
 		ToState:   record.StateOpen,
@@ -185,7 +210,7 @@ func TestIntegration_StateTransitions(t *testing.T) {
 	require.Equal(t, record.StateOpen, updated.State)
 
 	resolvedBy := resolver.ID
-	updated, err = env.recordSvc.Transition(ctx, tenantID, record.TransitionRequest{
+	updated, _, err = env.recordSvc.Transition(ctx, tenantID, record.TransitionRequest{
 		SessionID:  activation.SessionID,
 		ID:         root.ID,
 		ToState:    record.StateResolved,
@@ -194,7 +219,7 @@ func TestIntegration_StateTransitions(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, record.StateResolved, updated.State)
 
-	_, err = env.recordSvc.Transition(ctx, tenantID, record.TransitionRequest{
+	_, _, err = env.recordSvc.Transition(ctx, tenantID, record.TransitionRequest{
 		SessionID: activation.SessionID,
 		ID:        root.ID,
 		ToState:   record.StateLater,
@@ -210,7 +235,7 @@ func TestIntegration_ContextLoading(t *testing.T) {
 	proj, err := env.projectSvc.Create(ctx, tenantID, project.CreateRequest{Name: "Demo"})
 	require.NoError(t, err)
 
-	parent, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
+	parent, _, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
 		ProjectID: proj.ID,
 		Type:      "question",
 		Title:     "Parent",
@@ -222,7 +247,7 @@ func TestIntegration_ContextLoading(t *testing.T) {
 	parentActivation, err := env.sessionSvc.Activate(ctx, tenantID, session.ActivateRequest{RecordID: parent.ID})
 	require.NoError(t, err)
 
-	target, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
+	target, _, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
 		SessionID: parentActivation.SessionID,
 		ProjectID: proj.ID,
 		ParentID:  &parent.ID,
@@ -233,7 +258,7 @@ func TestIntegration_ContextLoading(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	openChild, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
+	openChild, _, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
 		SessionID: parentActivation.SessionID,
 		ProjectID: proj.ID,
 		ParentID:  &target.ID,
@@ -245,7 +270,7 @@ func TestIntegration_ContextLoading(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	resolvedChild, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
+	resolvedChild, _, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
 		SessionID: parentActivation.SessionID,
 		ProjectID: proj.ID,
 		ParentID:  &target.ID,
@@ -257,7 +282,7 @@ func TestIntegration_ContextLoading(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	_, err = env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
+	_, _, err = env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
 		SessionID: parentActivation.SessionID,
 		ProjectID: proj.ID,
 		ParentID:  &openChild.ID,
@@ -283,6 +308,182 @@ func TestIntegration_ContextLoading(t *testing.T) {
 	require.Len(t, activation.Context.Grandchildren, 1)
 }
 
+func TestIntegration_CrossProjectSearch(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	tenantID := "tenant1"
+
+	var projectIDs []string
+	for _, name := range []string{"Storage", "Billing", "Docs"} {
+		proj, err := env.projectSvc.Create(ctx, tenantID, project.CreateRequest{Name: name})
+		require.NoError(t, err)
+		projectIDs = append(projectIDs, proj.ID)
+	}
+
+	titles := []string{"Where we decided on sharding", "Invoice format", "Sharding guide"}
+	for i, title := range titles {
+		_, _, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
+			ProjectID: projectIDs[i],
+			Type:      "conclusion",
+			Title:     title,
+			Summary:   "Summary",
+			Body:      "Notes on sharding and billing.",
+		})
+		require.NoError(t, err)
+	}
+
+	page, err := env.recordSvc.Search(ctx, tenantID, "sharding", record.SearchOptions{})
+	require.NoError(t, err)
+	results := page.Results
+	require.Len(t, results, 3)
+	require.Equal(t, 3, page.Total)
+	// Title hits from two different projects rank above the body-only hit.
+	require.ElementsMatch(t, []string{"Storage", "Docs"}, []string{results[0].Record.ProjectName, results[1].Record.ProjectName})
+	require.Equal(t, "Billing", results[2].Record.ProjectName)
+
+	page, err = env.recordSvc.Search(ctx, tenantID, "sharding", record.SearchOptions{ProjectIDs: projectIDs[1:]})
+	require.NoError(t, err)
+	results = page.Results
+	require.Len(t, results, 2)
+	require.Equal(t, "Docs", results[0].Record.ProjectName)
+
+	list, err := env.recordSvc.List(ctx, tenantID, record.ListRecordsOptions{})
+	require.NoError(t, err)
+	require.Len(t, list.Records, 3)
+	require.Equal(t, 3, list.Total)
+}
+
+func TestIntegration_SearchPagesAcrossWrites(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	tenantID := "tenant1"
+
+	proj, err := env.projectSvc.Create(ctx, tenantID, project.CreateRequest{Name: "Demo"})
+	require.NoError(t, err)
+	create := func(title, body string) *record.Record {
+		rec, _, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
+			ProjectID: proj.ID,
+			Type:      "note",
+			Title:     title,
+			Summary:   "Summary",
+			Body:      body,
+		})
+		require.NoError(t, err)
+		return rec
+	}
+
+	want := make([]string, 0, 5)
+	for i := range 5 {
+		want = append(want, create(fmt.Sprintf("Note %d", i), "Mentions sharding once.").ID)
+	}
+
+	page, err := env.recordSvc.Search(ctx, tenantID, "sharding", record.SearchOptions{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Results, 2)
+	seen := []string{page.Results[0].Record.ID, page.Results[1].Record.ID}
+
+	// New records that would rank first, and an edit to an unseen record,
+	// must not shift the remaining pages.
+	create("Sharding", "Sharding sharding sharding.")
+	create("Sharding plan", "All about sharding.")
+	for _, id := range want {
+		if id == seen[0] || id == seen[1] {
+			continue
+		}
+		sess, err := env.sessionSvc.Activate(ctx, tenantID, session.ActivateRequest{RecordID: id})
+		require.NoError(t, err)
+		title := "Edited note"
+		_, _, err = env.recordSvc.Update(ctx, tenantID, record.UpdateRequest{SessionID: sess.SessionID, ID: id, Title: &title})
+		require.NoError(t, err)
+		break
+	}
+
+	for page.NextCursor != "" {
+		page, err = env.recordSvc.Search(ctx, tenantID, "sharding", record.SearchOptions{Limit: 2, Cursor: page.NextCursor})
+		require.NoError(t, err)
+		require.Equal(t, 5, page.Total)
+		for _, result := range page.Results {
+			seen = append(seen, result.Record.ID)
+		}
+	}
+	require.ElementsMatch(t, want, seen)
+
+	// A new search sees the new records.
+	page, err = env.recordSvc.Search(ctx, tenantID, "sharding", record.SearchOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 7, page.Total)
+}
+
+func TestIntegration_SweepSparesWritingSession(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	tenantID := "tenant1"
+
+	proj, err := env.projectSvc.Create(ctx, tenantID, project.CreateRequest{Name: "Demo"})
+	require.NoError(t, err)
+	var roots [2]*record.Record
+	for i := range roots {
+		roots[i], _, err = env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
+			ProjectID: proj.ID,
+			Type:      "question",
+			Title:     fmt.Sprintf("Root %d", i),
+			Summary:   "Summary",
+			Body:      "Body",
+		})
+		require.NoError(t, err)
+	}
+	writer, err := env.sessionSvc.Activate(ctx, tenantID, session.ActivateRequest{RecordID: roots[0].ID})
+	require.NoError(t, err)
+	watcher, err := env.sessionSvc.Activate(ctx, tenantID, session.ActivateRequest{RecordID: roots[1].ID})
+	require.NoError(t, err)
+
+	write := func(title string) {
+		t.Helper()
+		_, conflict, err := env.recordSvc.Update(ctx, tenantID, record.UpdateRequest{
+			SessionID: writer.SessionID,
+			ID:        roots[0].ID,
+			Title:     &title,
+		})
+		require.NoError(t, err)
+		require.Nil(t, conflict)
+	}
+
+	// The writer's own ticks don't count against it; the watcher falls
+	// behind them.
+	policy := session.SweepPolicy{StaleAfter: time.Hour, StaleTickGap: 3, CloseAfter: time.Hour}
+	var staled []string
+	for i := range 5 {
+		write(fmt.Sprintf("Root v%d", i+2))
+		result, err := env.sessionSvc.Sweep(ctx, policy)
+		require.NoError(t, err)
+		staled = append(staled, result.Staled...)
+	}
+	require.Equal(t, []string{watcher.SessionID}, staled)
+
+	// A write counts as activity, even after a long pause.
+	_, err = env.db.Exec(`UPDATE sessions SET last_activity = ? WHERE id = ?`,
+		time.Now().UTC().Add(-2*time.Hour), writer.SessionID)
+	require.NoError(t, err)
+	write("Root after a pause")
+	result, err := env.sessionSvc.Sweep(ctx, policy)
+	require.NoError(t, err)
+	require.Empty(t, result.Staled)
+
+	// Writing in a stale session makes it active again.
+	_, err = env.db.Exec(`UPDATE sessions SET status = 'stale', stale_at = ? WHERE id = ?`,
+		time.Now().UTC(), writer.SessionID)
+	require.NoError(t, err)
+	write("Root resumed")
+
+	sess, err := env.sessionRepo.Get(ctx, tenantID, writer.SessionID)
+	require.NoError(t, err)
+	require.Equal(t, session.StatusActive, sess.Status)
+	require.Nil(t, sess.StaleAt)
+	loaded, err := env.projectRepo.Get(ctx, tenantID, proj.ID)
+	require.NoError(t, err)
+	require.Equal(t, loaded.Tick, sess.LastSyncTick)
+}
+
 func TestIntegration_SessionStaleness(t *testing.T) {
 	ctx := context.Background()
 	env := newTestEnv(t)
@@ -291,7 +492,7 @@ func TestIntegration_SessionStaleness(t *testing.T) {
 	proj, err := env.projectSvc.Create(ctx, tenantID, project.CreateRequest{Name: "Demo"})
 	require.NoError(t, err)
 
-	root, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
+	root, _, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
 		ProjectID: proj.ID,
 		Type:      "question",
 		Title:     "Root",
@@ -303,7 +504,7 @@ func TestIntegration_SessionStaleness(t *testing.T) {
 	activation, err := env.sessionSvc.Activate(ctx, tenantID, session.ActivateRequest{RecordID: root.ID})
 	require.NoError(t, err)
 
-	_, err = env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
+	_, _, err = env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
 		ProjectID: proj.ID,
 		Type:      "note",
 		Title:     "Another",
@@ -0,0 +1,449 @@
+package integration_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rpggio/trellis/internal/domain/activity"
+	"github.com/rpggio/trellis/internal/domain/project"
+	"github.com/rpggio/trellis/internal/domain/record"
+	"github.com/rpggio/trellis/internal/domain/session"
+	"github.com/rpggio/trellis/internal/sqlite"
+	"github.com/stretchr/testify/require"
+)
+
+var errInjected = errors.New("injected failure")
+
+// faults fails the named repository step after it has run, so a rollback
+// has to undo a write that already happened.
+type faults struct {
+	step string
+}
+
+func (f *faults) after(step string, err error) error {
+	if err == nil && f.step == step {
+		return errInjected
+	}
+	return err
+}
+
+type faultyProjects struct {
+	*sqlite.ProjectRepository
+	faults *faults
+}
+
+func (r faultyProjects) IncrementTick(ctx context.Context, tenantID, projectID string) (int64, error) {
+	tick, err := r.ProjectRepository.IncrementTick(ctx, tenantID, projectID)
+	return tick, r.faults.after("IncrementTick", err)
+}
+
+type faultyRecords struct {
+	*sqlite.RecordRepository
+	faults *faults
+}
+
+func (r faultyRecords) Create(ctx context.Context, tenantID string, rec *record.Record) error {
+	return r.faults.after("Create", r.RecordRepository.Create(ctx, tenantID, rec))
+}
+
+func (r faultyRecords) SaveVersion(ctx context.Context, tenantID string, rec *record.Record) error {
+	return r.faults.after("SaveVersion", r.RecordRepository.SaveVersion(ctx, tenantID, rec))
+}
+
+func (r faultyRecords) Update(ctx context.Context, tenantID string, rec *record.Record, expectedTick int64) error {
+	return r.faults.after("Update", r.RecordRepository.Update(ctx, tenantID, rec, expectedTick))
+}
+
+func (r faultyRecords) SoftDelete(ctx context.Context, tenantID, id string, deletedAt time.Time) (int, error) {
+	count, err := r.RecordRepository.SoftDelete(ctx, tenantID, id, deletedAt)
+	return count, r.faults.after("SoftDelete", err)
+}
+
+func (r faultyRecords) Restore(ctx context.Context, tenantID, id string) (int, error) {
+	count, err := r.RecordRepository.Restore(ctx, tenantID, id)
+	return count, r.faults.after("Restore", err)
+}
+
+func (r faultyRecords) AddRelation(ctx context.Context, fromRecordID, toRecordID string, kind record.RelationKind) error {
+	return r.faults.after("AddRelation", r.RecordRepository.AddRelation(ctx, fromRecordID, toRecordID, kind))
+}
+
+func (r faultyRecords) RemoveRelation(ctx context.Context, fromRecordID, toRecordID string, kind record.RelationKind) error {
+	return r.faults.after("RemoveRelation", r.RecordRepository.RemoveRelation(ctx, fromRecordID, toRecordID, kind))
+}
+
+type faultySessions struct {
+	*sqlite.SessionRepository
+	faults *faults
+}
+
+func (r faultySessions) AddActivation(ctx context.Context, sessionID, recordID string, tick int64) error {
+	return r.faults.after("AddActivation", r.SessionRepository.AddActivation(ctx, sessionID, recordID, tick))
+}
+
+func (r faultySessions) Touch(ctx context.Context, tenantID, id string, tick int64, at time.Time) error {
+	return r.faults.after("Touch", r.SessionRepository.Touch(ctx, tenantID, id, tick, at))
+}
+
+type faultyActivities struct {
+	*sqlite.ActivityRepository
+	faults *faults
+}
+
+func (r faultyActivities) Log(ctx context.Context, tenantID string, entry *activity.ActivityEntry) error {
+	return r.faults.after("Log", r.ActivityRepository.Log(ctx, tenantID, entry))
+}
+
+func (env *testEnv) faultyRecordService(step string) *record.Service {
+	f := &faults{step: step}
+	return record.NewService(
+		faultyRecords{env.recordRepo, f},
+		faultySessions{env.sessionRepo, f},
+		faultyProjects{env.projectRepo, f},
+		faultyActivities{env.activityRepo, f},
+		env.searchRepo,
+		nil,
+		env.db,
+		nil,
+	)
+}
+
+// storeState captures everything a record mutation may write.
+type storeState struct {
+	projectTick    int64
+	records        int
+	activities     int
+	session        *session.Session
+	record         *record.Record
+	links          []record.Link
+	activationTick int64
+}
+
+func captureState(t *testing.T, env *testEnv, tenantID, projectID, sessionID, recordID string) storeState {
+	t.Helper()
+	ctx := context.Background()
+
+	proj, err := env.projectRepo.Get(ctx, tenantID, projectID)
+	require.NoError(t, err)
+	refs, err := env.recordRepo.List(ctx, tenantID, record.ListRecordsOptions{ProjectID: projectID})
+	require.NoError(t, err)
+	entries, err := env.activityRepo.List(ctx, tenantID, activity.ListActivityOptions{ProjectID: projectID, Limit: 1000})
+	require.NoError(t, err)
+
+	state := storeState{projectTick: proj.Tick, records: len(refs), activities: len(entries)}
+	state.session, err = env.sessionRepo.Get(ctx, tenantID, sessionID)
+	require.NoError(t, err)
+	if recordID != "" {
+		state.record, err = env.recordRepo.Get(ctx, tenantID, recordID)
+		require.NoError(t, err)
+		state.links, err = env.recordRepo.GetLinks(ctx, tenantID, recordID)
+		require.NoError(t, err)
+		state.activationTick, err = env.sessionRepo.GetActivationTick(ctx, sessionID, recordID)
+		require.NoError(t, err)
+	}
+	return state
+}
+
+func TestIntegration_UnitOfWork_Create(t *testing.T) {
+	for _, step := range []string{"IncrementTick", "Create", "AddActivation", "Touch", "Log"} {
+		t.Run(step, func(t *testing.T) {
+			ctx := context.Background()
+			env := newTestEnv(t)
+			tenantID := "tenant1"
+
+			proj, err := env.projectSvc.Create(ctx, tenantID, project.CreateRequest{Name: "Demo"})
+			require.NoError(t, err)
+			root, _, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
+				ProjectID: proj.ID,
+				Type:      "question",
+				Title:     "Root",
+				Summary:   "Root summary",
+				Body:      "Root body",
+			})
+			require.NoError(t, err)
+			activation, err := env.sessionSvc.Activate(ctx, tenantID, session.ActivateRequest{RecordID: root.ID})
+			require.NoError(t, err)
+
+			before := captureState(t, env, tenantID, proj.ID, activation.SessionID, "")
+
+			_, _, err = env.faultyRecordService(step).Create(ctx, tenantID, record.CreateRequest{
+				SessionID: activation.SessionID,
+				ProjectID: proj.ID,
+				ParentID:  &root.ID,
+				Type:      "question",
+				Title:     "Child",
+				Summary:   "Child summary",
+				Body:      "Child body",
+			})
+			require.ErrorIs(t, err, errInjected)
+
+			after := captureState(t, env, tenantID, proj.ID, activation.SessionID, "")
+			require.Equal(t, before, after)
+		})
+	}
+}
+
+func TestIntegration_UnitOfWork_Update(t *testing.T) {
+	for _, step := range []string{"IncrementTick", "SaveVersion", "Update", "AddActivation", "Touch", "Log"} {
+		t.Run(step, func(t *testing.T) {
+			ctx := context.Background()
+			env := newTestEnv(t)
+			tenantID := "tenant1"
+
+			proj, err := env.projectSvc.Create(ctx, tenantID, project.CreateRequest{Name: "Demo"})
+			require.NoError(t, err)
+			root, _, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
+				ProjectID: proj.ID,
+				Type:      "question",
+				Title:     "Root",
+				Summary:   "Root summary",
+				Body:      "Root body",
+			})
+			require.NoError(t, err)
+			activation, err := env.sessionSvc.Activate(ctx, tenantID, session.ActivateRequest{RecordID: root.ID})
+			require.NoError(t, err)
+
+			before := captureState(t, env, tenantID, proj.ID, activation.SessionID, root.ID)
+
+			title := "Changed"
+			_, _, err = env.faultyRecordService(step).Update(ctx, tenantID, record.UpdateRequest{
+				SessionID: activation.SessionID,
+				ID:        root.ID,
+				Title:     &title,
+			})
+			require.ErrorIs(t, err, errInjected)
+
+			after := captureState(t, env, tenantID, proj.ID, activation.SessionID, root.ID)
+			require.Equal(t, before, after)
+			_, err = env.recordRepo.GetVersionAt(ctx, tenantID, root.ID, root.Tick)
+			require.Error(t, err, "version history must not keep a rolled back write")
+
+			// The same update succeeds once the fault is gone.
+			_, conflict, err := env.recordSvc.Update(ctx, tenantID, record.UpdateRequest{
+				SessionID: activation.SessionID,
+				ID:        root.ID,
+				Title:     &title,
+			})
+			require.NoError(t, err)
+			require.Nil(t, conflict)
+		})
+	}
+}
+
+func TestIntegration_UnitOfWork_Transition(t *testing.T) {
+	for _, step := range []string{"IncrementTick", "SaveVersion", "Update", "AddActivation", "Touch", "Log"} {
+		t.Run(step, func(t *testing.T) {
+			ctx := context.Background()
+			env := newTestEnv(t)
+			tenantID := "tenant1"
+
+			proj, err := env.projectSvc.Create(ctx, tenantID, project.CreateRequest{Name: "Demo"})
+			require.NoError(t, err)
+			root, _, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
+				ProjectID: proj.ID,
+				Type:      "question",
+				Title:     "Root",
+				Summary:   "Root summary",
+				Body:      "Root body",
+			})
+			require.NoError(t, err)
+			activation, err := env.sessionSvc.Activate(ctx, tenantID, session.ActivateRequest{RecordID: root.ID})
+			require.NoError(t, err)
+
+			before := captureState(t, env, tenantID, proj.ID, activation.SessionID, root.ID)
+
+			reason := "parked"
+			_, _, err = env.faultyRecordService(step).Transition(ctx, tenantID, record.TransitionRequest{
+				SessionID: activation.SessionID,
+				ID:        root.ID,
+				ToState:   record.StateLater,
+				Reason:    &reason,
+			})
+			require.ErrorIs(t, err, errInjected)
+
+			after := captureState(t, env, tenantID, proj.ID, activation.SessionID, root.ID)
+			require.Equal(t, before, after)
+		})
+	}
+}
+
+// mutationFixture is a project with an activated root, an activated child
+// and a second activated root to link to.
+type mutationFixture struct {
+	projectID string
+	sessionID string
+	root      *record.Record
+	child     *record.Record
+	other     *record.Record
+}
+
+func newMutationFixture(t *testing.T, env *testEnv, tenantID string) mutationFixture {
+	t.Helper()
+	ctx := context.Background()
+
+	proj, err := env.projectSvc.Create(ctx, tenantID, project.CreateRequest{Name: "Demo"})
+	require.NoError(t, err)
+	create := func(sessionID string, parentID *string, title string) *record.Record {
+		rec, _, err := env.recordSvc.Create(ctx, tenantID, record.CreateRequest{
+			SessionID: sessionID,
+			ProjectID: proj.ID,
+			ParentID:  parentID,
+			Type:      "question",
+			Title:     title,
+			Summary:   title + " summary",
+			Body:      title + " body",
+		})
+		require.NoError(t, err)
+		return rec
+	}
+
+	root := create("", nil, "Root")
+	activation, err := env.sessionSvc.Activate(ctx, tenantID, session.ActivateRequest{RecordID: root.ID})
+	require.NoError(t, err)
+	return mutationFixture{
+		projectID: proj.ID,
+		sessionID: activation.SessionID,
+		root:      root,
+		child:     create(activation.SessionID, &root.ID, "Child"),
+		other:     create(activation.SessionID, nil, "Other"),
+	}
+}
+
+func TestIntegration_UnitOfWork_Mutations(t *testing.T) {
+	writeSteps := []string{"IncrementTick", "SaveVersion", "Update", "AddActivation", "Touch", "Log"}
+	tests := []struct {
+		name  string
+		steps []string
+		// setup prepares the store and returns the record whose state is
+		// compared, or "" to compare only project-wide counts.
+		setup  func(t *testing.T, env *testEnv, fx mutationFixture) string
+		mutate func(svc *record.Service, fx mutationFixture) error
+	}{
+		{
+			name:  "Revert",
+			steps: writeSteps,
+			setup: func(t *testing.T, env *testEnv, fx mutationFixture) string {
+				title := "Sloppy"
+				_, _, err := env.recordSvc.Update(context.Background(), "tenant1", record.UpdateRequest{
+					SessionID: fx.sessionID, ID: fx.root.ID, Title: &title,
+				})
+				require.NoError(t, err)
+				return fx.root.ID
+			},
+			mutate: func(svc *record.Service, fx mutationFixture) error {
+				_, _, err := svc.Revert(context.Background(), "tenant1", record.RevertRequest{
+					SessionID: fx.sessionID, ID: fx.root.ID, Tick: fx.root.Tick,
+				})
+				return err
+			},
+		},
+		{
+			name:  "ResolveConflict",
+			steps: writeSteps,
+			setup: func(t *testing.T, env *testEnv, fx mutationFixture) string {
+				return fx.root.ID
+			},
+			mutate: func(svc *record.Service, fx mutationFixture) error {
+				title := "Merged"
+				_, _, err := svc.ResolveConflict(context.Background(), "tenant1", record.ResolveConflictRequest{
+					SessionID: fx.sessionID, ID: fx.root.ID, RemoteTick: fx.root.Tick, Title: &title,
+				})
+				return err
+			},
+		},
+		{
+			name:  "Move",
+			steps: writeSteps,
+			setup: func(t *testing.T, env *testEnv, fx mutationFixture) string {
+				return fx.child.ID
+			},
+			mutate: func(svc *record.Service, fx mutationFixture) error {
+				_, _, err := svc.Move(context.Background(), "tenant1", record.MoveRequest{
+					SessionID: fx.sessionID, ID: fx.child.ID, ParentID: &fx.other.ID,
+				})
+				return err
+			},
+		},
+		{
+			name:  "Link",
+			steps: []string{"AddRelation", "Touch", "Log"},
+			setup: func(t *testing.T, env *testEnv, fx mutationFixture) string {
+				return fx.root.ID
+			},
+			mutate: func(svc *record.Service, fx mutationFixture) error {
+				_, err := svc.Link(context.Background(), "tenant1", record.LinkRequest{
+					SessionID: fx.sessionID, FromID: fx.root.ID, ToID: fx.other.ID, Kind: record.RelationBlocks,
+				})
+				return err
+			},
+		},
+		{
+			name:  "Unlink",
+			steps: []string{"RemoveRelation", "Touch", "Log"},
+			setup: func(t *testing.T, env *testEnv, fx mutationFixture) string {
+				_, err := env.recordSvc.Link(context.Background(), "tenant1", record.LinkRequest{
+					SessionID: fx.sessionID, FromID: fx.root.ID, ToID: fx.other.ID, Kind: record.RelationBlocks,
+				})
+				require.NoError(t, err)
+				return fx.root.ID
+			},
+			mutate: func(svc *record.Service, fx mutationFixture) error {
+				_, err := svc.Unlink(context.Background(), "tenant1", record.LinkRequest{
+					SessionID: fx.sessionID, FromID: fx.root.ID, ToID: fx.other.ID, Kind: record.RelationBlocks,
+				})
+				return err
+			},
+		},
+		{
+			name:  "Delete",
+			steps: []string{"IncrementTick", "SaveVersion", "Update", "AddActivation", "Touch", "SoftDelete", "Log"},
+			setup: func(t *testing.T, env *testEnv, fx mutationFixture) string {
+				return fx.root.ID
+			},
+			mutate: func(svc *record.Service, fx mutationFixture) error {
+				_, _, err := svc.Delete(context.Background(), "tenant1", record.DeleteRequest{
+					SessionID: fx.sessionID, ID: fx.root.ID,
+				})
+				return err
+			},
+		},
+		{
+			name:  "Restore",
+			steps: []string{"IncrementTick", "Restore", "AddActivation", "Touch", "Log"},
+			setup: func(t *testing.T, env *testEnv, fx mutationFixture) string {
+				_, _, err := env.recordSvc.Delete(context.Background(), "tenant1", record.DeleteRequest{
+					SessionID: fx.sessionID, ID: fx.root.ID,
+				})
+				require.NoError(t, err)
+				return ""
+			},
+			mutate: func(svc *record.Service, fx mutationFixture) error {
+				_, err := svc.Restore(context.Background(), "tenant1", record.RestoreRequest{
+					SessionID: fx.sessionID, ID: fx.root.ID,
+				})
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, step := range tt.steps {
+			t.Run(tt.name+"/"+step, func(t *testing.T) {
+				env := newTestEnv(t)
+				tenantID := "tenant1"
+				fx := newMutationFixture(t, env, tenantID)
+				recordID := tt.setup(t, env, fx)
+
+				before := captureState(t, env, tenantID, fx.projectID, fx.sessionID, recordID)
+				require.ErrorIs(t, tt.mutate(env.faultyRecordService(step), fx), errInjected)
+				after := captureState(t, env, tenantID, fx.projectID, fx.sessionID, recordID)
+				require.Equal(t, before, after)
+
+				// The same mutation succeeds once the fault is gone.
+				require.NoError(t, tt.mutate(env.recordSvc, fx))
+			})
+		}
+	}
+}